@@ -1,12 +1,15 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/play-with-docker/play-with-docker/config"
 	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/engine"
 	"github.com/play-with-docker/play-with-docker/event"
 	"github.com/play-with-docker/play-with-docker/handlers"
 	"github.com/play-with-docker/play-with-docker/id"
@@ -22,21 +25,34 @@ import (
 func main() {
 	config.ParseFlags()
 
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Args()))
+	}
+
+	if err := config.InitSecureCookie(); err != nil {
+		log.Fatal(err)
+	}
+	if err := config.CheckUserVolumes(); err != nil {
+		log.Fatal(err)
+	}
+
 	e := initEvent()
 	s := initStorage()
 	df := initDockerFactory(s)
 	kf := initK8sFactory(s)
+	rf := initRuntimeFactory(df)
 
-	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(df, s), provisioner.NewDinD(id.XIDGenerator{}, df, s))
-	sp := provisioner.NewOverlaySessionProvisioner(df)
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(df, s), provisioner.NewDinDWithRuntimes(id.XIDGenerator{}, rf, s))
+	sp := provisioner.NewRuntimeSessionProvisioner(rf)
 
-	core := pwd.NewPWD(df, e, s, sp, ipf)
+	core := pwd.NewPWDWithRuntimes(df, rf, e, s, sp, ipf)
 
 	tasks := []scheduler.Task{
 		task.NewCheckPorts(e, df),
 		task.NewCheckSwarmPorts(e, df),
 		task.NewCheckSwarmStatus(e, df),
-		task.NewCollectStats(e, df, s),
+		task.NewCollectStats(e, rf, s),
+		task.NewCheckInstanceHealth(e, rf, s, core),
 		task.NewCheckK8sClusterStatus(e, kf),
 		task.NewCheckK8sClusterExposedPorts(e, kf),
 	}
@@ -53,6 +69,9 @@ func main() {
 	}
 
     playground := types.Playground{Domain: config.PlaygroundDomain, DefaultDinDInstanceImage: "freecompilercamp/pwc:full", AvailableDinDInstanceImages: []string{"freecompilercamp/pwc:18.04","freecompilercamp/pwc:16.04","freecompilercamp/pwc:full", "freecompilercamp/pwc:rose-debug-gpu", "freecompilercamp/pwc:rose-debug", "freecompilercamp/pwc:rose-develop-weekly", "freecompilercamp/pwc:rose-develop-debug-weekly", "freecompilercamp/pwc:rose-release-weekly", "freecompilercamp/pwc:rose-bug", "freecompilercamp/pwc:rose-exam", "freecompilercamp/pwc:llvm10-gpu", "freecompilercamp/pwc:llvm10", "fcc_docker:test"}, AllowWindowsInstances: config.NoWindows, DefaultSessionDuration: d, Extras: map[string]interface{}{"LoginRedirect": "http://localhost:3000"}}
+	if config.PlaygroundAllowedOrigins != "" {
+		playground.AllowedOrigins = strings.Split(config.PlaygroundAllowedOrigins, ",")
+	}
 	if _, err := core.PlaygroundNew(playground); err != nil {
 		log.Fatalf("Cannot create default playground. Got: %v", err)
 	}
@@ -70,13 +89,33 @@ func initStorage() storage.StorageApi {
 }
 
 func initEvent() event.EventApi {
-	return event.NewLocalBroker()
+	e, err := event.NewLocalBrokerWithQueue(config.EventQueueSize, event.OverflowPolicy(config.EventOverflowPolicy))
+	if err != nil {
+		log.Fatal("Error initializing EventAPI: ", err)
+	}
+	return e
 }
 
 func initDockerFactory(s storage.StorageApi) docker.FactoryApi {
 	return docker.NewLocalCachedFactory(s)
 }
 
+func initRuntimeFactory(df docker.FactoryApi) engine.FactoryApi {
+	switch config.ContainerRuntime {
+	case "docker":
+		return docker.NewRuntimeFactory(df)
+	case "podman":
+		rf, err := engine.NewPodmanFactory(config.PodmanHost)
+		if err != nil {
+			log.Fatal("Error initializing podman runtime: ", err)
+		}
+		return rf
+	default:
+		log.Fatalf("Unknown container runtime [%s]", config.ContainerRuntime)
+		return nil
+	}
+}
+
 func initK8sFactory(s storage.StorageApi) k8s.FactoryApi {
 	return k8s.NewLocalCachedFactory(s)
 }
@@ -0,0 +1,140 @@
+// Package asciicast writes terminal sessions in the asciicast v2 format
+// (https://github.com/asciinema/asciinema/blob/develop/doc/asciicast-v2.md)
+// so they can be replayed with xterm or asciinema.
+package asciicast
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	EventOutput = "o"
+	EventInput  = "i"
+	EventResize = "r"
+)
+
+type Header struct {
+	Version   int               `json:"version"`
+	Width     uint              `json:"width"`
+	Height    uint              `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+type Writer struct {
+	mx     sync.Mutex
+	w      io.Writer
+	start  time.Time
+	closed bool
+
+	// Terminals send their data in arbitrary chunks, so a chunk can end in
+	// the middle of a character. Its first bytes wait here for the rest.
+	partialOutput []byte
+	partialInput  []byte
+}
+
+// NewWriter writes the header of the cast to w and returns a Writer that
+// appends events to it. Event times are relative to start.
+func NewWriter(w io.Writer, width, height uint, title string, start time.Time) (*Writer, error) {
+	h := Header{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: start.Unix(),
+		Title:     title,
+		Env:       map[string]string{"TERM": "xterm"},
+	}
+	b, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(w, "%s\n", b); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, start: start}, nil
+}
+
+func (c *Writer) event(at time.Time, kind, data string) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	return c.write(at, kind, data)
+}
+
+// stream records data of a kind of event that is sent in chunks, holding
+// back an incomplete character at the end until the next chunk.
+func (c *Writer) stream(at time.Time, kind string, partial *[]byte, data []byte) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	data = append(*partial, data...)
+	n := completeLength(data)
+	*partial = append([]byte(nil), data[n:]...)
+	if n == 0 {
+		return nil
+	}
+	return c.write(at, kind, string(data[:n]))
+}
+
+func (c *Writer) write(at time.Time, kind, data string) error {
+	if c.closed {
+		return nil
+	}
+	b, err := json.Marshal([]interface{}{at.Sub(c.start).Seconds(), kind, data})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.w, "%s\n", b)
+	return err
+}
+
+// completeLength returns the length of data without the incomplete UTF-8
+// sequence it ends with, if any.
+func completeLength(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(data)
+}
+
+// Output records data printed by the terminal.
+func (c *Writer) Output(data []byte) error {
+	return c.stream(time.Now(), EventOutput, &c.partialOutput, data)
+}
+
+// Input records data typed into the terminal.
+func (c *Writer) Input(data []byte) error {
+	return c.stream(time.Now(), EventInput, &c.partialInput, data)
+}
+
+// Resize records a change of the terminal size.
+func (c *Writer) Resize(cols, rows uint) error {
+	return c.event(time.Now(), EventResize, fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// Close stops recording events. It closes the underlying writer if it is an
+// io.Closer.
+func (c *Writer) Close() error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if closer, ok := c.w.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
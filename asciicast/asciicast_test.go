@@ -0,0 +1,72 @@
+package asciicast
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	start := time.Now().Add(-time.Second)
+
+	w, err := NewWriter(&buf, 80, 24, "node1", start)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Output([]byte("$ ")))
+	assert.Nil(t, w.Input([]byte("ls\r")))
+	assert.Nil(t, w.Resize(120, 40))
+	assert.Nil(t, w.Close())
+	assert.Nil(t, w.Output([]byte("ignored")))
+
+	s := bufio.NewScanner(&buf)
+
+	assert.True(t, s.Scan())
+	var h Header
+	assert.Nil(t, json.Unmarshal(s.Bytes(), &h))
+	assert.Equal(t, Header{Version: 2, Width: 80, Height: 24, Timestamp: start.Unix(), Title: "node1", Env: map[string]string{"TERM": "xterm"}}, h)
+
+	expected := [][]string{{EventOutput, "$ "}, {EventInput, "ls\r"}, {EventResize, "120x40"}}
+	for _, e := range expected {
+		assert.True(t, s.Scan())
+		var ev []interface{}
+		assert.Nil(t, json.Unmarshal(s.Bytes(), &ev))
+		assert.Len(t, ev, 3)
+		assert.True(t, ev[0].(float64) >= 1)
+		assert.Equal(t, e[0], ev[1])
+		assert.Equal(t, e[1], ev[2])
+	}
+	assert.False(t, s.Scan())
+}
+
+func TestWriter_SplitCharacters(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(&buf, 80, 24, "node1", time.Now())
+	assert.Nil(t, err)
+	euro := []byte("€")
+	assert.Nil(t, w.Output([]byte("a\xc3")))
+	assert.Nil(t, w.Output([]byte("\xa9b")))
+	assert.Nil(t, w.Output(euro[:1]))
+	assert.Nil(t, w.Output(euro[1:2]))
+	assert.Nil(t, w.Output(euro[2:]))
+	assert.Nil(t, w.Input([]byte("\xc3")))
+	assert.Nil(t, w.Input([]byte("\xb1")))
+	assert.Nil(t, w.Output([]byte("\xffc")))
+
+	s := bufio.NewScanner(&buf)
+	assert.True(t, s.Scan())
+
+	expected := [][]string{{EventOutput, "a"}, {EventOutput, "éb"}, {EventOutput, "€"}, {EventInput, "ñ"}, {EventOutput, "\ufffdc"}}
+	for _, e := range expected {
+		assert.True(t, s.Scan())
+		var ev []interface{}
+		assert.Nil(t, json.Unmarshal(s.Bytes(), &ev))
+		assert.Equal(t, e[0], ev[1])
+		assert.Equal(t, e[1], ev[2])
+	}
+	assert.False(t, s.Scan())
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/play-with-docker/play-with-docker/config"
+)
+
+const usersUsage = `Usage: play-with-docker [flags] users <command>
+
+Commands:
+  list [query]          List users, optionally matching query
+  ban <user id>         Ban a user and close their sessions
+  unban <user id>       Lift the ban of a user
+  delete <user id>      Delete a user and the data kept for them
+  sessions <user id>    Show the session history of a user
+  logout <user id>      Log a user out everywhere
+  impersonate <user id> Print a cookie that logs in as the user
+
+Commands are sent to the server at --admin-url with --admin-token.
+`
+
+// runCommand runs an admin subcommand against a running server and returns
+// the exit code of the process.
+func runCommand(args []string) int {
+	if len(args) < 2 || args[0] != "users" {
+		fmt.Fprint(os.Stderr, usersUsage)
+		return 2
+	}
+
+	command, args := args[1], args[2:]
+	var method, path string
+	switch {
+	case command == "list" && len(args) <= 1:
+		method, path = "GET", "/users"
+		if len(args) == 1 {
+			path += "?q=" + url.QueryEscape(args[0])
+		}
+	case command == "ban" && len(args) == 1:
+		method, path = "POST", "/users/"+url.PathEscape(args[0])+"/ban"
+	case command == "unban" && len(args) == 1:
+		method, path = "DELETE", "/users/"+url.PathEscape(args[0])+"/ban"
+	case command == "delete" && len(args) == 1:
+		method, path = "DELETE", "/users/"+url.PathEscape(args[0])
+	case command == "sessions" && len(args) == 1:
+		method, path = "GET", "/users/"+url.PathEscape(args[0])+"/sessions"
+	case command == "logout" && len(args) == 1:
+		method, path = "DELETE", "/users/"+url.PathEscape(args[0])+"/logins"
+	case command == "impersonate" && len(args) == 1:
+		method, path = "POST", "/users/"+url.PathEscape(args[0])+"/impersonate"
+	default:
+		fmt.Fprint(os.Stderr, usersUsage)
+		return 2
+	}
+
+	if err := adminRequest(method, path, command == "impersonate"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// adminRequest sends a request to the admin endpoints of the server and
+// prints the response. With printCookie the login cookie the server sets is
+// printed too.
+func adminRequest(method, path string, printCookie bool) error {
+	base := config.AdminURL
+	if base == "" {
+		base = "http://localhost:" + config.PortNumber
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(base, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth("admin", config.AdminToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s failed with status %d", method, path, resp.StatusCode)
+	}
+
+	if printCookie {
+		for _, c := range resp.Cookies() {
+			if c.Name == "id" {
+				fmt.Printf("Cookie: %s=%s\n", c.Name, c.Value)
+			}
+		}
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, body, "", "  "); err != nil {
+		os.Stdout.Write(body)
+		return nil
+	}
+	fmt.Println(out.String())
+	return nil
+}
@@ -0,0 +1,173 @@
+// Package cmdline reconstructs the command lines typed into a terminal from
+// the keystrokes sent to it, so they can be audited. Terminal leaves out the
+// lines typed while the terminal didn't echo, which are usually secrets.
+//
+// The reconstruction only knows what was typed. Lines edited with shell
+// features whose effect shows up in the output alone, like history recall or
+// tab completion, are logged as typed: history recall is dropped and tabs are
+// kept as they are.
+package cmdline
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	keyCtrlA     = 0x01
+	keyCtrlC     = 0x03
+	keyCtrlE     = 0x05
+	keyBackspace = 0x08
+	keyTab       = 0x09
+	keyLineFeed  = 0x0a
+	keyCtrlK     = 0x0b
+	keyReturn    = 0x0d
+	keyCtrlU     = 0x15
+	keyCtrlW     = 0x17
+	keyEscape    = 0x1b
+	keyDelete    = 0x7f
+)
+
+// Buffer is a line editor fed with terminal input.
+type Buffer struct {
+	line    []rune
+	cursor  int
+	pending []byte
+}
+
+func New() *Buffer {
+	return &Buffer{}
+}
+
+// Write feeds input to the buffer and returns the lines completed by it.
+// Escape sequences and characters split across writes are handled.
+func (b *Buffer) Write(data []byte) []string {
+	var lines []string
+
+	data = append(b.pending, data...)
+	b.pending = nil
+	for len(data) > 0 {
+		c := data[0]
+		switch {
+		case c == keyReturn || c == keyLineFeed:
+			if l := string(b.line); strings.TrimSpace(l) != "" {
+				lines = append(lines, l)
+			}
+			b.reset()
+			// Enter is sent as \r\n by some clients
+			if c == keyReturn && len(data) > 1 && data[1] == keyLineFeed {
+				data = data[1:]
+			}
+		case c == keyEscape:
+			n, complete := b.escape(data)
+			if !complete {
+				b.pending = data
+				return lines
+			}
+			data = data[n:]
+			continue
+		case c == keyCtrlC:
+			b.reset()
+		case c == keyBackspace || c == keyDelete:
+			if b.cursor > 0 {
+				b.line = append(b.line[:b.cursor-1], b.line[b.cursor:]...)
+				b.cursor--
+			}
+		case c == keyCtrlU:
+			b.line = b.line[b.cursor:]
+			b.cursor = 0
+		case c == keyCtrlK:
+			b.line = b.line[:b.cursor]
+		case c == keyCtrlW:
+			start := b.cursor
+			for start > 0 && b.line[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && b.line[start-1] != ' ' {
+				start--
+			}
+			b.line = append(b.line[:start], b.line[b.cursor:]...)
+			b.cursor = start
+		case c == keyCtrlA:
+			b.cursor = 0
+		case c == keyCtrlE:
+			b.cursor = len(b.line)
+		case c == keyTab:
+			b.insert('\t')
+		case c < 0x20:
+			// Other control keys don't change the line
+		default:
+			if !utf8.FullRune(data) {
+				b.pending = data
+				return lines
+			}
+			r, n := utf8.DecodeRune(data)
+			b.insert(r)
+			data = data[n:]
+			continue
+		}
+		data = data[1:]
+	}
+
+	return lines
+}
+
+// Line returns what has been typed since the last completed line.
+func (b *Buffer) Line() string {
+	return string(b.line)
+}
+
+func (b *Buffer) reset() {
+	b.line = b.line[:0]
+	b.cursor = 0
+}
+
+func (b *Buffer) insert(r rune) {
+	b.line = append(b.line, 0)
+	copy(b.line[b.cursor+1:], b.line[b.cursor:])
+	b.line[b.cursor] = r
+	b.cursor++
+}
+
+// escape applies the escape sequence at the start of data and returns its
+// length, or false if data ends before the sequence does. Cursor movement
+// and delete are applied, everything else is skipped.
+func (b *Buffer) escape(data []byte) (int, bool) {
+	if len(data) < 2 {
+		return 0, false
+	}
+	switch data[1] {
+	case '[':
+		// CSI: parameters followed by a final byte
+		for i := 2; i < len(data); i++ {
+			if data[i] >= 0x40 && data[i] <= 0x7e {
+				b.csi(string(data[2:i]), data[i])
+				return i + 1, true
+			}
+		}
+		return 0, false
+	case 'O':
+		// SS3, sent for some keys in application cursor mode
+		if len(data) < 3 {
+			return 0, false
+		}
+		b.csi("", data[2])
+		return 3, true
+	}
+	return 2, true
+}
+
+func (b *Buffer) csi(params string, final byte) {
+	switch {
+	case final == 'D' && b.cursor > 0:
+		b.cursor--
+	case final == 'C' && b.cursor < len(b.line):
+		b.cursor++
+	case final == 'H' || (final == '~' && (params == "1" || params == "7")):
+		b.cursor = 0
+	case final == 'F' || (final == '~' && (params == "4" || params == "8")):
+		b.cursor = len(b.line)
+	case final == '~' && params == "3" && b.cursor < len(b.line):
+		b.line = append(b.line[:b.cursor], b.line[b.cursor+1:]...)
+	}
+}
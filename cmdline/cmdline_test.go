@@ -0,0 +1,64 @@
+package cmdline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuffer(t *testing.T) {
+	b := New()
+
+	assert.Equal(t, []string{"ls -l"}, b.Write([]byte("ls -l\r")))
+	assert.Nil(t, b.Write([]byte("\r")))
+
+	// Editing keys
+	assert.Equal(t, []string{"cat file"}, b.Write([]byte("cat fiel\x7f\x7fle\r")))
+	assert.Equal(t, []string{"echo hi"}, b.Write([]byte("rm -rf /\x15echo hi\r\n")))
+	assert.Equal(t, []string{"make check"}, b.Write([]byte("make chk\x1b[D\x1b[D\x1b[Cec\r")))
+	assert.Equal(t, []string{"git status"}, b.Write([]byte("status\x01git \x05\r")))
+	assert.Equal(t, []string{"cd /"}, b.Write([]byte("cd /tmp foo\x17\x17/\r")))
+	assert.Nil(t, b.Write([]byte("sleep 100\x03")))
+	assert.Equal(t, "", b.Line())
+
+	// Sequences and characters split across writes
+	assert.Nil(t, b.Write([]byte("cho \x1b")))
+	assert.Nil(t, b.Write([]byte("[He\x1b[")))
+	assert.Nil(t, b.Write([]byte("F\xc3")))
+	assert.Equal(t, []string{"echo é"}, b.Write([]byte("\xa9\r")))
+
+	assert.Equal(t, []string{"a", "b"}, b.Write([]byte("a\rb\r")))
+}
+
+func TestTerminal(t *testing.T) {
+	term := NewTerminal()
+
+	// Typed key by key and echoed
+	for _, c := range "ls" {
+		assert.Nil(t, term.Input([]byte(string(c))))
+		term.Output([]byte(string(c)))
+	}
+	assert.Equal(t, []string{"ls"}, term.Input([]byte("\r")))
+	term.Output([]byte("\r\nfile\r\n$ [sudo] password for user: "))
+
+	// Typed key by key without echo
+	for _, c := range "secret" {
+		assert.Nil(t, term.Input([]byte(string(c))))
+	}
+	assert.Nil(t, term.Input([]byte("\r")))
+	term.Output([]byte("\r\nSorry, try again.\r\n[sudo] password for user: "))
+
+	// Pasted without echo
+	assert.Nil(t, term.Input([]byte("secret\r")))
+	term.Output([]byte("\r\n$ "))
+
+	// Pasted and echoed, which is only known once the echo arrived
+	assert.Nil(t, term.Input([]byte("make\r")))
+	term.Output([]byte("make\r\n"))
+	assert.Equal(t, []string{"make"}, term.Input([]byte("c")))
+	term.Output([]byte("c"))
+	assert.Equal(t, []string{"cd"}, term.Input([]byte("d\rpwd\r")))
+	term.Output([]byte("d\r\n$ pwd\r\n/\r\n"))
+	assert.Equal(t, []string{"pwd"}, term.Flush())
+	assert.Nil(t, term.Flush())
+}
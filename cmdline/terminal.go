@@ -0,0 +1,87 @@
+package cmdline
+
+import (
+	"bytes"
+	"sync"
+)
+
+// How much output is kept to look for the echo of lines that were typed in
+// one go.
+const maxEchoOutput = 4096
+
+// Terminal reconstructs the command lines typed into a terminal like Buffer,
+// but also watches its output to leave out the lines the terminal didn't
+// echo, such as passwords typed at the prompts of sudo, passwd or docker
+// login. Lines typed key by key are echoed when the terminal wrote anything
+// while they were typed. Lines that arrived whole, like pasted ones, are
+// echoed when their text shows up in the output before more input arrives.
+type Terminal struct {
+	mx      sync.Mutex
+	buffer  *Buffer
+	echoed  bool
+	pending []string
+	output  []byte
+}
+
+func NewTerminal() *Terminal {
+	return &Terminal{buffer: New()}
+}
+
+// Input feeds input to the terminal and returns the lines known by now to
+// have been completed while the terminal echoed.
+func (t *Terminal) Input(data []byte) []string {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	lines := t.confirm()
+	typing := t.buffer.Line() != ""
+	completed := t.buffer.Write(data)
+	for i, line := range completed {
+		if i == 0 && typing && t.echoed {
+			lines = append(lines, line)
+		} else {
+			t.pending = append(t.pending, line)
+		}
+	}
+	if len(completed) > 0 || t.buffer.Line() == "" {
+		t.echoed = false
+	}
+	return lines
+}
+
+// Output tells the terminal what it wrote.
+func (t *Terminal) Output(data []byte) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	if t.buffer.Line() != "" {
+		t.echoed = true
+	}
+	if len(t.pending) > 0 && len(t.output) < maxEchoOutput {
+		if n := maxEchoOutput - len(t.output); len(data) > n {
+			data = data[:n]
+		}
+		t.output = append(t.output, data...)
+	}
+}
+
+// Flush returns the lines that were echoed among those still waiting for
+// their echo, and forgets the rest.
+func (t *Terminal) Flush() []string {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	return t.confirm()
+}
+
+func (t *Terminal) confirm() []string {
+	var lines []string
+	for _, line := range t.pending {
+		if bytes.Contains(t.output, []byte(line)) {
+			lines = append(lines, line)
+		}
+	}
+	t.pending = nil
+	t.output = nil
+	return lines
+}
@@ -1,9 +1,12 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"log"
 	"os"
 	"regexp"
+	"time"
 
 	"github.com/gorilla/securecookie"
 
@@ -29,11 +32,14 @@ var AliasFilter = regexp.MustCompile(AliasPortGroupRegex)
 
 var PortNumber, SessionsFile, PWDContainerName, L2ContainerName, L2Subdomain, HashKey, SSHKeyPath, L2RouterIP, CookieHashKey, CookieBlockKey string
 var UseLetsEncrypt, ExternalDindVolume, NoWindows bool
+var DindVolumeSize string
 var LetsEncryptCertsDir string
 var MaxLoadAvg float64
 var ForceTLS bool
 var SecureCookie *securecookie.SecureCookie
+var LoginSessionTTL, LoginSessionRotation time.Duration
 var AdminToken string
+var AdminURL string
 
 // Unsafe enables a number of unsafe features when set. It is principally
 // intended to be used in development. For example, it allows the caller to
@@ -42,12 +48,38 @@ var Unsafe bool
 
 var PlaygroundDomain string
 
+// PlaygroundAllowedOrigins are the comma separated origins, besides its
+// domain, whose pages may call the default playground.
+var PlaygroundAllowedOrigins string
+
 var SegmentId string
 
 var RoseExamEndpoint string
 var LLVMExamEndpoint string
 var UseGPU bool
 
+var SnapshotRepository string
+
+var ContainerRuntime, PodmanHost string
+
+var RecordingsDir string
+
+var ExamGraderImage, ExamSubmissionsDir string
+
+var LTIKeyPath string
+
+var AutoLinkAccounts bool
+
+var TerminalScrollbackSize int
+var TerminalKeepAlive time.Duration
+var ShareTTL time.Duration
+
+var EventQueueSize int
+var EventOverflowPolicy string
+
+var UserVolumeDriver, UserVolumeSize, UserVolumePath string
+var UserVolumeExpiry time.Duration
+
 // TODO move this to a sync map so it can be updated on demand when the configuration for a playground changes
 var Providers = map[string]map[string]*oauth2.Config{}
 
@@ -64,24 +96,77 @@ func ParseFlags() {
 	flag.StringVar(&HashKey, "hash_key", "salmonrosado", "Hash key to use for cookies")
 	flag.BoolVar(&NoWindows, "win-disable", false, "Disable windows instances")
 	flag.BoolVar(&ExternalDindVolume, "dind-external-volume", false, "Use external dind volume though XFS volume driver")
+	flag.StringVar(&DindVolumeSize, "dind-volume-size", "5G", "Size of the external dind volume of instances in playgrounds that don't set their own")
 	flag.Float64Var(&MaxLoadAvg, "maxload", 100, "Maximum allowed load average before failing ping requests")
 	flag.StringVar(&SSHKeyPath, "ssh_key_path", "", "SSH Private Key to use")
 	flag.StringVar(&CookieHashKey, "cookie-hash-key", "", "Hash key to use to validate cookies")
 	flag.StringVar(&CookieBlockKey, "cookie-block-key", "", "Block key to use to encrypt cookies")
+	flag.DurationVar(&LoginSessionTTL, "login-session-ttl", 14*24*time.Hour, "How long users stay logged in without using the playground")
+	flag.DurationVar(&LoginSessionRotation, "login-session-rotation", 24*time.Hour, "How often the login cookie of a user is replaced with a new one")
 
 	flag.StringVar(&PlaygroundDomain, "playground-domain", "lab.freecompilercamp.org:5010", "Domain to use for the playground")
+	flag.StringVar(&PlaygroundAllowedOrigins, "playground-allowed-origins", "", "Comma separated origins, besides the playground domain, whose pages may call the playground with the cookies of the user. https://*.example.com allows any subdomain")
 	flag.StringVar(&AdminToken, "admin-token", "", "Token to validate admin user for admin endpoints")
+	flag.StringVar(&AdminURL, "admin-url", "", "URL of the server that admin subcommands are sent to. Defaults to the local server on --port")
 
 	flag.StringVar(&SegmentId, "segment-id", "", "Segment id to post metrics")
 
 	flag.StringVar(&RoseExamEndpoint, "rose-exam-endpoint", "https://github.com/freeCompilerCamp/code-for-rose-tutorials", "GitHub host endpoint for closed-book ROSE exams")
 	flag.StringVar(&LLVMExamEndpoint, "llvm-exam-endpoint", "https://github.com/freeCompilerCamp/code-for-llvm-tutorials", "GitHub host endpoint for closed-book LLVM exams")
 	flag.BoolVar(&UseGPU, "gpu-enable", false, "Enable GPU in docker containers")
+	flag.StringVar(&UserVolumeDriver, "user-volume-driver", "local", "Volume driver used for persistent user workspaces")
+	flag.StringVar(&UserVolumeSize, "user-volume-size", "", "Size quota of persistent user workspaces. Requires a volume driver that supports the size option, which the local driver doesn't")
+	flag.StringVar(&UserVolumePath, "user-volume-path", "/root", "Path where persistent user workspaces are mounted inside instances")
+	flag.DurationVar(&UserVolumeExpiry, "user-volume-expiry", 30*24*time.Hour, "Remove persistent user workspaces that have not been used for this long")
+	flag.StringVar(&ContainerRuntime, "container-runtime", "docker", "Container runtime used to run DinD instances and session networks. Either docker or podman")
+	flag.StringVar(&PodmanHost, "podman-host", "unix:///run/podman/podman.sock", "Address of the podman service used when the container runtime is podman")
+	flag.StringVar(&LTIKeyPath, "lti-key", "", "PEM encoded RSA private key the playground signs with as an LTI tool. A new key is generated on every start when empty")
+	flag.BoolVar(&AutoLinkAccounts, "auto-link-accounts", false, "Link logins with a new provider to the user that has the same verified email instead of creating a new user")
+	flag.StringVar(&RecordingsDir, "recordings-dir", "./pwd/recordings", "Directory where terminal recordings are stored")
+	flag.StringVar(&ExamGraderImage, "exam-grader-image", "", "Image that grades exams whose score is posted to an LMS. Its containers get the submitted files in /submission, run 'grade <exam>' and write 'given/maximum' to /grade/score, which the submitted code must not be able to write. No scores are posted when empty")
+	flag.StringVar(&ExamSubmissionsDir, "exam-submissions-dir", "./pwd/submissions", "Directory where the files submitted for graded exams are kept until they are graded")
+	flag.IntVar(&TerminalScrollbackSize, "terminal-scrollback-size", 64*1024, "Bytes of recent output kept for each instance terminal so reconnecting clients can catch up")
+	flag.DurationVar(&TerminalKeepAlive, "terminal-keepalive", 5*time.Minute, "How long instance terminals stay attached, buffering output, after the last client disconnects")
+	flag.DurationVar(&ShareTTL, "share-ttl", 24*time.Hour, "How long links that share a session stay valid. They never outlive the session")
+	flag.IntVar(&EventQueueSize, "event-queue-size", 1024, "Maximum number of events queued for each event subscriber")
+	flag.StringVar(&EventOverflowPolicy, "event-overflow-policy", "block", "What to do when the event queue of an internal subscriber is full. Either block, drop-newest or drop-oldest. Subscribers of websocket clients always drop their oldest events")
+	flag.StringVar(&SnapshotRepository, "snapshot-repository", "pwd-snapshots", "Image repository where instance snapshots are committed")
 
 	flag.BoolVar(&Unsafe, "unsafe", os.Getenv("PWD_UNSAFE") == "true", "Operate in unsafe mode")
 
 	flag.Parse()
+}
 
-	SecureCookie = securecookie.New([]byte(CookieHashKey), []byte(CookieBlockKey))
+// CheckUserVolumes refuses a size for persistent user workspaces when their
+// volume driver would silently ignore it.
+func CheckUserVolumes() error {
+	if UserVolumeSize != "" && UserVolumeDriver == "local" {
+		return errors.New("--user-volume-size is not supported by the local volume driver. Use a driver with a size option, such as xfsvol")
+	}
+	return nil
+}
 
+// InitSecureCookie sets up the keys login cookies are signed and encrypted
+// with. Empty keys are refused unless running in unsafe mode, where random
+// keys are used and logins don't survive restarts.
+func InitSecureCookie() error {
+	hashKey, blockKey := []byte(CookieHashKey), []byte(CookieBlockKey)
+	if len(hashKey) == 0 || len(blockKey) == 0 {
+		if !Unsafe {
+			return errors.New("--cookie-hash-key and --cookie-block-key must be set, or --unsafe to use random keys")
+		}
+		log.Println("Cookie keys are not set. Using random keys, logins won't survive restarts")
+		if len(hashKey) == 0 {
+			hashKey = securecookie.GenerateRandomKey(64)
+		}
+		if len(blockKey) == 0 {
+			blockKey = securecookie.GenerateRandomKey(32)
+		}
+	}
+	if n := len(blockKey); n != 16 && n != 24 && n != 32 {
+		return errors.New("--cookie-block-key must be 16, 24 or 32 bytes long")
+	}
+
+	SecureCookie = securecookie.New(hashKey, blockKey).MaxAge(int(LoginSessionTTL.Seconds()))
+	return nil
 }
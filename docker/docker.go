@@ -9,19 +9,19 @@ import (
 	"io/ioutil"
 	"log"
 	"net"
-	"os"
-	"strconv"
 	"strings"
 	"time"
 
 	client "github.com/docker/docker/client"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/swarm"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/containerd/containerd/reference"
 	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/engine"
 )
 
 const (
@@ -49,14 +49,24 @@ type DockerApi interface {
 	ContainerResize(name string, rows, cols uint) error
 	ContainerRename(old, new string) error
 	ContainerDelete(name string) error
+	ContainerRunning(name string) (bool, error)
 	ContainerCreate(opts CreateContainerOpts) error
 	ContainerIPs(id string) (map[string]string, error)
 	ExecAttach(instanceName string, command []string, out io.Writer) (int, error)
 	Exec(instanceName string, command []string) (int, error)
 
 	CreateAttachConnection(name string) (net.Conn, error)
+	ExecTerminal(name string, command []string) (string, net.Conn, error)
+	ExecResize(id string, rows, cols uint) error
 	CopyToContainer(containerName, destination, fileName string, content io.Reader) error
 	CopyFromContainer(containerName, filePath string) (io.Reader, error)
+	ContainerCommit(containerName, ref string) error
+	ImageRemove(ref string) error
+	ImageSize(ref string) (int64, error)
+	ImageSave(ref string) (io.ReadCloser, error)
+	ImageLoad(content io.Reader) error
+	VolumeCreate(name, driver string, driverOpts, labels map[string]string) error
+	VolumeDelete(name string) error
 	SwarmInit(advertiseAddr string) (*SwarmTokens, error)
 	SwarmJoin(addr, token string) error
 
@@ -213,23 +223,28 @@ func (d *docker) CreateAttachConnection(name string) (net.Conn, error) {
 	return conn.Conn, nil
 }
 
-func (d *docker) CopyToContainer(containerName, destination, fileName string, content io.Reader) error {
-	contents, err := ioutil.ReadAll(content)
+func (d *docker) ExecTerminal(name string, command []string) (string, net.Conn, error) {
+	e, err := d.c.ContainerExecCreate(context.Background(), name, types.ExecConfig{Cmd: command, AttachStdin: true, AttachStdout: true, AttachStderr: true, Tty: true})
 	if err != nil {
-		return err
-	}
-	var buf bytes.Buffer
-	t := tar.NewWriter(&buf)
-	if err := t.WriteHeader(&tar.Header{Name: fileName, Mode: 0600, Size: int64(len(contents)), Uid: 9999, Gid: 9999, ModTime: time.Now()}); err != nil {
-		return err
+		return "", nil, err
 	}
-	if _, err := t.Write(contents); err != nil {
-		return err
+	resp, err := d.c.ContainerExecAttach(context.Background(), e.ID, types.ExecStartCheck{Tty: true})
+	if err != nil {
+		return "", nil, err
 	}
-	if err := t.Close(); err != nil {
+	return e.ID, resp.Conn, nil
+}
+
+func (d *docker) ExecResize(id string, rows, cols uint) error {
+	return d.c.ContainerExecResize(context.Background(), id, types.ResizeOptions{Height: rows, Width: cols})
+}
+
+func (d *docker) CopyToContainer(containerName, destination, fileName string, content io.Reader) error {
+	buf, err := engine.Archive(fileName, content)
+	if err != nil {
 		return err
 	}
-	return d.c.CopyToContainer(context.Background(), containerName, destination, &buf, types.CopyToContainerOptions{AllowOverwriteDirWithFile: true})
+	return d.c.CopyToContainer(context.Background(), containerName, destination, buf, types.CopyToContainerOptions{AllowOverwriteDirWithFile: true})
 }
 
 func (d *docker) CopyFromContainer(containerName, filePath string) (io.Reader, error) {
@@ -246,76 +261,93 @@ func (d *docker) CopyFromContainer(containerName, filePath string) (io.Reader, e
 	return tr, nil
 }
 
-func (d *docker) ContainerDelete(name string) error {
-	err := d.c.ContainerRemove(context.Background(), name, types.ContainerRemoveOptions{Force: true, RemoveVolumes: true})
-	d.c.VolumeRemove(context.Background(), name, true)
+func (d *docker) ContainerCommit(containerName, ref string) error {
+	_, err := d.c.ContainerCommit(context.Background(), containerName, types.ContainerCommitOptions{Reference: ref, Pause: true})
 	return err
 }
 
-type CreateContainerOpts struct {
-	Image          string
-	SessionId      string
-	ContainerName  string
-	Hostname       string
-	ServerCert     []byte
-	ServerKey      []byte
-	CACert         []byte
-	Privileged     bool
-	HostFQDN       string
-	Labels         map[string]string
-	Networks       []string
-	DindVolumeSize string
-	Envs           []string
+func (d *docker) ImageRemove(ref string) error {
+	_, err := d.c.ImageRemove(context.Background(), ref, types.ImageRemoveOptions{PruneChildren: true})
+	return err
 }
 
-func (d *docker) ContainerCreate(opts CreateContainerOpts) (err error) {
-	// Make sure directories are available for the new instance container
-	containerDir := "/opt/pwd"
-	containerCertDir := fmt.Sprintf("%s/certs", containerDir)
+func (d *docker) ImageSize(ref string) (int64, error) {
+	i, _, err := d.c.ImageInspectWithRaw(context.Background(), ref)
+	if err != nil {
+		return 0, err
+	}
+	return i.Size, nil
+}
 
-	env := append(opts.Envs, fmt.Sprintf("SESSION_ID=%s", opts.SessionId))
+func (d *docker) ImageSave(ref string) (io.ReadCloser, error) {
+	return d.c.ImageSave(context.Background(), []string{ref})
+}
 
-	// Write certs to container cert dir
-	if len(opts.ServerCert) > 0 {
-		env = append(env, `DOCKER_TLSCERT=\/opt\/pwd\/certs\/cert.pem`)
-	}
-	if len(opts.ServerKey) > 0 {
-		env = append(env, `DOCKER_TLSKEY=\/opt\/pwd\/certs\/key.pem`)
-	}
-	if len(opts.CACert) > 0 {
-		// if ca cert is specified, verify that clients that connects present a certificate signed by the CA
-		env = append(env, `DOCKER_TLSCACERT=\/opt\/pwd\/certs\/ca.pem`)
+func (d *docker) ImageLoad(content io.Reader) error {
+	resp, err := d.c.ImageLoad(context.Background(), content, true)
+	if err != nil {
+		return err
 	}
-	if len(opts.ServerCert) > 0 || len(opts.ServerKey) > 0 || len(opts.CACert) > 0 {
-		// if any of the certs is specified, enable TLS
-		env = append(env, "DOCKER_TLSENABLE=true")
-	} else {
-		env = append(env, "DOCKER_TLSENABLE=false")
+	defer resp.Body.Close()
+	_, err = io.Copy(ioutil.Discard, resp.Body)
+	return err
+}
+
+func (d *docker) VolumeCreate(name, driver string, driverOpts, labels map[string]string) error {
+	_, err := d.c.VolumeCreate(context.Background(), volume.VolumeCreateBody{
+		Name:       name,
+		Driver:     driver,
+		DriverOpts: driverOpts,
+		Labels:     labels,
+	})
+	return err
+}
+
+func (d *docker) VolumeDelete(name string) error {
+	return d.c.VolumeRemove(context.Background(), name, false)
+}
+
+func (d *docker) ContainerDelete(name string) error {
+	err := d.c.ContainerRemove(context.Background(), name, types.ContainerRemoveOptions{Force: true, RemoveVolumes: true})
+	d.c.VolumeRemove(context.Background(), name, true)
+	return err
+}
+
+func (d *docker) ContainerRunning(name string) (bool, error) {
+	cinfo, err := d.c.ContainerInspect(context.Background(), name)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return false, nil
+		}
+		return false, err
 	}
+	return cinfo.State != nil && cinfo.State.Running, nil
+}
+
+type CreateContainerOpts = engine.CreateContainerOpts
+
+func (d *docker) ContainerCreate(opts CreateContainerOpts) (err error) {
+	env := opts.Env()
 
 	h := &container.HostConfig{
 		NetworkMode: container.NetworkMode(opts.SessionId),
 		Privileged:  opts.Privileged,
+		Runtime:     opts.Runtime,
 		AutoRemove:  true,
 		LogConfig:   container.LogConfig{Config: map[string]string{"max-size": "10m", "max-file": "1"}},
 	}
 
-	if os.Getenv("APPARMOR_PROFILE") != "" {
-		h.SecurityOpt = []string{fmt.Sprintf("apparmor=%s", os.Getenv("APPARMOR_PROFILE"))}
+	limits := engine.SandboxLimits()
+	if limits.AppArmorProfile != "" {
+		h.SecurityOpt = []string{fmt.Sprintf("apparmor=%s", limits.AppArmorProfile)}
 	}
 
-	if os.Getenv("STORAGE_SIZE") != "" {
+	if limits.StorageSize != "" {
 		// assing 10GB size FS for each container
-		h.StorageOpt = map[string]string{"size": os.Getenv("STORAGE_SIZE")}
+		h.StorageOpt = map[string]string{"size": limits.StorageSize}
 	}
 
-	var pidsLimit = int64(1000)
-	if envLimit := os.Getenv("MAX_PROCESSES"); envLimit != "" {
-		if i, err := strconv.Atoi(envLimit); err == nil {
-			pidsLimit = int64(i)
-		}
-	}
-	h.Resources.PidsLimit = &pidsLimit
+	h.Resources.PidsLimit = &limits.Pids
 
 	if config.UseGPU {
 		gpu := container.DeviceRequest{}
@@ -325,16 +357,15 @@ func (d *docker) ContainerCreate(opts CreateContainerOpts) (err error) {
 		h.Resources.DeviceRequests = append(h.Resources.DeviceRequests, gpu)
 	}
 
-	if memLimit := os.Getenv("MAX_MEMORY_MB"); memLimit != "" {
-		if i, err := strconv.Atoi(memLimit); err == nil {
-			h.Resources.Memory = int64(i) * Megabyte
-		}
-	}
+	h.Resources.Memory = limits.Memory
 
 	t := true
 	h.Resources.OomKillDisable = &t
 
-	env = append(env, fmt.Sprintf("PWD_HOST_FQDN=%s", opts.HostFQDN))
+	for _, m := range opts.Mounts {
+		h.Mounts = append(h.Mounts, mount.Mount{Type: mount.TypeVolume, Source: m.Source, Target: m.Target})
+	}
+
 	cf := &container.Config{
 		Hostname:     opts.Hostname,
 		Image:        opts.Image,
@@ -351,7 +382,9 @@ func (d *docker) ContainerCreate(opts CreateContainerOpts) (err error) {
 		EndpointsConfig: map[string]*network.EndpointSettings{opts.Networks[0]: &network.EndpointSettings{}},
 	}
 
-	if config.ExternalDindVolume {
+	// Plain unprivileged containers can't run a docker daemon, so they don't
+	// need a volume for it
+	if config.ExternalDindVolume && (opts.Privileged || opts.Runtime != "") {
 		_, err = d.c.VolumeCreate(context.Background(), volume.VolumeCreateBody{
 			Driver: "xfsvol",
 			DriverOpts: map[string]string{
@@ -398,13 +431,13 @@ func (d *docker) ContainerCreate(opts CreateContainerOpts) (err error) {
 		}
 	}
 
-	if err = d.copyIfSet(opts.ServerCert, "cert.pem", containerCertDir, opts.ContainerName); err != nil {
+	if err = d.copyIfSet(opts.ServerCert, "cert.pem", engine.CertsDir, opts.ContainerName); err != nil {
 		return
 	}
-	if err = d.copyIfSet(opts.ServerKey, "key.pem", containerCertDir, opts.ContainerName); err != nil {
+	if err = d.copyIfSet(opts.ServerKey, "key.pem", engine.CertsDir, opts.ContainerName); err != nil {
 		return
 	}
-	if err = d.copyIfSet(opts.CACert, "ca.pem", containerCertDir, opts.ContainerName); err != nil {
+	if err = d.copyIfSet(opts.CACert, "ca.pem", engine.CertsDir, opts.ContainerName); err != nil {
 		return
 	}
 
@@ -18,6 +18,9 @@ import (
 type FactoryApi interface {
 	GetForSession(session *types.Session) (DockerApi, error)
 	GetForInstance(instance *types.Instance) (DockerApi, error)
+	// GetForHost returns the daemon sessions run on when its DaemonHost is
+	// host.
+	GetForHost(host string) (DockerApi, error)
 }
 
 func NewClient(instance *types.Instance, proxyHost string) (*client.Client, error) {
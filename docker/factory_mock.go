@@ -18,3 +18,8 @@ func (m *FactoryMock) GetForInstance(instance *types.Instance) (DockerApi, error
 	args := m.Called(instance)
 	return args.Get(0).(DockerApi), args.Error(1)
 }
+
+func (m *FactoryMock) GetForHost(host string) (DockerApi, error) {
+	args := m.Called(host)
+	return args.Get(0).(DockerApi), args.Error(1)
+}
@@ -50,6 +50,17 @@ func (f *localCachedFactory) GetForSession(session *types.Session) (DockerApi, e
 	return f.sessionClient, nil
 }
 
+func (f *localCachedFactory) GetForHost(host string) (DockerApi, error) {
+	d, err := f.GetForSession(nil)
+	if err != nil {
+		return nil, err
+	}
+	if d.DaemonHost() != host {
+		return nil, fmt.Errorf("Container host [%s] is not available", host)
+	}
+	return d, nil
+}
+
 func (f *localCachedFactory) GetForInstance(instance *types.Instance) (DockerApi, error) {
 	key := instance.Name
 
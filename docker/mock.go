@@ -69,6 +69,14 @@ func (m *Mock) CreateAttachConnection(name string) (net.Conn, error) {
 	args := m.Called(name)
 	return args.Get(0).(net.Conn), args.Error(1)
 }
+func (m *Mock) ExecTerminal(name string, command []string) (string, net.Conn, error) {
+	args := m.Called(name, command)
+	return args.String(0), args.Get(1).(net.Conn), args.Error(2)
+}
+func (m *Mock) ExecResize(id string, rows, cols uint) error {
+	args := m.Called(id, rows, cols)
+	return args.Error(0)
+}
 func (m *Mock) CopyToContainer(containerName, destination, fileName string, content io.Reader) error {
 	args := m.Called(containerName, destination, fileName, content)
 	return args.Error(0)
@@ -78,10 +86,42 @@ func (m *Mock) CopyFromContainer(containerName, filePath string) (io.Reader, err
 	args := m.Called(containerName, filePath)
 	return args.Get(0).(io.Reader), args.Error(1)
 }
+func (m *Mock) ContainerCommit(containerName, ref string) error {
+	args := m.Called(containerName, ref)
+	return args.Error(0)
+}
+func (m *Mock) ImageRemove(ref string) error {
+	args := m.Called(ref)
+	return args.Error(0)
+}
+func (m *Mock) ImageSize(ref string) (int64, error) {
+	args := m.Called(ref)
+	return args.Get(0).(int64), args.Error(1)
+}
+func (m *Mock) ImageSave(ref string) (io.ReadCloser, error) {
+	args := m.Called(ref)
+	return args.Get(0).(io.ReadCloser), args.Error(1)
+}
+func (m *Mock) ImageLoad(content io.Reader) error {
+	args := m.Called(content)
+	return args.Error(0)
+}
+func (m *Mock) VolumeCreate(name, driver string, driverOpts, labels map[string]string) error {
+	args := m.Called(name, driver, driverOpts, labels)
+	return args.Error(0)
+}
+func (m *Mock) VolumeDelete(name string) error {
+	args := m.Called(name)
+	return args.Error(0)
+}
 func (m *Mock) ContainerDelete(id string) error {
 	args := m.Called(id)
 	return args.Error(0)
 }
+func (m *Mock) ContainerRunning(name string) (bool, error) {
+	args := m.Called(name)
+	return args.Bool(0), args.Error(1)
+}
 func (m *Mock) ContainerCreate(opts CreateContainerOpts) error {
 	args := m.Called(opts)
 	return args.Error(0)
@@ -0,0 +1,41 @@
+package docker
+
+import (
+	"github.com/docker/docker/api/types"
+	"github.com/play-with-docker/play-with-docker/engine"
+	pwdtypes "github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+// runtime exposes a DockerApi as an engine.RuntimeApi. Session networks are
+// attachable overlays so they can span every node of the swarm.
+type runtime struct {
+	DockerApi
+}
+
+func (r *runtime) NetworkCreate(id string) error {
+	return r.DockerApi.NetworkCreate(id, types.NetworkCreate{Driver: "overlay", Attachable: true})
+}
+
+type runtimeFactory struct {
+	factory FactoryApi
+}
+
+func NewRuntimeFactory(f FactoryApi) engine.FactoryApi {
+	return &runtimeFactory{factory: f}
+}
+
+func (f *runtimeFactory) GetForSession(session *pwdtypes.Session) (engine.RuntimeApi, error) {
+	d, err := f.factory.GetForSession(session)
+	if err != nil {
+		return nil, err
+	}
+	return &runtime{DockerApi: d}, nil
+}
+
+func (f *runtimeFactory) GetForHost(host string) (engine.RuntimeApi, error) {
+	d, err := f.factory.GetForHost(host)
+	if err != nil {
+		return nil, err
+	}
+	return &runtime{DockerApi: d}, nil
+}
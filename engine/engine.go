@@ -0,0 +1,164 @@
+// Package engine holds the container operations instances are built on,
+// independently of the container engine that runs them.
+package engine
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+type RuntimeApi interface {
+	DaemonHost() string
+
+	// ContainerStats returns a single stats sample encoded the same way the
+	// Docker Engine API does.
+	ContainerStats(name string) (io.ReadCloser, error)
+	ContainerResize(name string, rows, cols uint) error
+	ContainerDelete(name string) error
+	// ContainerRunning tells whether the container exists and is running.
+	ContainerRunning(name string) (bool, error)
+	ContainerCreate(opts CreateContainerOpts) error
+	ContainerIPs(id string) (map[string]string, error)
+	ExecAttach(instanceName string, command []string, out io.Writer) (int, error)
+	Exec(instanceName string, command []string) (int, error)
+
+	CreateAttachConnection(name string) (net.Conn, error)
+	// ExecTerminal starts command in the container with its own TTY and
+	// returns the id of the exec and a connection to its terminal.
+	ExecTerminal(name string, command []string) (string, net.Conn, error)
+	ExecResize(id string, rows, cols uint) error
+	CopyToContainer(containerName, destination, fileName string, content io.Reader) error
+	CopyFromContainer(containerName, filePath string) (io.Reader, error)
+	// ContainerCommit saves the filesystem of the container as the image ref.
+	ContainerCommit(containerName, ref string) error
+	ImageRemove(ref string) error
+	// ImageSize returns the size of the image in bytes.
+	ImageSize(ref string) (int64, error)
+	// ImageSave and ImageLoad move images between hosts as tar archives.
+	ImageSave(ref string) (io.ReadCloser, error)
+	ImageLoad(content io.Reader) error
+	VolumeCreate(name, driver string, driverOpts, labels map[string]string) error
+	VolumeDelete(name string) error
+
+	// NetworkCreate creates the network instances of a session are attached
+	// to. Containers on it must be able to reach each other.
+	NetworkCreate(id string) error
+	NetworkConnect(container, network, ip string) (string, error)
+	NetworkDisconnect(containerId, networkId string) error
+	NetworkDelete(id string) error
+}
+
+type FactoryApi interface {
+	GetForSession(session *types.Session) (RuntimeApi, error)
+	// GetForHost returns the runtime whose DaemonHost is host, for images
+	// and volumes that outlive the session they were created in.
+	GetForHost(host string) (RuntimeApi, error)
+}
+
+type CreateContainerOpts struct {
+	Image          string
+	SessionId      string
+	ContainerName  string
+	Hostname       string
+	ServerCert     []byte
+	ServerKey      []byte
+	CACert         []byte
+	Privileged     bool
+	Runtime        string
+	HostFQDN       string
+	Labels         map[string]string
+	Networks       []string
+	DindVolumeSize string
+	Envs           []string
+	Mounts         []types.Mount
+}
+
+const CertsDir = "/opt/pwd/certs"
+
+const Megabyte = 1024 * 1024
+
+// Limits are what every instance container is allowed to use, whatever the
+// runtime that runs it.
+type Limits struct {
+	Pids int64
+	// Memory is in bytes, no limit when 0.
+	Memory int64
+	// StorageSize is the size of the root filesystem, no limit when empty.
+	StorageSize     string
+	AppArmorProfile string
+}
+
+// SandboxLimits reads the limits of instance containers from the
+// MAX_PROCESSES, MAX_MEMORY_MB, STORAGE_SIZE and APPARMOR_PROFILE environment
+// variables. Instances can't run more than 1000 processes by default.
+func SandboxLimits() Limits {
+	l := Limits{Pids: 1000, StorageSize: os.Getenv("STORAGE_SIZE"), AppArmorProfile: os.Getenv("APPARMOR_PROFILE")}
+	if envLimit := os.Getenv("MAX_PROCESSES"); envLimit != "" {
+		if i, err := strconv.Atoi(envLimit); err == nil {
+			l.Pids = int64(i)
+		}
+	}
+	if memLimit := os.Getenv("MAX_MEMORY_MB"); memLimit != "" {
+		if i, err := strconv.Atoi(memLimit); err == nil {
+			l.Memory = int64(i) * Megabyte
+		}
+	}
+	return l
+}
+
+// Env returns the environment of the instance container, including the
+// variables the instance images use to configure their docker daemon.
+func (opts CreateContainerOpts) Env() []string {
+	env := append([]string{}, opts.Envs...)
+	env = append(env, fmt.Sprintf("SESSION_ID=%s", opts.SessionId))
+
+	// Write certs to container cert dir
+	if len(opts.ServerCert) > 0 {
+		env = append(env, `DOCKER_TLSCERT=\/opt\/pwd\/certs\/cert.pem`)
+	}
+	if len(opts.ServerKey) > 0 {
+		env = append(env, `DOCKER_TLSKEY=\/opt\/pwd\/certs\/key.pem`)
+	}
+	if len(opts.CACert) > 0 {
+		// if ca cert is specified, verify that clients that connects present a certificate signed by the CA
+		env = append(env, `DOCKER_TLSCACERT=\/opt\/pwd\/certs\/ca.pem`)
+	}
+	if len(opts.ServerCert) > 0 || len(opts.ServerKey) > 0 || len(opts.CACert) > 0 {
+		// if any of the certs is specified, enable TLS
+		env = append(env, "DOCKER_TLSENABLE=true")
+	} else {
+		env = append(env, "DOCKER_TLSENABLE=false")
+	}
+	env = append(env, fmt.Sprintf("PWD_HOST_FQDN=%s", opts.HostFQDN))
+	return env
+}
+
+// Archive wraps content in a tar archive holding a single file, which is
+// what container engines expect when copying files into a container.
+func Archive(fileName string, content io.Reader) (*bytes.Buffer, error) {
+	contents, err := ioutil.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	t := tar.NewWriter(&buf)
+	if err := t.WriteHeader(&tar.Header{Name: fileName, Mode: 0600, Size: int64(len(contents)), Uid: 9999, Gid: 9999, ModTime: time.Now()}); err != nil {
+		return nil, err
+	}
+	if _, err := t.Write(contents); err != nil {
+		return nil, err
+	}
+	if err := t.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
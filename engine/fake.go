@@ -0,0 +1,447 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+// Fake is an in-memory RuntimeApi for tests. Containers get an address on
+// every network they are attached to and commands are recorded instead of
+// being run. It also satisfies FactoryApi, handing itself out for every
+// session.
+type Fake struct {
+	rw         sync.Mutex
+	host       string
+	containers map[string]*FakeContainer
+	networks   map[string]map[string]string
+	execs      map[string]*FakeExecTerminal
+	images     map[string]string
+	volumes    map[string]map[string]string
+	lastIP     int
+
+	// ExecOutput and ExecExitCode are the result of every exec'd command.
+	ExecOutput   string
+	ExecExitCode int
+	// ExecWrites are the files every exec'd command writes in its container.
+	ExecWrites map[string][]byte
+	// CommitSize is the size of every committed image.
+	CommitSize int64
+}
+
+type FakeContainer struct {
+	Opts  CreateContainerOpts
+	Rows  uint
+	Cols  uint
+	Files map[string][]byte
+	Execs [][]string
+
+	// Stopped makes the container look like it crashed.
+	Stopped bool
+
+	// Terminal is the container side of the last attach connection.
+	Terminal net.Conn
+	// ExecTerminals are the terminals started with ExecTerminal.
+	ExecTerminals []*FakeExecTerminal
+}
+
+type FakeExecTerminal struct {
+	Id       string
+	Command  []string
+	Rows     uint
+	Cols     uint
+	Terminal net.Conn
+}
+
+func NewFake() *Fake {
+	return NewFakeOnHost("unix:///var/run/fake.sock")
+}
+
+// NewFakeOnHost returns a Fake whose DaemonHost is host.
+func NewFakeOnHost(host string) *Fake {
+	return &Fake{host: host, containers: map[string]*FakeContainer{}, networks: map[string]map[string]string{}, execs: map[string]*FakeExecTerminal{}, images: map[string]string{}, volumes: map[string]map[string]string{}}
+}
+
+func (f *Fake) GetForSession(session *types.Session) (RuntimeApi, error) {
+	return f, nil
+}
+
+func (f *Fake) GetForHost(host string) (RuntimeApi, error) {
+	if host != f.DaemonHost() {
+		return nil, fmt.Errorf("Container host [%s] is not available", host)
+	}
+	return f, nil
+}
+
+// Container returns the container with the given name, or nil if it doesn't
+// exist.
+func (f *Fake) Container(name string) *FakeContainer {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	return f.containers[name]
+}
+
+// Image returns the container the image was committed from, or "" if it
+// doesn't exist.
+func (f *Fake) Image(ref string) string {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	return f.images[ref]
+}
+
+// Volume returns the driver options of the volume, or nil if it doesn't
+// exist.
+func (f *Fake) Volume(name string) map[string]string {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	return f.volumes[name]
+}
+
+// HasNetwork tells whether the network exists.
+func (f *Fake) HasNetwork(id string) bool {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	_, found := f.networks[id]
+	return found
+}
+
+func (f *Fake) DaemonHost() string {
+	return f.host
+}
+
+func (f *Fake) container(name string) (*FakeContainer, error) {
+	c, found := f.containers[name]
+	if !found {
+		return nil, fmt.Errorf("No such container: %s", name)
+	}
+	return c, nil
+}
+
+func (f *Fake) connect(container, network, ip string) (string, error) {
+	n, found := f.networks[network]
+	if !found {
+		return "", fmt.Errorf("network %s not found", network)
+	}
+	if ip == "" {
+		ip = fmt.Sprintf("10.0.%d.%d", f.lastIP/254, f.lastIP%254+1)
+		f.lastIP++
+	}
+	n[container] = ip
+	return ip, nil
+}
+
+func (f *Fake) ContainerStats(name string) (io.ReadCloser, error) {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	if _, err := f.container(name); err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(strings.NewReader(`{"cpu_stats":{},"precpu_stats":{},"memory_stats":{}}`)), nil
+}
+
+func (f *Fake) ContainerResize(name string, rows, cols uint) error {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	c, err := f.container(name)
+	if err != nil {
+		return err
+	}
+	c.Rows = rows
+	c.Cols = cols
+	return nil
+}
+
+func (f *Fake) ContainerDelete(name string) error {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	if _, err := f.container(name); err != nil {
+		return err
+	}
+	delete(f.containers, name)
+	for _, n := range f.networks {
+		delete(n, name)
+	}
+	return nil
+}
+
+func (f *Fake) ContainerRunning(name string) (bool, error) {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	c, found := f.containers[name]
+	return found && !c.Stopped, nil
+}
+
+func (f *Fake) ContainerCreate(opts CreateContainerOpts) error {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	if _, found := f.containers[opts.ContainerName]; found {
+		return fmt.Errorf("Conflict. The container name %s is already in use", opts.ContainerName)
+	}
+	for _, n := range opts.Networks {
+		if _, found := f.networks[n]; !found {
+			return fmt.Errorf("network %s not found", n)
+		}
+	}
+	c := &FakeContainer{Opts: opts, Files: map[string][]byte{}}
+	for _, n := range opts.Networks {
+		f.connect(opts.ContainerName, n, "")
+	}
+	for name, content := range map[string][]byte{"cert.pem": opts.ServerCert, "key.pem": opts.ServerKey, "ca.pem": opts.CACert} {
+		if len(content) > 0 {
+			c.Files[path.Join(CertsDir, name)] = content
+		}
+	}
+	f.containers[opts.ContainerName] = c
+	return nil
+}
+
+func (f *Fake) ContainerIPs(id string) (map[string]string, error) {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	if _, err := f.container(id); err != nil {
+		return nil, err
+	}
+	ips := map[string]string{}
+	for network, containers := range f.networks {
+		if ip, found := containers[id]; found {
+			ips[network] = ip
+		}
+	}
+	return ips, nil
+}
+
+func (f *Fake) ExecAttach(instanceName string, command []string, out io.Writer) (int, error) {
+	code, err := f.Exec(instanceName, command)
+	if err != nil {
+		return 0, err
+	}
+	io.WriteString(out, f.ExecOutput)
+	return code, nil
+}
+
+func (f *Fake) Exec(instanceName string, command []string) (int, error) {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	c, err := f.container(instanceName)
+	if err != nil {
+		return 0, err
+	}
+	if c.Stopped {
+		return 0, fmt.Errorf("container %s is not running", instanceName)
+	}
+	c.Execs = append(c.Execs, command)
+	for p, b := range f.ExecWrites {
+		c.Files[path.Clean(p)] = b
+	}
+	return f.ExecExitCode, nil
+}
+
+func (f *Fake) CreateAttachConnection(name string) (net.Conn, error) {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	c, err := f.container(name)
+	if err != nil {
+		return nil, err
+	}
+	client, server := net.Pipe()
+	c.Terminal = server
+	return client, nil
+}
+
+func (f *Fake) ExecTerminal(name string, command []string) (string, net.Conn, error) {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	c, err := f.container(name)
+	if err != nil {
+		return "", nil, err
+	}
+	if c.Stopped {
+		return "", nil, fmt.Errorf("container %s is not running", name)
+	}
+	client, server := net.Pipe()
+	e := &FakeExecTerminal{Id: fmt.Sprintf("exec%d", len(f.execs)+1), Command: command, Terminal: server}
+	c.ExecTerminals = append(c.ExecTerminals, e)
+	f.execs[e.Id] = e
+	return e.Id, client, nil
+}
+
+func (f *Fake) ExecResize(id string, rows, cols uint) error {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	e, found := f.execs[id]
+	if !found {
+		return fmt.Errorf("No such exec instance: %s", id)
+	}
+	e.Rows = rows
+	e.Cols = cols
+	return nil
+}
+
+func (f *Fake) CopyToContainer(containerName, destination, fileName string, content io.Reader) error {
+	b, err := ioutil.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	c, err := f.container(containerName)
+	if err != nil {
+		return err
+	}
+	c.Files[path.Join(destination, fileName)] = b
+	return nil
+}
+
+func (f *Fake) CopyFromContainer(containerName, filePath string) (io.Reader, error) {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	c, err := f.container(containerName)
+	if err != nil {
+		return nil, err
+	}
+	b, found := c.Files[path.Clean(filePath)]
+	if !found {
+		return nil, fmt.Errorf("Could not find the file %s in container %s", filePath, containerName)
+	}
+	return bytes.NewReader(b), nil
+}
+
+func (f *Fake) ContainerCommit(containerName, ref string) error {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	if _, err := f.container(containerName); err != nil {
+		return err
+	}
+	f.images[ref] = containerName
+	return nil
+}
+
+func (f *Fake) ImageRemove(ref string) error {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	if _, found := f.images[ref]; !found {
+		return fmt.Errorf("No such image: %s", ref)
+	}
+	delete(f.images, ref)
+	return nil
+}
+
+func (f *Fake) ImageSize(ref string) (int64, error) {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	if _, found := f.images[ref]; !found {
+		return 0, fmt.Errorf("No such image: %s", ref)
+	}
+	return f.CommitSize, nil
+}
+
+// ImageSave archives the image as its ref and the container it was
+// committed from.
+func (f *Fake) ImageSave(ref string) (io.ReadCloser, error) {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	container, found := f.images[ref]
+	if !found {
+		return nil, fmt.Errorf("No such image: %s", ref)
+	}
+	return ioutil.NopCloser(strings.NewReader(ref + "\n" + container)), nil
+}
+
+func (f *Fake) ImageLoad(content io.Reader) error {
+	b, err := ioutil.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	parts := strings.SplitN(string(b), "\n", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("Invalid image archive")
+	}
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	f.images[parts[0]] = parts[1]
+	return nil
+}
+
+func (f *Fake) VolumeCreate(name, driver string, driverOpts, labels map[string]string) error {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	opts := map[string]string{}
+	for k, v := range driverOpts {
+		opts[k] = v
+	}
+	f.volumes[name] = opts
+	return nil
+}
+
+func (f *Fake) VolumeDelete(name string) error {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	if _, found := f.volumes[name]; !found {
+		return fmt.Errorf("get %s: no such volume", name)
+	}
+	delete(f.volumes, name)
+	return nil
+}
+
+func (f *Fake) NetworkCreate(id string) error {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	if _, found := f.networks[id]; found {
+		return fmt.Errorf("network with name %s already exists", id)
+	}
+	f.networks[id] = map[string]string{}
+	return nil
+}
+
+func (f *Fake) NetworkConnect(container, network, ip string) (string, error) {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	return f.connect(container, network, ip)
+}
+
+func (f *Fake) NetworkDisconnect(containerId, networkId string) error {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	n, found := f.networks[networkId]
+	if !found {
+		return fmt.Errorf("network %s not found", networkId)
+	}
+	if _, found := n[containerId]; !found {
+		return fmt.Errorf("container %s is not connected to the network %s", containerId, networkId)
+	}
+	delete(n, containerId)
+	return nil
+}
+
+func (f *Fake) NetworkDelete(id string) error {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	if _, found := f.networks[id]; !found {
+		return fmt.Errorf("network %s not found", id)
+	}
+	delete(f.networks, id)
+	return nil
+}
+
+// FakeHosts is a FactoryApi for tests that span several hosts. Sessions get
+// the Fake of their host.
+type FakeHosts map[string]*Fake
+
+func (h FakeHosts) GetForSession(session *types.Session) (RuntimeApi, error) {
+	return h.GetForHost(session.Host)
+}
+
+func (h FakeHosts) GetForHost(host string) (RuntimeApi, error) {
+	f, found := h[host]
+	if !found {
+		return nil, fmt.Errorf("Container host [%s] is not available", host)
+	}
+	return f, nil
+}
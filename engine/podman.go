@@ -0,0 +1,605 @@
+package engine
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+// podmanApiVersion is the version of the libpod REST API requests are sent
+// to. Stats are read from the Docker compatible endpoint of the same service
+// so they keep the Docker Engine encoding.
+const podmanApiVersion = "v4.0.0"
+
+// podman runs instances through the REST API of a podman system service, so
+// hosts where dockerd isn't allowed can still run PWD.
+type podman struct {
+	host string
+	addr string
+	cli  *http.Client
+	dial func(ctx context.Context) (net.Conn, error)
+}
+
+type podmanFactory struct {
+	p *podman
+}
+
+// NewPodmanFactory returns a factory handing out the podman service listening
+// on host, which is either a unix socket (unix:///run/podman/podman.sock) or a
+// tcp address (tcp://10.0.0.1:8888). Every session shares the same service.
+func NewPodmanFactory(host string) (FactoryApi, error) {
+	p, err := NewPodman(host)
+	if err != nil {
+		return nil, err
+	}
+	return &podmanFactory{p: p}, nil
+}
+
+func (f *podmanFactory) GetForSession(session *types.Session) (RuntimeApi, error) {
+	return f.p, nil
+}
+
+func (f *podmanFactory) GetForHost(host string) (RuntimeApi, error) {
+	if host != f.p.DaemonHost() {
+		return nil, fmt.Errorf("Container host [%s] is not available", host)
+	}
+	return f.p, nil
+}
+
+func NewPodman(host string) (*podman, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+	p := &podman{host: host}
+	dialer := &net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}
+	switch u.Scheme {
+	case "unix":
+		p.addr = "d"
+		p.dial = func(ctx context.Context) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", u.Path)
+		}
+	case "tcp", "http":
+		p.addr = u.Host
+		p.dial = func(ctx context.Context) (net.Conn, error) {
+			return dialer.DialContext(ctx, "tcp", u.Host)
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported podman host [%s]", host)
+	}
+	p.cli = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return p.dial(ctx)
+			},
+			MaxIdleConnsPerHost: 5,
+		},
+	}
+	return p, nil
+}
+
+type podmanError struct {
+	StatusCode int
+	Message    string `json:"message"`
+}
+
+func (e *podmanError) Error() string {
+	return e.Message
+}
+
+func isPodmanNotFound(err error) bool {
+	if e, ok := err.(*podmanError); ok {
+		return e.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+func (p *podman) url(path string, query url.Values) string {
+	u := url.URL{Scheme: "http", Host: p.addr, Path: fmt.Sprintf("/%s%s", podmanApiVersion, path), RawQuery: query.Encode()}
+	return u.String()
+}
+
+func (p *podman) newRequest(method, path string, query url.Values, body interface{}) (*http.Request, error) {
+	var r io.Reader
+	contentType := ""
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		r = b
+		contentType = "application/x-tar"
+	default:
+		buf, err := json.Marshal(b)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(buf)
+		contentType = "application/json"
+	}
+	req, err := http.NewRequest(method, p.url(path, query), r)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+// do sends the request and returns the response body, which the caller must
+// close. Any status code above 299 is turned into a *podmanError.
+func (p *podman) do(method, path string, query url.Values, body interface{}) (io.ReadCloser, error) {
+	req, err := p.newRequest(method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.cli.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		e := &podmanError{StatusCode: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(e); err != nil || e.Message == "" {
+			e.Message = fmt.Sprintf("podman responded with status code %d", resp.StatusCode)
+		}
+		return nil, e
+	}
+	return resp.Body, nil
+}
+
+// call is like do but decodes the JSON response into out when it's not nil.
+func (p *podman) call(method, path string, query url.Values, body, out interface{}) error {
+	rc, err := p.do(method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if out == nil {
+		_, err = io.Copy(ioutil.Discard, rc)
+		return err
+	}
+	return json.NewDecoder(rc).Decode(out)
+}
+
+func (p *podman) DaemonHost() string {
+	return p.host
+}
+
+func (p *podman) ContainerStats(name string) (io.ReadCloser, error) {
+	return p.do("GET", fmt.Sprintf("/containers/%s/stats", name), url.Values{"stream": {"false"}}, nil)
+}
+
+func (p *podman) ContainerResize(name string, rows, cols uint) error {
+	q := url.Values{"h": {fmt.Sprint(rows)}, "w": {fmt.Sprint(cols)}}
+	return p.call("POST", fmt.Sprintf("/libpod/containers/%s/resize", name), q, nil, nil)
+}
+
+func (p *podman) ContainerDelete(name string) error {
+	q := url.Values{"force": {"true"}, "v": {"true"}}
+	err := p.call("DELETE", fmt.Sprintf("/libpod/containers/%s", name), q, nil, nil)
+	if isPodmanNotFound(err) {
+		return fmt.Errorf("No such container: %s", name)
+	}
+	return err
+}
+
+type podmanNamedVolume struct {
+	Name string `json:"Name"`
+	Dest string `json:"Dest"`
+}
+
+type podmanNamespace struct {
+	NSMode string `json:"nsmode"`
+}
+
+type podmanSpec struct {
+	Name            string                       `json:"name"`
+	Hostname        string                       `json:"hostname"`
+	Image           string                       `json:"image"`
+	Env             map[string]string            `json:"env"`
+	Labels          map[string]string            `json:"labels,omitempty"`
+	Privileged      bool                         `json:"privileged"`
+	OCIRuntime      string                       `json:"oci_runtime,omitempty"`
+	Terminal        bool                         `json:"terminal"`
+	Stdin           bool                         `json:"stdin"`
+	Remove          bool                         `json:"remove"`
+	NetNS           podmanNamespace              `json:"netns"`
+	Networks        map[string]struct{}          `json:"Networks"`
+	Volumes         []podmanNamedVolume          `json:"volumes,omitempty"`
+	Resources       podmanResources              `json:"resource_limits"`
+	StorageOpts     map[string]string            `json:"storage_opts,omitempty"`
+	AppArmorProfile string                       `json:"apparmor_profile,omitempty"`
+	Devices         []podmanDevice               `json:"devices,omitempty"`
+	LogConfig       map[string]map[string]string `json:"log_configuration,omitempty"`
+}
+
+type podmanResources struct {
+	Pids struct {
+		Limit int64 `json:"limit"`
+	} `json:"pids"`
+	Memory struct {
+		Limit            int64 `json:"limit,omitempty"`
+		DisableOOMKiller bool  `json:"disableOOMKiller"`
+	} `json:"memory"`
+}
+
+type podmanDevice struct {
+	Path string `json:"path"`
+}
+
+func (p *podman) ContainerCreate(opts CreateContainerOpts) (err error) {
+	spec := podmanSpec{
+		Name:       opts.ContainerName,
+		Hostname:   opts.Hostname,
+		Image:      opts.Image,
+		Env:        map[string]string{},
+		Labels:     opts.Labels,
+		Privileged: opts.Privileged,
+		OCIRuntime: opts.Runtime,
+		Terminal:   true,
+		Stdin:      true,
+		Remove:     true,
+		NetNS:      podmanNamespace{NSMode: "bridge"},
+		Networks:   map[string]struct{}{},
+		LogConfig:  map[string]map[string]string{"options": {"max-size": "10m"}},
+	}
+
+	limits := SandboxLimits()
+	spec.Resources.Pids.Limit = limits.Pids
+	spec.Resources.Memory.Limit = limits.Memory
+	spec.Resources.Memory.DisableOOMKiller = true
+	if limits.StorageSize != "" {
+		spec.StorageOpts = map[string]string{"size": limits.StorageSize}
+	}
+	spec.AppArmorProfile = limits.AppArmorProfile
+	if config.UseGPU {
+		spec.Devices = append(spec.Devices, podmanDevice{Path: "nvidia.com/gpu=all"})
+	}
+
+	for _, e := range opts.Env() {
+		chunks := strings.SplitN(e, "=", 2)
+		if len(chunks) == 2 {
+			spec.Env[chunks[0]] = chunks[1]
+		}
+	}
+	for _, n := range opts.Networks {
+		spec.Networks[n] = struct{}{}
+	}
+	for _, m := range opts.Mounts {
+		spec.Volumes = append(spec.Volumes, podmanNamedVolume{Name: m.Source, Dest: m.Target})
+	}
+
+	// Plain unprivileged containers can't run a docker daemon, so they don't
+	// need a volume for it
+	if config.ExternalDindVolume && (opts.Privileged || opts.Runtime != "") {
+		if err = p.VolumeCreate(opts.ContainerName, "xfsvol", map[string]string{"size": opts.DindVolumeSize}, nil); err != nil {
+			return
+		}
+		spec.Volumes = append(spec.Volumes, podmanNamedVolume{Name: opts.ContainerName, Dest: "/var/lib/docker"})
+		defer func() {
+			if err != nil {
+				p.VolumeDelete(opts.ContainerName)
+			}
+		}()
+	}
+
+	if err = p.call("POST", "/libpod/containers/create", nil, spec, nil); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			p.ContainerDelete(opts.ContainerName)
+		}
+	}()
+
+	for name, content := range map[string][]byte{"cert.pem": opts.ServerCert, "key.pem": opts.ServerKey, "ca.pem": opts.CACert} {
+		if len(content) > 0 {
+			if err = p.CopyToContainer(opts.ContainerName, CertsDir, name, bytes.NewReader(content)); err != nil {
+				return
+			}
+		}
+	}
+
+	err = p.call("POST", fmt.Sprintf("/libpod/containers/%s/start", opts.ContainerName), nil, nil, nil)
+	return
+}
+
+type podmanInspect struct {
+	State struct {
+		Running bool `json:"Running"`
+	} `json:"State"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress string `json:"IPAddress"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+func (p *podman) ContainerRunning(name string) (bool, error) {
+	var ins podmanInspect
+	err := p.call("GET", fmt.Sprintf("/libpod/containers/%s/json", name), nil, nil, &ins)
+	if isPodmanNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return ins.State.Running, nil
+}
+
+func (p *podman) ContainerIPs(id string) (map[string]string, error) {
+	var ins podmanInspect
+	if err := p.call("GET", fmt.Sprintf("/libpod/containers/%s/json", id), nil, nil, &ins); err != nil {
+		return nil, err
+	}
+	ips := map[string]string{}
+	for networkId, conf := range ins.NetworkSettings.Networks {
+		ips[networkId] = conf.IPAddress
+	}
+	return ips, nil
+}
+
+type podmanExecConfig struct {
+	Cmd          []string `json:"Cmd"`
+	AttachStdout bool     `json:"AttachStdout"`
+	AttachStderr bool     `json:"AttachStderr"`
+	Tty          bool     `json:"Tty"`
+}
+
+type podmanExecStart struct {
+	Detach bool `json:"Detach"`
+	Tty    bool `json:"Tty"`
+}
+
+type podmanExecInspect struct {
+	Running  bool `json:"Running"`
+	ExitCode int  `json:"ExitCode"`
+}
+
+func (p *podman) exec(instanceName string, command []string, out io.Writer) (int, error) {
+	attach := out != nil
+	var e struct {
+		Id string `json:"Id"`
+	}
+	conf := podmanExecConfig{Cmd: command, AttachStdout: attach, AttachStderr: attach, Tty: attach}
+	if err := p.call("POST", fmt.Sprintf("/libpod/containers/%s/exec", instanceName), nil, conf, &e); err != nil {
+		return 0, err
+	}
+	rc, err := p.do("POST", fmt.Sprintf("/libpod/exec/%s/start", e.Id), nil, podmanExecStart{Detach: !attach, Tty: attach})
+	if err != nil {
+		return 0, err
+	}
+	if attach {
+		io.Copy(out, rc)
+	}
+	rc.Close()
+
+	var ins podmanExecInspect
+	for range time.Tick(1 * time.Second) {
+		if err := p.call("GET", fmt.Sprintf("/libpod/exec/%s/json", e.Id), nil, nil, &ins); err != nil {
+			return 0, err
+		}
+		if !ins.Running {
+			break
+		}
+	}
+	return ins.ExitCode, nil
+}
+
+func (p *podman) ExecAttach(instanceName string, command []string, out io.Writer) (int, error) {
+	return p.exec(instanceName, command, out)
+}
+
+func (p *podman) Exec(instanceName string, command []string) (int, error) {
+	return p.exec(instanceName, command, nil)
+}
+
+// hijackedConn reads through the buffer the HTTP response was parsed with, as
+// it may already hold the first bytes of the stream.
+type hijackedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *hijackedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (p *podman) CreateAttachConnection(name string) (net.Conn, error) {
+	q := url.Values{"stream": {"true"}, "stdin": {"true"}, "stdout": {"true"}, "stderr": {"true"}, "detachKeys": {"ctrl-^,ctrl-^"}}
+	req, err := p.newRequest("POST", fmt.Sprintf("/libpod/containers/%s/attach", name), q, nil)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := p.hijack(req)
+	if err != nil {
+		return nil, fmt.Errorf("Could not attach to container [%s]. Got: %v", name, err)
+	}
+	return conn, nil
+}
+
+// hijack sends req and takes over the connection for the stream that
+// follows the response.
+func (p *podman) hijack(req *http.Request) (net.Conn, error) {
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+
+	conn, err := p.dial(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	return &hijackedConn{Conn: conn, r: br}, nil
+}
+
+type podmanExecTerminalConfig struct {
+	Cmd          []string `json:"Cmd"`
+	AttachStdin  bool     `json:"AttachStdin"`
+	AttachStdout bool     `json:"AttachStdout"`
+	AttachStderr bool     `json:"AttachStderr"`
+	Tty          bool     `json:"Tty"`
+}
+
+func (p *podman) ExecTerminal(name string, command []string) (string, net.Conn, error) {
+	var e struct {
+		Id string `json:"Id"`
+	}
+	conf := podmanExecTerminalConfig{Cmd: command, AttachStdin: true, AttachStdout: true, AttachStderr: true, Tty: true}
+	if err := p.call("POST", fmt.Sprintf("/libpod/containers/%s/exec", name), nil, conf, &e); err != nil {
+		return "", nil, err
+	}
+	req, err := p.newRequest("POST", fmt.Sprintf("/libpod/exec/%s/start", e.Id), nil, podmanExecStart{Tty: true})
+	if err != nil {
+		return "", nil, err
+	}
+	conn, err := p.hijack(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("Could not start terminal in container [%s]. Got: %v", name, err)
+	}
+	return e.Id, conn, nil
+}
+
+func (p *podman) ExecResize(id string, rows, cols uint) error {
+	q := url.Values{"h": {fmt.Sprint(rows)}, "w": {fmt.Sprint(cols)}}
+	return p.call("POST", fmt.Sprintf("/libpod/exec/%s/resize", id), q, nil, nil)
+}
+
+func (p *podman) CopyToContainer(containerName, destination, fileName string, content io.Reader) error {
+	buf, err := Archive(fileName, content)
+	if err != nil {
+		return err
+	}
+	return p.call("PUT", fmt.Sprintf("/libpod/containers/%s/archive", containerName), url.Values{"path": {destination}}, buf, nil)
+}
+
+func (p *podman) CopyFromContainer(containerName, filePath string) (io.Reader, error) {
+	rc, err := p.do("GET", fmt.Sprintf("/libpod/containers/%s/archive", containerName), url.Values{"path": {filePath}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(rc)
+	// advance to the only possible file in the tar archive
+	h, err := tr.Next()
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	if h.Typeflag == tar.TypeDir {
+		rc.Close()
+		return nil, fmt.Errorf("Copying directories is not supported")
+	}
+	return tr, nil
+}
+
+// splitImageRef splits ref into its repository and tag, which is latest
+// when ref has none.
+func splitImageRef(ref string) (string, string) {
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, "latest"
+}
+
+func (p *podman) ContainerCommit(containerName, ref string) error {
+	repo, tag := splitImageRef(ref)
+	q := url.Values{"container": {containerName}, "repo": {repo}, "tag": {tag}, "pause": {"true"}}
+	return p.call("POST", "/libpod/commit", q, nil, nil)
+}
+
+func (p *podman) ImageRemove(ref string) error {
+	return p.call("DELETE", fmt.Sprintf("/libpod/images/%s", ref), nil, nil, nil)
+}
+
+func (p *podman) ImageSize(ref string) (int64, error) {
+	var ins struct {
+		Size int64 `json:"Size"`
+	}
+	if err := p.call("GET", fmt.Sprintf("/libpod/images/%s/json", ref), nil, nil, &ins); err != nil {
+		return 0, err
+	}
+	return ins.Size, nil
+}
+
+func (p *podman) ImageSave(ref string) (io.ReadCloser, error) {
+	return p.do("GET", fmt.Sprintf("/libpod/images/%s/get", ref), url.Values{"format": {"docker-archive"}}, nil)
+}
+
+func (p *podman) ImageLoad(content io.Reader) error {
+	return p.call("POST", "/libpod/images/load", nil, content, nil)
+}
+
+func (p *podman) VolumeCreate(name, driver string, driverOpts, labels map[string]string) error {
+	body := map[string]interface{}{"Name": name, "Driver": driver, "Options": driverOpts, "Label": labels}
+	return p.call("POST", "/libpod/volumes/create", nil, body, nil)
+}
+
+func (p *podman) VolumeDelete(name string) error {
+	return p.call("DELETE", fmt.Sprintf("/libpod/volumes/%s", name), nil, nil, nil)
+}
+
+func (p *podman) NetworkCreate(id string) error {
+	return p.call("POST", "/libpod/networks/create", nil, map[string]interface{}{"name": id, "driver": "bridge"}, nil)
+}
+
+func (p *podman) NetworkConnect(container, network, ip string) (string, error) {
+	body := map[string]interface{}{"container": container}
+	if ip != "" {
+		body["static_ips"] = []string{ip}
+	}
+	err := p.call("POST", fmt.Sprintf("/libpod/networks/%s/connect", network), nil, body, nil)
+	if err != nil && !strings.Contains(err.Error(), "already") {
+		return "", err
+	}
+
+	// Obtain the IP of the container in this network
+	ips, err := p.ContainerIPs(container)
+	if err != nil {
+		return "", err
+	}
+	if ip, found := ips[network]; found {
+		return ip, nil
+	}
+	return "", fmt.Errorf("Container [%s] connected to the network [%s] but couldn't obtain it's IP address", container, network)
+}
+
+func (p *podman) NetworkDisconnect(containerId, networkId string) error {
+	body := map[string]interface{}{"Container": containerId, "Force": true}
+	err := p.call("POST", fmt.Sprintf("/libpod/networks/%s/disconnect", networkId), nil, body, nil)
+	if isPodmanNotFound(err) {
+		return fmt.Errorf("container %s is not connected to the network %s", containerId, networkId)
+	}
+	return err
+}
+
+func (p *podman) NetworkDelete(id string) error {
+	err := p.call("DELETE", fmt.Sprintf("/libpod/networks/%s", id), nil, nil, nil)
+	if isPodmanNotFound(err) {
+		return fmt.Errorf("network %s not found", id)
+	}
+	return err
+}
@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPodmanContainerCreate(t *testing.T) {
+	var spec podmanSpec
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls = append(calls, req.Method+" "+req.URL.Path)
+		switch req.URL.Path {
+		case "/v4.0.0/libpod/containers/create":
+			json.NewDecoder(req.Body).Decode(&spec)
+			rw.WriteHeader(http.StatusCreated)
+			rw.Write([]byte(`{"Id":"abcd"}`))
+		case "/v4.0.0/libpod/containers/aaaabbbb_node1/archive":
+			assert.Equal(t, CertsDir, req.URL.Query().Get("path"))
+			rw.WriteHeader(http.StatusOK)
+		case "/v4.0.0/libpod/containers/aaaabbbb_node1/start":
+			rw.WriteHeader(http.StatusNoContent)
+		case "/v4.0.0/libpod/containers/aaaabbbb_node1/json":
+			rw.Write([]byte(`{"NetworkSettings":{"Networks":{"aaaabbbbcccc":{"IPAddress":"10.0.0.2"}}}}`))
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+			rw.Write([]byte(`{"cause":"no such container","message":"no container with name or ID found","response":404}`))
+		}
+	}))
+	defer srv.Close()
+
+	p, err := NewPodman(srv.URL)
+	assert.Nil(t, err)
+
+	os.Setenv("MAX_PROCESSES", "200")
+	os.Setenv("MAX_MEMORY_MB", "512")
+	os.Setenv("STORAGE_SIZE", "5G")
+	defer os.Unsetenv("MAX_PROCESSES")
+	defer os.Unsetenv("MAX_MEMORY_MB")
+	defer os.Unsetenv("STORAGE_SIZE")
+
+	err = p.ContainerCreate(CreateContainerOpts{
+		Image:         "franela/dind",
+		SessionId:     "aaaabbbbcccc",
+		ContainerName: "aaaabbbb_node1",
+		Hostname:      "node1",
+		ServerCert:    []byte("cert"),
+		Privileged:    true,
+		Networks:      []string{"aaaabbbbcccc"},
+		Mounts:        []types.Mount{{Source: "pwd-user-1", Target: "/root"}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"POST /v4.0.0/libpod/containers/create",
+		"PUT /v4.0.0/libpod/containers/aaaabbbb_node1/archive",
+		"POST /v4.0.0/libpod/containers/aaaabbbb_node1/start",
+	}, calls)
+	assert.Equal(t, "aaaabbbb_node1", spec.Name)
+	assert.True(t, spec.Privileged)
+	assert.Equal(t, "aaaabbbbcccc", spec.Env["SESSION_ID"])
+	assert.Equal(t, "true", spec.Env["DOCKER_TLSENABLE"])
+	assert.Contains(t, spec.Networks, "aaaabbbbcccc")
+	assert.Equal(t, []podmanNamedVolume{{Name: "pwd-user-1", Dest: "/root"}}, spec.Volumes)
+	assert.Equal(t, int64(200), spec.Resources.Pids.Limit)
+	assert.Equal(t, int64(512*Megabyte), spec.Resources.Memory.Limit)
+	assert.True(t, spec.Resources.Memory.DisableOOMKiller)
+	assert.Equal(t, map[string]string{"size": "5G"}, spec.StorageOpts)
+
+	ips, err := p.ContainerIPs("aaaabbbb_node1")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"aaaabbbbcccc": "10.0.0.2"}, ips)
+
+	err = p.ContainerDelete("aaaabbbb_node2")
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "No such container"))
+}
+
+func TestPodmanHost(t *testing.T) {
+	_, err := NewPodman("unix:///run/podman/podman.sock")
+	assert.Nil(t, err)
+
+	_, err = NewPodman("ssh://somewhere")
+	assert.NotNil(t, err)
+}
+
+func TestPodmanExec_InspectFails(t *testing.T) {
+	inspections := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v4.0.0/libpod/containers/aaaabbbb_node1/exec":
+			rw.WriteHeader(http.StatusCreated)
+			rw.Write([]byte(`{"Id":"exec1"}`))
+		case "/v4.0.0/libpod/exec/exec1/start":
+			rw.WriteHeader(http.StatusOK)
+		case "/v4.0.0/libpod/exec/exec1/json":
+			inspections++
+			if inspections == 1 {
+				rw.Write([]byte(`{"Running":true}`))
+				return
+			}
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(`{"message":"exec session is gone","response":500}`))
+		}
+	}))
+	defer srv.Close()
+
+	p, err := NewPodman(srv.URL)
+	assert.Nil(t, err)
+
+	_, err = p.Exec("aaaabbbb_node1", []string{"true"})
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, inspections)
+}
+
+func TestSplitImageRef(t *testing.T) {
+	repo, tag := splitImageRef("localhost:5000/pwd-snapshots/user1:snap1")
+	assert.Equal(t, "localhost:5000/pwd-snapshots/user1", repo)
+	assert.Equal(t, "snap1", tag)
+
+	repo, tag = splitImageRef("localhost:5000/pwd-snapshots")
+	assert.Equal(t, "localhost:5000/pwd-snapshots", repo)
+	assert.Equal(t, "latest", tag)
+}
@@ -21,8 +21,22 @@ var (
 type Handler func(id string, args ...interface{})
 type AnyHandler func(eventType EventType, id string, args ...interface{})
 
+// Subscription is returned when registering a handler. Unsubscribing stops
+// the handler from receiving further events, so anything registering
+// handlers for a limited time (like a websocket connection) must unsubscribe
+// when it is done. It is safe to unsubscribe more than once and from within
+// the handler itself.
+type Subscription interface {
+	Unsubscribe()
+}
+
 type EventApi interface {
 	Emit(name EventType, id string, args ...interface{})
-	On(name EventType, handler Handler)
-	OnAny(handler AnyHandler)
+	On(name EventType, handler Handler) Subscription
+	OnAny(handler AnyHandler) Subscription
+	// OnClient and OnAnyClient register handlers that serve a single
+	// client, like a websocket connection. Events are dropped for them when
+	// they fall behind, so a stalled client never holds up Emit.
+	OnClient(name EventType, handler Handler) Subscription
+	OnAnyClient(handler AnyHandler) Subscription
 }
@@ -1,47 +1,298 @@
 package event
 
-import "sync"
+import (
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// OverflowPolicy decides what happens when an event is emitted to a
+// subscriber whose queue is full.
+type OverflowPolicy string
+
+const (
+	// OverflowBlock makes Emit wait until the subscriber catches up.
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDropNewest discards the event being emitted.
+	OverflowDropNewest OverflowPolicy = "drop-newest"
+	// OverflowDropOldest discards the oldest event waiting in the queue.
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+)
+
+const DefaultQueueSize = 1024
+
+var (
+	queueDepthGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "event_queue_depth",
+		Help: "Events waiting to be delivered to subscribers",
+	})
+	subscribersGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "event_subscribers",
+		Help: "Event subscribers",
+	})
+	droppedCounterVec = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "event_dropped_total",
+		Help: "Events dropped because the queue of a subscriber was full",
+	}, []string{"event"})
+)
+
+func init() {
+	prometheus.MustRegister(queueDepthGauge)
+	prometheus.MustRegister(subscribersGauge)
+	prometheus.MustRegister(droppedCounterVec)
+}
+
+type delivery struct {
+	name EventType
+	id   string
+	args []interface{}
+}
+
+// subscriber owns a bounded queue of events and a goroutine that delivers
+// them to its handler in the order they were emitted. Slow subscribers only
+// delay their own events.
+type subscriber struct {
+	id         uint64
+	handler    Handler
+	anyHandler AnyHandler
+	size       int
+	policy     OverflowPolicy
+
+	mx     sync.Mutex
+	cond   *sync.Cond
+	queue  []delivery
+	closed bool
+}
+
+func newSubscriber(id uint64, size int, policy OverflowPolicy) *subscriber {
+	s := &subscriber{id: id, size: size, policy: policy}
+	s.cond = sync.NewCond(&s.mx)
+	subscribersGauge.Inc()
+	go s.run()
+	return s
+}
+
+func (s *subscriber) push(d delivery) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for !s.closed && len(s.queue) >= s.size {
+		switch s.policy {
+		case OverflowDropNewest:
+			droppedCounterVec.WithLabelValues(d.name.String()).Inc()
+			return
+		case OverflowDropOldest:
+			droppedCounterVec.WithLabelValues(s.queue[0].name.String()).Inc()
+			s.queue = s.queue[1:]
+			queueDepthGauge.Dec()
+		default:
+			s.cond.Wait()
+		}
+	}
+	if s.closed {
+		return
+	}
+	s.queue = append(s.queue, d)
+	queueDepthGauge.Inc()
+	s.cond.Broadcast()
+}
+
+func (s *subscriber) run() {
+	for {
+		s.mx.Lock()
+		for !s.closed && len(s.queue) == 0 {
+			s.cond.Wait()
+		}
+		if s.closed {
+			queueDepthGauge.Sub(float64(len(s.queue)))
+			s.queue = nil
+			s.mx.Unlock()
+			return
+		}
+		d := s.queue[0]
+		s.queue = s.queue[1:]
+		queueDepthGauge.Dec()
+		// Wake up emitters waiting for room in the queue
+		s.cond.Broadcast()
+		s.mx.Unlock()
+
+		if s.anyHandler != nil {
+			s.anyHandler(d.name, d.id, d.args...)
+		} else {
+			s.handler(d.id, d.args...)
+		}
+	}
+}
+
+func (s *subscriber) close() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	subscribersGauge.Dec()
+	s.cond.Broadcast()
+}
+
+func (s *subscriber) depth() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return len(s.queue)
+}
 
 type localBroker struct {
 	sync.Mutex
 
-	handlers    map[EventType][]Handler
-	anyHandlers []AnyHandler
+	size   int
+	policy OverflowPolicy
+
+	lastId      uint64
+	handlers    map[EventType][]*subscriber
+	anyHandlers []*subscriber
+}
+
+type subscription struct {
+	once   sync.Once
+	cancel func()
+}
+
+func (s *subscription) Unsubscribe() {
+	s.once.Do(s.cancel)
 }
 
 func NewLocalBroker() *localBroker {
-	return &localBroker{handlers: map[EventType][]Handler{}, anyHandlers: []AnyHandler{}}
+	b, _ := NewLocalBrokerWithQueue(DefaultQueueSize, OverflowBlock)
+	return b
 }
 
-func (b *localBroker) On(name EventType, handler Handler) {
+// NewLocalBrokerWithQueue returns a broker that queues up to size events for
+// each subscriber and applies policy when a queue is full.
+func NewLocalBrokerWithQueue(size int, policy OverflowPolicy) (*localBroker, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("Event queue size must be at least 1, got %d", size)
+	}
+	switch policy {
+	case OverflowBlock, OverflowDropNewest, OverflowDropOldest:
+	default:
+		return nil, fmt.Errorf("Unknown event overflow policy %q", policy)
+	}
+	return &localBroker{size: size, policy: policy, handlers: map[EventType][]*subscriber{}, anyHandlers: []*subscriber{}}, nil
+}
+
+func removeSubscriber(subs []*subscriber, id uint64) []*subscriber {
+	for n, s := range subs {
+		if s.id == id {
+			return append(subs[:n:n], subs[n+1:]...)
+		}
+	}
+	return subs
+}
+
+func (b *localBroker) On(name EventType, handler Handler) Subscription {
+	return b.on(name, handler, b.policy)
+}
+
+// OnClient drops the oldest events queued for handler when it falls behind,
+// whatever the overflow policy of the broker.
+func (b *localBroker) OnClient(name EventType, handler Handler) Subscription {
+	return b.on(name, handler, OverflowDropOldest)
+}
+
+func (b *localBroker) on(name EventType, handler Handler, policy OverflowPolicy) Subscription {
 	b.Lock()
 	defer b.Unlock()
 
-	if b.handlers[name] == nil {
-		b.handlers[name] = []Handler{}
-	}
-	b.handlers[name] = append(b.handlers[name], handler)
+	b.lastId++
+	s := newSubscriber(b.lastId, b.size, policy)
+	s.handler = handler
+	b.handlers[name] = append(b.handlers[name], s)
+
+	return &subscription{cancel: func() {
+		b.Lock()
+		b.handlers[name] = removeSubscriber(b.handlers[name], s.id)
+		if len(b.handlers[name]) == 0 {
+			delete(b.handlers, name)
+		}
+		b.Unlock()
+
+		s.close()
+	}}
+}
+
+func (b *localBroker) OnAny(handler AnyHandler) Subscription {
+	return b.onAny(handler, b.policy)
+}
+
+// OnAnyClient drops the oldest events queued for handler when it falls
+// behind, whatever the overflow policy of the broker.
+func (b *localBroker) OnAnyClient(handler AnyHandler) Subscription {
+	return b.onAny(handler, OverflowDropOldest)
+}
+
+func (b *localBroker) onAny(handler AnyHandler, policy OverflowPolicy) Subscription {
+	b.Lock()
+	defer b.Unlock()
+
+	b.lastId++
+	s := newSubscriber(b.lastId, b.size, policy)
+	s.anyHandler = handler
+	b.anyHandlers = append(b.anyHandlers, s)
+
+	return &subscription{cancel: func() {
+		b.Lock()
+		b.anyHandlers = removeSubscriber(b.anyHandlers, s.id)
+		b.Unlock()
+
+		s.close()
+	}}
 }
 
-func (b *localBroker) OnAny(handler AnyHandler) {
+// HandlerCount returns how many handlers are currently subscribed.
+func (b *localBroker) HandlerCount() int {
 	b.Lock()
 	defer b.Unlock()
 
-	b.anyHandlers = append(b.anyHandlers, handler)
+	count := len(b.anyHandlers)
+	for _, subs := range b.handlers {
+		count += len(subs)
+	}
+	return count
+}
+
+// QueueDepth returns how many events are waiting to be delivered across all
+// subscribers.
+func (b *localBroker) QueueDepth() int {
+	b.Lock()
+	subs := append([]*subscriber{}, b.anyHandlers...)
+	for _, s := range b.handlers {
+		subs = append(subs, s...)
+	}
+	b.Unlock()
+
+	depth := 0
+	for _, s := range subs {
+		depth += s.depth()
+	}
+	return depth
 }
 
+// Emit queues the event for every interested subscriber. Events emitted one
+// after the other are delivered to each subscriber in the same order.
 func (b *localBroker) Emit(name EventType, sessionId string, args ...interface{}) {
-	go func() {
-		b.Lock()
-		defer b.Unlock()
+	b.Lock()
+	anyHandlers := b.anyHandlers
+	handlers := b.handlers[name]
+	b.Unlock()
 
-		for _, handler := range b.anyHandlers {
-			handler(name, sessionId, args...)
-		}
-		if b.handlers[name] != nil {
-			for _, handler := range b.handlers[name] {
-				handler(sessionId, args...)
-			}
-		}
-	}()
+	d := delivery{name: name, id: sessionId, args: args}
+	for _, s := range anyHandlers {
+		s.push(d)
+	}
+	for _, s := range handlers {
+		s.push(d)
+	}
 }
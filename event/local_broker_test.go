@@ -3,6 +3,7 @@ package event
 import (
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -58,3 +59,254 @@ func TestLocalBroker_OnAny(t *testing.T) {
 	assert.Equal(t, "1", receivedSessionId)
 	assert.Equal(t, expectedArgs, receivedArgs)
 }
+
+func TestLocalBroker_Unsubscribe(t *testing.T) {
+	broker := NewLocalBroker()
+
+	called := 0
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+
+	sub := broker.On(INSTANCE_NEW, func(sessionId string, args ...interface{}) {
+		called++
+	})
+	anySub := broker.OnAny(func(eventType EventType, sessionId string, args ...interface{}) {
+		called++
+	})
+	broker.On(INSTANCE_NEW, func(sessionId string, args ...interface{}) {
+		wg.Done()
+	})
+	assert.Equal(t, 3, broker.HandlerCount())
+
+	sub.Unsubscribe()
+	anySub.Unsubscribe()
+	anySub.Unsubscribe()
+	assert.Equal(t, 1, broker.HandlerCount())
+
+	broker.Emit(INSTANCE_NEW, "1")
+	wg.Wait()
+
+	assert.Equal(t, 0, called)
+}
+
+func TestLocalBroker_UnsubscribeFromHandler(t *testing.T) {
+	broker := NewLocalBroker()
+
+	called := 0
+	unsubscribed := make(chan struct{})
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+
+	var sub Subscription
+	sub = broker.On(INSTANCE_NEW, func(sessionId string, args ...interface{}) {
+		called++
+		sub.Unsubscribe()
+		close(unsubscribed)
+	})
+	broker.On(INSTANCE_NEW, func(sessionId string, args ...interface{}) {
+		wg.Done()
+	})
+
+	broker.Emit(INSTANCE_NEW, "1")
+	<-unsubscribed
+	broker.Emit(INSTANCE_NEW, "2")
+	wg.Wait()
+
+	assert.Equal(t, 1, called)
+	assert.Equal(t, 1, broker.HandlerCount())
+}
+
+func TestLocalBroker_Ordered(t *testing.T) {
+	broker := NewLocalBroker()
+
+	received := []interface{}{}
+	wg := sync.WaitGroup{}
+	wg.Add(500)
+
+	broker.On(INSTANCE_STATS, func(sessionId string, args ...interface{}) {
+		received = append(received, args[0])
+		wg.Done()
+	})
+	expected := []interface{}{}
+	for i := 0; i < 500; i++ {
+		expected = append(expected, i)
+		broker.Emit(INSTANCE_STATS, "1", i)
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, expected, received)
+}
+
+func TestLocalBroker_SlowSubscriber(t *testing.T) {
+	broker := NewLocalBroker()
+
+	release := make(chan struct{})
+	wg := sync.WaitGroup{}
+	wg.Add(10)
+
+	broker.On(INSTANCE_STATS, func(sessionId string, args ...interface{}) {
+		<-release
+	})
+	broker.On(INSTANCE_STATS, func(sessionId string, args ...interface{}) {
+		wg.Done()
+	})
+	for i := 0; i < 10; i++ {
+		broker.Emit(INSTANCE_STATS, "1", i)
+	}
+
+	// The fast subscriber gets every event while the slow one is stuck
+	wg.Wait()
+	assert.True(t, broker.QueueDepth() >= 9)
+	close(release)
+}
+
+func TestLocalBroker_DropNewest(t *testing.T) {
+	broker, err := NewLocalBrokerWithQueue(2, OverflowDropNewest)
+	assert.Nil(t, err)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	received := []interface{}{}
+	wg := sync.WaitGroup{}
+	wg.Add(3)
+
+	broker.On(INSTANCE_STATS, func(sessionId string, args ...interface{}) {
+		if args[0] == 0 {
+			close(started)
+			<-release
+		}
+		received = append(received, args[0])
+		wg.Done()
+	})
+	broker.Emit(INSTANCE_STATS, "1", 0)
+	<-started
+	for i := 1; i < 5; i++ {
+		broker.Emit(INSTANCE_STATS, "1", i)
+	}
+	close(release)
+
+	wg.Wait()
+
+	assert.Equal(t, []interface{}{0, 1, 2}, received)
+}
+
+func TestLocalBroker_DropOldest(t *testing.T) {
+	broker, err := NewLocalBrokerWithQueue(2, OverflowDropOldest)
+	assert.Nil(t, err)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	received := []interface{}{}
+	wg := sync.WaitGroup{}
+	wg.Add(3)
+
+	broker.On(INSTANCE_STATS, func(sessionId string, args ...interface{}) {
+		if args[0] == 0 {
+			close(started)
+			<-release
+		}
+		received = append(received, args[0])
+		wg.Done()
+	})
+	broker.Emit(INSTANCE_STATS, "1", 0)
+	<-started
+	for i := 1; i < 5; i++ {
+		broker.Emit(INSTANCE_STATS, "1", i)
+	}
+	close(release)
+
+	wg.Wait()
+
+	assert.Equal(t, []interface{}{0, 3, 4}, received)
+}
+
+func TestLocalBroker_Block(t *testing.T) {
+	broker, err := NewLocalBrokerWithQueue(1, OverflowBlock)
+	assert.Nil(t, err)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	received := []interface{}{}
+	wg := sync.WaitGroup{}
+	wg.Add(3)
+
+	broker.On(INSTANCE_STATS, func(sessionId string, args ...interface{}) {
+		if args[0] == 0 {
+			close(started)
+			<-release
+		}
+		received = append(received, args[0])
+		wg.Done()
+	})
+	broker.Emit(INSTANCE_STATS, "1", 0)
+	<-started
+	broker.Emit(INSTANCE_STATS, "1", 1)
+
+	emitted := make(chan struct{})
+	go func() {
+		broker.Emit(INSTANCE_STATS, "1", 2)
+		close(emitted)
+	}()
+
+	select {
+	case <-emitted:
+		t.Fatal("Emit should block while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-emitted
+
+	wg.Wait()
+
+	assert.Equal(t, []interface{}{0, 1, 2}, received)
+}
+
+func TestLocalBroker_ClientNeverBlocks(t *testing.T) {
+	broker, err := NewLocalBrokerWithQueue(1, OverflowBlock)
+	assert.Nil(t, err)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	received := []interface{}{}
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+
+	broker.OnAnyClient(func(eventType EventType, sessionId string, args ...interface{}) {
+		if args[0] == 0 {
+			close(started)
+			<-release
+		}
+		received = append(received, args[0])
+		wg.Done()
+	})
+	broker.Emit(INSTANCE_STATS, "1", 0)
+	<-started
+
+	emitted := make(chan struct{})
+	go func() {
+		for i := 1; i < 5; i++ {
+			broker.Emit(INSTANCE_STATS, "1", i)
+		}
+		close(emitted)
+	}()
+
+	select {
+	case <-emitted:
+	case <-time.After(time.Second):
+		t.Fatal("Emit should not wait for a client that fell behind")
+	}
+	close(release)
+
+	wg.Wait()
+
+	assert.Equal(t, []interface{}{0, 4}, received)
+}
+
+func TestNewLocalBrokerWithQueue_Invalid(t *testing.T) {
+	_, err := NewLocalBrokerWithQueue(0, OverflowBlock)
+	assert.NotNil(t, err)
+
+	_, err = NewLocalBrokerWithQueue(10, OverflowPolicy("foo"))
+	assert.NotNil(t, err)
+}
@@ -6,14 +6,30 @@ type Mock struct {
 	M mock.Mock
 }
 
+type nopSubscription struct{}
+
+func (nopSubscription) Unsubscribe() {}
+
 func (m *Mock) Emit(name EventType, sessionId string, args ...interface{}) {
 	m.M.Called(name, sessionId, args)
 }
 
-func (m *Mock) On(name EventType, handler Handler) {
+func (m *Mock) On(name EventType, handler Handler) Subscription {
+	m.M.Called(name, handler)
+	return nopSubscription{}
+}
+
+func (m *Mock) OnAny(handler AnyHandler) Subscription {
+	m.M.Called(handler)
+	return nopSubscription{}
+}
+
+func (m *Mock) OnClient(name EventType, handler Handler) Subscription {
 	m.M.Called(name, handler)
+	return nopSubscription{}
 }
 
-func (m *Mock) OnAny(handler AnyHandler) {
+func (m *Mock) OnAnyClient(handler AnyHandler) Subscription {
 	m.M.Called(handler)
+	return nopSubscription{}
 }
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/play-with-docker/play-with-docker/pwd"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+)
+
+type contextKey string
+
+// tokenUserKey holds the user an API token of a request authenticated, in
+// the same shape as the id cookie so handlers don't tell them apart.
+const tokenUserKey contextKey = "tokenUser"
+
+// tokenKey holds the API token of a request once it was authenticated.
+const tokenKey contextKey = "token"
+
+type authenticatedToken struct {
+	token *types.APIToken
+	user  *types.User
+}
+
+type newAPITokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresIn is a duration like 720h. Tokens without one don't expire.
+	ExpiresIn string `json:"expires_in"`
+}
+
+type apiTokenResponse struct {
+	*types.APIToken
+	// Token is the value to authenticate with. It is only sent when the
+	// token is created.
+	Token string `json:"token,omitempty"`
+}
+
+func newAPITokenResponse(token *types.APIToken, value string) apiTokenResponse {
+	t := *token
+	t.Hash = ""
+	return apiTokenResponse{APIToken: &t, Token: value}
+}
+
+// bearerToken returns the token of the Authorization header of the request,
+// if it has one.
+func bearerToken(req *http.Request) string {
+	h := req.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(h[7:])
+}
+
+// authenticateToken authenticates the API token of the request, answering
+// the request when it isn't valid. Tokens are only looked up once per request.
+func authenticateToken(rw http.ResponseWriter, req *http.Request, value string) (*types.APIToken, *types.User, bool) {
+	if t, found := req.Context().Value(tokenKey).(*authenticatedToken); found {
+		return t.token, t.user, true
+	}
+	token, user, err := core.APITokenAuthenticate(value)
+	if err != nil {
+		var accessDenied *pwd.AccessDeniedError
+		if pwd.APITokenInvalid(err) {
+			rw.WriteHeader(http.StatusUnauthorized)
+		} else if errors.As(err, &accessDenied) {
+			rw.WriteHeader(http.StatusForbidden)
+		} else {
+			log.Printf("Could not authenticate API token. Got: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+		}
+		return nil, nil, false
+	}
+	return token, user, true
+}
+
+// tokenScope lets requests with an API token through to h as the user of the
+// token when the token has the given scope. Requests without one go through
+// untouched and are authenticated by their cookie. Routes that aren't
+// wrapped don't take tokens, and ignore the cookies of requests with one.
+func tokenScope(scope string, h http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		value := bearerToken(req)
+		if value == "" {
+			h(rw, req)
+			return
+		}
+
+		token, user, ok := authenticateToken(rw, req, value)
+		if !ok {
+			return
+		}
+		if !token.HasScope(scope) {
+			log.Printf("API token [%s] doesn't have scope [%s]\n", token.Id, scope)
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		cookie := &CookieID{Id: user.Id, UserName: user.Name, UserAvatar: user.Avatar, ProviderId: user.ProviderUserId}
+		h(rw, req.WithContext(context.WithValue(req.Context(), tokenUserKey, cookie)))
+	}
+}
+
+func NewAPIToken(rw http.ResponseWriter, req *http.Request) {
+	user := loggedInUser(rw, req)
+	if user == nil {
+		return
+	}
+
+	body := newAPITokenRequest{}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var expiresAt time.Time
+	if body.ExpiresIn != "" {
+		d, err := time.ParseDuration(body.ExpiresIn)
+		if err != nil || d <= 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		expiresAt = time.Now().Add(d)
+	}
+
+	token, value, err := core.APITokenNew(user, body.Name, body.Scopes, expiresAt)
+	if err != nil {
+		if pwd.APITokenInvalidScope(err) {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(newAPITokenResponse(token, value))
+}
+
+func ListAPITokens(rw http.ResponseWriter, req *http.Request) {
+	user := loggedInUser(rw, req)
+	if user == nil {
+		return
+	}
+
+	tokens, err := core.APITokenFindByUser(user.Id)
+	if err != nil {
+		log.Printf("Error listing API tokens of user %s. Got: %v\n", user.Id, err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]apiTokenResponse, len(tokens))
+	for i, t := range tokens {
+		resp[i] = newAPITokenResponse(t, "")
+	}
+	json.NewEncoder(rw).Encode(resp)
+}
+
+func DeleteAPIToken(rw http.ResponseWriter, req *http.Request) {
+	user := loggedInUser(rw, req)
+	if user == nil {
+		return
+	}
+	tokenId := mux.Vars(req)["tokenId"]
+
+	token, err := core.APITokenGet(tokenId)
+	if storage.NotFound(err) || (err == nil && token.UserId != user.Id) {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := core.APITokenDelete(token); err != nil {
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
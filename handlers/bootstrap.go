@@ -10,7 +10,6 @@ import (
 	"log"
 	"net/http"
 	"path"
-	"strings"
 	"time"
 
 	"golang.org/x/crypto/acme/autocert"
@@ -54,43 +53,56 @@ func Bootstrap(c pwd.PWDApi, ev event.EventApi) {
 }
 
 func Register(extend HandlerExtender) {
+	initLTITool()
 	initPlaygrounds()
 
 	r := mux.NewRouter()
 	corsRouter := mux.NewRouter()
 
-	corsHandler := gh.CORS(gh.AllowCredentials(), gh.AllowedHeaders([]string{"x-requested-with", "content-type"}), gh.AllowedMethods([]string{"GET", "POST", "HEAD", "DELETE"}), gh.AllowedOriginValidator(func(origin string) bool {
-		if strings.Contains(origin, "localhost") ||
-			strings.HasSuffix(origin, "docker.com") ||
-			strings.HasSuffix(origin, "ouankou.com") ||
-			strings.HasSuffix(origin, "racedetection.org") ||
-			strings.HasSuffix(origin, "freecompilercamp.org") {
-			return true
-		}
-		return false
-	}), gh.AllowedOrigins([]string{}))
+	// Only the allowed origins of the playground the request was made to may
+	// call it with the cookies of the user
+	corsHandler := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			gh.CORS(gh.AllowCredentials(), gh.AllowedHeaders([]string{"x-requested-with", "content-type", "authorization", csrfHeader, shareHeader}), gh.AllowedMethods([]string{"GET", "POST", "HEAD", "DELETE"}), gh.AllowedOriginValidator(func(origin string) bool {
+				return originAllowed(req, origin)
+			}), gh.AllowedOrigins([]string{}))(h).ServeHTTP(rw, req)
+		})
+	}
 
 	// Specific routes
 	// "examuploadcompile" and "examrun" endpoint added for closed-book exams in PWC
 	r.HandleFunc("/ping", Ping).Methods("GET")
 	corsRouter.HandleFunc("/instances/images", GetInstanceImages).Methods("GET")
-	corsRouter.HandleFunc("/sessions/{sessionId}", GetSession).Methods("GET")
-	corsRouter.HandleFunc("/sessions/{sessionId}/close", CloseSession).Methods("POST")
-	corsRouter.HandleFunc("/sessions/{sessionId}", CloseSession).Methods("DELETE")
-	corsRouter.HandleFunc("/sessions/{sessionId}/setup", SessionSetup).Methods("POST")
-	corsRouter.HandleFunc("/sessions/{sessionId}/instances", NewInstance).Methods("POST")
-	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}/uploads", FileUpload).Methods("POST")
-	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}/examuploadcompile", ExamUploadCompile).Methods("POST")
-	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}/examrun", ExamRun).Methods("POST")
-	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}", DeleteInstance).Methods("DELETE")
-	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}/exec", Exec).Methods("POST")
-	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}/fstree", fsTree).Methods("GET")
-	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}/file", file).Methods("GET")
+	corsRouter.HandleFunc("/sessions/{sessionId}", tokenScope(types.TokenScopeSessions, requireSession(accessObserver, GetSession))).Methods("GET")
+	corsRouter.HandleFunc("/sessions/{sessionId}/close", tokenScope(types.TokenScopeSessions, requireSession(accessCollaborator, CloseSession))).Methods("POST")
+	corsRouter.HandleFunc("/sessions/{sessionId}", tokenScope(types.TokenScopeSessions, requireSession(accessCollaborator, CloseSession))).Methods("DELETE")
+	corsRouter.HandleFunc("/sessions/{sessionId}/setup", tokenScope(types.TokenScopeSessions, requireSession(accessCollaborator, SessionSetup))).Methods("POST")
+	corsRouter.HandleFunc("/sessions/{sessionId}/instances", tokenScope(types.TokenScopeInstances, requireSession(accessCollaborator, NewInstance))).Methods("POST")
+	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}/uploads", tokenScope(types.TokenScopeUploads, requireSession(accessCollaborator, FileUpload))).Methods("POST")
+	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}/examuploadcompile", tokenScope(types.TokenScopeExams, requireSession(accessCollaborator, ExamUploadCompile))).Methods("POST")
+	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}/examrun", tokenScope(types.TokenScopeExams, requireSession(accessCollaborator, ExamRun))).Methods("POST")
+	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}", tokenScope(types.TokenScopeInstances, requireSession(accessCollaborator, DeleteInstance))).Methods("DELETE")
+	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}/exec", tokenScope(types.TokenScopeExec, requireSession(accessCollaborator, Exec))).Methods("POST")
+	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}/fstree", tokenScope(types.TokenScopeInstances, requireSession(accessCollaborator, fsTree))).Methods("GET")
+	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}/file", tokenScope(types.TokenScopeInstances, requireSession(accessCollaborator, file))).Methods("GET")
+	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}/snapshots", tokenScope(types.TokenScopeInstances, requireSession(accessCollaborator, InstanceSnapshot))).Methods("POST")
+	corsRouter.HandleFunc("/sessions/{sessionId}/claim", requireSession(accessOwner, ClaimSession)).Methods("POST")
+	corsRouter.HandleFunc("/sessions/{sessionId}/shares", requireSession(accessOwner, NewShare)).Methods("POST")
+	corsRouter.HandleFunc("/sessions/{sessionId}/shares", requireSession(accessOwner, ListShares)).Methods("GET")
+	corsRouter.HandleFunc("/sessions/{sessionId}/share", GetShare).Methods("GET")
+	corsRouter.HandleFunc("/sessions/{sessionId}/shares/{token}", requireSession(accessOwner, DeleteShare)).Methods("DELETE")
+	corsRouter.HandleFunc("/sessions/{sessionId}/recordings", requireSession(accessObserver, ListRecordings)).Methods("GET")
+	corsRouter.HandleFunc("/sessions/{sessionId}/recordings/{recordingId}", DownloadRecording).Methods("GET")
+	corsRouter.HandleFunc("/sessions/{sessionId}/recordings/{recordingId}", DeleteRecording).Methods("DELETE")
 
 	r.HandleFunc("/sessions/{sessionId}/instances/{instanceName}/editor", func(rw http.ResponseWriter, r *http.Request) {
 		http.ServeFile(rw, r, "www/editor.html")
 	})
 
+	r.HandleFunc("/sessions/{sessionId}/recordings/{recordingId}/replay", func(rw http.ResponseWriter, r *http.Request) {
+		http.ServeFile(rw, r, "www/replay.html")
+	}).Methods("GET")
+
 	r.HandleFunc("/ooc", func(rw http.ResponseWriter, r *http.Request) {
 		http.ServeFile(rw, r, "./www/ooc.html")
 	}).Methods("GET")
@@ -110,21 +122,51 @@ func Register(extend HandlerExtender) {
 	r.HandleFunc("/", Landing).Methods("GET")
 
 	corsRouter.HandleFunc("/users/me", LoggedInUser).Methods("GET")
+	corsRouter.HandleFunc("/users/me/usage", UserUsage).Methods("GET")
+	corsRouter.HandleFunc("/users/me/csrf", CSRFToken).Methods("GET")
+	corsRouter.HandleFunc("/users/me/logout", Logout).Methods("POST")
+	corsRouter.HandleFunc("/users/me/logins", ListLogins).Methods("GET")
+	corsRouter.HandleFunc("/users/me/logins", LogoutEverywhere).Methods("DELETE")
+	corsRouter.HandleFunc("/users/me/identities/{provider}/{providerUserId:.+}", UnlinkIdentity).Methods("DELETE")
+	corsRouter.HandleFunc("/users/me/tokens", ListAPITokens).Methods("GET")
+	corsRouter.HandleFunc("/users/me/tokens", NewAPIToken).Methods("POST")
+	corsRouter.HandleFunc("/users/me/tokens/{tokenId}", DeleteAPIToken).Methods("DELETE")
+	corsRouter.HandleFunc("/users/me/snapshots", ListSnapshots).Methods("GET")
+	corsRouter.HandleFunc("/users/me/snapshots/{snapshotId}", DeleteSnapshot).Methods("DELETE")
 	r.HandleFunc("/users/{userId:^(?me)}", GetUser).Methods("GET")
 	r.HandleFunc("/oauth/providers", ListProviders).Methods("GET")
 	r.HandleFunc("/oauth/providers/{provider}/login", Login).Methods("GET")
+	r.HandleFunc("/oauth/providers/{provider}/link", Login).Methods("GET").Name("link")
 	r.HandleFunc("/oauth/providers/{provider}/callback", LoginCallback).Methods("GET")
-	r.HandleFunc("/playgrounds", NewPlayground).Methods("PUT")
-	r.HandleFunc("/playgrounds", ListPlaygrounds).Methods("GET")
+	r.HandleFunc("/lti/login", LTILogin).Methods("GET", "POST")
+	r.HandleFunc("/lti/launch", LTILaunch).Methods("POST")
+	r.HandleFunc("/lti/jwks", LTIKeySet).Methods("GET")
+	r.HandleFunc("/playgrounds", requireRole(types.RoleAdmin, globalScope, NewPlayground)).Methods("PUT")
+	r.HandleFunc("/playgrounds", requireRole(types.RoleAdmin, globalScope, ListPlaygrounds)).Methods("GET")
+	r.HandleFunc("/commands", ListCommands).Methods("GET")
 	r.HandleFunc("/my/playground", GetCurrentPlayground).Methods("GET")
-
-	corsRouter.HandleFunc("/", NewSession).Methods("POST")
+	r.HandleFunc("/volumes", requireRole(types.RoleAdmin, globalScope, ListUserVolumes)).Methods("GET")
+	r.HandleFunc("/volumes/{volumeName}", requireRole(types.RoleAdmin, globalScope, DeleteUserVolume)).Methods("DELETE")
+	r.HandleFunc("/users/{userId}/roles", UserRoles).Methods("PUT", "DELETE")
+	r.HandleFunc("/users", requireRole(types.RoleAdmin, globalScope, ListUsers)).Methods("GET")
+	r.HandleFunc("/users/{userId}", requireRole(types.RoleAdmin, globalScope, DeleteUser)).Methods("DELETE")
+	r.HandleFunc("/users/{userId}/ban", requireRole(types.RoleAdmin, globalScope, BanUser)).Methods("POST")
+	r.HandleFunc("/users/{userId}/ban", requireRole(types.RoleAdmin, globalScope, UnbanUser)).Methods("DELETE")
+	r.HandleFunc("/users/{userId}/sessions", requireRole(types.RoleAdmin, globalScope, ListUserSessions)).Methods("GET")
+	r.HandleFunc("/users/{userId}/logins", requireRole(types.RoleAdmin, globalScope, RevokeUserLogins)).Methods("DELETE")
+	r.HandleFunc("/users/{userId}/impersonate", requireRole(types.RoleAdmin, globalScope, ImpersonateUser)).Methods("POST")
+	r.HandleFunc("/courses/{courseId}", requireRole(types.RoleInstructor, courseScope, GetCourse)).Methods("GET")
+	r.HandleFunc("/courses/{courseId}/sessions", requireRole(types.RoleInstructor, courseScope, ListCourseSessions)).Methods("GET")
+
+	corsRouter.HandleFunc("/", tokenScope(types.TokenScopeSessions, NewSession)).Methods("POST")
 
 	if extend != nil {
 		extend(corsRouter)
 	}
 
 	n := negroni.Classic()
+	n.UseFunc(rotateLogin)
+	n.UseFunc(protectForgery)
 
 	r.PathPrefix("/").Handler(negroni.New(negroni.Wrap(corsHandler(corsRouter))))
 	n.UseHandler(r)
@@ -199,6 +241,7 @@ func initPlaygrounds() {
 	for _, p := range pgs {
 		initAssets(p)
 		initOauthProviders(p)
+		initLTIPlatforms(p)
 	}
 }
 
@@ -268,4 +311,6 @@ func initOauthProviders(p *types.Playground) {
 
 		config.Providers[p.Id]["docker"] = conf
 	}
+
+	initOIDCProviders(p)
 }
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/play-with-docker/play-with-docker/pwd"
+	"github.com/play-with-docker/play-with-docker/storage"
+)
+
+// ClaimSession hands the anonymous session in the URL over to the logged in
+// user, so it shows up in their history and counts toward their quotas. Only
+// the browser that created the session can hand it over.
+func ClaimSession(rw http.ResponseWriter, req *http.Request) {
+	user := loggedInUser(rw, req)
+	if user == nil {
+		return
+	}
+	vars := mux.Vars(req)
+	sessionId := vars["sessionId"]
+
+	session, err := core.SessionGet(sessionId)
+	if storage.NotFound(err) {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := core.SessionClaim(session, user, requestCreatorSecret(req)); err != nil {
+		var accessDenied *pwd.AccessDeniedError
+		if errors.As(err, &accessDenied) {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if quotaExceeded(rw, err) {
+			return
+		}
+		if pwd.SessionClaimed(err) {
+			rw.WriteHeader(http.StatusConflict)
+			return
+		}
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	clearCreatorCookie(rw, req, session)
+
+	json.NewEncoder(rw).Encode(session)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+// ListCommands lets instructors search the commands students typed into
+// their terminals. Commands are looked up by session_id or user_id, and can
+// be narrowed down with both or with a case insensitive search for q. Only
+// commands typed in the courses or playgrounds the caller instructs are
+// listed.
+func ListCommands(rw http.ResponseWriter, req *http.Request) {
+	hasRole, err := requestRoles(req)
+	if err != nil {
+		rw.WriteHeader(accessDeniedStatus(err))
+		return
+	}
+
+	query := req.URL.Query()
+	sessionId := query.Get("session_id")
+	userId := query.Get("user_id")
+	q := strings.ToLower(query.Get("q"))
+
+	var commands []*types.Command
+	if userId != "" {
+		commands, err = core.CommandFindByUser(userId)
+	} else if sessionId != "" {
+		commands, err = core.CommandFindBySession(sessionId)
+	} else {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error listing commands. Got: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	found := []*types.Command{}
+	for _, c := range commands {
+		if sessionId != "" && c.SessionId != sessionId {
+			continue
+		}
+		if !hasRole(types.RoleInstructor, types.RoleScope{PlaygroundId: c.PlaygroundId, CourseId: c.CourseId}) {
+			continue
+		}
+		if q != "" && !strings.Contains(strings.ToLower(c.Line), q) {
+			continue
+		}
+		found = append(found, c)
+	}
+
+	json.NewEncoder(rw).Encode(found)
+}
@@ -1,16 +1,25 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
 )
 
+var loginMismatchError = errors.New("Cookie doesn't belong to the user of its login")
+var tokenNotAcceptedError = errors.New("API tokens are not accepted here")
+
 type CookieID struct {
 	Id         string `json:"id"`
 	UserName   string `json:"user_name"`
 	UserAvatar string `json:"user_avatar"`
 	ProviderId string `json:"provider_id"`
+	// LoginId is the login session the cookie belongs to.
+	LoginId string `json:"login_id"`
+	// ImpersonatedBy is the admin that logged in as the user, if any.
+	ImpersonatedBy string `json:"impersonated_by,omitempty"`
 }
 
 func (c *CookieID) SetCookie(rw http.ResponseWriter, host string) error {
@@ -20,6 +29,7 @@ func (c *CookieID) SetCookie(rw http.ResponseWriter, host string) error {
 			Value:    encoded,
 			Domain:   host,
 			Path:     "/",
+			MaxAge:   int(config.LoginSessionTTL.Seconds()),
 			SameSite: http.SameSiteNoneMode,
 			Secure:   config.UseLetsEncrypt,
 			HttpOnly: true,
@@ -30,15 +40,63 @@ func (c *CookieID) SetCookie(rw http.ResponseWriter, host string) error {
 	}
 	return nil
 }
+
+// clearCookie removes the id cookie, and the CSRF token that goes with it,
+// from the browser.
+func clearCookie(rw http.ResponseWriter, host string) {
+	http.SetCookie(rw, &http.Cookie{
+		Name:     "id",
+		Domain:   host,
+		Path:     "/",
+		MaxAge:   -1,
+		SameSite: http.SameSiteNoneMode,
+		Secure:   config.UseLetsEncrypt,
+		HttpOnly: true,
+	})
+	http.SetCookie(rw, &http.Cookie{
+		Name:     csrfField,
+		Path:     "/",
+		MaxAge:   -1,
+		SameSite: http.SameSiteNoneMode,
+		Secure:   config.UseLetsEncrypt,
+	})
+	clearDomainCSRFCookie(rw, host)
+}
+
+// ReadCookie returns the id cookie of the request, or the user of its API
+// token when a route that takes tokens authenticated one.
 func ReadCookie(r *http.Request) (*CookieID, error) {
-	if cookie, err := r.Cookie("id"); err == nil {
-		value := &CookieID{}
-		if err = config.SecureCookie.Decode("id", cookie.Value, &value); err == nil {
-			return value, nil
-		} else {
-			return nil, err
-		}
-	} else {
-		return nil, err
+	if value, found := r.Context().Value(tokenUserKey).(*CookieID); found {
+		return value, nil
+	}
+	value, _, err := readLogin(r)
+	return value, err
+}
+
+// readLogin returns the id cookie of the request and the login session it
+// belongs to. Cookies of logins that ended or expired are refused, and so are
+// the cookies of requests with an API token, which are only authenticated by
+// the token on the routes that take one.
+func readLogin(r *http.Request) (*CookieID, *types.LoginSession, error) {
+	if bearerToken(r) != "" {
+		return nil, nil, tokenNotAcceptedError
+	}
+	cookie, err := r.Cookie("id")
+	if err != nil {
+		return nil, nil, err
+	}
+	value := &CookieID{}
+	if err := config.SecureCookie.Decode("id", cookie.Value, &value); err != nil {
+		return nil, nil, err
+	}
+
+	loginSession, err := core.LoginSessionGet(value.LoginId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if loginSession.UserId != value.Id {
+		return nil, nil, loginMismatchError
 	}
+	value.ImpersonatedBy = loginSession.ImpersonatedBy
+	return value, loginSession, nil
 }
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/play-with-docker/play-with-docker/config"
+)
+
+// Requests that change something while logged in with a cookie have to send
+// the CSRF token of their login in this header, or in the csrf_token field
+// of a form. The browser keeps a readable copy of the token in the
+// csrf_token cookie for pages of the playground, other allowed origins get
+// it from /users/me/csrf.
+const csrfHeader = "X-CSRF-Token"
+const csrfField = "csrf_token"
+
+// originAllowed tells whether pages from the origin may call the playground
+// the request was made to.
+func originAllowed(req *http.Request, origin string) bool {
+	playground := core.PlaygroundFindByDomain(req.Host)
+	if playground == nil {
+		return false
+	}
+	return playground.AllowsOrigin(origin)
+}
+
+// checkWSOrigin only lets pages from the allowed origins of the playground
+// open websockets, which browsers open with the cookies of the user.
+func checkWSOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	return origin == "" || originAllowed(req, origin)
+}
+
+func safeMethod(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "OPTIONS"
+}
+
+// protectForgery refuses requests that change something when they come from
+// a page of an origin the playground doesn't allow, or carry a login cookie
+// without the CSRF token of the login. Requests with a valid API token don't
+// rely on cookies, since cookies aren't looked at when there is a token, and
+// LTI launches are posted by the platform, checked against its keys and
+// only accepted from the browser that started them.
+func protectForgery(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	if safeMethod(req.Method) || strings.HasPrefix(req.URL.Path, ltiPath) {
+		next(rw, req)
+		return
+	}
+	if origin := req.Header.Get("Origin"); origin != "" && !originAllowed(req, origin) {
+		log.Printf("Refusing %s %s from origin %s\n", req.Method, req.URL.Path, origin)
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if value := bearerToken(req); value != "" {
+		token, user, ok := authenticateToken(rw, req, value)
+		if !ok {
+			return
+		}
+		next(rw, req.WithContext(context.WithValue(req.Context(), tokenKey, &authenticatedToken{token: token, user: user})))
+		return
+	}
+	if _, loginSession, err := readLogin(req); err == nil {
+		token := requestCSRFToken(req)
+		if loginSession.CSRFToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(loginSession.CSRFToken)) != 1 {
+			log.Printf("Refusing %s %s of user [%s] without a valid CSRF token\n", req.Method, req.URL.Path, loginSession.UserId)
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+	}
+	next(rw, req)
+}
+
+// requestCSRFToken returns the CSRF token sent with the request. Only url
+// encoded forms are looked into, so uploads are left for the handlers to
+// read.
+func requestCSRFToken(req *http.Request) string {
+	if token := req.Header.Get(csrfHeader); token != "" {
+		return token
+	}
+	if mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediaType == "application/x-www-form-urlencoded" {
+		if err := req.ParseForm(); err == nil {
+			return req.PostForm.Get(csrfField)
+		}
+	}
+	return ""
+}
+
+// setCSRFCookie hands the CSRF token of the login to the pages of the
+// playground. Unlike the login cookie, scripts can read it, so it is only
+// sent to the host of the playground and not to the hosts of instances,
+// which serve whatever users run in them.
+func setCSRFCookie(rw http.ResponseWriter, domain, token string) {
+	clearDomainCSRFCookie(rw, domain)
+	http.SetCookie(rw, &http.Cookie{
+		Name:     csrfField,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(config.LoginSessionTTL.Seconds()),
+		SameSite: http.SameSiteNoneMode,
+		Secure:   config.UseLetsEncrypt,
+	})
+}
+
+// clearDomainCSRFCookie removes the copy of the CSRF token that used to be
+// set for the whole cookie domain.
+func clearDomainCSRFCookie(rw http.ResponseWriter, domain string) {
+	http.SetCookie(rw, &http.Cookie{
+		Name:     csrfField,
+		Domain:   domain,
+		Path:     "/",
+		MaxAge:   -1,
+		SameSite: http.SameSiteNoneMode,
+		Secure:   config.UseLetsEncrypt,
+	})
+}
+
+// CSRFToken returns the CSRF token of the login the request was made with.
+func CSRFToken(rw http.ResponseWriter, req *http.Request) {
+	_, loginSession, err := readLogin(req)
+	if err != nil {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(map[string]string{"token": loginSession.CSRFToken})
+}
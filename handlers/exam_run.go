@@ -3,6 +3,8 @@
 * It does the following:
 *   - Checks to make sure that the exam has already been uploaded AND compiled.
 *   - Runs the make check target in the corresponding Makefile.
+*   - Has the submission graded and posts the score to the LMS when the
+*     session was launched for the exam.
 */
 
 package handlers
@@ -100,6 +102,14 @@ func ExamRun(rw http.ResponseWriter, req *http.Request) {
     return
   }
 
+  // Step 3: Sessions launched from a course for this exam post the score
+  // back to the course gradebook. The output of make check comes from the
+  // instance of the student, so the submission is graded by the grader
+  // instead.
+  if s.LineItem != "" && s.Exam == examName {
+    go gradeExam(s)
+  }
+
   rw.WriteHeader(http.StatusOK)
   return
 
@@ -2,6 +2,8 @@
 * Specialized version of file_upload that is intended to upload code.
 * It does the following:
 *   - Uploads the code to the instance via the multipart form data
+*   - Keeps a copy of the code for the grader when the session was launched
+*     for the exam
 *   - Compiles the code
 * HTTP Response back contains the compilation status (success or fail), and
 * any errors if fail.
@@ -11,8 +13,10 @@
 package handlers
 
 import (
+  "bytes"
   "strings"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
   "encoding/json"
@@ -93,6 +97,11 @@ func ExamUploadCompile(rw http.ResponseWriter, req *http.Request) {
 	}
 	path := req.URL.Query().Get("path") + "/exams/" + examName
 
+  // Sessions launched from a course for this exam keep a copy of the
+  // submission for the grader, as the copy in the instance can be changed.
+  graded := s.LineItem != "" && s.Exam == examName
+  submission := map[string][]byte{}
+
 	for {
 		p, err := red.NextPart()
 		if err == io.EOF {
@@ -106,7 +115,18 @@ func ExamUploadCompile(rw http.ResponseWriter, req *http.Request) {
 		if p.FileName() == "" {
 			continue
 		}
-		err = core.InstanceUploadFromReader(i, p.FileName(), path, p)
+		var r io.Reader = p
+		if graded {
+			content, err := ioutil.ReadAll(p)
+			if err != nil {
+				log.Println(err)
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			submission[p.FileName()] = content
+			r = bytes.NewReader(content)
+		}
+		err = core.InstanceUploadFromReader(i, p.FileName(), path, r)
 		if err != nil {
 			log.Println(err)
 			rw.WriteHeader(http.StatusInternalServerError)
@@ -116,6 +136,14 @@ func ExamUploadCompile(rw http.ResponseWriter, req *http.Request) {
 		log.Printf("Uploaded [%s] to [%s]\n", p.FileName(), i.Name)
   }
 
+  if graded {
+    if err := core.ExamSubmit(s, examName, submission); err != nil {
+      log.Println(err)
+      rw.WriteHeader(http.StatusInternalServerError)
+      return
+    }
+  }
+
   // Step 2: Compile via make
 
   var makeCmd = fmt.Sprintf(`{ "command": ["make", "-B", "-C", "%s"] }`, path)
@@ -1,20 +1,24 @@
 package handlers
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/oauth2"
 
 	"github.com/google/go-github/github"
 	"github.com/gorilla/mux"
 	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/oidc"
+	"github.com/play-with-docker/play-with-docker/pwd"
 	"github.com/play-with-docker/play-with-docker/pwd/types"
-	uuid "github.com/satori/go.uuid"
 	"google.golang.org/api/people/v1"
 )
 
@@ -34,6 +38,23 @@ func LoggedInUser(rw http.ResponseWriter, req *http.Request) {
 	json.NewEncoder(rw).Encode(user)
 }
 
+// loggedInUser returns the user that made the request, answering with 401
+// when there is none.
+func loggedInUser(rw http.ResponseWriter, req *http.Request) *types.User {
+	cookie, err := ReadCookie(req)
+	if err != nil {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+	user, err := core.UserGet(cookie.Id)
+	if err != nil {
+		log.Printf("Couldn't get user with id %s. Got: %v\n", cookie.Id, err)
+		rw.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+	return user
+}
+
 func ListProviders(rw http.ResponseWriter, req *http.Request) {
 	playground := core.PlaygroundFindByDomain(req.Host)
 	if playground == nil {
@@ -49,6 +70,8 @@ func ListProviders(rw http.ResponseWriter, req *http.Request) {
 	json.NewEncoder(rw).Encode(providers)
 }
 
+// Login sends the user to log in with the provider. On the link route the
+// logged in user is sent to link their account with the provider instead.
 func Login(rw http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	providerName := vars["provider"]
@@ -66,7 +89,17 @@ func Login(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	loginRequest, err := core.UserNewLoginRequest(providerName)
+	var loginRequest *types.LoginRequest
+	var err error
+	if mux.CurrentRoute(req).GetName() == "link" {
+		user := loggedInUser(rw, req)
+		if user == nil {
+			return
+		}
+		loginRequest, err = core.UserNewLinkRequest(providerName, user)
+	} else {
+		loginRequest, err = core.UserNewLoginRequest(providerName)
+	}
 	if err != nil {
 		log.Printf("Could not start a new user login request for provider %s. Got: %v\n", providerName, err)
 		rw.WriteHeader(http.StatusInternalServerError)
@@ -82,7 +115,8 @@ func Login(rw http.ResponseWriter, req *http.Request) {
 		host = req.Host
 	}
 	provider.RedirectURL = fmt.Sprintf("%s://%s/oauth/providers/%s/callback", scheme, host, providerName)
-	url := provider.AuthCodeURL(loginRequest.Id, oauth2.SetAuthURLParam("nonce", uuid.NewV4().String()))
+	url := provider.AuthCodeURL(loginRequest.Id, oauth2.SetAuthURLParam("nonce", loginRequest.Nonce))
+	setLoginRequestCookie(rw, oauthPath, loginRequest.Id)
 
 	http.Redirect(rw, req, url, http.StatusFound)
 }
@@ -109,12 +143,28 @@ func LoginCallback(rw http.ResponseWriter, req *http.Request) {
 	code := query.Get("code")
 	loginRequestId := query.Get("state")
 
+	// Only the browser that started the login can finish it, so nobody can
+	// have someone else log in as them or link to their account
+	if !loginRequestStartedBy(req, loginRequestId) {
+		log.Printf("Refusing login request %s for provider %s from another browser\n", loginRequestId, providerName)
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+	clearLoginRequestCookie(rw, oauthPath)
+
 	loginRequest, err := core.UserGetLoginRequest(loginRequestId)
 	if err != nil {
 		log.Printf("Could not get login request %s for provider %s. Got: %v\n", loginRequestId, providerName, err)
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if loginRequest.LinkUserId != "" {
+		if cookie, _, err := readLogin(req); err != nil || cookie.Id != loginRequest.LinkUserId {
+			log.Printf("Refusing to link an identity of provider %s to user [%s] without their login\n", providerName, loginRequest.LinkUserId)
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+	}
 
 	ctx := req.Context()
 	tok, err := provider.Exchange(ctx, code)
@@ -140,7 +190,13 @@ func LoginCallback(rw http.ResponseWriter, req *http.Request) {
 		user.ProviderUserId = strconv.Itoa(u.GetID())
 		user.Name = u.GetName()
 		user.Avatar = u.GetAvatarURL()
-		user.Email = u.GetEmail()
+		emails, _, err := client.Users.ListEmails(ctx, nil)
+		if err != nil {
+			log.Printf("Could not get emails from github. Got: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		user.Email, user.EmailVerified = githubEmail(u.GetEmail(), emails)
 	} else if providerName == "google" {
 		ts := oauth2.StaticTokenSource(
 			&oauth2.Token{AccessToken: tok.AccessToken},
@@ -163,6 +219,9 @@ func LoginCallback(rw http.ResponseWriter, req *http.Request) {
 		}
 
 		user.Email = person.EmailAddresses[0].Value
+		if m := person.EmailAddresses[0].Metadata; m != nil {
+			user.EmailVerified = m.Verified
+		}
 		user.Name = person.Names[0].GivenName
 		user.ProviderUserId = person.ResourceName
 
@@ -193,25 +252,36 @@ func LoginCallback(rw http.ResponseWriter, req *http.Request) {
 		// Since DockerID doesn't return a user avatar, we try with twitter through avatars.io
 		// Worst case we get a generic avatar
 		user.Avatar = fmt.Sprintf("https://avatars.io/twitter/%s", user.Name)
+	} else if l, found := getOIDCLogin(playground.Id, providerName); found {
+		user, err = l.user(ctx, tok, loginRequest.Nonce)
+		if err != nil {
+			log.Printf("Could not get user from provider %s. Got: %v\n", providerName, err)
+			if oidc.InvalidToken(err) {
+				rw.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
 	}
 
 	user, err = core.UserLogin(loginRequest, user)
 	if err != nil {
 		log.Printf("Could not login user. Got: %v\n", err)
+		var accessDenied *pwd.AccessDeniedError
+		if errors.As(err, &accessDenied) {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if pwd.IdentityLinked(err) {
+			rw.WriteHeader(http.StatusConflict)
+			return
+		}
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	cookieData := CookieID{Id: user.Id, UserName: user.Name, UserAvatar: user.Avatar, ProviderId: user.ProviderUserId}
-
-	host := "localhost"
-	if req.Host != "" {
-		// we get the parent domain so cookie is set
-		// in all subdomain and siblings
-		host = getParentDomain(req.Host)
-	}
-
-	if err := cookieData.SetCookie(rw, host); err != nil {
+	if err := setUserCookie(rw, req, user); err != nil {
 		log.Printf("Could not encode cookie. Got: %v\n", err)
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
@@ -239,6 +309,95 @@ func LoginCallback(rw http.ResponseWriter, req *http.Request) {
 </html>`, r)
 }
 
+// The login request a browser started is kept in this cookie, for the
+// routes under path, until the provider sends the user back.
+const loginRequestCookie = "login_request"
+
+// oauthPath is where the routes of logins with a provider are.
+const oauthPath = "/oauth/providers/"
+
+// How long users have to log in with the provider.
+const loginRequestTTL = 10 * time.Minute
+
+func setLoginRequestCookie(rw http.ResponseWriter, path, id string) {
+	http.SetCookie(rw, &http.Cookie{
+		Name:     loginRequestCookie,
+		Value:    id,
+		Path:     path,
+		MaxAge:   int(loginRequestTTL.Seconds()),
+		SameSite: http.SameSiteNoneMode,
+		Secure:   config.UseLetsEncrypt,
+		HttpOnly: true,
+	})
+}
+
+func clearLoginRequestCookie(rw http.ResponseWriter, path string) {
+	http.SetCookie(rw, &http.Cookie{
+		Name:     loginRequestCookie,
+		Path:     path,
+		MaxAge:   -1,
+		SameSite: http.SameSiteNoneMode,
+		Secure:   config.UseLetsEncrypt,
+		HttpOnly: true,
+	})
+}
+
+// loginRequestStartedBy tells whether the browser that made the request
+// started the login request with the id.
+func loginRequestStartedBy(req *http.Request, id string) bool {
+	cookie, err := req.Cookie(loginRequestCookie)
+	return err == nil && id != "" && subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(id)) == 1
+}
+
+// githubEmail returns the email of a GitHub user and whether GitHub verified
+// it. The public email is preferred over the primary one.
+func githubEmail(public string, emails []*github.UserEmail) (string, bool) {
+	var primary *github.UserEmail
+	for _, e := range emails {
+		if public != "" && strings.EqualFold(e.GetEmail(), public) {
+			return e.GetEmail(), e.GetVerified()
+		}
+		if e.GetPrimary() {
+			primary = e
+		}
+	}
+	if primary != nil {
+		return primary.GetEmail(), primary.GetVerified()
+	}
+	return public, false
+}
+
+// setUserCookie logs the user in on the playground and all its siblings.
+func setUserCookie(rw http.ResponseWriter, req *http.Request, user *types.User) error {
+	return setLoginCookie(rw, req, user, "")
+}
+
+// setLoginCookie starts a login session for the user and sets the cookie
+// that points to it. impersonatedBy is the admin logging in as the user, if
+// any.
+func setLoginCookie(rw http.ResponseWriter, req *http.Request, user *types.User, impersonatedBy string) error {
+	loginSession, err := core.LoginSessionNew(user, impersonatedBy, req.UserAgent())
+	if err != nil {
+		return err
+	}
+	cookieData := CookieID{Id: user.Id, UserName: user.Name, UserAvatar: user.Avatar, ProviderId: user.ProviderUserId, LoginId: loginSession.Id, ImpersonatedBy: impersonatedBy}
+	if err := cookieData.SetCookie(rw, cookieDomain(req)); err != nil {
+		return err
+	}
+	setCSRFCookie(rw, cookieDomain(req), loginSession.CSRFToken)
+	return nil
+}
+
+// cookieDomain is the domain login cookies are set for.
+func cookieDomain(req *http.Request) string {
+	if req.Host == "" {
+		return "localhost"
+	}
+	// we get the parent domain so cookie is set
+	// in all subdomain and siblings
+	return getParentDomain(req.Host)
+}
+
 // getParentDomain returns the parent domain (if available)
 // of the currend domain
 func getParentDomain(host string) string {
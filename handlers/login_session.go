@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+// rotateLogin gives the browser a new login cookie when the one it sent is
+// due for rotation. Websocket upgrades are skipped since the cookie set on
+// them never reaches the browser.
+func rotateLogin(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	if !websocket.IsWebSocketUpgrade(req) {
+		if cookie, loginSession, err := readLogin(req); err == nil && loginSession.RotationDue(config.LoginSessionRotation, time.Now()) {
+			if rotated, err := core.LoginSessionRotate(loginSession); err != nil {
+				log.Printf("Could not rotate login session of user [%s]. Got: %v\n", loginSession.UserId, err)
+			} else {
+				cookie.LoginId = rotated.Id
+				if err := cookie.SetCookie(rw, cookieDomain(req)); err != nil {
+					log.Printf("Could not encode cookie. Got: %v\n", err)
+				}
+			}
+		}
+	}
+	next(rw, req)
+}
+
+// Logout ends the login the request was made with.
+func Logout(rw http.ResponseWriter, req *http.Request) {
+	_, loginSession, err := readLogin(req)
+	if err == nil {
+		if err := core.LoginSessionDelete(loginSession); err != nil {
+			log.Println(err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	clearCookie(rw, cookieDomain(req))
+}
+
+// ListLogins lists where the logged in user is logged in.
+func ListLogins(rw http.ResponseWriter, req *http.Request) {
+	user := loggedInUser(rw, req)
+	if user == nil {
+		return
+	}
+
+	loginSessions, err := core.LoginSessionFindByUser(user.Id)
+	if err != nil {
+		log.Printf("Error listing logins of user %s. Got: %v\n", user.Id, err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(loginSessionsResponse(loginSessions))
+}
+
+// LogoutEverywhere ends all the logins of the logged in user.
+func LogoutEverywhere(rw http.ResponseWriter, req *http.Request) {
+	user := loggedInUser(rw, req)
+	if user == nil {
+		return
+	}
+
+	if err := core.LoginSessionRevokeUser(user.Id); err != nil {
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	clearCookie(rw, cookieDomain(req))
+}
+
+// RevokeUserLogins lets admins log the user in the URL out everywhere.
+func RevokeUserLogins(rw http.ResponseWriter, req *http.Request) {
+	user := adminUser(rw, req)
+	if user == nil {
+		return
+	}
+
+	if err := core.LoginSessionRevokeUser(user.Id); err != nil {
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// loginSessionsResponse hides the ids and CSRF tokens of the logins, since
+// they are as good as the cookies that point to them.
+func loginSessionsResponse(loginSessions []*types.LoginSession) []types.LoginSession {
+	resp := make([]types.LoginSession, len(loginSessions))
+	for i, l := range loginSessions {
+		resp[i] = *l
+		resp[i].Id = ""
+		resp[i].CSRFToken = ""
+	}
+	return resp
+}
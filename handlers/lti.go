@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/lti"
+	"github.com/play-with-docker/play-with-docker/provisioner"
+	"github.com/play-with-docker/play-with-docker/pwd"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+// Users launched from a platform log in with the provider of the platform.
+const ltiProviderPrefix = "lti:"
+
+// ltiPath is where the LTI routes are.
+const ltiPath = "/lti/"
+
+// How long posting a score to a platform may take.
+const ltiScoreTimeout = 30 * time.Second
+
+var ltiTool *lti.Tool
+
+var (
+	ltiMx        sync.Mutex
+	ltiPlatforms = map[string]map[string]*lti.Platform{}
+)
+
+// initLTITool loads the key the playground signs with as an LTI tool. Without
+// a configured key one is generated, which platforms have to fetch again
+// every time the server restarts.
+func initLTITool() {
+	if config.LTIKeyPath != "" {
+		tool, err := lti.LoadTool(config.LTIKeyPath)
+		if err != nil {
+			log.Fatalf("Could not load LTI tool key from %s. Got: %v", config.LTIKeyPath, err)
+		}
+		ltiTool = tool
+		return
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("Could not generate LTI tool key. Got: %v", err)
+	}
+	ltiTool = lti.NewTool(key)
+}
+
+func initLTIPlatforms(p *types.Playground) {
+	platforms := map[string]*lti.Platform{}
+	for _, c := range p.LTIPlatforms {
+		if c.Name == "" || c.Issuer == "" || c.ClientID == "" || c.AuthLoginURL == "" || c.KeySetURL == "" {
+			log.Printf("Skipping LTI platform [%s] of playground [%s]: name, issuer, client id, auth login url and key set url are required\n", c.Name, p.Id)
+			continue
+		}
+		platforms[c.Name] = lti.NewPlatform(c)
+	}
+
+	ltiMx.Lock()
+	ltiPlatforms[p.Id] = platforms
+	ltiMx.Unlock()
+}
+
+func getLTIPlatform(playgroundId, name string) (*lti.Platform, bool) {
+	ltiMx.Lock()
+	defer ltiMx.Unlock()
+	platform, found := ltiPlatforms[playgroundId][name]
+	return platform, found
+}
+
+// findLTIPlatform returns the platform with the given issuer. Platforms that
+// register the tool more than once are told apart by the client id.
+func findLTIPlatform(playgroundId, issuer, clientId string) (*lti.Platform, bool) {
+	ltiMx.Lock()
+	defer ltiMx.Unlock()
+	for _, platform := range ltiPlatforms[playgroundId] {
+		if platform.Issuer() == issuer && (clientId == "" || platform.ClientID() == clientId) {
+			return platform, true
+		}
+	}
+	return nil, false
+}
+
+func LTIKeySet(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(ltiTool.KeySet())
+}
+
+// LTILogin answers the login initiation a platform starts a launch with.
+func LTILogin(rw http.ResponseWriter, req *http.Request) {
+	playground := core.PlaygroundFindByDomain(req.Host)
+	if playground == nil {
+		log.Printf("Playground for domain %s was not found!", req.Host)
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	req.ParseForm()
+	issuer := req.Form.Get("iss")
+	loginHint := req.Form.Get("login_hint")
+	if issuer == "" || loginHint == "" {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	platform, found := findLTIPlatform(playground.Id, issuer, req.Form.Get("client_id"))
+	if !found {
+		log.Printf("Could not find LTI platform %s\n", issuer)
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	loginRequest, err := core.UserNewLoginRequest(ltiProviderPrefix + platform.Name())
+	if err != nil {
+		log.Printf("Could not start a new user login request for LTI platform %s. Got: %v\n", platform.Name(), err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	redirectURI := fmt.Sprintf("%s://%s/lti/launch", scheme, req.Host)
+	url := platform.AuthRequestURL(redirectURI, loginHint, req.Form.Get("lti_message_hint"), loginRequest.Id, loginRequest.Nonce)
+	setLoginRequestCookie(rw, ltiPath, loginRequest.Id)
+
+	http.Redirect(rw, req, url, http.StatusFound)
+}
+
+// LTILaunch logs in the user of a launch and creates a session for them.
+// The image and exam of the session are taken from the custom parameters of
+// the launch. Users get the role in the course the platform gives them.
+func LTILaunch(rw http.ResponseWriter, req *http.Request) {
+	playground := core.PlaygroundFindByDomain(req.Host)
+	if playground == nil {
+		log.Printf("Playground for domain %s was not found!", req.Host)
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	req.ParseForm()
+	loginRequestId := req.Form.Get("state")
+	// Only the browser the launch started in can finish it, so nobody can
+	// have someone else log in as them
+	if !loginRequestStartedBy(req, loginRequestId) {
+		log.Printf("Refusing LTI launch %s from another browser\n", loginRequestId)
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+	clearLoginRequestCookie(rw, ltiPath)
+
+	loginRequest, err := core.UserGetLoginRequest(loginRequestId)
+	if err != nil || !strings.HasPrefix(loginRequest.Provider, ltiProviderPrefix) {
+		log.Printf("Could not get LTI login request %s. Got: %v\n", loginRequestId, err)
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	platform, found := getLTIPlatform(playground.Id, strings.TrimPrefix(loginRequest.Provider, ltiProviderPrefix))
+	if !found {
+		log.Printf("Could not find LTI platform for provider %s\n", loginRequest.Provider)
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	launch, err := platform.ParseLaunch(req.Context(), req.Form.Get("id_token"), loginRequest.Nonce)
+	if err != nil {
+		log.Printf("Could not verify launch from LTI platform %s. Got: %v\n", platform.Name(), err)
+		if lti.InvalidLaunch(err) {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	user := &types.User{
+		Provider:       loginRequest.Provider,
+		ProviderUserId: launch.UserId,
+		Name:           launch.Name,
+		Email:          launch.Email,
+		Avatar:         launch.Picture,
+	}
+	user, err = core.UserLogin(loginRequest, user)
+	if err != nil {
+		log.Printf("Could not login user. Got: %v\n", err)
+		var accessDenied *pwd.AccessDeniedError
+		if errors.As(err, &accessDenied) {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var courseId string
+	if launch.ContextId != "" {
+		course, err := core.CourseFindOrNew(&types.Course{
+			PlaygroundId: playground.Id,
+			Issuer:       platform.Issuer(),
+			ContextId:    launch.ContextId,
+			Title:        launch.ContextTitle,
+			Label:        launch.ContextLabel,
+		})
+		if err != nil {
+			log.Printf("Could not get course %s of LTI platform %s. Got: %v\n", launch.ContextId, platform.Name(), err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		courseId = course.Id
+
+		// The platform tells who teaches the course, so the role it gave
+		// in an earlier launch is taken back when it changed
+		grant := types.RoleGrant{Role: types.RoleStudent, RoleScope: types.RoleScope{CourseId: course.Id}}
+		previous := types.RoleGrant{Role: types.RoleInstructor, RoleScope: grant.RoleScope}
+		if launch.Instructor() {
+			grant.Role, previous.Role = types.RoleInstructor, types.RoleStudent
+		}
+		if err := core.UserRevokeRole(user, previous); err != nil {
+			log.Printf("Could not revoke %s role in course %s from user %s. Got: %v\n", previous.Role, course.Id, user.Id, err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if err := core.UserGrantRole(user, grant); err != nil {
+			log.Printf("Could not grant %s role in course %s to user %s. Got: %v\n", grant.Role, course.Id, user.Id, err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	sConfig := types.SessionConfig{
+		Playground:  playground,
+		UserId:      user.Id,
+		Duration:    playground.DefaultSessionDuration,
+		ImageName:   launch.Custom["image"],
+		CourseId:    courseId,
+		Exam:        launch.Custom["exam"],
+		LineItem:    launch.LineItem,
+		LTIPlatform: platform.Name(),
+		LTIUserId:   launch.UserId,
+	}
+	s, err := core.SessionNew(context.Background(), sConfig)
+	if err != nil {
+		var accessDenied *pwd.AccessDeniedError
+		if errors.As(err, &accessDenied) {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if quotaExceeded(rw, err) {
+			return
+		}
+		if provisioner.OutOfCapacity(err) {
+			http.Redirect(rw, req, "/ooc", http.StatusFound)
+			return
+		}
+		log.Printf("Could not create session for LTI launch. Got: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := setUserCookie(rw, req, user); err != nil {
+		log.Printf("Could not encode cookie. Got: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(rw, req, fmt.Sprintf("/p/%s", s.Id), http.StatusFound)
+}
+
+// gradeExam grades the exam the session was launched for and posts the
+// score to the line item the session was launched with.
+func gradeExam(session *types.Session) {
+	given, maximum, err := core.ExamGrade(session, session.Exam)
+	if pwd.ExamGradingDisabled(err) {
+		return
+	} else if err != nil {
+		log.Printf("Could not grade exam [%s] of session [%s]. Got: %v\n", session.Exam, session.Id, err)
+		return
+	}
+
+	platform, found := getLTIPlatform(session.PlaygroundId, session.LTIPlatform)
+	if !found {
+		log.Printf("Could not find LTI platform %s to post exam score of session [%s]\n", session.LTIPlatform, session.Id)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ltiScoreTimeout)
+	defer cancel()
+	score := lti.Score{UserId: session.LTIUserId, Given: given, Maximum: maximum}
+	if err := platform.PostScore(ctx, ltiTool, session.LineItem, score); err != nil {
+		log.Printf("Could not post exam score of session [%s] to LTI platform %s. Got: %v\n", session.Id, platform.Name(), err)
+	}
+}
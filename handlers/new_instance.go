@@ -2,20 +2,24 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/play-with-docker/play-with-docker/config"
 	"github.com/play-with-docker/play-with-docker/provisioner"
+	"github.com/play-with-docker/play-with-docker/pwd"
 	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
 )
 
 func NewInstance(rw http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	sessionId := vars["sessionId"]
 
-	body := types.InstanceConfig{PlaygroundFQDN: req.Host, DindVolumeSize: "5G"}
+	body := types.InstanceConfig{PlaygroundFQDN: req.Host, DindVolumeSize: config.DindVolumeSize}
 
 	json.NewDecoder(req.Body).Decode(&body)
 
@@ -57,11 +61,28 @@ func NewInstance(rw http.ResponseWriter, req *http.Request) {
 
 	i, err := core.InstanceNew(s, body)
 	if err != nil {
+		var accessDenied *pwd.AccessDeniedError
+		if errors.As(err, &accessDenied) {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if quotaExceeded(rw, err) {
+			return
+		}
+		if storage.NotFound(err) {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
 		if provisioner.OutOfCapacity(err) {
 			rw.WriteHeader(http.StatusServiceUnavailable)
 			fmt.Fprintln(rw, `{"error": "out_of_capacity"}`)
 			return
 		}
+		if pwd.UserVolumeOnOtherHost(err) {
+			rw.WriteHeader(http.StatusConflict)
+			fmt.Fprintln(rw, `{"error": "user_volume_on_other_host"}`)
+			return
+		}
 		log.Println(err)
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,7 +13,9 @@ import (
 
 	"github.com/play-with-docker/play-with-docker/config"
 	"github.com/play-with-docker/play-with-docker/provisioner"
+	"github.com/play-with-docker/play-with-docker/pwd"
 	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/satori/go.uuid"
 )
 
 type NewSessionResponse struct {
@@ -78,8 +81,19 @@ func NewSession(rw http.ResponseWriter, req *http.Request) {
 	}
 
 	sConfig := types.SessionConfig{Playground: playground, UserId: userId, Duration: duration, Stack: stack, StackName: stackName, ImageName: imageName}
+	if userId == "" {
+		sConfig.CreatorSecret = uuid.NewV4().String()
+	}
 	s, err := core.SessionNew(context.Background(), sConfig)
 	if err != nil {
+		var accessDenied *pwd.AccessDeniedError
+		if errors.As(err, &accessDenied) {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if quotaExceeded(rw, err) {
+			return
+		}
 		if provisioner.OutOfCapacity(err) {
 			http.Redirect(rw, req, "/ooc", http.StatusFound)
 			return
@@ -89,6 +103,9 @@ func NewSession(rw http.ResponseWriter, req *http.Request) {
 		return
 		//TODO: Return some error code
 	} else {
+		if sConfig.CreatorSecret != "" {
+			setCreatorCookie(rw, req, s, sConfig.CreatorSecret)
+		}
 		hostname := req.Host
 		// If request is not a form, return sessionId in the body
 		if req.Header.Get("X-Requested-With") == "XMLHttpRequest" {
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/oidc"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+// How long discovery of an OpenID Connect provider may take on startup.
+const oidcDiscoveryTimeout = 10 * time.Second
+
+type oidcLogin struct {
+	provider *oidc.Provider
+	conf     types.OIDCProvider
+}
+
+var (
+	oidcMx     sync.Mutex
+	oidcLogins = map[string]map[string]*oidcLogin{}
+)
+
+// initOIDCProviders discovers the OpenID Connect providers of the playground
+// and registers them next to the built-in providers. Providers that can't be
+// discovered are logged and left out.
+func initOIDCProviders(p *types.Playground) {
+	logins := map[string]*oidcLogin{}
+	for _, c := range p.OIDCProviders {
+		if c.Name == "" || c.Issuer == "" || c.ClientID == "" {
+			log.Printf("Skipping OpenID Connect provider [%s] of playground [%s]: name, issuer and client id are required\n", c.Name, p.Id)
+			continue
+		}
+		if _, found := config.Providers[p.Id][c.Name]; found {
+			log.Printf("Skipping OpenID Connect provider [%s] of playground [%s]: the name is already in use\n", c.Name, p.Id)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), oidcDiscoveryTimeout)
+		provider, err := oidc.Discover(ctx, c.Issuer)
+		cancel()
+		if err != nil {
+			log.Printf("Could not discover OpenID Connect provider [%s] at %s. Got: %v\n", c.Name, c.Issuer, err)
+			continue
+		}
+
+		scopes := c.Scopes
+		if len(scopes) == 0 {
+			scopes = []string{"openid", "profile", "email"}
+		}
+		config.Providers[p.Id][c.Name] = &oauth2.Config{
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			Scopes:       scopes,
+			Endpoint:     provider.Endpoint(),
+		}
+		logins[c.Name] = &oidcLogin{provider: provider, conf: c}
+	}
+
+	oidcMx.Lock()
+	oidcLogins[p.Id] = logins
+	oidcMx.Unlock()
+}
+
+func getOIDCLogin(playgroundId, name string) (*oidcLogin, bool) {
+	oidcMx.Lock()
+	defer oidcMx.Unlock()
+	l, found := oidcLogins[playgroundId][name]
+	return l, found
+}
+
+// user verifies the ID token returned with tok and maps its claims to a user.
+// Claims missing from the token are looked up in the user info of the
+// provider.
+func (l *oidcLogin) user(ctx context.Context, tok *oauth2.Token, nonce string) (*types.User, error) {
+	rawIDToken, ok := tok.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("Provider %s didn't return an ID token", l.conf.Name)
+	}
+	claims, err := l.provider.Verify(ctx, rawIDToken, l.conf.ClientID, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	idClaim, nameClaim, emailClaim, avatarClaim := l.conf.Claims()
+	if claims.String(nameClaim) == "" || claims.String(emailClaim) == "" || claims.String(avatarClaim) == "" {
+		info, err := l.provider.UserInfo(ctx, oauth2.StaticTokenSource(tok))
+		if err != nil {
+			log.Printf("Could not get user info from provider %s. Got: %v\n", l.conf.Name, err)
+		} else if info.String("sub") == claims.String("sub") {
+			// User info is only trusted for the user of the ID token
+			for name, value := range info {
+				if _, found := claims[name]; !found {
+					claims[name] = value
+				}
+			}
+		}
+	}
+
+	user := &types.User{
+		Provider:       l.conf.Name,
+		ProviderUserId: claims.String(idClaim),
+		Name:           claims.String(nameClaim),
+		Email:          claims.String(emailClaim),
+		Avatar:         claims.String(avatarClaim),
+	}
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		user.EmailVerified = v
+	case string:
+		// Some providers send it as a string
+		user.EmailVerified = v == "true"
+	}
+	if user.ProviderUserId == "" {
+		return nil, fmt.Errorf("ID token of provider %s has no %s claim", l.conf.Name, idClaim)
+	}
+	return user, nil
+}
@@ -12,11 +12,6 @@ import (
 )
 
 func NewPlayground(rw http.ResponseWriter, req *http.Request) {
-	if !ValidateToken(req) {
-		rw.WriteHeader(http.StatusForbidden)
-		return
-	}
-
 	var playground types.Playground
 
 	err := json.NewDecoder(req.Body).Decode(&playground)
@@ -37,11 +32,6 @@ func NewPlayground(rw http.ResponseWriter, req *http.Request) {
 }
 
 func ListPlaygrounds(rw http.ResponseWriter, req *http.Request) {
-	if !ValidateToken(req) {
-		rw.WriteHeader(http.StatusForbidden)
-		return
-	}
-
 	playgrounds, err := core.PlaygroundList()
 	if err != nil {
 		log.Printf("Error listing playgrounds. Got: %v\n", err)
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/text/encoding"
+)
+
+// Front ends that request the protocolV2 websocket subprotocol exchange
+// terminal I/O as binary frames, so the bytes are passed through untouched.
+// Control messages are still JSON text frames in both versions. Sockets that
+// don't ask for it get the original protocol, where terminal I/O travels as
+// JSON strings.
+//
+// A binary frame is laid out as
+//
+//	| kind (1 byte) | name length (1 byte) | instance name | data |
+//
+// The name can't be empty and the data can.
+const protocolV2 = "pwd.v2"
+
+const (
+	frameTerminalOut byte = 1
+	frameTerminalIn  byte = 2
+)
+
+var invalidFrameError = errors.New("Invalid binary frame")
+
+type frame struct {
+	kind byte
+	name string
+	data []byte
+}
+
+func knownFrameKind(kind byte) bool {
+	return kind == frameTerminalOut || kind == frameTerminalIn
+}
+
+func encodeFrame(f frame) ([]byte, error) {
+	if !knownFrameKind(f.kind) {
+		return nil, fmt.Errorf("Unknown binary frame kind %d", f.kind)
+	}
+	if len(f.name) == 0 {
+		return nil, errors.New("Binary frames need an instance name")
+	}
+	if len(f.name) > 255 {
+		return nil, fmt.Errorf("Instance name %s is too long for a binary frame", f.name)
+	}
+	b := make([]byte, 0, 2+len(f.name)+len(f.data))
+	b = append(b, f.kind, byte(len(f.name)))
+	b = append(b, f.name...)
+	b = append(b, f.data...)
+	return b, nil
+}
+
+func decodeFrame(b []byte) (frame, error) {
+	if len(b) < 2 || b[1] == 0 || len(b) < 2+int(b[1]) || !knownFrameKind(b[0]) {
+		return frame{}, invalidFrameError
+	}
+	n := 2 + int(b[1])
+	return frame{kind: b[0], name: string(b[2:n]), data: b[n:]}, nil
+}
+
+// legacyTerminalData converts terminal output for the original protocol,
+// which can only carry valid UTF-8.
+func legacyTerminalData(data []byte) string {
+	b, err := encoding.Replacement.NewEncoder().Bytes(data)
+	if err != nil {
+		return string(data)
+	}
+	return string(b)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeFrame(t *testing.T) {
+	longest := strings.Repeat("n", 255)
+
+	tests := []struct {
+		name     string
+		frame    frame
+		expected []byte
+		fails    bool
+	}{
+		{"output", frame{kind: frameTerminalOut, name: "node1", data: []byte("ls\r\n")}, []byte("\x01\x05node1ls\r\n"), false},
+		{"input", frame{kind: frameTerminalIn, name: "node1", data: []byte{0xff, 0x00}}, []byte("\x02\x05node1\xff\x00"), false},
+		{"empty data", frame{kind: frameTerminalOut, name: "node1"}, []byte("\x01\x05node1"), false},
+		{"longest name", frame{kind: frameTerminalOut, name: longest, data: []byte("x")}, append([]byte{1, 255}, longest+"x"...), false},
+		{"name too long", frame{kind: frameTerminalOut, name: longest + "n"}, nil, true},
+		{"empty name", frame{kind: frameTerminalOut, data: []byte("x")}, nil, true},
+		{"unknown kind", frame{kind: 3, name: "node1"}, nil, true},
+		{"zero kind", frame{kind: 0, name: "node1"}, nil, true},
+	}
+
+	for _, test := range tests {
+		b, err := encodeFrame(test.frame)
+		if test.fails {
+			assert.NotNil(t, err, test.name)
+			continue
+		}
+		assert.Nil(t, err, test.name)
+		assert.Equal(t, test.expected, b, test.name)
+	}
+}
+
+func TestDecodeFrame(t *testing.T) {
+	longest := strings.Repeat("n", 255)
+
+	tests := []struct {
+		name     string
+		b        []byte
+		expected frame
+		fails    bool
+	}{
+		{"output", []byte("\x01\x05node1ls\r\n"), frame{kind: frameTerminalOut, name: "node1", data: []byte("ls\r\n")}, false},
+		{"input", []byte("\x02\x05node1\xff\x00"), frame{kind: frameTerminalIn, name: "node1", data: []byte{0xff, 0x00}}, false},
+		{"empty data", []byte("\x02\x05node1"), frame{kind: frameTerminalIn, name: "node1", data: []byte{}}, false},
+		{"longest name", append([]byte{2, 255}, longest+"x"...), frame{kind: frameTerminalIn, name: longest, data: []byte("x")}, false},
+		{"empty", []byte{}, frame{}, true},
+		{"only kind", []byte{2}, frame{}, true},
+		{"truncated name", []byte("\x02\x05node"), frame{}, true},
+		{"truncated longest name", append([]byte{2, 255}, longest[1:]...), frame{}, true},
+		{"empty name", []byte("\x02\x00ls"), frame{}, true},
+		{"unknown kind", []byte("\x03\x05node1ls"), frame{}, true},
+		{"zero kind", []byte("\x00\x05node1ls"), frame{}, true},
+	}
+
+	for _, test := range tests {
+		f, err := decodeFrame(test.b)
+		if test.fails {
+			assert.Equal(t, invalidFrameError, err, test.name)
+			continue
+		}
+		assert.Nil(t, err, test.name)
+		assert.Equal(t, test.expected, f, test.name)
+	}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	f := frame{kind: frameTerminalIn, name: "aaaabbbb_node1", data: []byte("\x1b[A\xe2\x82")}
+	b, err := encodeFrame(f)
+	assert.Nil(t, err)
+	decoded, err := decodeFrame(b)
+	assert.Nil(t, err)
+	assert.Equal(t, f, decoded)
+}
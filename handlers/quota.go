@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/play-with-docker/play-with-docker/pwd"
+)
+
+// quotaExceeded answers with 429 and the name of the quota when err is
+// because the user ran out of it.
+func quotaExceeded(rw http.ResponseWriter, err error) bool {
+	var quotaErr *pwd.QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(rw).Encode(map[string]string{"error": "quota_exceeded", "quota": quotaErr.Quota})
+	return true
+}
+
+// UserUsage shows the logged in user how much of their quota in the
+// playground they have used and how much is left. The course query parameter
+// picks the course whose roles apply.
+func UserUsage(rw http.ResponseWriter, req *http.Request) {
+	cookie, err := ReadCookie(req)
+	if err != nil {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	user, err := core.UserGet(cookie.Id)
+	if err != nil {
+		log.Printf("Couldn't get user with id %s. Got: %v\n", cookie.Id, err)
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	playground := core.PlaygroundFindByDomain(req.Host)
+	if playground == nil {
+		log.Printf("Playground for domain %s was not found!", req.Host)
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	usage, err := core.UserUsage(user, playground, req.URL.Query().Get("course"))
+	if err != nil {
+		log.Printf("Could not get usage of user [%s]. Got: %v\n", user.Id, err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(rw).Encode(usage)
+}
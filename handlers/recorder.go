@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"log"
+	"sync"
+
+	"github.com/play-with-docker/play-with-docker/asciicast"
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+// terminalRecorder records a terminal of an instance, its main terminal or an
+// additional shell, while at least one terminal manager is connected to it.
+// Output comes from the terminal hub and input from every manager.
+type terminalRecorder struct {
+	recording *types.Recording
+	cast      *asciicast.Writer
+	managers  []*manager
+}
+
+type recorders struct {
+	mx         sync.Mutex
+	once       sync.Once
+	byTerminal map[string]*terminalRecorder
+}
+
+var terminalRecorders = &recorders{byTerminal: map[string]*terminalRecorder{}}
+
+// join starts recording the terminal called name if the playground records
+// terminals and nobody is recording it yet.
+func (r *recorders) join(m *manager, name string, instance *types.Instance) {
+	r.once.Do(func() {
+		e.On(event.INSTANCE_VIEWPORT_RESIZE, func(sessionId string, args ...interface{}) {
+			if name, cols, rows, ok := viewportResizeArgs(args); ok {
+				r.resize(name, cols, rows)
+			}
+		})
+	})
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if ir, found := r.byTerminal[name]; found {
+		for _, om := range ir.managers {
+			if om == m {
+				return
+			}
+		}
+		ir.managers = append(ir.managers, m)
+		return
+	}
+
+	vp := core.SessionGetViewPort(m.session.Id, name)
+	if vp.Cols == 0 || vp.Rows == 0 {
+		vp = types.ViewPort{Cols: 80, Rows: 24}
+	}
+	recording, cast, err := core.RecordingNew(m.session, instance, name, vp.Cols, vp.Rows)
+	if err != nil {
+		log.Printf("Could not start recording of terminal [%s]. Got: %v\n", name, err)
+		return
+	}
+	if recording == nil {
+		return
+	}
+	r.byTerminal[name] = &terminalRecorder{recording: recording, cast: cast, managers: []*manager{m}}
+}
+
+// leave stops recording the terminal when m was the last manager connected
+// to it.
+func (r *recorders) leave(m *manager, name string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	ir, found := r.byTerminal[name]
+	if !found {
+		return
+	}
+	for n, om := range ir.managers {
+		if om == m {
+			ir.managers = append(ir.managers[:n], ir.managers[n+1:]...)
+			break
+		}
+	}
+	if len(ir.managers) > 0 {
+		return
+	}
+	delete(r.byTerminal, name)
+	ir.cast.Close()
+	if err := core.RecordingEnd(ir.recording); err != nil {
+		log.Printf("Could not end recording [%s]. Got: %v\n", ir.recording.Id, err)
+	}
+}
+
+func (r *recorders) get(name string) *terminalRecorder {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	return r.byTerminal[name]
+}
+
+func (r *recorders) output(name string, data []byte) {
+	if ir := r.get(name); ir != nil {
+		ir.cast.Output(data)
+	}
+}
+
+func (r *recorders) input(name string, data []byte) {
+	if ir := r.get(name); ir != nil {
+		ir.cast.Input(data)
+	}
+}
+
+func (r *recorders) resize(name string, cols, rows uint) {
+	if cols == 0 || rows == 0 {
+		return
+	}
+	if ir := r.get(name); ir != nil {
+		ir.cast.Resize(cols, rows)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+)
+
+func ListRecordings(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	sessionId := vars["sessionId"]
+
+	recordings, err := core.RecordingFindBySession(sessionId)
+	if err != nil {
+		log.Printf("Error listing recordings for session %s. Got: %v\n", sessionId, err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	visible := []*types.Recording{}
+	for _, recording := range recordings {
+		if authorizeRecording(req, recording) == nil {
+			visible = append(visible, recording)
+		}
+	}
+
+	json.NewEncoder(rw).Encode(visible)
+}
+
+// getRecording returns the recording in the request, making sure it belongs
+// to the session of the request and the caller may see it. Recordings outlive
+// their sessions, so the session itself doesn't need to exist anymore.
+func getRecording(rw http.ResponseWriter, req *http.Request) *types.Recording {
+	vars := mux.Vars(req)
+	sessionId := vars["sessionId"]
+	recordingId := vars["recordingId"]
+
+	recording, err := core.RecordingGet(recordingId)
+	if err == storage.NotFoundError {
+		rw.WriteHeader(http.StatusNotFound)
+		return nil
+	} else if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return nil
+	}
+	if recording.SessionId != sessionId {
+		rw.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+	if err := authorizeRecording(req, recording); err != nil {
+		log.Printf("Denied access to recording [%s]. Got: %v\n", recording.Id, err)
+		rw.WriteHeader(accessDeniedStatus(err))
+		return nil
+	}
+	return recording
+}
+
+// authorizeRecording only lets the user that recorded a recording and the
+// instructors of their course or playground see it. Recordings can be of
+// exams, so holders of a share of the session can't, and nobody but
+// instructors can see the ones of anonymous sessions.
+func authorizeRecording(req *http.Request, recording *types.Recording) error {
+	cookie, err := ReadCookie(req)
+	if err != nil {
+		return notLoggedInError
+	}
+	if recording.UserId != "" && cookie.Id == recording.UserId {
+		return nil
+	}
+	if !instructs(cookie.Id, types.RoleScope{PlaygroundId: recording.PlaygroundId, CourseId: recording.CourseId}) {
+		return notSessionOwnerError
+	}
+	return nil
+}
+
+func DownloadRecording(rw http.ResponseWriter, req *http.Request) {
+	recording := getRecording(rw, req)
+	if recording == nil {
+		return
+	}
+
+	r, err := core.RecordingOpen(recording)
+	if err != nil {
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer r.Close()
+
+	rw.Header().Set("Content-Type", "application/x-asciicast")
+	if req.URL.Query().Get("download") != "" {
+		rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-%s.cast\"", recording.Hostname, recording.Id))
+	}
+	io.Copy(rw, r)
+}
+
+func DeleteRecording(rw http.ResponseWriter, req *http.Request) {
+	cookie, err := ReadCookie(req)
+	if err != nil {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	recording := getRecording(rw, req)
+	if recording == nil {
+		return
+	}
+	if recording.UserId == "" || recording.UserId != cookie.Id {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if err := core.RecordingDelete(recording); err != nil {
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/play-with-docker/play-with-docker/pwd"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+)
+
+var missingRoleError = errors.New("User doesn't have the required role")
+
+// roleChecker tells whether the caller of a request has a role in a scope.
+type roleChecker func(role string, scope types.RoleScope) bool
+
+// requestRoles returns the roles of the caller of the request. Requests with
+// the admin token have every role everywhere, so the token keeps working to
+// bootstrap the first admins.
+func requestRoles(req *http.Request) (roleChecker, error) {
+	if ValidateToken(req) {
+		return func(string, types.RoleScope) bool { return true }, nil
+	}
+	cookie, err := ReadCookie(req)
+	if err != nil {
+		return nil, notLoggedInError
+	}
+	user, err := core.UserGet(cookie.Id)
+	if err != nil {
+		return nil, err
+	}
+	return user.HasRole, nil
+}
+
+// roleScopeFunc returns the scope the role of a request is checked in.
+type roleScopeFunc func(req *http.Request) (types.RoleScope, error)
+
+// globalScope is for endpoints that reach across playgrounds.
+func globalScope(req *http.Request) (types.RoleScope, error) {
+	return types.RoleScope{}, nil
+}
+
+// courseScope is the course in the URL.
+func courseScope(req *http.Request) (types.RoleScope, error) {
+	course, err := core.CourseGet(mux.Vars(req)["courseId"])
+	if err != nil {
+		return types.RoleScope{}, err
+	}
+	return types.RoleScope{PlaygroundId: course.PlaygroundId, CourseId: course.Id}, nil
+}
+
+// requireRole only lets requests through to h when the caller has at least
+// the given role in the scope of the request.
+func requireRole(role string, scope roleScopeFunc, h http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		s, err := scope(req)
+		if storage.NotFound(err) {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Println(err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		hasRole, err := requestRoles(req)
+		if err != nil {
+			log.Printf("Denied access to %s. Got: %v\n", req.URL.Path, err)
+			rw.WriteHeader(accessDeniedStatus(err))
+			return
+		}
+		if !hasRole(role, s) {
+			log.Printf("Denied access to %s. Got: %v\n", req.URL.Path, missingRoleError)
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		h(rw, req)
+	}
+}
+
+// grantScope returns the scope a grant applies to, taking the playground of
+// course grants from the course.
+func grantScope(grant types.RoleGrant) (types.RoleScope, error) {
+	if grant.CourseId == "" {
+		return grant.RoleScope, nil
+	}
+	course, err := core.CourseGet(grant.CourseId)
+	if err != nil {
+		return types.RoleScope{}, err
+	}
+	return types.RoleScope{PlaygroundId: course.PlaygroundId, CourseId: course.Id}, nil
+}
+
+// canGrant tells whether the caller may hand out or take away the role.
+// Admins manage roles in their scope, and instructors can manage the
+// students and instructors of their courses.
+func canGrant(hasRole roleChecker, grant types.RoleGrant, scope types.RoleScope) bool {
+	if hasRole(types.RoleAdmin, scope) {
+		return true
+	}
+	return scope.CourseId != "" && grant.Role != types.RoleAdmin && hasRole(types.RoleInstructor, scope)
+}
+
+// UserRoles grants a role to a user with PUT and revokes it with DELETE.
+func UserRoles(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	userId := vars["userId"]
+
+	var grant types.RoleGrant
+	if err := json.NewDecoder(req.Body).Decode(&grant); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	hasRole, err := requestRoles(req)
+	if err != nil {
+		rw.WriteHeader(accessDeniedStatus(err))
+		return
+	}
+	scope, err := grantScope(grant)
+	if storage.NotFound(err) {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !canGrant(hasRole, grant, scope) {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	user, err := core.UserGet(userId)
+	if storage.NotFound(err) {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil && user == nil {
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if req.Method == "DELETE" {
+		err = core.UserRevokeRole(user, grant)
+	} else {
+		err = core.UserGrantRole(user, grant)
+	}
+	if err != nil {
+		if pwd.RoleInvalid(err) {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(user.Roles)
+}
+
+func GetCourse(rw http.ResponseWriter, req *http.Request) {
+	course, err := core.CourseGet(mux.Vars(req)["courseId"])
+	if err != nil {
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(course)
+}
+
+// ListCourseSessions lets instructors follow the sessions launched from their
+// course and the exams they were launched for.
+func ListCourseSessions(rw http.ResponseWriter, req *http.Request) {
+	courseId := mux.Vars(req)["courseId"]
+
+	sessions, err := core.SessionFindByCourse(courseId)
+	if err != nil {
+		log.Printf("Error listing sessions of course %s. Got: %v\n", courseId, err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(sessions)
+}
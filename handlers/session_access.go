@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+)
+
+// sessionAccess is what a request is allowed to do in a session.
+type sessionAccess int
+
+const (
+	// accessObserver can watch the session.
+	accessObserver sessionAccess = iota + 1
+	// accessCollaborator can also use the terminals and instances.
+	accessCollaborator
+	// accessOwner can also hand out and revoke shares.
+	accessOwner
+)
+
+var notLoggedInError = errors.New("Not logged in")
+var notSessionOwnerError = errors.New("Session belongs to a different user")
+var invalidShareError = errors.New("Share token is not valid for the session")
+var bannedUserError = errors.New("User is banned")
+var notSessionCreatorError = errors.New("Session was created by somebody else")
+
+// creatorCookie holds the secret that proves who created a session of a
+// playground without login. It is only sent along to the URLs of the
+// session.
+const creatorCookie = "session_creator"
+
+// authorizeSession works out what the request may do in the session. Banned
+// users get no access at all. Requests carrying a share token get the role of
+// the share, unless the owner of the session is banned. Otherwise the caller
+// has to be logged in as the user that owns the session, or instruct the
+// course or playground of the session to watch it. Sessions of playgrounds
+// without login don't belong to anybody, so they are owned by whoever holds
+// the secret they were created with.
+func authorizeSession(req *http.Request, session *types.Session) (sessionAccess, *types.Share, error) {
+	if cookie, err := ReadCookie(req); err == nil && userBanned(cookie.Id) {
+		return 0, nil, bannedUserError
+	}
+	share, err := requestShare(req, session.Id)
+	if err != nil {
+		return 0, nil, invalidShareError
+	}
+	if share != nil {
+		if session.UserId != "" && userBanned(session.UserId) {
+			return 0, nil, bannedUserError
+		}
+		if share.ReadOnly() {
+			return accessObserver, share, nil
+		}
+		return accessCollaborator, share, nil
+	}
+
+	if session.UserId == "" {
+		if !session.CreatedWith(requestCreatorSecret(req)) {
+			return 0, nil, notSessionCreatorError
+		}
+		return accessOwner, nil, nil
+	}
+	cookie, err := ReadCookie(req)
+	if err != nil {
+		return 0, nil, notLoggedInError
+	}
+	if cookie.Id == session.UserId {
+		if user, err := core.UserGet(cookie.Id); user != nil && user.IsBanned {
+			return 0, nil, bannedUserError
+		} else if err != nil && user == nil {
+			return 0, nil, err
+		}
+		return accessOwner, nil, nil
+	}
+	if instructs(cookie.Id, types.RoleScope{PlaygroundId: session.PlaygroundId, CourseId: session.CourseId}) {
+		return accessObserver, nil, nil
+	}
+	return 0, nil, notSessionOwnerError
+}
+
+// setCreatorCookie hands the secret the session was created with to the
+// browser that created it.
+func setCreatorCookie(rw http.ResponseWriter, req *http.Request, session *types.Session, secret string) {
+	http.SetCookie(rw, &http.Cookie{
+		Name:     creatorCookie,
+		Value:    secret,
+		Domain:   cookieDomain(req),
+		Path:     "/sessions/" + session.Id,
+		MaxAge:   int(time.Until(session.ExpiresAt).Seconds()),
+		SameSite: http.SameSiteNoneMode,
+		Secure:   config.UseLetsEncrypt,
+		HttpOnly: true,
+	})
+}
+
+// clearCreatorCookie removes the secret of the creator of a session that
+// was claimed, since the session belongs to a user from then on.
+func clearCreatorCookie(rw http.ResponseWriter, req *http.Request, session *types.Session) {
+	http.SetCookie(rw, &http.Cookie{
+		Name:     creatorCookie,
+		Domain:   cookieDomain(req),
+		Path:     "/sessions/" + session.Id,
+		MaxAge:   -1,
+		SameSite: http.SameSiteNoneMode,
+		Secure:   config.UseLetsEncrypt,
+		HttpOnly: true,
+	})
+}
+
+// requestCreatorSecret returns the secret of the creator of the session the
+// request was made to, if the caller has it.
+func requestCreatorSecret(req *http.Request) string {
+	cookie, err := req.Cookie(creatorCookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// userBanned tells whether the user is banned. Users that can't be found
+// aren't.
+func userBanned(userId string) bool {
+	user, _ := core.UserGet(userId)
+	return user != nil && user.IsBanned
+}
+
+// instructs tells whether the user is an instructor in the scope.
+func instructs(userId string, scope types.RoleScope) bool {
+	user, err := core.UserGet(userId)
+	if err != nil {
+		return false
+	}
+	return user.HasRole(types.RoleInstructor, scope)
+}
+
+// accessDeniedStatus is the status code to answer with when authorizeSession
+// fails.
+func accessDeniedStatus(err error) int {
+	if err == notLoggedInError {
+		return http.StatusUnauthorized
+	}
+	return http.StatusForbidden
+}
+
+// requireSession only lets requests through to h when they are allowed at
+// least the given access to the session in the URL.
+func requireSession(level sessionAccess, h http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		sessionId := mux.Vars(req)["sessionId"]
+
+		session, err := core.SessionGet(sessionId)
+		if err == storage.NotFoundError {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Println(err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		access, _, err := authorizeSession(req, session)
+		if err != nil {
+			log.Printf("Denied access to session [%s]. Got: %v\n", sessionId, err)
+			rw.WriteHeader(accessDeniedStatus(err))
+			return
+		}
+		if access < level {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		h(rw, req)
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/pwd"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorizeSession_BannedShare(t *testing.T) {
+	m := &pwd.Mock{}
+	core = m
+	defer func() { core = nil }()
+
+	session := &types.Session{Id: "aaaabbbbcccc", UserId: "owner"}
+	share := &types.Share{Token: "token1", SessionId: session.Id, Role: types.ShareRoleCollaborator, ExpiresAt: time.Now().Add(time.Hour)}
+	banned := errors.New("User is banned")
+	m.On("ShareGet", "token1").Return(share, nil)
+	m.On("UserGet", "owner").Return(&types.User{Id: "owner"}, nil).Once()
+	m.On("UserGet", "guest").Return(&types.User{Id: "guest", IsBanned: true}, banned)
+
+	req := httptest.NewRequest("GET", "/sessions/aaaabbbbcccc/ws/", nil)
+	req.Header.Set(shareHeader, "token1")
+
+	access, found, err := authorizeSession(req, session)
+	assert.Nil(t, err)
+	assert.Equal(t, accessCollaborator, access)
+	assert.Equal(t, share, found)
+
+	// Banned users can't get in through a share
+	guest := req.WithContext(context.WithValue(req.Context(), tokenUserKey, &CookieID{Id: "guest"}))
+	_, _, err = authorizeSession(guest, session)
+	assert.Equal(t, bannedUserError, err)
+
+	// Nor can anybody through the shares of a banned user
+	m.On("UserGet", "owner").Return(&types.User{Id: "owner", IsBanned: true}, banned)
+	_, _, err = authorizeSession(req, session)
+	assert.Equal(t, bannedUserError, err)
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/play-with-docker/play-with-docker/config"
 	"github.com/play-with-docker/play-with-docker/pwd"
 )
 
@@ -13,7 +14,7 @@ func SessionSetup(rw http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	sessionId := vars["sessionId"]
 
-	body := pwd.SessionSetupConf{PlaygroundFQDN: req.Host, DindVolumeSize: "5G"}
+	body := pwd.SessionSetupConf{PlaygroundFQDN: req.Host, DindVolumeSize: config.DindVolumeSize}
 
 	json.NewDecoder(req.Body).Decode(&body)
 
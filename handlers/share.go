@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/pwd"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+)
+
+type newShareRequest struct {
+	Role string `json:"role"`
+}
+
+// Share links carry their token in the fragment of the URL, which browsers
+// neither send to servers nor put in Referer headers. Pages opened through a
+// link send the token once in shareHeader to GetShare, which hands it back in
+// shareCookie for the URLs of the session, so that it never shows up in URLs
+// that end up in access logs.
+const shareHeader = "X-Share-Token"
+const shareCookie = "session_share"
+
+// shareSockets are the websockets opened through each share, so they can be
+// closed when the share is revoked or expires. Clients that reconnect are
+// authorized again.
+var shareSockets = struct {
+	sync.Mutex
+	m map[string]map[*socket]struct{}
+}{m: map[string]map[*socket]struct{}{}}
+
+// trackShareSocket keeps the socket opened through the share until the
+// returned function is called, and closes it when the share expires.
+func trackShareSocket(share *types.Share, s *socket) func() {
+	shareSockets.Lock()
+	sockets, found := shareSockets.m[share.Token]
+	if !found {
+		sockets = map[*socket]struct{}{}
+		shareSockets.m[share.Token] = sockets
+	}
+	sockets[s] = struct{}{}
+	shareSockets.Unlock()
+
+	expiry := time.AfterFunc(time.Until(share.ExpiresAt), func() {
+		s.c.Close()
+	})
+	return func() {
+		expiry.Stop()
+		shareSockets.Lock()
+		defer shareSockets.Unlock()
+		delete(sockets, s)
+		if len(shareSockets.m[share.Token]) == 0 {
+			delete(shareSockets.m, share.Token)
+		}
+	}
+}
+
+// closeShareSockets disconnects everybody that is connected through the
+// share.
+func closeShareSockets(share *types.Share) {
+	shareSockets.Lock()
+	defer shareSockets.Unlock()
+	for s := range shareSockets.m[share.Token] {
+		s.c.Close()
+	}
+	delete(shareSockets.m, share.Token)
+}
+
+// requestShare returns the share the request was made with, or nil when it
+// doesn't carry a share token. Tokens that don't belong to the session are
+// reported as not found.
+func requestShare(req *http.Request, sessionId string) (*types.Share, error) {
+	token := req.Header.Get(shareHeader)
+	if token == "" {
+		if cookie, err := req.Cookie(shareCookie); err == nil {
+			token = cookie.Value
+		}
+	}
+	if token == "" {
+		return nil, nil
+	}
+	share, err := core.ShareGet(token)
+	if err != nil {
+		return nil, err
+	}
+	if share.SessionId != sessionId {
+		return nil, storage.NotFoundError
+	}
+	return share, nil
+}
+
+func NewShare(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	sessionId := vars["sessionId"]
+
+	body := newShareRequest{}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	session, err := core.SessionGet(sessionId)
+	if err == storage.NotFoundError {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	share, err := core.ShareNew(session, body.Role)
+	if err != nil {
+		if pwd.ShareInvalidRole(err) {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(share)
+}
+
+func ListShares(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	sessionId := vars["sessionId"]
+
+	shares, err := core.ShareFindBySession(sessionId)
+	if err != nil {
+		log.Printf("Error listing shares for session %s. Got: %v\n", sessionId, err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(shares)
+}
+
+// GetShare lets the holder of a share link find out which role it grants,
+// and hands the token back in a cookie for the other URLs of the session.
+func GetShare(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	sessionId := vars["sessionId"]
+
+	share, err := requestShare(req, sessionId)
+	if err == storage.NotFoundError || (err == nil && share == nil) {
+		clearShareCookie(rw, req, sessionId)
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(rw, &http.Cookie{
+		Name:     shareCookie,
+		Value:    share.Token,
+		Domain:   cookieDomain(req),
+		Path:     "/sessions/" + sessionId,
+		MaxAge:   int(time.Until(share.ExpiresAt).Seconds()),
+		SameSite: http.SameSiteNoneMode,
+		Secure:   config.UseLetsEncrypt,
+		HttpOnly: true,
+	})
+	json.NewEncoder(rw).Encode(share)
+}
+
+// clearShareCookie removes a share token that is no longer valid.
+func clearShareCookie(rw http.ResponseWriter, req *http.Request, sessionId string) {
+	http.SetCookie(rw, &http.Cookie{
+		Name:     shareCookie,
+		Domain:   cookieDomain(req),
+		Path:     "/sessions/" + sessionId,
+		MaxAge:   -1,
+		SameSite: http.SameSiteNoneMode,
+		Secure:   config.UseLetsEncrypt,
+		HttpOnly: true,
+	})
+}
+
+func DeleteShare(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	sessionId := vars["sessionId"]
+	token := vars["token"]
+
+	share, err := core.ShareGet(token)
+	if err == storage.NotFoundError || (err == nil && share.SessionId != sessionId) {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := core.ShareDelete(share); err != nil {
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	closeShareSockets(share)
+}
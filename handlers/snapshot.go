@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/play-with-docker/play-with-docker/pwd"
+	"github.com/play-with-docker/play-with-docker/storage"
+)
+
+func InstanceSnapshot(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	sessionId := vars["sessionId"]
+	instanceName := vars["instanceName"]
+
+	s, err := core.SessionGet(sessionId)
+	if err == storage.NotFoundError {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	i := core.InstanceGet(s, instanceName)
+	if i == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	snapshot, err := core.InstanceSnapshot(s, i)
+	if err != nil {
+		var accessDenied *pwd.AccessDeniedError
+		if errors.As(err, &accessDenied) {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if pwd.SnapshotNotSupported(err) {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if quotaExceeded(rw, err) {
+			return
+		}
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(snapshot)
+}
+
+func ListSnapshots(rw http.ResponseWriter, req *http.Request) {
+	cookie, err := ReadCookie(req)
+	if err != nil {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	snapshots, err := core.SnapshotFindByUser(cookie.Id)
+	if err != nil {
+		log.Printf("Error listing snapshots for user %s. Got: %v\n", cookie.Id, err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(snapshots)
+}
+
+func DeleteSnapshot(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	snapshotId := vars["snapshotId"]
+
+	cookie, err := ReadCookie(req)
+	if err != nil {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	snapshot, err := core.SnapshotGet(snapshotId)
+	if err == storage.NotFoundError {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if snapshot.UserId != cookie.Id {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if err := core.SnapshotDelete(snapshot); err != nil {
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/scrollback"
+)
+
+// hubSubscriber is how a hub hands output to a terminal manager. out must not
+// block: it queues the output and returns false when the queue of the
+// manager is full, in which case the manager is dropped and told through
+// slow. fail is called when the terminal goes away.
+type hubSubscriber struct {
+	out  func(seq uint64, data []byte) bool
+	fail func()
+	slow func()
+}
+
+// terminalHub owns the connection to a terminal of an instance, either its
+// main terminal or an additional shell. It is shared by every terminal
+// manager showing the terminal and keeps the recent output in a scrollback
+// buffer. The connection stays open for a while after the last manager
+// leaves, so clients that reconnect can resume from the last byte they have
+// seen instead of losing what was printed in between.
+type terminalHub struct {
+	name     string
+	instance *types.Instance
+	execId   string
+	conn     net.Conn
+	buffer   *scrollback.Buffer
+
+	mx     sync.Mutex
+	wmx    sync.Mutex
+	subs   map[*manager]hubSubscriber
+	idle   *time.Timer
+	closed bool
+}
+
+type hubs struct {
+	mx     sync.Mutex
+	once   sync.Once
+	byName map[string]*terminalHub
+}
+
+var terminalHubs = &hubs{byName: map[string]*terminalHub{}}
+
+var terminalNotFoundError = errors.New("Terminal not found")
+
+// attachFunc connects to a terminal of an instance, returning the id of the
+// exec running it if it isn't the main terminal.
+type attachFunc func() (string, net.Conn, error)
+
+func attachMainTerminal(instance *types.Instance) attachFunc {
+	return func() (string, net.Conn, error) {
+		conn, err := core.InstanceGetTerminal(instance)
+		return "", conn, err
+	}
+}
+
+func attachExecTerminal(instance *types.Instance) attachFunc {
+	return func() (string, net.Conn, error) {
+		return core.InstanceExecTerminal(instance)
+	}
+}
+
+// join subscribes m to the terminal called name, calling attach to connect
+// to it if nobody is. With a nil attach only existing terminals are joined.
+// Buffered output from since onwards is replayed before live output. When
+// since is nil the whole buffer is replayed.
+func (h *hubs) join(m *manager, name string, instance *types.Instance, attach attachFunc, since *uint64, s hubSubscriber) (*terminalHub, error) {
+	h.once.Do(func() {
+		e.On(event.INSTANCE_VIEWPORT_RESIZE, func(sessionId string, args ...interface{}) {
+			if name, cols, rows, ok := viewportResizeArgs(args); ok {
+				h.resize(name, cols, rows)
+			}
+		})
+	})
+
+	for {
+		h.mx.Lock()
+		hub, found := h.byName[name]
+		if !found {
+			if attach == nil {
+				h.mx.Unlock()
+				return nil, terminalNotFoundError
+			}
+			execId, conn, err := attach()
+			if err != nil {
+				h.mx.Unlock()
+				return nil, err
+			}
+			hub = &terminalHub{name: name, instance: instance, execId: execId, conn: conn, buffer: scrollback.New(config.TerminalScrollbackSize), subs: map[*manager]hubSubscriber{}}
+			h.byName[name] = hub
+			go hub.read()
+		}
+		h.mx.Unlock()
+
+		// The hub might have been closed in the meantime, in which case a
+		// new one is attached.
+		if hub.subscribe(m, since, s) {
+			return hub, nil
+		}
+		h.remove(hub)
+	}
+}
+
+// viewportResizeArgs reads the arguments of INSTANCE_VIEWPORT_RESIZE events,
+// which are the columns, the rows and the name of the terminal.
+func viewportResizeArgs(args []interface{}) (string, uint, uint, bool) {
+	if len(args) != 3 {
+		return "", 0, 0, false
+	}
+	cols, colsOk := args[0].(uint)
+	rows, rowsOk := args[1].(uint)
+	name, nameOk := args[2].(string)
+	return name, cols, rows, colsOk && rowsOk && nameOk
+}
+
+// resize applies the size negotiated for a terminal by the clients of its
+// session.
+func (h *hubs) resize(name string, cols, rows uint) {
+	h.mx.Lock()
+	hub := h.byName[name]
+	h.mx.Unlock()
+
+	if hub == nil {
+		return
+	}
+	if err := hub.resize(rows, cols); err != nil {
+		log.Printf("Could not resize terminal [%s]. Got: %v\n", name, err)
+	}
+}
+
+func (h *hubs) remove(hub *terminalHub) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if h.byName[hub.name] == hub {
+		delete(h.byName, hub.name)
+	}
+}
+
+func (t *terminalHub) subscribe(m *manager, since *uint64, s hubSubscriber) bool {
+	t.mx.Lock()
+	if t.closed {
+		t.mx.Unlock()
+		return false
+	}
+	if t.idle != nil {
+		t.idle.Stop()
+		t.idle = nil
+	}
+	from := t.buffer.Start()
+	if since != nil {
+		from = *since
+	}
+	if data, seq := t.buffer.Since(from); len(data) > 0 && !s.out(seq, data) {
+		t.mx.Unlock()
+		t.leave(m)
+		s.slow()
+		return true
+	}
+	t.subs[m] = s
+	t.mx.Unlock()
+	return true
+}
+
+// leave unsubscribes m. The hub is closed once nobody has been subscribed for
+// the configured keepalive.
+func (t *terminalHub) leave(m *manager) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	delete(t.subs, m)
+	if len(t.subs) > 0 || t.closed || t.idle != nil {
+		return
+	}
+	t.idle = time.AfterFunc(config.TerminalKeepAlive, func() {
+		t.mx.Lock()
+		idle := len(t.subs) == 0
+		t.mx.Unlock()
+		if idle {
+			t.close()
+		}
+	})
+}
+
+// resize resizes additional shells. The main terminal of an instance is
+// resized by core itself.
+func (t *terminalHub) resize(rows, cols uint) error {
+	if t.execId == "" {
+		return nil
+	}
+	return core.InstanceResizeExecTerminal(t.instance, t.execId, rows, cols)
+}
+
+func (t *terminalHub) write(data []byte) error {
+	t.wmx.Lock()
+	defer t.wmx.Unlock()
+
+	_, err := t.conn.Write(data)
+	return err
+}
+
+func (t *terminalHub) close() {
+	t.mx.Lock()
+	if t.closed {
+		t.mx.Unlock()
+		return
+	}
+	t.closed = true
+	t.mx.Unlock()
+
+	terminalHubs.remove(t)
+	t.conn.Close()
+}
+
+func (t *terminalHub) read() {
+	buf := make([]byte, 1024)
+	for {
+		n, err := t.conn.Read(buf)
+		if err != nil {
+			break
+		}
+		b := make([]byte, n)
+		copy(b, buf[:n])
+
+		t.mx.Lock()
+		seq := t.buffer.End()
+		t.buffer.Write(b)
+		slow := map[*manager]hubSubscriber{}
+		for m, s := range t.subs {
+			if !s.out(seq, b) {
+				slow[m] = s
+			}
+		}
+		t.mx.Unlock()
+		terminalRecorders.output(t.name, b)
+
+		// Managers that can't keep up would hold up everybody else
+		for m, s := range slow {
+			log.Printf("Dropping slow client of terminal [%s]\n", t.name)
+			t.leave(m)
+			s.slow()
+		}
+	}
+
+	t.mx.Lock()
+	closed := t.closed
+	subs := t.subs
+	t.subs = map[*manager]hubSubscriber{}
+	t.mx.Unlock()
+	if closed {
+		return
+	}
+	log.Printf("Terminal of instance [%s] was disconnected\n", t.name)
+	t.close()
+	for _, s := range subs {
+		s.fail()
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/scrollback"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTerminalHub_DropsSlowSubscribers(t *testing.T) {
+	conn, terminal := net.Pipe()
+	defer terminal.Close()
+	hub := &terminalHub{name: "node1", conn: conn, buffer: scrollback.New(1024), subs: map[*manager]hubSubscriber{}}
+	go hub.read()
+
+	slow, fast := &manager{}, &manager{}
+	dropped := make(chan struct{})
+	received := make(chan string, 2)
+	assert.True(t, hub.subscribe(slow, nil, hubSubscriber{
+		out:  func(seq uint64, data []byte) bool { return false },
+		fail: func() {},
+		slow: func() { close(dropped) },
+	}))
+	assert.True(t, hub.subscribe(fast, nil, hubSubscriber{
+		out:  func(seq uint64, data []byte) bool { received <- string(data); return true },
+		fail: func() {},
+		slow: func() { t.Error("fast subscriber was dropped") },
+	}))
+
+	terminal.Write([]byte("hello"))
+	select {
+	case <-dropped:
+	case <-time.After(time.Second):
+		t.Fatal("slow subscriber was not dropped")
+	}
+	terminal.Write([]byte("world"))
+	assert.Equal(t, "hello", <-received)
+	assert.Equal(t, "world", <-received)
+
+	hub.mx.Lock()
+	_, found := hub.subs[slow]
+	hub.mx.Unlock()
+	assert.False(t, found)
+}
+
+func TestManager_CloseStopsReceiving(t *testing.T) {
+	m := &manager{
+		sendCh:    make(chan info),
+		receiveCh: make(chan info),
+		stateCh:   make(chan state),
+		errorCh:   make(chan *types.Instance),
+		instances: map[string]*types.Instance{},
+		done:      make(chan struct{}),
+	}
+	stopped := make(chan struct{}, 3)
+	go func() { m.Receive(func(string, uint64, []byte) {}); stopped <- struct{}{} }()
+	go func() { m.Status(func(string, string) {}); stopped <- struct{}{} }()
+	go func() { m.process(); stopped <- struct{}{} }()
+
+	m.Close()
+	m.Close()
+	for i := 0; i < 3; i++ {
+		select {
+		case <-stopped:
+		case <-time.After(time.Second):
+			t.Fatal("manager goroutines did not stop")
+		}
+	}
+
+	// Nothing blocks once the manager is closed
+	m.Send("node1", []byte("ls"))
+	m.status("node1", "connect")
+	assert.True(t, m.queue("node1", 0, []byte("x")))
+}
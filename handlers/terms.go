@@ -1,54 +1,30 @@
 package handlers
 
 import (
+	"fmt"
 	"log"
-	"net"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/play-with-docker/play-with-docker/cmdline"
 	"github.com/play-with-docker/play-with-docker/event"
 	"github.com/play-with-docker/play-with-docker/pwd/types"
-
-	"golang.org/x/text/encoding"
+	uuid "github.com/satori/go.uuid"
 )
 
+// Additional terminals of an instance are named after the instance followed
+// by this separator and the id of the terminal.
+const terminalSeparator = "#"
+
 type terminal struct {
-	conn     net.Conn
-	write    chan []byte
+	hub      *terminalHub
 	instance *types.Instance
 }
 
-func (t *terminal) Go(ch chan info, ech chan *types.Instance) {
-	go func() {
-		for d := range t.write {
-			_, err := t.conn.Write(d)
-			if err != nil {
-				ech <- t.instance
-				return
-			}
-		}
-	}()
-	go func() {
-		encoder := encoding.Replacement.NewEncoder()
-		buf := make([]byte, 1024)
-		for {
-			n, err := t.conn.Read(buf)
-			if err != nil {
-				ech <- t.instance
-				return
-			}
-			b, err := encoder.Bytes(buf[:n])
-			if err != nil {
-				ech <- t.instance
-				return
-			}
-			ch <- info{name: t.instance.Name, data: b}
-		}
-	}()
-}
-
 type info struct {
 	name string
+	seq  uint64
 	data []byte
 }
 
@@ -57,31 +33,103 @@ type state struct {
 	status string
 }
 
+// receiveQueueSize is how many chunks of terminal output a manager can
+// have waiting to be received before it is considered too slow.
+const receiveQueueSize = 100
+
 type manager struct {
 	session   *types.Session
+	userId    string
 	sendCh    chan info
 	receiveCh chan info
 	stateCh   chan state
 	terminals map[string]*terminal
 	errorCh   chan *types.Instance
 	instances map[string]*types.Instance
+	resume    map[string]uint64
+	lines     map[string]*cmdline.Terminal
+	linesMx   sync.Mutex
+	subs      []event.Subscription
+	onSlow    func()
+	slowOnce  sync.Once
+	done      chan struct{}
+	closeOnce sync.Once
 	sync.Mutex
 }
 
 func (m *manager) Send(name string, data []byte) {
-	m.sendCh <- info{name: name, data: data}
+	select {
+	case m.sendCh <- info{name: name, data: data}:
+	case <-m.done:
+	}
 }
-func (m *manager) Receive(cb func(name string, data []byte)) {
-	for i := range m.receiveCh {
-		cb(i.name, i.data)
+
+// Receive calls cb with the output of every terminal until the manager is
+// closed. seq is the position of data in the output of the terminal.
+func (m *manager) Receive(cb func(name string, seq uint64, data []byte)) {
+	for {
+		select {
+		case i := <-m.receiveCh:
+			cb(i.name, i.seq, i.data)
+		case <-m.done:
+			return
+		}
 	}
 }
+
+// Status calls cb with the changes of status of every terminal until the
+// manager is closed.
 func (m *manager) Status(cb func(name, status string)) {
-	for s := range m.stateCh {
-		cb(s.name, s.status)
+	for {
+		select {
+		case s := <-m.stateCh:
+			cb(s.name, s.status)
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// OnSlow sets what to do when the output of the terminals is not received
+// fast enough, after which the manager gets no more output.
+func (m *manager) OnSlow(cb func()) {
+	m.onSlow = cb
+}
+
+func (m *manager) status(name, status string) {
+	select {
+	case m.stateCh <- state{name: name, status: status}:
+	case <-m.done:
 	}
 }
 
+// queue hands output of a terminal to Receive without blocking the hub of
+// the terminal.
+func (m *manager) queue(name string, seq uint64, data []byte) bool {
+	m.linesMx.Lock()
+	if l, found := m.lines[name]; found {
+		l.Output(data)
+	}
+	m.linesMx.Unlock()
+
+	select {
+	case m.receiveCh <- info{name: name, seq: seq, data: data}:
+		return true
+	case <-m.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (m *manager) slow() {
+	m.slowOnce.Do(func() {
+		if m.onSlow != nil {
+			m.onSlow()
+		}
+	})
+}
+
 func (m *manager) connect(instance *types.Instance) error {
 	if !m.trackingInstance(instance) {
 		return nil
@@ -94,37 +142,114 @@ func (m *manager) connectTerminal(instance *types.Instance) error {
 	m.Lock()
 	defer m.Unlock()
 
-	conn, err := core.InstanceGetTerminal(instance)
+	// Clients that reconnect tell where they left off the first time
+	var since *uint64
+	if seq, found := m.resume[instance.Name]; found {
+		since = &seq
+		delete(m.resume, instance.Name)
+	}
+	err := m.joinTerminal(instance.Name, instance, attachMainTerminal(instance), since, func() {
+		select {
+		case m.errorCh <- instance:
+		case <-m.done:
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// Additional terminals the client had open are still running if it
+	// reconnected before the keepalive expired
+	prefix := instance.Name + terminalSeparator
+	for name, seq := range m.resume {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		seq := seq
+		delete(m.resume, name)
+		m.joinTerminal(name, instance, nil, &seq, m.execTerminalFailed(name))
+	}
+
+	return nil
+}
+
+// joinTerminal subscribes to the terminal called name. m must be locked.
+func (m *manager) joinTerminal(name string, instance *types.Instance, attach attachFunc, since *uint64, fail func()) error {
+	hub, err := terminalHubs.join(m, name, instance, attach, since, hubSubscriber{
+		out: func(seq uint64, data []byte) bool {
+			return m.queue(name, seq, data)
+		},
+		fail: fail,
+		slow: m.slow,
+	})
 	if err != nil {
 		return err
 	}
-	chw := make(chan []byte, 10)
-	t := terminal{conn: conn, write: chw, instance: instance}
-	m.terminals[instance.Name] = &t
-	t.Go(m.receiveCh, m.errorCh)
-	m.stateCh <- state{name: instance.Name, status: "connect"}
+	m.terminals[name] = &terminal{hub: hub, instance: instance}
+	terminalRecorders.join(m, name, instance)
+	m.status(name, "connect")
 
 	return nil
 }
 
+// execTerminalFailed returns what to do when an additional terminal goes
+// away. Unlike the main terminal it isn't reconnected, as its shell is gone.
+func (m *manager) execTerminalFailed(name string) func() {
+	return func() {
+		m.Lock()
+		delete(m.terminals, name)
+		m.Unlock()
+		terminalRecorders.leave(m, name)
+		m.status(name, "close")
+	}
+}
+
+// OpenTerminal starts an additional shell in the instance and returns the
+// name of its terminal.
+func (m *manager) OpenTerminal(instanceName string) (string, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	instance, found := m.instances[instanceName]
+	if !found {
+		return "", fmt.Errorf("Instance [%s] is not part of session [%s]", instanceName, m.session.Id)
+	}
+	name := instanceName + terminalSeparator + uuid.NewV4().String()[:8]
+	if err := m.joinTerminal(name, instance, attachExecTerminal(instance), nil, m.execTerminalFailed(name)); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// CloseTerminal ends the shell of an additional terminal. Every manager
+// showing it is told that it was closed.
+func (m *manager) CloseTerminal(name string) error {
+	t := m.getTerminal(name)
+	if t == nil || t.hub.execId == "" {
+		return terminalNotFoundError
+	}
+	return t.hub.conn.Close()
+}
+
+// disconnectTerminal leaves every terminal of the instance.
 func (m *manager) disconnectTerminal(instance *types.Instance) {
 	m.Lock()
 	defer m.Unlock()
 
-	t := m.terminals[instance.Name]
-	if t != nil {
-		if t.write != nil {
-			close(t.write)
-		}
-		if t.conn != nil {
-			t.conn.Close()
+	for name, t := range m.terminals {
+		if t.instance.Name == instance.Name {
+			t.hub.leave(m)
+			delete(m.terminals, name)
+			terminalRecorders.leave(m, name)
 		}
-		delete(m.terminals, instance.Name)
 	}
 }
 
-func (m *manager) getTerminal(instanceName string) *terminal {
-	return m.terminals[instanceName]
+func (m *manager) getTerminal(name string) *terminal {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.terminals[name]
 }
 
 func (m *manager) trackInstance(instance *types.Instance) {
@@ -160,10 +285,16 @@ func (m *manager) disconnect(instance *types.Instance) {
 func (m *manager) process() {
 	for {
 		select {
+		case <-m.done:
+			return
 		case i := <-m.sendCh:
 			t := m.getTerminal(i.name)
 			if t != nil {
-				t.write <- i.data
+				terminalRecorders.input(i.name, i.data)
+				m.audit(t, i.name, i.data)
+				if err := t.hub.write(i.data); err != nil {
+					log.Printf("Could not write to terminal of instance [%s]. Got: %v\n", i.name, err)
+				}
 			}
 		case instance := <-m.errorCh:
 			// check if it still exists before reconnecting
@@ -172,19 +303,72 @@ func (m *manager) process() {
 				log.Println("Instance doesn't exist anymore. Won't reconnect")
 				continue
 			}
-			m.stateCh <- state{name: instance.Name, status: "reconnect"}
+			m.status(instance.Name, "reconnect")
 			time.AfterFunc(time.Second, func() {
 				m.connect(instance)
 			})
 		}
 	}
 }
-func (m *manager) Close() {
-	for _, i := range m.instances {
-		m.disconnect(i)
+
+// audit logs the command lines typed into the terminal. Lines the terminal
+// didn't echo, like passwords, are left out.
+func (m *manager) audit(t *terminal, name string, data []byte) {
+	m.linesMx.Lock()
+	l, found := m.lines[name]
+	if !found {
+		l = cmdline.NewTerminal()
+		m.lines[name] = l
+	}
+	m.linesMx.Unlock()
+
+	m.logCommands(t, name, l.Input(data))
+}
+
+func (m *manager) logCommands(t *terminal, name string, lines []string) {
+	for _, line := range lines {
+		if _, err := core.CommandNew(m.session, t.instance, name, m.userId, line); err != nil {
+			log.Printf("Could not log command typed into terminal [%s]. Got: %v\n", name, err)
+		}
+	}
+}
+
+// flushCommands logs the lines whose echo arrived after the last input.
+func (m *manager) flushCommands() {
+	m.linesMx.Lock()
+	lines := make(map[string]*cmdline.Terminal, len(m.lines))
+	for name, l := range m.lines {
+		lines[name] = l
+	}
+	m.linesMx.Unlock()
+
+	for name, l := range lines {
+		if t := m.getTerminal(name); t != nil {
+			m.logCommands(t, name, l.Flush())
+		}
 	}
 }
 
+// Close leaves every terminal and stops the goroutines of the manager.
+func (m *manager) Close() {
+	m.closeOnce.Do(func() {
+		for _, sub := range m.subs {
+			sub.Unsubscribe()
+		}
+		m.flushCommands()
+		m.Lock()
+		instances := make([]*types.Instance, 0, len(m.instances))
+		for _, i := range m.instances {
+			instances = append(instances, i)
+		}
+		m.Unlock()
+		for _, i := range instances {
+			m.disconnect(i)
+		}
+		close(m.done)
+	})
+}
+
 func (m *manager) Start() error {
 	instances, err := core.InstanceFindBySession(m.session)
 	if err != nil {
@@ -198,18 +382,28 @@ func (m *manager) Start() error {
 	return nil
 }
 
-func NewManager(s *types.Session) (*manager, error) {
+// NewManager creates a terminal manager for the session, used by the given
+// user if they are logged in. resume holds the position in the output of each
+// terminal the client has already seen.
+func NewManager(s *types.Session, userId string, resume map[string]uint64) (*manager, error) {
+	if resume == nil {
+		resume = map[string]uint64{}
+	}
 	m := &manager{
 		session:   s,
+		userId:    userId,
 		sendCh:    make(chan info, 10),
-		receiveCh: make(chan info, 10),
+		receiveCh: make(chan info, receiveQueueSize),
 		stateCh:   make(chan state, 10),
 		terminals: make(map[string]*terminal),
 		errorCh:   make(chan *types.Instance, 10),
 		instances: make(map[string]*types.Instance),
+		resume:    resume,
+		lines:     make(map[string]*cmdline.Terminal),
+		done:      make(chan struct{}),
 	}
 
-	e.On(event.INSTANCE_NEW, func(sessionId string, args ...interface{}) {
+	newSub := e.On(event.INSTANCE_NEW, func(sessionId string, args ...interface{}) {
 		if sessionId != s.Id {
 			return
 		}
@@ -225,7 +419,7 @@ func NewManager(s *types.Session) (*manager, error) {
 		m.connect(instance)
 	})
 
-	e.On(event.INSTANCE_DELETE, func(sessionId string, args ...interface{}) {
+	deleteSub := e.On(event.INSTANCE_DELETE, func(sessionId string, args ...interface{}) {
 		if sessionId != s.Id {
 			return
 		}
@@ -235,6 +429,7 @@ func NewManager(s *types.Session) (*manager, error) {
 		instance := &types.Instance{Name: instanceName}
 		m.disconnect(instance)
 	})
+	m.subs = []event.Subscription{newSub, deleteSub}
 
 	return m, nil
 }
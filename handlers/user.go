@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/play-with-docker/play-with-docker/pwd"
 	"github.com/play-with-docker/play-with-docker/storage"
 )
 
@@ -34,3 +35,27 @@ func GetUser(rw http.ResponseWriter, req *http.Request) {
 	pui := PublicUserInfo{Id: u.Id, Avatar: u.Avatar, Name: u.Name}
 	json.NewEncoder(rw).Encode(pui)
 }
+
+// UnlinkIdentity removes an account with a provider from the logged in user.
+func UnlinkIdentity(rw http.ResponseWriter, req *http.Request) {
+	user := loggedInUser(rw, req)
+	if user == nil {
+		return
+	}
+	vars := mux.Vars(req)
+
+	err := core.UserUnlinkIdentity(user, vars["provider"], vars["providerUserId"])
+	if storage.NotFound(err) {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if pwd.LastIdentity(err) {
+		rw.WriteHeader(http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(user)
+}
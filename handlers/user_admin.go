@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+)
+
+// adminUser returns the user in the URL, banned or not.
+func adminUser(rw http.ResponseWriter, req *http.Request) *types.User {
+	userId := mux.Vars(req)["userId"]
+
+	user, err := core.UserGet(userId)
+	if storage.NotFound(err) {
+		rw.WriteHeader(http.StatusNotFound)
+		return nil
+	} else if err != nil && user == nil {
+		log.Printf("Couldn't get user with id %s. Got: %v\n", userId, err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return nil
+	}
+	return user
+}
+
+// ListUsers lists the users matching the q query parameter.
+func ListUsers(rw http.ResponseWriter, req *http.Request) {
+	users, err := core.UserList(req.URL.Query().Get("q"))
+	if err != nil {
+		log.Printf("Error listing users. Got: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(users)
+}
+
+func BanUser(rw http.ResponseWriter, req *http.Request) {
+	user := adminUser(rw, req)
+	if user == nil {
+		return
+	}
+
+	log.Printf("Banning user [%s]\n", user.Id)
+	if err := core.UserBan(user); err != nil {
+		log.Printf("Could not ban user [%s]. Got: %v\n", user.Id, err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(user)
+}
+
+func UnbanUser(rw http.ResponseWriter, req *http.Request) {
+	user := adminUser(rw, req)
+	if user == nil {
+		return
+	}
+
+	if err := core.UserUnban(user); err != nil {
+		log.Printf("Could not unban user [%s]. Got: %v\n", user.Id, err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(user)
+}
+
+func DeleteUser(rw http.ResponseWriter, req *http.Request) {
+	user := adminUser(rw, req)
+	if user == nil {
+		return
+	}
+
+	log.Printf("Deleting user [%s]\n", user.Id)
+	if err := core.UserDelete(user); err != nil {
+		log.Printf("Could not delete user [%s]. Got: %v\n", user.Id, err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// ListUserSessions returns the history of the sessions of the user.
+func ListUserSessions(rw http.ResponseWriter, req *http.Request) {
+	user := adminUser(rw, req)
+	if user == nil {
+		return
+	}
+
+	sessionLogs, err := core.SessionLogFindByUser(user.Id)
+	if err != nil {
+		log.Printf("Error listing sessions of user [%s]. Got: %v\n", user.Id, err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(sessionLogs)
+}
+
+// ImpersonateUser logs the caller in as the user, to see the playground the
+// way they do. The cookie remembers who is impersonating.
+func ImpersonateUser(rw http.ResponseWriter, req *http.Request) {
+	user := adminUser(rw, req)
+	if user == nil {
+		return
+	}
+
+	impersonator := "admin-token"
+	if cookie, err := ReadCookie(req); err == nil {
+		impersonator = cookie.Id
+	}
+	log.Printf("User [%s] is impersonating user [%s]\n", impersonator, user.Id)
+
+	if err := setLoginCookie(rw, req, user, impersonator); err != nil {
+		log.Printf("Could not encode cookie. Got: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(user)
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/play-with-docker/play-with-docker/storage"
+)
+
+func ListUserVolumes(rw http.ResponseWriter, req *http.Request) {
+	volumes, err := core.UserVolumeList()
+	if err != nil {
+		log.Printf("Error listing user volumes. Got: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(volumes)
+}
+
+func DeleteUserVolume(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	volumeName := vars["volumeName"]
+
+	volume, err := core.UserVolumeGet(volumeName)
+	if err == storage.NotFoundError {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := core.UserVolumeDelete(volume); err != nil {
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
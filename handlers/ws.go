@@ -5,19 +5,28 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
 	"github.com/play-with-docker/play-with-docker/storage"
 	"github.com/satori/go.uuid"
 )
 
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
+	CheckOrigin:  checkWSOrigin,
+	Subprotocols: []string{protocolV2},
 }
 
+// How long writing a message to a websocket may take before the client is
+// considered gone.
+const wsWriteTimeout = 10 * time.Second
+
 type message struct {
 	Name string        `json:"name"`
 	Args []interface{} `json:"args"`
@@ -30,6 +39,8 @@ type socket struct {
 	r         *http.Request
 	id        string
 	closed    bool
+	closeOnce sync.Once
+	binary    bool
 }
 
 func newSocket(r *http.Request, c *websocket.Conn) *socket {
@@ -38,6 +49,7 @@ func newSocket(r *http.Request, c *websocket.Conn) *socket {
 		listeners: map[string][]func(args ...interface{}){},
 		r:         r,
 		id:        uuid.NewV4().String(),
+		binary:    c.Subprotocol() == protocolV2,
 	}
 }
 
@@ -49,9 +61,16 @@ func (s *socket) Request() *http.Request {
 	return s.r
 }
 
+// Close stops writing to the socket and runs the close listeners. The read
+// loop and a failed write can both close the socket, the listeners only run
+// the first time.
 func (s *socket) Close() {
-	s.closed = true
-	s.onMessage(message{Name: "close"})
+	s.closeOnce.Do(func() {
+		s.mx.Lock()
+		s.closed = true
+		s.mx.Unlock()
+		s.onMessage(message{Name: "close"})
+	})
 }
 
 func (s *socket) process() {
@@ -62,6 +81,16 @@ func (s *socket) process() {
 			log.Printf("Error reading message from websocket. Got: %v\n", err)
 			break
 		}
+		if mt == websocket.BinaryMessage && s.binary {
+			// Terminal input is handled in order, as it arrives
+			f, err := decodeFrame(m)
+			if err != nil || f.kind != frameTerminalIn {
+				log.Printf("Received invalid binary frame from websocket.\n")
+				continue
+			}
+			s.dispatch(message{Name: "instance terminal in", Args: []interface{}{f.name, string(f.data)}})
+			continue
+		}
 		if mt != websocket.TextMessage {
 			log.Printf("Received websocket message, but it is not a text message.\n")
 			continue
@@ -90,24 +119,56 @@ func (s *socket) onMessage(msg message) {
 	}
 }
 
-func (s *socket) Emit(ev string, args ...interface{}) {
+// dispatch calls the listeners of the message synchronously.
+func (s *socket) dispatch(msg message) {
 	s.mx.Lock()
-	defer s.mx.Unlock()
+	cbs := s.listeners[msg.Name]
+	s.mx.Unlock()
 
-	if s.closed {
+	for _, cb := range cbs {
+		cb(msg.Args...)
+	}
+}
+
+// EmitTerminalOut sends output of the terminal of an instance, as a binary
+// frame if the socket speaks the binary protocol.
+func (s *socket) EmitTerminalOut(name string, data []byte) {
+	if !s.binary {
+		s.Emit("instance terminal out", name, legacyTerminalData(data))
 		return
 	}
 
+	b, err := encodeFrame(frame{kind: frameTerminalOut, name: name, data: data})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	s.write(websocket.BinaryMessage, b)
+}
+
+func (s *socket) Emit(ev string, args ...interface{}) {
 	m := message{Name: ev, Args: args}
 	b, err := json.Marshal(m)
 	if err != nil {
 		log.Printf("Cannot marshal event to json. Got: %v\n", err)
 		return
 	}
-	if err := s.c.WriteMessage(websocket.TextMessage, b); err != nil {
+	s.write(websocket.TextMessage, b)
+}
+
+func (s *socket) write(mt int, b []byte) {
+	s.mx.Lock()
+	if s.closed {
+		s.mx.Unlock()
+		return
+	}
+	s.c.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	err := s.c.WriteMessage(mt, b)
+	s.mx.Unlock()
+
+	if err != nil {
 		log.Printf("Cannot write event to websocket connection. Got: %v\n", err)
 		s.Close()
-		return
 	}
 }
 
@@ -122,7 +183,49 @@ func (s *socket) On(ev string, cb func(args ...interface{})) {
 	s.listeners[ev] = listeners
 }
 
+// resumePositions parses the resume query parameters of a reconnecting
+// client. Each one is an instance name and the position in the output of its
+// terminal the client has seen, separated by a colon.
+func resumePositions(r *http.Request) map[string]uint64 {
+	positions := map[string]uint64{}
+	for _, p := range r.URL.Query()["resume"] {
+		i := strings.LastIndex(p, ":")
+		if i < 0 {
+			continue
+		}
+		seq, err := strconv.ParseUint(p[i+1:], 10, 64)
+		if err != nil {
+			continue
+		}
+		positions[p[:i]] = seq
+	}
+	return positions
+}
+
+// WSH only upgrades requests from the owner of the session or from holders
+// of one of its shares. Sockets opened through a share are closed when the
+// share is revoked or expires.
 func WSH(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sessionId := vars["sessionId"]
+
+	session, err := core.SessionGet(sessionId)
+	if err == storage.NotFoundError {
+		log.Printf("Session with id [%s] does not exist!\n", sessionId)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	access, share, err := authorizeSession(r, session)
+	if err != nil {
+		log.Printf("Denied websocket for session [%s]. Got: %v\n", sessionId, err)
+		w.WriteHeader(accessDeniedStatus(err))
+		return
+	}
+
 	c, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Print("upgrade:", err)
@@ -131,80 +234,173 @@ func WSH(w http.ResponseWriter, r *http.Request) {
 	defer c.Close()
 
 	s := newSocket(r, c)
-	ws(s)
+	if share != nil {
+		defer trackShareSocket(share, s)()
+	}
+	ws(s, session, access)
 	s.process()
 }
 
-func ws(so *socket) {
+// ws attaches the socket to the session. Observers can watch the terminals
+// but their input, resizes and requests to close the session are dropped.
+func ws(so *socket, session *types.Session, access sessionAccess) {
 	defer func() {
 		if r := recover(); r != nil {
 			fmt.Println("Recovered from ", r)
 		}
 	}()
-	vars := mux.Vars(so.Request())
+	readOnly := access < accessCollaborator
 
-	sessionId := vars["sessionId"]
-
-	session, err := core.SessionGet(sessionId)
-	if err == storage.NotFoundError {
-		log.Printf("Session with id [%s] does not exist!\n", sessionId)
-		return
+	var userId string
+	if cookie, err := ReadCookie(so.Request()); err == nil {
+		userId = cookie.Id
 	}
-
-	client := core.ClientNew(so.Id(), session)
+	client := core.ClientNew(so.Id(), session, userId)
 	if client == nil {
 		log.Printf("ERROR: Client was not created for session id %s and socket id %s\n", session.Id, so.Id())
 	}
 
-	m, err := NewManager(session)
+	m, err := NewManager(session, userId, resumePositions(so.Request()))
 	if err != nil {
 		log.Printf("Error creating terminal manager. Got: %v", err)
 		return
 	}
 
-	go m.Receive(func(name string, data []byte) {
-		so.Emit("instance terminal out", name, string(data))
+	// Tell the client where the output of a terminal starts whenever it
+	// doesn't follow what was sent last, so it can resume from there.
+	sent := map[string]uint64{}
+	go m.Receive(func(name string, seq uint64, data []byte) {
+		if end, found := sent[name]; !found || end != seq {
+			so.Emit("instance terminal seq", name, seq)
+		}
+		sent[name] = seq + uint64(len(data))
+		so.EmitTerminalOut(name, data)
 	})
 	go m.Status(func(name, status string) {
 		so.Emit("instance terminal status", name, status)
 	})
+	// Clients that can't keep up are disconnected, they resume from where
+	// they were when they reconnect
+	m.OnSlow(func() {
+		log.Printf("Closing websocket of slow client of session [%s]\n", session.Id)
+		so.c.Close()
+	})
 
 	err = m.Start()
 	if err != nil {
 		log.Println(err)
+		m.Close()
 		return
 	}
 
 	so.On("session close", func(args ...interface{}) {
+		if readOnly {
+			return
+		}
 		m.Close()
 		core.SessionClose(session)
 	})
 
 	so.On("instance terminal in", func(args ...interface{}) {
-		if len(args) == 2 && args[0] != nil && args[1] != nil {
-			name := args[0].(string)
-			data := args[1].(string)
+		if readOnly {
+			return
+		}
+		if len(args) != 2 {
+			return
+		}
+		name, nameOk := args[0].(string)
+		data, dataOk := args[1].(string)
+		if nameOk && dataOk {
 			m.Send(name, []byte(data))
 		}
 	})
 
-	so.On("instance viewport resize", func(args ...interface{}) {
-		if len(args) == 2 && args[0] != nil && args[1] != nil {
-			// User resized his viewport
-			cols := args[0].(float64)
-			rows := args[1].(float64)
-			core.ClientResizeViewPort(client, uint(cols), uint(rows))
+	so.On("instance terminal open", func(args ...interface{}) {
+		if readOnly {
+			return
+		}
+		if len(args) != 1 {
+			return
+		}
+		if instanceName, ok := args[0].(string); ok {
+			name, err := m.OpenTerminal(instanceName)
+			if err != nil {
+				log.Printf("Could not open terminal in instance [%s]. Got: %v\n", instanceName, err)
+				so.Emit("instance terminal error", instanceName, err.Error())
+				return
+			}
+			so.Emit("instance terminal opened", instanceName, name)
 		}
 	})
 
-	so.On("close", func(args ...interface{}) {
-		m.Close()
-		core.ClientClose(client)
+	so.On("instance terminal close", func(args ...interface{}) {
+		if readOnly {
+			return
+		}
+		if len(args) != 1 {
+			return
+		}
+		if name, ok := args[0].(string); ok {
+			if err := m.CloseTerminal(name); err != nil {
+				log.Printf("Could not close terminal [%s]. Got: %v\n", name, err)
+			}
+		}
+	})
+
+	so.On("instance terminal resize", func(args ...interface{}) {
+		if readOnly {
+			return
+		}
+		if len(args) != 3 {
+			return
+		}
+		name, nameOk := args[0].(string)
+		cols, colsOk := args[1].(float64)
+		rows, rowsOk := args[2].(float64)
+		if nameOk && colsOk && rowsOk {
+			core.ClientResizeTerminal(client, name, uint(cols), uint(rows))
+		}
+	})
+
+	so.On("session resize policy", func(args ...interface{}) {
+		if access < accessOwner {
+			return
+		}
+		if len(args) != 1 {
+			return
+		}
+		if policy, ok := args[0].(string); ok {
+			if err := core.SessionSetResizePolicy(session, policy); err != nil {
+				log.Printf("Could not set resize policy of session [%s]. Got: %v\n", session.Id, err)
+			}
+		}
 	})
 
-	e.OnAny(func(eventType event.EventType, sessionId string, args ...interface{}) {
+	so.On("instance viewport resize", func(args ...interface{}) {
+		// Observers must not shrink the terminals of whoever they are watching
+		if readOnly {
+			return
+		}
+		if len(args) != 2 {
+			return
+		}
+		// User resized his viewport
+		cols, colsOk := args[0].(float64)
+		rows, rowsOk := args[1].(float64)
+		if colsOk && rowsOk {
+			core.ClientResizeViewPort(client, uint(cols), uint(rows))
+		}
+	})
+
+	sub := e.OnAnyClient(func(eventType event.EventType, sessionId string, args ...interface{}) {
 		if session.Id == sessionId {
 			so.Emit(eventType.String(), args...)
 		}
 	})
+
+	so.On("close", func(args ...interface{}) {
+		sub.Unsubscribe()
+		m.Close()
+		core.ClientClose(client)
+	})
 }
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSocketClose_Once(t *testing.T) {
+	s := &socket{listeners: map[string][]func(args ...interface{}){}}
+	closes := make(chan struct{}, 2)
+	s.On("close", func(args ...interface{}) {
+		closes <- struct{}{}
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Close()
+		}()
+	}
+	wg.Wait()
+
+	<-closes
+	select {
+	case <-closes:
+		t.Fatal("Close listeners ran twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Nothing is written to closed sockets
+	s.write(websocket.TextMessage, []byte("{}"))
+	assert.True(t, s.closed)
+}
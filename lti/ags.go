@@ -0,0 +1,99 @@
+package lti
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Score is the result of a user in the activity of a line item.
+type Score struct {
+	UserId  string
+	Given   float64
+	Maximum float64
+	Comment string
+}
+
+// PostScore publishes the score to the gradebook of the platform. The tool
+// authenticates with a client credentials grant signed with its key.
+func (p *Platform) PostScore(ctx context.Context, tool *Tool, lineItem string, score Score) error {
+	token, err := p.accessToken(ctx, tool, ScopeScore)
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(lineItem)
+	if err != nil {
+		return err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/scores"
+
+	body, err := json.Marshal(map[string]interface{}{
+		"userId":           score.UserId,
+		"scoreGiven":       score.Given,
+		"scoreMaximum":     score.Maximum,
+		"comment":          score.Comment,
+		"activityProgress": "Completed",
+		"gradingProgress":  "FullyGraded",
+		"timestamp":        time.Now().Format("2006-01-02T15:04:05.000Z07:00"),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.ims.lis.v1.score+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("Could not post score to %s. Got status %d", u, resp.StatusCode)
+	}
+	return nil
+}
+
+func (p *Platform) accessToken(ctx context.Context, tool *Tool, scope string) (string, error) {
+	assertion, err := tool.assertion(p.conf.ClientID, p.conf.AuthTokenURL)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+	form.Set("client_assertion", assertion)
+	form.Set("scope", scope)
+
+	req, err := http.NewRequest("POST", p.conf.AuthTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Could not get an access token from %s. Got status %d", p.conf.AuthTokenURL, resp.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
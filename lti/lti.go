@@ -0,0 +1,205 @@
+// Package lti lets learning management systems launch sessions as an LTI 1.3
+// tool. Platforms start launches through an OpenID Connect login initiation
+// and send the launch as an ID token, which is verified against the keys
+// they publish. Scores are posted back through the Assignment and Grade
+// Services.
+package lti
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/play-with-docker/play-with-docker/oidc"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+const (
+	claimMessageType  = "https://purl.imsglobal.org/spec/lti/claim/message_type"
+	claimVersion      = "https://purl.imsglobal.org/spec/lti/claim/version"
+	claimDeploymentId = "https://purl.imsglobal.org/spec/lti/claim/deployment_id"
+	claimContext      = "https://purl.imsglobal.org/spec/lti/claim/context"
+	claimCustom       = "https://purl.imsglobal.org/spec/lti/claim/custom"
+	claimRoles        = "https://purl.imsglobal.org/spec/lti/claim/roles"
+	claimAGSEndpoint  = "https://purl.imsglobal.org/spec/lti-ags/claim/endpoint"
+
+	// ScopeScore lets the tool post scores to line items.
+	ScopeScore = "https://purl.imsglobal.org/spec/lti-ags/scope/score"
+)
+
+var (
+	unsupportedMessageError = errors.New("LTI message is not a resource link launch")
+	unknownDeploymentError  = errors.New("LTI launch comes from an unknown deployment")
+)
+
+// InvalidLaunch tells whether err comes from a launch that didn't pass
+// verification.
+func InvalidLaunch(err error) bool {
+	return err == unsupportedMessageError || err == unknownDeploymentError || oidc.InvalidToken(err)
+}
+
+// Launch is a verified resource link launch.
+type Launch struct {
+	UserId       string
+	Name         string
+	Email        string
+	Picture      string
+	DeploymentId string
+	ContextId    string
+	ContextTitle string
+	ContextLabel string
+	// Roles are the LIS roles of the user in the context.
+	Roles []string
+	// Custom are the custom parameters of the resource link.
+	Custom map[string]string
+	// LineItem is where scores of the launch are posted. It is empty when the
+	// platform doesn't let the tool post scores.
+	LineItem string
+}
+
+// instructorRoles are the roles of users that teach, as context roles,
+// institution roles or the short and LTI 1.1 names some platforms still send.
+var instructorRoles = map[string]bool{
+	"http://purl.imsglobal.org/vocab/lis/v2/membership#Instructor":         true,
+	"http://purl.imsglobal.org/vocab/lis/v2/institution/person#Instructor": true,
+	"Instructor":                          true,
+	"urn:lti:role:ims/lis/Instructor":     true,
+	"urn:lti:instrole:ims/lis/Instructor": true,
+}
+
+// instructorSubRolePrefix starts the sub-roles of instructors, like teaching
+// assistants.
+const instructorSubRolePrefix = "http://purl.imsglobal.org/vocab/lis/v2/membership/Instructor#"
+
+// Instructor tells whether the user teaches the context of the launch.
+func (l *Launch) Instructor() bool {
+	for _, r := range l.Roles {
+		if instructorRoles[r] || strings.HasPrefix(r, instructorSubRolePrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Platform is a learning management system the tool is registered with.
+type Platform struct {
+	conf     types.LTIPlatform
+	provider *oidc.Provider
+}
+
+func NewPlatform(conf types.LTIPlatform) *Platform {
+	return &Platform{conf: conf, provider: oidc.NewProvider(conf.Issuer, conf.KeySetURL)}
+}
+
+func (p *Platform) Name() string {
+	return p.conf.Name
+}
+
+func (p *Platform) Issuer() string {
+	return p.conf.Issuer
+}
+
+func (p *Platform) ClientID() string {
+	return p.conf.ClientID
+}
+
+// AuthRequestURL answers a login initiation of the platform. The user is sent
+// back to it to authenticate, and the platform then posts the launch to
+// redirectURI along with the state.
+func (p *Platform) AuthRequestURL(redirectURI, loginHint, messageHint, state, nonce string) string {
+	q := url.Values{}
+	q.Set("scope", "openid")
+	q.Set("response_type", "id_token")
+	q.Set("response_mode", "form_post")
+	q.Set("prompt", "none")
+	q.Set("client_id", p.conf.ClientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("login_hint", loginHint)
+	if messageHint != "" {
+		q.Set("lti_message_hint", messageHint)
+	}
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+
+	u, err := url.Parse(p.conf.AuthLoginURL)
+	if err != nil {
+		return p.conf.AuthLoginURL + "?" + q.Encode()
+	}
+	for k, v := range u.Query() {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// ParseLaunch verifies the ID token the platform posted and returns the
+// launch it carries. The token must have been issued for the login request
+// with the given nonce.
+func (p *Platform) ParseLaunch(ctx context.Context, rawIDToken, nonce string) (*Launch, error) {
+	claims, err := p.provider.Verify(ctx, rawIDToken, p.conf.ClientID, nonce)
+	if err != nil {
+		return nil, err
+	}
+	if claims.String(claimMessageType) != "LtiResourceLinkRequest" || claims.String(claimVersion) != "1.3.0" {
+		return nil, unsupportedMessageError
+	}
+
+	launch := &Launch{
+		UserId:       claims.String("sub"),
+		Name:         claims.String("name"),
+		Email:        claims.String("email"),
+		Picture:      claims.String("picture"),
+		DeploymentId: claims.String(claimDeploymentId),
+		Custom:       map[string]string{},
+	}
+	if !p.knownDeployment(launch.DeploymentId) {
+		return nil, unknownDeploymentError
+	}
+
+	if c, ok := claims[claimContext].(map[string]interface{}); ok {
+		course := oidc.Claims(c)
+		launch.ContextId = course.String("id")
+		launch.ContextTitle = course.String("title")
+		launch.ContextLabel = course.String("label")
+	}
+	if roles, ok := claims[claimRoles].([]interface{}); ok {
+		for _, r := range roles {
+			if role, ok := r.(string); ok {
+				launch.Roles = append(launch.Roles, role)
+			}
+		}
+	}
+	if c, ok := claims[claimCustom].(map[string]interface{}); ok {
+		custom := oidc.Claims(c)
+		for name := range custom {
+			launch.Custom[name] = custom.String(name)
+		}
+	}
+	if c, ok := claims[claimAGSEndpoint].(map[string]interface{}); ok {
+		ags := oidc.Claims(c)
+		if scopes, ok := ags["scope"].([]interface{}); ok {
+			for _, s := range scopes {
+				if s == ScopeScore {
+					launch.LineItem = ags.String("lineitem")
+				}
+			}
+		}
+	}
+
+	return launch, nil
+}
+
+// knownDeployment tells whether launches from the deployment are accepted.
+// Platforms that don't list their deployments accept all of them.
+func (p *Platform) knownDeployment(id string) bool {
+	if len(p.conf.DeploymentIds) == 0 {
+		return id != ""
+	}
+	for _, d := range p.conf.DeploymentIds {
+		if d == id {
+			return true
+		}
+	}
+	return false
+}
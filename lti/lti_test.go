@@ -0,0 +1,236 @@
+package lti
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockPlatform is a local learning management system that signs launches
+// with an RSA key and records the scores posted to it.
+type mockPlatform struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	scores []map[string]interface{}
+}
+
+func newMockPlatform(t *testing.T, tool *Tool) *mockPlatform {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	m := &mockPlatform{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/keys", func(rw http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(rw).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "platform",
+				"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(rw http.ResponseWriter, req *http.Request) {
+		req.ParseForm()
+		parts := strings.Split(req.Form.Get("client_assertion"), ".")
+		if req.Form.Get("grant_type") != "client_credentials" || req.Form.Get("scope") != ScopeScore || len(parts) != 3 {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if rsa.VerifyPKCS1v15(&tool.key.PublicKey, crypto.SHA256, digest[:], signature) != nil {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(rw).Encode(map[string]string{"access_token": "access", "token_type": "Bearer"})
+	})
+	mux.HandleFunc("/lineitems/1/scores", func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer access" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		score := map[string]interface{}{}
+		json.NewDecoder(req.Body).Decode(&score)
+		m.scores = append(m.scores, score)
+	})
+	m.server = httptest.NewServer(mux)
+	return m
+}
+
+func (m *mockPlatform) conf() types.LTIPlatform {
+	return types.LTIPlatform{
+		Name:          "lms",
+		Issuer:        m.server.URL,
+		ClientID:      "client1",
+		DeploymentIds: []string{"deployment1"},
+		AuthLoginURL:  m.server.URL + "/auth?platform=1",
+		AuthTokenURL:  m.server.URL + "/token",
+		KeySetURL:     m.server.URL + "/keys",
+	}
+}
+
+func (m *mockPlatform) launch(t *testing.T, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "platform"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, digest[:])
+	assert.Nil(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (m *mockPlatform) claims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":             m.server.URL,
+		"aud":             "client1",
+		"sub":             "student1",
+		"name":            "Student One",
+		"nonce":           "nonce1",
+		"exp":             time.Now().Add(time.Hour).Unix(),
+		claimMessageType:  "LtiResourceLinkRequest",
+		claimVersion:      "1.3.0",
+		claimDeploymentId: "deployment1",
+		claimContext:      map[string]string{"id": "course1", "title": "Compilers", "label": "CS101"},
+		claimCustom:       map[string]string{"image": "franela/dind", "exam": "loops"},
+		claimRoles:        []string{"http://purl.imsglobal.org/vocab/lis/v2/membership#Learner"},
+		claimAGSEndpoint: map[string]interface{}{
+			"scope":    []string{ScopeScore},
+			"lineitem": m.server.URL + "/lineitems/1",
+		},
+	}
+}
+
+func newTestTool(t *testing.T) *Tool {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	return NewTool(key)
+}
+
+func TestAuthRequestURL(t *testing.T) {
+	p := NewPlatform(types.LTIPlatform{ClientID: "client1", AuthLoginURL: "https://lms.example.com/auth?platform=1"})
+
+	u, err := url.Parse(p.AuthRequestURL("https://pwd.example.com/lti/launch", "hint", "", "state1", "nonce1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "lms.example.com", u.Host)
+	q := u.Query()
+	assert.Equal(t, "1", q.Get("platform"))
+	assert.Equal(t, "id_token", q.Get("response_type"))
+	assert.Equal(t, "form_post", q.Get("response_mode"))
+	assert.Equal(t, "client1", q.Get("client_id"))
+	assert.Equal(t, "https://pwd.example.com/lti/launch", q.Get("redirect_uri"))
+	assert.Equal(t, "hint", q.Get("login_hint"))
+	assert.Equal(t, "state1", q.Get("state"))
+	assert.Equal(t, "nonce1", q.Get("nonce"))
+	_, found := q["lti_message_hint"]
+	assert.False(t, found)
+}
+
+func TestParseLaunch(t *testing.T) {
+	m := newMockPlatform(t, newTestTool(t))
+	defer m.server.Close()
+	ctx := context.Background()
+
+	p := NewPlatform(m.conf())
+
+	launch, err := p.ParseLaunch(ctx, m.launch(t, m.claims()), "nonce1")
+	assert.Nil(t, err)
+	assert.Equal(t, &Launch{
+		UserId:       "student1",
+		Name:         "Student One",
+		DeploymentId: "deployment1",
+		ContextId:    "course1",
+		ContextTitle: "Compilers",
+		ContextLabel: "CS101",
+		Roles:        []string{"http://purl.imsglobal.org/vocab/lis/v2/membership#Learner"},
+		Custom:       map[string]string{"image": "franela/dind", "exam": "loops"},
+		LineItem:     m.server.URL + "/lineitems/1",
+	}, launch)
+	assert.False(t, launch.Instructor())
+
+	_, err = p.ParseLaunch(ctx, m.launch(t, m.claims()), "nonce2")
+	assert.True(t, InvalidLaunch(err))
+
+	c := m.claims()
+	c[claimDeploymentId] = "deployment2"
+	_, err = p.ParseLaunch(ctx, m.launch(t, c), "nonce1")
+	assert.Equal(t, unknownDeploymentError, err)
+
+	c = m.claims()
+	c[claimMessageType] = "LtiDeepLinkingRequest"
+	_, err = p.ParseLaunch(ctx, m.launch(t, c), "nonce1")
+	assert.Equal(t, unsupportedMessageError, err)
+
+	c = m.claims()
+	c[claimRoles] = []string{"http://purl.imsglobal.org/vocab/lis/v2/membership#Instructor"}
+	launch, err = p.ParseLaunch(ctx, m.launch(t, c), "nonce1")
+	assert.Nil(t, err)
+	assert.True(t, launch.Instructor())
+
+	// Scores can't be posted without the score scope
+	c = m.claims()
+	c[claimAGSEndpoint] = map[string]interface{}{"lineitem": m.server.URL + "/lineitems/1"}
+	launch, err = p.ParseLaunch(ctx, m.launch(t, c), "nonce1")
+	assert.Nil(t, err)
+	assert.Empty(t, launch.LineItem)
+}
+
+func TestLaunchInstructor(t *testing.T) {
+	instructors := []string{
+		"http://purl.imsglobal.org/vocab/lis/v2/membership#Instructor",
+		"http://purl.imsglobal.org/vocab/lis/v2/membership/Instructor#TeachingAssistant",
+		"http://purl.imsglobal.org/vocab/lis/v2/institution/person#Instructor",
+		"Instructor",
+		"urn:lti:role:ims/lis/Instructor",
+	}
+	for _, r := range instructors {
+		l := &Launch{Roles: []string{"http://purl.imsglobal.org/vocab/lis/v2/membership#Learner", r}}
+		assert.True(t, l.Instructor(), r)
+	}
+
+	others := []string{
+		"http://purl.imsglobal.org/vocab/lis/v2/membership#Learner",
+		"http://purl.imsglobal.org/vocab/lis/v2/membership/Learner#Instructor",
+		"http://purl.imsglobal.org/vocab/lis/v2/institution/person#Student",
+		"Learner",
+	}
+	for _, r := range others {
+		l := &Launch{Roles: []string{r}}
+		assert.False(t, l.Instructor(), r)
+	}
+}
+
+func TestPostScore(t *testing.T) {
+	tool := newTestTool(t)
+	m := newMockPlatform(t, tool)
+	defer m.server.Close()
+
+	p := NewPlatform(m.conf())
+
+	err := p.PostScore(context.Background(), tool, m.server.URL+"/lineitems/1?type=exam", Score{UserId: "student1", Given: 7, Maximum: 10})
+	assert.Nil(t, err)
+	assert.Len(t, m.scores, 1)
+	assert.Equal(t, "student1", m.scores[0]["userId"])
+	assert.Equal(t, float64(7), m.scores[0]["scoreGiven"])
+	assert.Equal(t, float64(10), m.scores[0]["scoreMaximum"])
+	assert.Equal(t, "FullyGraded", m.scores[0]["gradingProgress"])
+
+	// Platforms only accept assertions signed by the registered tool
+	err = p.PostScore(context.Background(), newTestTool(t), m.server.URL+"/lineitems/1", Score{UserId: "student1", Given: 7, Maximum: 10})
+	assert.NotNil(t, err)
+	assert.Len(t, m.scores, 1)
+}
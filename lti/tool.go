@@ -0,0 +1,103 @@
+package lti
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// How long the assertions the tool authenticates with are valid.
+const assertionLifetime = 5 * time.Minute
+
+// Tool is the identity of the playground towards platforms. Platforms fetch
+// its public key to check the assertions it signs when requesting access
+// tokens.
+type Tool struct {
+	key   *rsa.PrivateKey
+	keyId string
+}
+
+// NewTool returns a tool that signs with the given key.
+func NewTool(key *rsa.PrivateKey) *Tool {
+	sum := sha256.Sum256(key.N.Bytes())
+	return &Tool{key: key, keyId: base64.RawURLEncoding.EncodeToString(sum[:16])}
+}
+
+// LoadTool reads the key of the tool from a PEM file holding an RSA private
+// key in PKCS#1 or PKCS#8 form.
+func LoadTool(path string) (*Tool, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("LTI tool key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return NewTool(key), nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("LTI tool key is not an RSA key")
+	}
+	return NewTool(rsaKey), nil
+}
+
+// KeySet returns the JSON web key set with the public key of the tool.
+func (t *Tool) KeySet() interface{} {
+	return map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": t.keyId,
+			"n":   base64.RawURLEncoding.EncodeToString(t.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(t.key.E)).Bytes()),
+		}},
+	}
+}
+
+// assertion signs a JWT that authenticates the tool as clientId towards the
+// token endpoint of a platform.
+func (t *Tool) assertion(clientId, tokenURL string) (string, error) {
+	now := time.Now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": t.keyId})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss": clientId,
+		"sub": clientId,
+		"aud": tokenURL,
+		"iat": now.Unix(),
+		"exp": now.Add(assertionLifetime).Unix(),
+		"jti": uuid.NewV4().String(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, t.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,419 @@
+// Package oidc logs users in with any OpenID Connect provider. Providers are
+// set up through discovery and the ID tokens they issue are verified against
+// the keys they publish.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Leeway allowed for clock differences with the provider.
+const clockSkew = time.Minute
+
+// How often the keys of a provider are fetched again at most, as anybody can
+// send tokens signed with keys it doesn't know.
+const keyRefetchInterval = time.Minute
+
+var (
+	malformedTokenError    = errors.New("ID token is malformed")
+	unsupportedAlgError    = errors.New("ID token is signed with an unsupported algorithm")
+	unknownKeyError        = errors.New("ID token is signed with an unknown key")
+	invalidSignatureError  = errors.New("ID token signature is invalid")
+	issuerMismatchError    = errors.New("ID token was issued by a different provider")
+	audienceMismatchError  = errors.New("ID token was issued to a different client")
+	expiredTokenError      = errors.New("ID token has expired")
+	notYetValidTokenError  = errors.New("ID token is not valid yet")
+	partyMismatchError     = errors.New("ID token was authorized for a different client")
+	nonceMismatchError     = errors.New("ID token nonce doesn't match the login request")
+	discoveryMismatchError = errors.New("Discovered issuer doesn't match the configured one")
+)
+
+// InvalidToken tells whether err comes from an ID token that didn't pass
+// verification.
+func InvalidToken(err error) bool {
+	switch err {
+	case malformedTokenError, unsupportedAlgError, unknownKeyError, invalidSignatureError,
+		issuerMismatchError, audienceMismatchError, expiredTokenError, notYetValidTokenError,
+		partyMismatchError, nonceMismatchError:
+		return true
+	}
+	return false
+}
+
+// Claims are the claims of an ID token or of the user info of a user.
+type Claims map[string]interface{}
+
+// String returns the named claim if it is a string.
+func (c Claims) String(name string) string {
+	if s, ok := c[name].(string); ok {
+		return s
+	}
+	if f, ok := c[name].(float64); ok {
+		return fmt.Sprintf("%.0f", f)
+	}
+	return ""
+}
+
+type discovery struct {
+	Issuer      string `json:"issuer"`
+	AuthURL     string `json:"authorization_endpoint"`
+	TokenURL    string `json:"token_endpoint"`
+	UserInfoURL string `json:"userinfo_endpoint"`
+	JWKSURL     string `json:"jwks_uri"`
+}
+
+// Provider is an OpenID Connect provider found through discovery.
+type Provider struct {
+	Issuer      string
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+	JWKSURL     string
+
+	client    *http.Client
+	mx        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetching  chan struct{}
+	fetchedAt time.Time
+	now       func() time.Time
+}
+
+// Discover reads the configuration of the provider at issuer from its
+// well-known discovery document.
+func Discover(ctx context.Context, issuer string) (*Provider, error) {
+	return discover(ctx, http.DefaultClient, issuer)
+}
+
+func discover(ctx context.Context, client *http.Client, issuer string) (*Provider, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	var d discovery
+	if err := getJSON(ctx, client, issuer+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != issuer {
+		return nil, discoveryMismatchError
+	}
+
+	return &Provider{
+		Issuer:      d.Issuer,
+		AuthURL:     d.AuthURL,
+		TokenURL:    d.TokenURL,
+		UserInfoURL: d.UserInfoURL,
+		JWKSURL:     d.JWKSURL,
+		client:      client,
+		keys:        map[string]crypto.PublicKey{},
+		now:         time.Now,
+	}, nil
+}
+
+// NewProvider returns a provider that is configured by hand rather than
+// discovered. Only its ID tokens can be verified.
+func NewProvider(issuer, jwksURL string) *Provider {
+	return &Provider{
+		Issuer:  issuer,
+		JWKSURL: jwksURL,
+		client:  http.DefaultClient,
+		keys:    map[string]crypto.PublicKey{},
+		now:     time.Now,
+	}
+}
+
+// Endpoint returns the OAuth2 endpoint of the provider.
+func (p *Provider) Endpoint() oauth2.Endpoint {
+	return oauth2.Endpoint{AuthURL: p.AuthURL, TokenURL: p.TokenURL}
+}
+
+// Verify checks the signature and claims of an ID token issued to clientId
+// and returns its claims. Tokens issued to several clients must have been
+// authorized for clientId. When nonce isn't empty the token must carry it.
+func (p *Provider) Verify(ctx context.Context, rawIDToken, clientId, nonce string) (Claims, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, malformedTokenError
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, malformedTokenError
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, malformedTokenError
+	}
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, malformedTokenError
+	}
+	if claims.String("iss") != p.Issuer {
+		return nil, issuerMismatchError
+	}
+	if !audienceContains(claims["aud"], clientId) {
+		return nil, audienceMismatchError
+	}
+	if azp, found := claims["azp"]; found && azp != clientId {
+		return nil, partyMismatchError
+	} else if aud, ok := claims["aud"].([]interface{}); ok && len(aud) > 1 && !found {
+		return nil, partyMismatchError
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || p.now().Add(-clockSkew).After(time.Unix(int64(exp), 0)) {
+		return nil, expiredTokenError
+	}
+	if nbf, found := claims["nbf"]; found {
+		if nbf, ok := nbf.(float64); !ok || p.now().Add(clockSkew).Before(time.Unix(int64(nbf), 0)) {
+			return nil, notYetValidTokenError
+		}
+	}
+	if nonce != "" && claims.String("nonce") != nonce {
+		return nil, nonceMismatchError
+	}
+
+	return claims, nil
+}
+
+// UserInfo returns the claims the provider has about the user the token was
+// issued for.
+func (p *Provider) UserInfo(ctx context.Context, ts oauth2.TokenSource) (Claims, error) {
+	if p.UserInfoURL == "" {
+		return Claims{}, nil
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	var claims Claims
+	if err := getJSON(ctx, oauth2.NewClient(ctx, ts), p.UserInfoURL, &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// key returns the key with the given id, fetching the keys of the provider
+// again if it is not known, as providers rotate their keys from time to time.
+// The keys are fetched at most once every keyRefetchInterval and without
+// holding the lock, callers that need them meanwhile wait for the fetch that
+// is going on.
+func (p *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mx.Lock()
+	if key, found := p.lookup(kid); found {
+		p.mx.Unlock()
+		return key, nil
+	}
+	if fetching := p.fetching; fetching != nil {
+		p.mx.Unlock()
+		select {
+		case <-fetching:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		p.mx.Lock()
+		defer p.mx.Unlock()
+		if key, found := p.lookup(kid); found {
+			return key, nil
+		}
+		return nil, unknownKeyError
+	}
+	if !p.fetchedAt.IsZero() && p.now().Sub(p.fetchedAt) < keyRefetchInterval {
+		p.mx.Unlock()
+		return nil, unknownKeyError
+	}
+	fetching := make(chan struct{})
+	p.fetching = fetching
+	p.fetchedAt = p.now()
+	p.mx.Unlock()
+
+	keys, err := fetchKeys(ctx, p.client, p.JWKSURL)
+
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	p.fetching = nil
+	close(fetching)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	if key, found := p.lookup(kid); found {
+		return key, nil
+	}
+	return nil, unknownKeyError
+}
+
+func (p *Provider) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, found := p.keys[kid]
+	return key, found
+}
+
+var curves = map[string]func() elliptic.Curve{
+	"P-256": elliptic.P256,
+	"P-384": elliptic.P384,
+	"P-521": elliptic.P521,
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func fetchKeys(ctx context.Context, client *http.Client, url string) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, client, url, &set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			curve, found := curves[k.Crv]
+			if !found {
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	return keys, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	if len(alg) != 5 {
+		return unsupportedAlgError
+	}
+	var h hash.Hash
+	var ch crypto.Hash
+	switch alg[2:] {
+	case "256":
+		h, ch = sha256.New(), crypto.SHA256
+	case "384":
+		h, ch = sha512.New384(), crypto.SHA384
+	case "512":
+		h, ch = sha512.New(), crypto.SHA512
+	default:
+		return unsupportedAlgError
+	}
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch {
+	case strings.HasPrefix(alg, "RS"):
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return invalidSignatureError
+		}
+		if rsa.VerifyPKCS1v15(k, ch, digest, signature) != nil {
+			return invalidSignatureError
+		}
+	case strings.HasPrefix(alg, "PS"):
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return invalidSignatureError
+		}
+		if rsa.VerifyPSS(k, ch, digest, signature, nil) != nil {
+			return invalidSignatureError
+		}
+	case strings.HasPrefix(alg, "ES"):
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature)%2 != 0 {
+			return invalidSignatureError
+		}
+		r := new(big.Int).SetBytes(signature[:len(signature)/2])
+		s := new(big.Int).SetBytes(signature[len(signature)/2:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return invalidSignatureError
+		}
+	default:
+		return unsupportedAlgError
+	}
+	return nil
+}
+
+func audienceContains(aud interface{}, clientId string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == clientId
+	case []interface{}:
+		for _, v := range a {
+			if v == clientId {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Could not get %s. Got status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
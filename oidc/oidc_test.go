@@ -0,0 +1,205 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+// mockProvider is a local OpenID Connect provider that signs ID tokens with
+// an RSA key.
+type mockProvider struct {
+	server  *httptest.Server
+	key     *rsa.PrivateKey
+	kid     string
+	fetches int
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	m := &mockProvider{key: key, kid: "key1"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(rw http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(rw).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/auth",
+			"token_endpoint":         m.server.URL + "/token",
+			"userinfo_endpoint":      m.server.URL + "/userinfo",
+			"jwks_uri":               m.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(rw http.ResponseWriter, req *http.Request) {
+		m.fetches++
+		json.NewEncoder(rw).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": m.kid,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/userinfo", func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer access" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(rw).Encode(map[string]string{"sub": "user1", "email": "user1@example.com"})
+	})
+	m.server = httptest.NewServer(mux)
+	return m
+}
+
+func (m *mockProvider) sign(t *testing.T, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, digest[:])
+	assert.Nil(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (m *mockProvider) claims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":   m.server.URL,
+		"aud":   "client1",
+		"sub":   "user1",
+		"name":  "User One",
+		"nonce": "nonce1",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	m := newMockProvider(t)
+	defer m.server.Close()
+
+	p, err := Discover(context.Background(), m.server.URL+"/")
+	assert.Nil(t, err)
+	assert.Equal(t, m.server.URL, p.Issuer)
+	assert.Equal(t, oauth2.Endpoint{AuthURL: m.server.URL + "/auth", TokenURL: m.server.URL + "/token"}, p.Endpoint())
+
+	_, err = Discover(context.Background(), m.server.URL+"/realms/other")
+	assert.NotNil(t, err)
+}
+
+func TestVerify(t *testing.T) {
+	m := newMockProvider(t)
+	defer m.server.Close()
+	ctx := context.Background()
+
+	p, err := Discover(ctx, m.server.URL)
+	assert.Nil(t, err)
+
+	claims, err := p.Verify(ctx, m.sign(t, m.kid, m.claims()), "client1", "nonce1")
+	assert.Nil(t, err)
+	assert.Equal(t, "user1", claims.String("sub"))
+	assert.Equal(t, "User One", claims.String("name"))
+
+	_, err = p.Verify(ctx, m.sign(t, m.kid, m.claims()), "client2", "nonce1")
+	assert.Equal(t, audienceMismatchError, err)
+
+	_, err = p.Verify(ctx, m.sign(t, m.kid, m.claims()), "client1", "nonce2")
+	assert.Equal(t, nonceMismatchError, err)
+
+	_, err = p.Verify(ctx, m.sign(t, "key2", m.claims()), "client1", "nonce1")
+	assert.Equal(t, unknownKeyError, err)
+
+	c := m.claims()
+	c["aud"] = []string{"other", "client1"}
+	_, err = p.Verify(ctx, m.sign(t, m.kid, c), "client1", "nonce1")
+	assert.Equal(t, partyMismatchError, err)
+
+	c["azp"] = "client1"
+	_, err = p.Verify(ctx, m.sign(t, m.kid, c), "client1", "nonce1")
+	assert.Nil(t, err)
+
+	c["azp"] = "other"
+	_, err = p.Verify(ctx, m.sign(t, m.kid, c), "client1", "nonce1")
+	assert.Equal(t, partyMismatchError, err)
+
+	c = m.claims()
+	c["nbf"] = time.Now().Add(time.Hour).Unix()
+	_, err = p.Verify(ctx, m.sign(t, m.kid, c), "client1", "nonce1")
+	assert.Equal(t, notYetValidTokenError, err)
+
+	c["nbf"] = time.Now().Add(30 * time.Second).Unix()
+	_, err = p.Verify(ctx, m.sign(t, m.kid, c), "client1", "nonce1")
+	assert.Nil(t, err)
+
+	c = m.claims()
+	c["iss"] = "https://evil.example.com"
+	_, err = p.Verify(ctx, m.sign(t, m.kid, c), "client1", "nonce1")
+	assert.Equal(t, issuerMismatchError, err)
+
+	c = m.claims()
+	c["exp"] = time.Now().Add(-time.Hour).Unix()
+	_, err = p.Verify(ctx, m.sign(t, m.kid, c), "client1", "nonce1")
+	assert.Equal(t, expiredTokenError, err)
+
+	token := m.sign(t, m.kid, m.claims())
+	_, err = p.Verify(ctx, token[:len(token)-4]+"AAAA", "client1", "nonce1")
+	assert.Equal(t, invalidSignatureError, err)
+	assert.True(t, InvalidToken(err))
+
+	_, err = p.Verify(ctx, "not a token", "client1", "nonce1")
+	assert.Equal(t, malformedTokenError, err)
+}
+
+func TestVerify_KeyRefetch(t *testing.T) {
+	m := newMockProvider(t)
+	defer m.server.Close()
+	ctx := context.Background()
+
+	p, err := Discover(ctx, m.server.URL)
+	assert.Nil(t, err)
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	_, err = p.Verify(ctx, m.sign(t, m.kid, m.claims()), "client1", "nonce1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, m.fetches)
+
+	// Unknown keys don't make the keys to be fetched again right away
+	for i := 0; i < 5; i++ {
+		_, err = p.Verify(ctx, m.sign(t, "key2", m.claims()), "client1", "nonce1")
+		assert.Equal(t, unknownKeyError, err)
+	}
+	assert.Equal(t, 1, m.fetches)
+
+	// Rotated keys are picked up once the interval has passed
+	m.kid = "key2"
+	now = now.Add(keyRefetchInterval)
+	_, err = p.Verify(ctx, m.sign(t, "key2", m.claims()), "client1", "nonce1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, m.fetches)
+}
+
+func TestUserInfo(t *testing.T) {
+	m := newMockProvider(t)
+	defer m.server.Close()
+	ctx := context.Background()
+
+	p, err := Discover(ctx, m.server.URL)
+	assert.Nil(t, err)
+
+	claims, err := p.UserInfo(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "access"}))
+	assert.Nil(t, err)
+	assert.Equal(t, "user1@example.com", claims.String("email"))
+}
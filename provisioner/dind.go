@@ -13,6 +13,7 @@ import (
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/play-with-docker/play-with-docker/config"
 	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/engine"
 	"github.com/play-with-docker/play-with-docker/id"
 	"github.com/play-with-docker/play-with-docker/pwd/types"
 	"github.com/play-with-docker/play-with-docker/router"
@@ -20,15 +21,21 @@ import (
 )
 
 type DinD struct {
-	factory   docker.FactoryApi
+	runtimes  engine.FactoryApi
 	storage   storage.StorageApi
 	generator id.Generator
 	cache     *lru.Cache
 }
 
 func NewDinD(generator id.Generator, f docker.FactoryApi, s storage.StorageApi) *DinD {
+	return NewDinDWithRuntimes(generator, docker.NewRuntimeFactory(f), s)
+}
+
+// NewDinDWithRuntimes is like NewDinD but runs instances on whatever
+// container runtime rf hands out.
+func NewDinDWithRuntimes(generator id.Generator, rf engine.FactoryApi, s storage.StorageApi) *DinD {
 	c, _ := lru.New(5000)
-	return &DinD{generator: generator, factory: f, storage: s, cache: c}
+	return &DinD{generator: generator, runtimes: rf, storage: s, cache: c}
 }
 
 func checkHostnameExists(sessionId, hostname string, instances []*types.Instance) bool {
@@ -43,11 +50,11 @@ func checkHostnameExists(sessionId, hostname string, instances []*types.Instance
 }
 
 func (d *DinD) InstanceNew(session *types.Session, conf types.InstanceConfig) (*types.Instance, error) {
+	playground, err := d.storage.PlaygroundGet(session.PlaygroundId)
+	if err != nil {
+		return nil, err
+	}
 	if conf.ImageName == "" {
-		playground, err := d.storage.PlaygroundGet(session.PlaygroundId)
-		if err != nil {
-			return nil, err
-		}
 		conf.ImageName = playground.DefaultDinDInstanceImage
 	}
 	log.Printf("NewInstance - using image: [%s]\n", conf.ImageName)
@@ -73,7 +80,7 @@ func (d *DinD) InstanceNew(session *types.Session, conf types.InstanceConfig) (*
 	}
 
 	containerName := fmt.Sprintf("%s_%s", session.Id[:8], d.generator.NewId())
-	opts := docker.CreateContainerOpts{
+	opts := engine.CreateContainerOpts{
 		Image:          conf.ImageName,
 		SessionId:      session.Id,
 		ContainerName:  containerName,
@@ -82,21 +89,30 @@ func (d *DinD) InstanceNew(session *types.Session, conf types.InstanceConfig) (*
 		ServerKey:      conf.ServerKey,
 		CACert:         conf.CACert,
 		HostFQDN:       conf.PlaygroundFQDN,
-		Privileged:     true,
 		Networks:       networks,
 		DindVolumeSize: conf.DindVolumeSize,
 		Envs:           conf.Envs,
+		Mounts:         conf.Mounts,
+	}
+
+	switch r := playground.InstanceRuntime(conf.ImageName); r {
+	case types.InstanceRuntimeDinD:
+		opts.Privileged = true
+	case types.InstanceRuntimeContainer:
+		// plain unprivileged container, nothing to set
+	default:
+		opts.Runtime = r
 	}
 
-	dockerClient, err := d.factory.GetForSession(session)
+	runtime, err := d.runtimes.GetForSession(session)
 	if err != nil {
 		return nil, err
 	}
-	if err := dockerClient.ContainerCreate(opts); err != nil {
+	if err := runtime.ContainerCreate(opts); err != nil {
 		return nil, err
 	}
 
-	ips, err := dockerClient.ContainerIPs(containerName)
+	ips, err := runtime.ContainerIPs(containerName)
 	if err != nil {
 		return nil, err
 	}
@@ -114,6 +130,8 @@ func (d *DinD) InstanceNew(session *types.Session, conf types.InstanceConfig) (*
 	instance.ServerKey = conf.ServerKey
 	instance.CACert = conf.CACert
 	instance.Tls = conf.Tls
+	instance.Envs = conf.Envs
+	instance.Networks = conf.Networks
 	instance.ProxyHost = router.EncodeHost(session.Id, instance.RoutableIP, router.HostOpts{})
 	instance.SessionHost = session.Host
 
@@ -136,11 +154,11 @@ func (d *DinD) getSession(sessionId string) (*types.Session, error) {
 }
 
 func (d *DinD) InstanceDelete(session *types.Session, instance *types.Instance) error {
-	dockerClient, err := d.factory.GetForSession(session)
+	runtime, err := d.runtimes.GetForSession(session)
 	if err != nil {
 		return err
 	}
-	err = dockerClient.ContainerDelete(instance.Name)
+	err = runtime.ContainerDelete(instance.Name)
 	if err != nil && !strings.Contains(err.Error(), "No such container") {
 		return err
 	}
@@ -152,11 +170,11 @@ func (d *DinD) InstanceExec(instance *types.Instance, cmd []string) (int, error)
 	if err != nil {
 		return -1, err
 	}
-	dockerClient, err := d.factory.GetForSession(session)
+	runtime, err := d.runtimes.GetForSession(session)
 	if err != nil {
 		return -1, err
 	}
-	return dockerClient.Exec(instance.Name, cmd)
+	return runtime.Exec(instance.Name, cmd)
 }
 
 // For PWC closed-book testing, like InstanceExec except returns the output of
@@ -166,13 +184,13 @@ func (d *DinD) InstanceExecOutput(instance *types.Instance, cmd []string) (io.Re
 	if err!= nil {
 		return nil, err
 	}
-	dockerClient, err := d.factory.GetForSession(session)
+	runtime, err := d.runtimes.GetForSession(session)
 	if err != nil {
 		return nil, err
 	}
 	b := bytes.NewBuffer([]byte{})
 
-	if c,err := dockerClient.ExecAttach(instance.Name, cmd, b); c > 0 {
+	if c,err := runtime.ExecAttach(instance.Name, cmd, b); c > 0 {
 		log.Println(b.String())
 		//return nil, fmt.Errorf("Error %d trying to run command", c)
 	} else if err != nil {
@@ -187,13 +205,13 @@ func (d *DinD) InstanceFSTree(instance *types.Instance) (io.Reader, error) {
 	if err != nil {
 		return nil, err
 	}
-	dockerClient, err := d.factory.GetForSession(session)
+	runtime, err := d.runtimes.GetForSession(session)
 	if err != nil {
 		return nil, err
 	}
 	b := bytes.NewBuffer([]byte{})
 
-	if c, err := dockerClient.ExecAttach(instance.Name, []string{"bash", "-c", `tree --noreport -J $HOME`}, b); c > 0 {
+	if c, err := runtime.ExecAttach(instance.Name, []string{"bash", "-c", `tree --noreport -J $HOME`}, b); c > 0 {
 		log.Println(b.String())
 		return nil, fmt.Errorf("Error %d trying list directories", c)
 	} else if err != nil {
@@ -208,12 +226,12 @@ func (d *DinD) InstanceFile(instance *types.Instance, filePath string) (io.Reade
 	if err != nil {
 		return nil, err
 	}
-	dockerClient, err := d.factory.GetForSession(session)
+	runtime, err := d.runtimes.GetForSession(session)
 	if err != nil {
 		return nil, err
 	}
 
-	return dockerClient.CopyFromContainer(instance.Name, filePath)
+	return runtime.CopyFromContainer(instance.Name, filePath)
 }
 
 func (d *DinD) InstanceResizeTerminal(instance *types.Instance, rows, cols uint) error {
@@ -221,11 +239,11 @@ func (d *DinD) InstanceResizeTerminal(instance *types.Instance, rows, cols uint)
 	if err != nil {
 		return err
 	}
-	dockerClient, err := d.factory.GetForSession(session)
+	runtime, err := d.runtimes.GetForSession(session)
 	if err != nil {
 		return err
 	}
-	return dockerClient.ContainerResize(instance.Name, rows, cols)
+	return runtime.ContainerResize(instance.Name, rows, cols)
 }
 
 func (d *DinD) InstanceGetTerminal(instance *types.Instance) (net.Conn, error) {
@@ -233,11 +251,39 @@ func (d *DinD) InstanceGetTerminal(instance *types.Instance) (net.Conn, error) {
 	if err != nil {
 		return nil, err
 	}
-	dockerClient, err := d.factory.GetForSession(session)
+	runtime, err := d.runtimes.GetForSession(session)
 	if err != nil {
 		return nil, err
 	}
-	return dockerClient.CreateAttachConnection(instance.Name)
+	return runtime.CreateAttachConnection(instance.Name)
+}
+
+// execTerminalCommand runs the login shell of choice of the image for
+// additional terminals.
+var execTerminalCommand = []string{"sh", "-c", "if command -v bash > /dev/null; then exec bash -l; fi; exec sh -l"}
+
+func (d *DinD) InstanceExecTerminal(instance *types.Instance) (string, net.Conn, error) {
+	session, err := d.getSession(instance.SessionId)
+	if err != nil {
+		return "", nil, err
+	}
+	runtime, err := d.runtimes.GetForSession(session)
+	if err != nil {
+		return "", nil, err
+	}
+	return runtime.ExecTerminal(instance.Name, execTerminalCommand)
+}
+
+func (d *DinD) InstanceResizeExecTerminal(instance *types.Instance, id string, rows, cols uint) error {
+	session, err := d.getSession(instance.SessionId)
+	if err != nil {
+		return err
+	}
+	runtime, err := d.runtimes.GetForSession(session)
+	if err != nil {
+		return err
+	}
+	return runtime.ExecResize(id, rows, cols)
 }
 
 func (d *DinD) InstanceUploadFromUrl(instance *types.Instance, fileName, dest, url string) error {
@@ -254,12 +300,12 @@ func (d *DinD) InstanceUploadFromUrl(instance *types.Instance, fileName, dest, u
 	if err != nil {
 		return err
 	}
-	dockerClient, err := d.factory.GetForSession(session)
+	runtime, err := d.runtimes.GetForSession(session)
 	if err != nil {
 		return err
 	}
 
-	copyErr := dockerClient.CopyToContainer(instance.Name, dest, fileName, resp.Body)
+	copyErr := runtime.CopyToContainer(instance.Name, dest, fileName, resp.Body)
 
 	if copyErr != nil {
 		return fmt.Errorf("Error while downloading file [%s]. Error: %s\n", url, copyErr)
@@ -273,13 +319,13 @@ func (d *DinD) getInstanceCWD(instance *types.Instance) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	dockerClient, err := d.factory.GetForSession(session)
+	runtime, err := d.runtimes.GetForSession(session)
 	if err != nil {
 		return "", err
 	}
 	b := bytes.NewBufferString("")
 
-	if c, err := dockerClient.ExecAttach(instance.Name, []string{"bash", "-c", `pwdx $(</var/run/cwd)`}, b); c > 0 {
+	if c, err := runtime.ExecAttach(instance.Name, []string{"bash", "-c", `pwdx $(</var/run/cwd)`}, b); c > 0 {
 		return "", fmt.Errorf("Error %d trying to get CWD", c)
 	} else if err != nil {
 		return "", err
@@ -295,7 +341,7 @@ func (d *DinD) InstanceUploadFromReader(instance *types.Instance, fileName, dest
 	if err != nil {
 		return err
 	}
-	dockerClient, err := d.factory.GetForSession(session)
+	runtime, err := d.runtimes.GetForSession(session)
 	if err != nil {
 		return err
 	}
@@ -310,7 +356,7 @@ func (d *DinD) InstanceUploadFromReader(instance *types.Instance, fileName, dest
 		}
 	}
 
-	copyErr := dockerClient.CopyToContainer(instance.Name, finalDest, fileName, reader)
+	copyErr := runtime.CopyToContainer(instance.Name, finalDest, fileName, reader)
 
 	if copyErr != nil {
 		return fmt.Errorf("Error while uploading file [%s]. Error: %s\n", fileName, copyErr)
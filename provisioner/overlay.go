@@ -7,27 +7,33 @@ import (
 	"net/url"
 	"strings"
 
-	dtypes "github.com/docker/docker/api/types"
 	"github.com/play-with-docker/play-with-docker/config"
 	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/engine"
 	"github.com/play-with-docker/play-with-docker/pwd/types"
 )
 
 type overlaySessionProvisioner struct {
-	dockerFactory docker.FactoryApi
+	runtimes engine.FactoryApi
 }
 
 func NewOverlaySessionProvisioner(df docker.FactoryApi) SessionProvisionerApi {
-	return &overlaySessionProvisioner{dockerFactory: df}
+	return NewRuntimeSessionProvisioner(docker.NewRuntimeFactory(df))
+}
+
+// NewRuntimeSessionProvisioner gives each session its own network on the
+// container runtime rf hands out and connects the L2 router to it.
+func NewRuntimeSessionProvisioner(rf engine.FactoryApi) SessionProvisionerApi {
+	return &overlaySessionProvisioner{runtimes: rf}
 }
 
 func (p *overlaySessionProvisioner) SessionNew(ctx context.Context, s *types.Session) error {
-	dockerClient, err := p.dockerFactory.GetForSession(s)
+	runtime, err := p.runtimes.GetForSession(s)
 	if err != nil {
 		// We assume we are out of capacity
 		return fmt.Errorf("Out of capacity")
 	}
-	u, _ := url.Parse(dockerClient.DaemonHost())
+	u, _ := url.Parse(runtime.DaemonHost())
 	if u.Host == "" {
 		s.Host = "localhost"
 	} else {
@@ -35,14 +41,13 @@ func (p *overlaySessionProvisioner) SessionNew(ctx context.Context, s *types.Ses
 		s.Host = chunks[0]
 	}
 
-	opts := dtypes.NetworkCreate{Driver: "overlay", Attachable: true}
-	if err := dockerClient.NetworkCreate(s.Id, opts); err != nil {
+	if err := runtime.NetworkCreate(s.Id); err != nil {
 		log.Println("ERROR NETWORKING", err)
 		return err
 	}
 	log.Printf("Network [%s] created for session [%s]\n", s.Id, s.Id)
 
-	ip, err := dockerClient.NetworkConnect(config.L2ContainerName, s.Id, s.PwdIpAddress)
+	ip, err := runtime.NetworkConnect(config.L2ContainerName, s.Id, s.PwdIpAddress)
 	if err != nil {
 		log.Println(err)
 		return err
@@ -53,19 +58,19 @@ func (p *overlaySessionProvisioner) SessionNew(ctx context.Context, s *types.Ses
 }
 func (p *overlaySessionProvisioner) SessionClose(s *types.Session) error {
 	// Disconnect L2 router from the network
-	dockerClient, err := p.dockerFactory.GetForSession(s)
+	runtime, err := p.runtimes.GetForSession(s)
 	if err != nil {
 		log.Println(err)
 		return err
 	}
-	if err := dockerClient.NetworkDisconnect(config.L2ContainerName, s.Id); err != nil {
+	if err := runtime.NetworkDisconnect(config.L2ContainerName, s.Id); err != nil {
 		if !strings.Contains(err.Error(), "is not connected to the network") {
 			log.Println("ERROR NETWORKING", err)
 			return err
 		}
 	}
 	log.Printf("Disconnected l2 from network [%s]\n", s.Id)
-	if err := dockerClient.NetworkDelete(s.Id); err != nil {
+	if err := runtime.NetworkDelete(s.Id); err != nil {
 		if !strings.Contains(err.Error(), "not found") {
 			log.Println(err)
 			return err
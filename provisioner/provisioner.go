@@ -15,6 +15,12 @@ func OutOfCapacity(e error) bool {
 	return e == OutOfCapacityError
 }
 
+var TerminalsNotSupportedError = errors.New("Additional terminals are not supported for this instance type")
+
+func TerminalsNotSupported(e error) bool {
+	return e == TerminalsNotSupportedError
+}
+
 type InstanceProvisionerApi interface {
 	InstanceNew(session *types.Session, conf types.InstanceConfig) (*types.Instance, error)
 	InstanceDelete(session *types.Session, instance *types.Instance) error
@@ -25,6 +31,10 @@ type InstanceProvisionerApi interface {
 
 	InstanceResizeTerminal(instance *types.Instance, cols, rows uint) error
 	InstanceGetTerminal(instance *types.Instance) (net.Conn, error)
+	// InstanceExecTerminal starts a new shell in the instance, independent
+	// from its main terminal, and returns its id and a connection to it.
+	InstanceExecTerminal(instance *types.Instance) (string, net.Conn, error)
+	InstanceResizeExecTerminal(instance *types.Instance, id string, rows, cols uint) error
 
 	InstanceUploadFromUrl(instance *types.Instance, fileName, dest, url string) error
 	InstanceUploadFromReader(instance *types.Instance, fileName, dest string, reader io.Reader) error
@@ -204,6 +204,14 @@ func (d *windows) InstanceGetTerminal(instance *types.Instance) (net.Conn, error
 	return ws, nil
 }
 
+func (d *windows) InstanceExecTerminal(instance *types.Instance) (string, net.Conn, error) {
+	return "", nil, TerminalsNotSupportedError
+}
+
+func (d *windows) InstanceResizeExecTerminal(instance *types.Instance, id string, rows, cols uint) error {
+	return TerminalsNotSupportedError
+}
+
 func (d *windows) InstanceUploadFromUrl(instance *types.Instance, fileName, dest, u string) error {
 	log.Printf("Downloading file [%s]\n", u)
 	resp, err := http.Get(u)
@@ -0,0 +1,125 @@
+package pwd
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/satori/go.uuid"
+)
+
+var apiTokenInvalidScopeError = errors.New("Token scopes must be sessions, instances, exec, uploads or exams")
+var apiTokenInvalidError = errors.New("API token is not valid")
+
+func APITokenInvalidScope(e error) bool {
+	return e == apiTokenInvalidScopeError
+}
+
+func APITokenInvalid(e error) bool {
+	return e == apiTokenInvalidError
+}
+
+func hashTokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// APITokenNew creates a token for the user that can be used for the given
+// scopes until expiresAt, or forever when it is zero. It returns the value
+// to authenticate with, which is the id of the token and a random secret.
+// The value can't be recovered later.
+func (p *pwd) APITokenNew(user *types.User, name string, scopes []string, expiresAt time.Time) (*types.APIToken, string, error) {
+	defer observeAction("APITokenNew", time.Now())
+
+	if len(scopes) == 0 {
+		return nil, "", apiTokenInvalidScopeError
+	}
+	for _, s := range scopes {
+		if !types.ValidTokenScope(s) {
+			return nil, "", apiTokenInvalidScopeError
+		}
+	}
+
+	secret := uuid.NewV4().String()
+	token := &types.APIToken{
+		Id:        p.generator.NewId(),
+		UserId:    user.Id,
+		Name:      name,
+		Scopes:    scopes,
+		Hash:      hashTokenSecret(secret),
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	if err := p.storage.APITokenPut(token); err != nil {
+		return nil, "", err
+	}
+
+	return token, token.Id + "." + secret, nil
+}
+
+func (p *pwd) APITokenGet(id string) (*types.APIToken, error) {
+	defer observeAction("APITokenGet", time.Now())
+
+	return p.storage.APITokenGet(id)
+}
+
+func (p *pwd) APITokenFindByUser(userId string) ([]*types.APIToken, error) {
+	defer observeAction("APITokenFindByUser", time.Now())
+
+	return p.storage.APITokenFindByUserId(userId)
+}
+
+func (p *pwd) APITokenDelete(token *types.APIToken) error {
+	defer observeAction("APITokenDelete", time.Now())
+
+	return p.storage.APITokenDelete(token.Id)
+}
+
+// APITokenAuthenticate returns the token with the given value and the user
+// it belongs to. Tokens of banned users are refused.
+func (p *pwd) APITokenAuthenticate(value string) (*types.APIToken, *types.User, error) {
+	defer observeAction("APITokenAuthenticate", time.Now())
+
+	i := strings.Index(value, ".")
+	if i < 0 {
+		return nil, nil, apiTokenInvalidError
+	}
+	token, err := p.storage.APITokenGet(value[:i])
+	if storage.NotFound(err) {
+		return nil, nil, apiTokenInvalidError
+	} else if err != nil {
+		return nil, nil, err
+	}
+	hash := hashTokenSecret(value[i+1:])
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(token.Hash)) != 1 {
+		return nil, nil, apiTokenInvalidError
+	}
+	now := time.Now()
+	if token.Expired(now) {
+		return nil, nil, apiTokenInvalidError
+	}
+
+	user, err := p.UserGet(token.UserId)
+	if errors.Is(err, userBannedError) {
+		return nil, nil, &AccessDeniedError{err}
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	// Scripts can make many requests in a row, so when the token was last
+	// used is only kept to the minute
+	if now.Sub(token.LastUsedAt) > time.Minute {
+		token.LastUsedAt = now
+		if err := p.storage.APITokenPut(token); err != nil {
+			log.Printf("Could not update last use of API token [%s]. Got: %v\n", token.Id, err)
+		}
+	}
+
+	return token, user, nil
+}
@@ -0,0 +1,90 @@
+package pwd
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/id"
+	"github.com/play-with-docker/play-with-docker/provisioner"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAPITokenNew(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	user := &types.User{Id: "u1"}
+
+	_g.On("NewId").Return("aaaabbbbcccc")
+	_s.On("APITokenPut", mock.AnythingOfType("*types.APIToken")).Return(nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+	p.generator = _g
+
+	token, value, err := p.APITokenNew(user, "ci", []string{types.TokenScopeSessions, types.TokenScopeExec}, time.Time{})
+	assert.Nil(t, err)
+	assert.Equal(t, "u1", token.UserId)
+	assert.Equal(t, "aaaabbbbcccc", token.Id)
+	assert.Contains(t, value, "aaaabbbbcccc.")
+	assert.NotContains(t, value, token.Hash)
+	assert.True(t, token.HasScope(types.TokenScopeExec))
+	assert.False(t, token.HasScope(types.TokenScopeUploads))
+
+	_, _, err = p.APITokenNew(user, "ci", []string{"admin"}, time.Time{})
+	assert.True(t, APITokenInvalidScope(err))
+	_, _, err = p.APITokenNew(user, "ci", nil, time.Time{})
+	assert.True(t, APITokenInvalidScope(err))
+
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
+func TestAPITokenAuthenticate(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(nil, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	token := &types.APIToken{Id: "t1", UserId: "u1", Hash: hashTokenSecret("secret")}
+	expired := &types.APIToken{Id: "t2", UserId: "u1", Hash: hashTokenSecret("secret"), ExpiresAt: time.Now().Add(-time.Hour)}
+	user := &types.User{Id: "u1"}
+
+	_s.On("APITokenGet", "t1").Return(token, nil)
+	_s.On("APITokenGet", "t2").Return(expired, nil)
+	_s.On("APITokenGet", "t3").Return((*types.APIToken)(nil), storage.NotFoundError)
+	_s.On("UserGet", "u1").Return(user, nil).Once()
+	_s.On("APITokenPut", token).Return(nil).Once()
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	found, foundUser, err := p.APITokenAuthenticate("t1.secret")
+	assert.Nil(t, err)
+	assert.Equal(t, token, found)
+	assert.Equal(t, user, foundUser)
+	assert.False(t, token.LastUsedAt.IsZero())
+
+	for _, value := range []string{"t1.wrong", "t2.secret", "t3.secret", "secret"} {
+		_, _, err = p.APITokenAuthenticate(value)
+		assert.True(t, APITokenInvalid(err), value)
+	}
+
+	_s.On("UserGet", "u1").Return(&types.User{Id: "u1", IsBanned: true}, nil).Once()
+	_, _, err = p.APITokenAuthenticate("t1.secret")
+	var accessDenied *AccessDeniedError
+	assert.True(t, errors.As(err, &accessDenied))
+
+	_s.AssertExpectations(t)
+}
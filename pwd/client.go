@@ -8,15 +8,19 @@ import (
 	"github.com/play-with-docker/play-with-docker/pwd/types"
 )
 
-func (p *pwd) ClientNew(id string, session *types.Session) *types.Client {
+// ClientNew registers a client of the session. userId is the user it was
+// opened by, if any, and is what the owner resize policy goes by.
+func (p *pwd) ClientNew(id string, session *types.Session, userId string) *types.Client {
 	defer observeAction("ClientNew", time.Now())
-	c := &types.Client{Id: id, SessionId: session.Id}
+	c := &types.Client{Id: id, SessionId: session.Id, UserId: userId}
 	if err := p.storage.ClientPut(c); err != nil {
 		log.Println("Error saving client", err)
 	}
 	return c
 }
 
+// ClientResizeViewPort sets the size of every terminal of the client that
+// doesn't have its own size.
 func (p *pwd) ClientResizeViewPort(c *types.Client, cols, rows uint) {
 	defer observeAction("ClientResizeViewPort", time.Now())
 	c.ViewPort.Rows = rows
@@ -26,7 +30,22 @@ func (p *pwd) ClientResizeViewPort(c *types.Client, cols, rows uint) {
 		log.Println("Error saving client", err)
 		return
 	}
-	p.notifyClientSmallestViewPort(c.SessionId)
+	p.notifyClientViewPort(c.SessionId)
+}
+
+// ClientResizeTerminal sets the size of the named terminal for the client.
+func (p *pwd) ClientResizeTerminal(c *types.Client, terminal string, cols, rows uint) {
+	defer observeAction("ClientResizeTerminal", time.Now())
+	if c.Terminals == nil {
+		c.Terminals = map[string]types.ViewPort{}
+	}
+	c.Terminals[terminal] = types.ViewPort{Rows: rows, Cols: cols}
+
+	if err := p.storage.ClientPut(c); err != nil {
+		log.Println("Error saving client", err)
+		return
+	}
+	p.notifyClientViewPort(c.SessionId, terminal)
 }
 
 func (p *pwd) ClientClose(client *types.Client) {
@@ -36,7 +55,7 @@ func (p *pwd) ClientClose(client *types.Client) {
 		log.Println("Error deleting client", err)
 		return
 	}
-	p.notifyClientSmallestViewPort(client.SessionId)
+	p.notifyClientViewPort(client.SessionId)
 }
 
 func (p *pwd) ClientCount() int {
@@ -48,20 +67,48 @@ func (p *pwd) ClientCount() int {
 	return count
 }
 
-func (p *pwd) notifyClientSmallestViewPort(sessionId string) {
+// notifyClientViewPort negotiates the size of the given terminals again, or
+// of every terminal in the session when none are given. Terminals of
+// instances are resized here, everybody else is told through events.
+func (p *pwd) notifyClientViewPort(sessionId string, terminals ...string) {
 	instances, err := p.storage.InstanceFindBySessionId(sessionId)
 	if err != nil {
 		log.Printf("Error finding instances for session [%s]. Got: %v\n", sessionId, err)
 		return
 	}
 
-	vp := p.SessionGetSmallestViewPort(sessionId)
-	// Resize all terminals in the session
-	for _, instance := range instances {
-		err := p.InstanceResizeTerminal(instance, vp.Rows, vp.Cols)
+	if len(terminals) == 0 {
+		clients, err := p.storage.ClientFindBySessionId(sessionId)
 		if err != nil {
-			log.Println("Error resizing terminal", err)
+			log.Printf("Error finding clients for session [%s]. Got: %v\n", sessionId, err)
+			return
+		}
+		seen := map[string]bool{}
+		for _, instance := range instances {
+			seen[instance.Name] = true
+			terminals = append(terminals, instance.Name)
+		}
+		for _, c := range clients {
+			for name := range c.Terminals {
+				if !seen[name] {
+					seen[name] = true
+					terminals = append(terminals, name)
+				}
+			}
+		}
+	}
+
+	byName := map[string]*types.Instance{}
+	for _, instance := range instances {
+		byName[instance.Name] = instance
+	}
+	for _, name := range terminals {
+		vp := p.SessionGetViewPort(sessionId, name)
+		if instance, found := byName[name]; found {
+			if err := p.InstanceResizeTerminal(instance, vp.Rows, vp.Cols); err != nil {
+				log.Println("Error resizing terminal", err)
+			}
 		}
+		p.event.Emit(event.INSTANCE_VIEWPORT_RESIZE, sessionId, vp.Cols, vp.Rows, name)
 	}
-	p.event.Emit(event.INSTANCE_VIEWPORT_RESIZE, sessionId, vp.Cols, vp.Rows)
 }
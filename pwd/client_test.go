@@ -50,9 +50,9 @@ func TestClientNew(t *testing.T) {
 	session, err := p.SessionNew(context.Background(), sConfig)
 	assert.Nil(t, err)
 
-	client := p.ClientNew("foobar", session)
+	client := p.ClientNew("foobar", session, "user1")
 
-	assert.Equal(t, types.Client{Id: "foobar", SessionId: session.Id, ViewPort: types.ViewPort{Cols: 0, Rows: 0}}, *client)
+	assert.Equal(t, types.Client{Id: "foobar", SessionId: session.Id, UserId: "user1", ViewPort: types.ViewPort{Cols: 0, Rows: 0}}, *client)
 
 	_d.AssertExpectations(t)
 	_f.AssertExpectations(t)
@@ -91,7 +91,7 @@ func TestClientCount(t *testing.T) {
 	session, err := p.SessionNew(context.Background(), sConfig)
 	assert.Nil(t, err)
 
-	p.ClientNew("foobar", session)
+	p.ClientNew("foobar", session, "")
 
 	assert.Equal(t, 1, p.ClientCount())
 
@@ -119,13 +119,14 @@ func TestClientResizeViewPort(t *testing.T) {
 	_s.On("SessionPut", mock.AnythingOfType("*types.Session")).Return(nil)
 	_s.On("SessionCount").Return(1, nil)
 	_s.On("InstanceCount").Return(0, nil)
-	_s.On("InstanceFindBySessionId", "aaaabbbbcccc").Return([]*types.Instance{}, nil)
+	_s.On("InstanceFindBySessionId", "aaaabbbbcccc").Return([]*types.Instance{{Name: "aaaabbbb_node1", SessionId: "aaaabbbbcccc"}}, nil)
 	_s.On("ClientPut", mock.AnythingOfType("*types.Client")).Return(nil)
 	_s.On("ClientCount").Return(1, nil)
+	_d.On("ContainerResize", "aaaabbbb_node1", uint(24), uint(80)).Return(nil)
 	var nilArgs []interface{}
 	_e.M.On("Emit", event.SESSION_NEW, "aaaabbbbcccc", nilArgs).Return()
 
-	_e.M.On("Emit", event.INSTANCE_VIEWPORT_RESIZE, "aaaabbbbcccc", []interface{}{uint(80), uint(24)}).Return()
+	_e.M.On("Emit", event.INSTANCE_VIEWPORT_RESIZE, "aaaabbbbcccc", []interface{}{uint(80), uint(24), "aaaabbbb_node1"}).Return()
 	p := NewPWD(_f, _e, _s, sp, ipf)
 	p.generator = _g
 	playground := &types.Playground{Id: "foobar"}
@@ -133,7 +134,8 @@ func TestClientResizeViewPort(t *testing.T) {
 	sConfig := types.SessionConfig{Playground: playground, UserId: "", Duration: time.Hour, Stack: "", StackName: "", ImageName: ""}
 	session, err := p.SessionNew(context.Background(), sConfig)
 	assert.Nil(t, err)
-	client := p.ClientNew("foobar", session)
+	client := p.ClientNew("foobar", session, "")
+	_s.On("SessionGet", "aaaabbbbcccc").Return(session, nil)
 	_s.On("ClientFindBySessionId", "aaaabbbbcccc").Return([]*types.Client{client}, nil)
 
 	p.ClientResizeViewPort(client, 80, 24)
@@ -146,3 +148,61 @@ func TestClientResizeViewPort(t *testing.T) {
 	_g.AssertExpectations(t)
 	_e.M.AssertExpectations(t)
 }
+
+func TestSessionGetViewPort(t *testing.T) {
+	_s := &storage.Mock{}
+	_f := &docker.FactoryMock{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(&id.MockGenerator{}, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	session := &types.Session{Id: "aaaabbbbcccc", UserId: "owner"}
+	clients := []*types.Client{
+		{Id: "c1", SessionId: session.Id, UserId: "owner", ViewPort: types.ViewPort{Cols: 100, Rows: 40}},
+		{Id: "c2", SessionId: session.Id, ViewPort: types.ViewPort{Cols: 80, Rows: 50}},
+		{Id: "c3", SessionId: session.Id, ViewPort: types.ViewPort{Cols: 200, Rows: 30}, Terminals: map[string]types.ViewPort{"node1#a": {Cols: 60, Rows: 20}}},
+		{Id: "c4", SessionId: session.Id},
+	}
+	_s.On("SessionGet", session.Id).Return(session, nil)
+	_s.On("ClientFindBySessionId", session.Id).Return(clients, nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	assert.Equal(t, types.ViewPort{Cols: 80, Rows: 30}, p.SessionGetViewPort(session.Id, "node1"))
+	assert.Equal(t, types.ViewPort{Cols: 60, Rows: 20}, p.SessionGetViewPort(session.Id, "node1#a"))
+
+	session.ResizePolicy = types.ResizePolicyLargest
+	assert.Equal(t, types.ViewPort{Cols: 200, Rows: 50}, p.SessionGetViewPort(session.Id, "node1"))
+	assert.Equal(t, types.ViewPort{Cols: 100, Rows: 50}, p.SessionGetViewPort(session.Id, "node1#a"))
+
+	session.ResizePolicy = types.ResizePolicyOwner
+	assert.Equal(t, types.ViewPort{Cols: 100, Rows: 40}, p.SessionGetViewPort(session.Id, "node1"))
+
+	// Without the owner around the smallest size wins
+	session.UserId = "someone"
+	assert.Equal(t, types.ViewPort{Cols: 80, Rows: 30}, p.SessionGetViewPort(session.Id, "node1"))
+}
+
+func TestSessionSetResizePolicy(t *testing.T) {
+	_s := &storage.Mock{}
+	_f := &docker.FactoryMock{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(&id.MockGenerator{}, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	session := &types.Session{Id: "aaaabbbbcccc"}
+	_s.On("SessionPut", session).Return(nil)
+	_s.On("InstanceFindBySessionId", session.Id).Return([]*types.Instance{}, nil)
+	_s.On("ClientFindBySessionId", session.Id).Return([]*types.Client{}, nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	err := p.SessionSetResizePolicy(session, "tallest")
+	assert.True(t, SessionInvalidResizePolicy(err))
+
+	err = p.SessionSetResizePolicy(session, types.ResizePolicyOwner)
+	assert.Nil(t, err)
+	assert.Equal(t, types.ResizePolicyOwner, session.ResizePolicy)
+
+	_s.AssertExpectations(t)
+}
@@ -0,0 +1,52 @@
+package pwd
+
+import (
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+// CommandNew logs a command line typed by the user into a terminal of the
+// instance. It returns a nil command when the playground doesn't audit
+// commands.
+func (p *pwd) CommandNew(session *types.Session, instance *types.Instance, terminal, userId, line string) (*types.Command, error) {
+	defer observeAction("CommandNew", time.Now())
+
+	playground, err := p.storage.PlaygroundGet(session.PlaygroundId)
+	if err != nil {
+		return nil, err
+	}
+	if !playground.AuditCommands {
+		return nil, nil
+	}
+
+	command := &types.Command{
+		Id:           p.generator.NewId(),
+		SessionId:    session.Id,
+		UserId:       userId,
+		PlaygroundId: session.PlaygroundId,
+		CourseId:     session.CourseId,
+		InstanceName: instance.Name,
+		Hostname:     instance.Hostname,
+		Terminal:     terminal,
+		Line:         line,
+		CreatedAt:    time.Now(),
+	}
+	if err := p.storage.CommandPut(command); err != nil {
+		return nil, err
+	}
+
+	return command, nil
+}
+
+func (p *pwd) CommandFindBySession(sessionId string) ([]*types.Command, error) {
+	defer observeAction("CommandFindBySession", time.Now())
+
+	return p.storage.CommandFindBySessionId(sessionId)
+}
+
+func (p *pwd) CommandFindByUser(userId string) ([]*types.Command, error) {
+	defer observeAction("CommandFindByUser", time.Now())
+
+	return p.storage.CommandFindByUserId(userId)
+}
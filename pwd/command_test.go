@@ -0,0 +1,73 @@
+package pwd
+
+import (
+	"testing"
+
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/id"
+	"github.com/play-with-docker/play-with-docker/provisioner"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCommandNew(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	s := &types.Session{Id: "aaaabbbbcccc", UserId: "user1", PlaygroundId: "foobar"}
+	i := &types.Instance{Name: "aaaabbbb_node1", Hostname: "node1", SessionId: s.Id}
+
+	_g.On("NewId").Return("cmd1")
+	_s.On("PlaygroundGet", "foobar").Return(&types.Playground{Id: "foobar", AuditCommands: true}, nil)
+	_s.On("CommandPut", mock.AnythingOfType("*types.Command")).Return(nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+	p.generator = _g
+
+	command, err := p.CommandNew(s, i, "aaaabbbb_node1", "user2", "make check")
+	assert.Nil(t, err)
+	assert.Equal(t, "cmd1", command.Id)
+	assert.Equal(t, s.Id, command.SessionId)
+	assert.Equal(t, "user2", command.UserId)
+	assert.Equal(t, "node1", command.Hostname)
+	assert.Equal(t, "make check", command.Line)
+	assert.False(t, command.CreatedAt.IsZero())
+
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
+func TestCommandNew_Disabled(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	s := &types.Session{Id: "aaaabbbbcccc", PlaygroundId: "foobar"}
+	i := &types.Instance{Name: "aaaabbbb_node1", Hostname: "node1", SessionId: s.Id}
+
+	_s.On("PlaygroundGet", "foobar").Return(&types.Playground{Id: "foobar"}, nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+	p.generator = _g
+
+	command, err := p.CommandNew(s, i, "aaaabbbb_node1", "", "ls")
+	assert.Nil(t, err)
+	assert.Nil(t, command)
+
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
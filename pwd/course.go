@@ -0,0 +1,41 @@
+package pwd
+
+import (
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+)
+
+// CourseFindOrNew returns the course of the context the given course is
+// launched from, creating it the first time the context launches a session.
+// Title and label are kept up to date with the ones the platform sends.
+func (p *pwd) CourseFindOrNew(course *types.Course) (*types.Course, error) {
+	defer observeAction("CourseFindOrNew", time.Now())
+
+	c, err := p.storage.CourseFindByContext(course.Issuer, course.ContextId)
+	if storage.NotFound(err) {
+		course.Id = p.generator.NewId()
+		if err := p.storage.CoursePut(course); err != nil {
+			return nil, err
+		}
+		return course, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if c.Title != course.Title || c.Label != course.Label {
+		c.Title = course.Title
+		c.Label = course.Label
+		if err := p.storage.CoursePut(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (p *pwd) CourseGet(id string) (*types.Course, error) {
+	defer observeAction("CourseGet", time.Now())
+
+	return p.storage.CourseGet(id)
+}
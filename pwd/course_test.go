@@ -0,0 +1,52 @@
+package pwd
+
+import (
+	"testing"
+
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/id"
+	"github.com/play-with-docker/play-with-docker/provisioner"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCourseFindOrNew(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	launched := &types.Course{PlaygroundId: "playground1", Issuer: "https://lms.example.com", ContextId: "context1", Title: "Compilers"}
+	expected := &types.Course{Id: "aaaabbbbcccc", PlaygroundId: "playground1", Issuer: "https://lms.example.com", ContextId: "context1", Title: "Compilers"}
+
+	_g.On("NewId").Return("aaaabbbbcccc")
+	_s.On("CourseFindByContext", "https://lms.example.com", "context1").Return((*types.Course)(nil), storage.NotFoundError).Once()
+	_s.On("CoursePut", expected).Return(nil).Once()
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+	p.generator = _g
+
+	course, err := p.CourseFindOrNew(launched)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, course)
+
+	// Courses are found again by their context and renamed along with it
+	stored := &types.Course{Id: "aaaabbbbcccc", PlaygroundId: "playground1", Issuer: "https://lms.example.com", ContextId: "context1", Title: "Compilers"}
+	renamed := &types.Course{Id: "aaaabbbbcccc", PlaygroundId: "playground1", Issuer: "https://lms.example.com", ContextId: "context1", Title: "Compilers 2"}
+	_s.On("CourseFindByContext", "https://lms.example.com", "context1").Return(stored, nil).Once()
+	_s.On("CoursePut", renamed).Return(nil).Once()
+
+	course, err = p.CourseFindOrNew(&types.Course{PlaygroundId: "playground1", Issuer: "https://lms.example.com", ContextId: "context1", Title: "Compilers 2"})
+	assert.Nil(t, err)
+	assert.Equal(t, "aaaabbbbcccc", course.Id)
+	assert.Equal(t, "Compilers 2", course.Title)
+
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
@@ -0,0 +1,173 @@
+package pwd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/engine"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+// Exams whose score is posted to an LMS are graded in a container of the
+// grader image instead of the instance of the student, as anything the
+// student can run could forge its result. The grader gets a copy of the
+// files that were submitted, runs examGraderCommand and writes the score to
+// examGraderScorePath.
+const (
+	examGraderCommand       = "grade"
+	examGraderSubmissionDir = "/submission"
+	examGraderScorePath     = "/grade/score"
+)
+
+var examGradingDisabledError = errors.New("Exams are not graded as no grader image is configured")
+var examNotSubmittedError = errors.New("Nothing was submitted for the exam")
+
+func ExamGradingDisabled(e error) bool {
+	return e == examGradingDisabledError
+}
+
+func ExamNotSubmitted(e error) bool {
+	return e == examNotSubmittedError
+}
+
+var examNameRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+var examScoreRegex = regexp.MustCompile(`^\s*([0-9]+(?:\.[0-9]+)?)\s*/\s*([0-9]+(?:\.[0-9]+)?)\s*$`)
+
+func examSubmissionPath(session *types.Session, exam string) (string, error) {
+	if !examNameRegex.MatchString(exam) || exam == "." || exam == ".." {
+		return "", fmt.Errorf("Invalid exam name %s", exam)
+	}
+	return filepath.Join(config.ExamSubmissionsDir, session.Id, exam), nil
+}
+
+// ExamSubmit keeps the files submitted for the exam, replacing the previous
+// submission, so that they can be graded.
+func (p *pwd) ExamSubmit(session *types.Session, exam string, files map[string][]byte) error {
+	defer observeAction("ExamSubmit", time.Now())
+
+	dir, err := examSubmissionPath(session, exam)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for name, content := range files {
+		name = filepath.Base(name)
+		if name == "." || name == ".." || name == string(filepath.Separator) {
+			continue
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			log.Printf("Error saving file [%s] submitted for exam [%s] of session [%s]. Got: %v\n", name, exam, session.Id, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// ExamGrade grades the last submission for the exam in a container of the
+// grader image and returns the score it wrote.
+func (p *pwd) ExamGrade(session *types.Session, exam string) (float64, float64, error) {
+	defer observeAction("ExamGrade", time.Now())
+
+	if config.ExamGraderImage == "" {
+		return 0, 0, examGradingDisabledError
+	}
+	dir, err := examSubmissionPath(session, exam)
+	if err != nil {
+		return 0, 0, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, 0, examNotSubmittedError
+	} else if err != nil {
+		return 0, 0, err
+	}
+
+	runtime, err := p.runtimes.GetForSession(session)
+	if err != nil {
+		return 0, 0, err
+	}
+	name := fmt.Sprintf("%s_grader_%s", session.Id[:8], p.generator.NewId())
+
+	// The grader gets a network of its own, as the instances of the student
+	// could tamper with it on the network of the session
+	if err := runtime.NetworkCreate(name); err != nil {
+		log.Printf("Error creating network of grader [%s]. Got: %v\n", name, err)
+		return 0, 0, err
+	}
+	defer func() {
+		if err := runtime.NetworkDelete(name); err != nil {
+			log.Printf("Error deleting network of grader [%s]. Got: %v\n", name, err)
+		}
+	}()
+
+	opts := engine.CreateContainerOpts{
+		Image:         config.ExamGraderImage,
+		SessionId:     name,
+		ContainerName: name,
+		Hostname:      "grader",
+		Networks:      []string{name},
+	}
+	if err := runtime.ContainerCreate(opts); err != nil {
+		log.Printf("Error creating grader container for session [%s]. Got: %v\n", session.Id, err)
+		return 0, 0, err
+	}
+	defer func() {
+		if err := runtime.ContainerDelete(name); err != nil {
+			log.Printf("Error deleting grader container [%s]. Got: %v\n", name, err)
+		}
+	}()
+
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return 0, 0, err
+		}
+		if err := runtime.CopyToContainer(name, examGraderSubmissionDir, f.Name(), bytes.NewReader(content)); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	code, err := runtime.Exec(name, []string{examGraderCommand, exam})
+	if err != nil {
+		return 0, 0, err
+	}
+	if code != 0 {
+		return 0, 0, fmt.Errorf("Grader of exam %s exited with code %d", exam, code)
+	}
+
+	r, err := runtime.CopyFromContainer(name, examGraderScorePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	score, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	m := examScoreRegex.FindSubmatch(score)
+	if m == nil {
+		return 0, 0, fmt.Errorf("Grader of exam %s wrote an invalid score %q", exam, score)
+	}
+	given, _ := strconv.ParseFloat(string(m[1]), 64)
+	maximum, _ := strconv.ParseFloat(string(m[2]), 64)
+	if maximum <= 0 || given > maximum {
+		return 0, 0, fmt.Errorf("Grader of exam %s wrote an invalid score %q", exam, score)
+	}
+	return given, maximum, nil
+}
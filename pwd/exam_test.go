@@ -0,0 +1,117 @@
+package pwd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/engine"
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/id"
+	"github.com/play-with-docker/play-with-docker/provisioner"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func newExamPWD(t *testing.T) (*pwd, *engine.Fake, *id.MockGenerator, func()) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	rt := engine.NewFake()
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinDWithRuntimes(_g, rt, _s))
+	sp := provisioner.NewRuntimeSessionProvisioner(rt)
+
+	dir, err := ioutil.TempDir("", "submissions")
+	assert.Nil(t, err)
+	config.ExamSubmissionsDir = dir
+	config.ExamGraderImage = "grader"
+	rt.NetworkCreate("aaaabbbbcccc")
+
+	p := NewPWDWithRuntimes(_f, rt, _e, _s, sp, ipf)
+	p.generator = _g
+	return p, rt, _g, func() {
+		config.ExamGraderImage = ""
+		os.RemoveAll(dir)
+	}
+}
+
+func TestExamGrade(t *testing.T) {
+	p, rt, _g, cleanup := newExamPWD(t)
+	defer cleanup()
+
+	s := &types.Session{Id: "aaaabbbbcccc"}
+	_g.On("NewId").Return("dddd")
+	rt.ExecWrites = map[string][]byte{"/grade/score": []byte("7.5/10\n")}
+
+	err := p.ExamSubmit(s, "exam1", map[string][]byte{"../../solution.cpp": []byte("int main() {}")})
+	assert.Nil(t, err)
+	b, err := ioutil.ReadFile(filepath.Join(config.ExamSubmissionsDir, s.Id, "exam1", "solution.cpp"))
+	assert.Nil(t, err)
+	assert.Equal(t, "int main() {}", string(b))
+
+	given, maximum, err := p.ExamGrade(s, "exam1")
+	assert.Nil(t, err)
+	assert.Equal(t, 7.5, given)
+	assert.Equal(t, 10.0, maximum)
+	assert.Nil(t, rt.Container("aaaabbbb_grader_dddd"))
+	assert.False(t, rt.HasNetwork("aaaabbbb_grader_dddd"))
+	assert.True(t, rt.HasNetwork("aaaabbbbcccc"))
+
+	_g.AssertExpectations(t)
+}
+
+func TestExamGrade_InvalidScore(t *testing.T) {
+	p, rt, _g, cleanup := newExamPWD(t)
+	defer cleanup()
+
+	s := &types.Session{Id: "aaaabbbbcccc"}
+	_g.On("NewId").Return("dddd")
+
+	assert.Nil(t, p.ExamSubmit(s, "exam1", map[string][]byte{"solution.cpp": []byte("")}))
+
+	for _, score := range []string{"", "score: 10/10", "11/10", "1/0"} {
+		rt.ExecWrites = map[string][]byte{"/grade/score": []byte(score)}
+		_, _, err := p.ExamGrade(s, "exam1")
+		assert.NotNil(t, err, score)
+		assert.Nil(t, rt.Container("aaaabbbb_grader_dddd"))
+	}
+
+	rt.ExecWrites = map[string][]byte{"/grade/score": []byte("10/10")}
+	rt.ExecExitCode = 1
+	_, _, err := p.ExamGrade(s, "exam1")
+	assert.NotNil(t, err)
+}
+
+func TestExamGrade_NotSubmitted(t *testing.T) {
+	p, _, _, cleanup := newExamPWD(t)
+	defer cleanup()
+
+	_, _, err := p.ExamGrade(&types.Session{Id: "aaaabbbbcccc"}, "exam1")
+	assert.True(t, ExamNotSubmitted(err))
+}
+
+func TestExamGrade_Disabled(t *testing.T) {
+	p, _, _, cleanup := newExamPWD(t)
+	defer cleanup()
+	config.ExamGraderImage = ""
+
+	s := &types.Session{Id: "aaaabbbbcccc"}
+	assert.Nil(t, p.ExamSubmit(s, "exam1", map[string][]byte{"solution.cpp": []byte("")}))
+	_, _, err := p.ExamGrade(s, "exam1")
+	assert.True(t, ExamGradingDisabled(err))
+}
+
+func TestExamSubmit_InvalidName(t *testing.T) {
+	p, _, _, cleanup := newExamPWD(t)
+	defer cleanup()
+
+	for _, exam := range []string{"", "..", "../exam1", "exam/1"} {
+		err := p.ExamSubmit(&types.Session{Id: "aaaabbbbcccc"}, exam, nil)
+		assert.NotNil(t, err, exam)
+	}
+}
@@ -29,6 +29,24 @@ func (p *pwd) InstanceGetTerminal(instance *types.Instance) (net.Conn, error) {
 	return prov.InstanceGetTerminal(instance)
 }
 
+func (p *pwd) InstanceExecTerminal(instance *types.Instance) (string, net.Conn, error) {
+	defer observeAction("InstanceExecTerminal", time.Now())
+	prov, err := p.getProvisioner(instance.Type)
+	if err != nil {
+		return "", nil, err
+	}
+	return prov.InstanceExecTerminal(instance)
+}
+
+func (p *pwd) InstanceResizeExecTerminal(instance *types.Instance, id string, rows, cols uint) error {
+	defer observeAction("InstanceResizeExecTerminal", time.Now())
+	prov, err := p.getProvisioner(instance.Type)
+	if err != nil {
+		return err
+	}
+	return prov.InstanceResizeExecTerminal(instance, id, rows, cols)
+}
+
 func (p *pwd) InstanceUploadFromUrl(instance *types.Instance, fileName, dest string, url string) error {
 	defer observeAction("InstanceUploadFromUrl", time.Now())
 	prov, err := p.getProvisioner(instance.Type)
@@ -95,6 +113,42 @@ func (p *pwd) InstanceDelete(session *types.Session, instance *types.Instance) e
 	return nil
 }
 
+// InstanceRecreate replaces an instance whose container went away with a new
+// one running the same image under the same hostname, with the same settings
+// it was created with. InstanceNew mounts the user volume again.
+func (p *pwd) InstanceRecreate(session *types.Session, instance *types.Instance) (*types.Instance, error) {
+	defer observeAction("InstanceRecreate", time.Now())
+
+	playground, err := p.storage.PlaygroundGet(session.PlaygroundId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.InstanceDelete(session, instance); err != nil {
+		return nil, err
+	}
+
+	conf := types.InstanceConfig{
+		ImageName:      instance.Image,
+		Hostname:       instance.Hostname,
+		Type:           instance.Type,
+		Tls:            instance.Tls,
+		ServerCert:     instance.ServerCert,
+		ServerKey:      instance.ServerKey,
+		CACert:         instance.CACert,
+		Cert:           instance.Cert,
+		Key:            instance.Key,
+		PlaygroundFQDN: playground.Domain,
+		DindVolumeSize: config.DindVolumeSize,
+		Envs:           instance.Envs,
+		Networks:       instance.Networks,
+	}
+	if len(playground.DindVolumeSize) > 0 {
+		conf.DindVolumeSize = playground.DindVolumeSize
+	}
+	return p.InstanceNew(session, conf)
+}
+
 func (p *pwd) InstanceNew(session *types.Session, conf types.InstanceConfig) (*types.Instance, error) {
 	defer observeAction("InstanceNew", time.Now())
 
@@ -107,6 +161,38 @@ func (p *pwd) InstanceNew(session *types.Session, conf types.InstanceConfig) (*t
 		conf.Tls = true
 	}
 
+	if conf.SnapshotId != "" {
+		snapshot, err := p.storage.SnapshotGet(conf.SnapshotId)
+		if err != nil {
+			return nil, err
+		}
+		if snapshot.UserId != session.UserId {
+			return nil, &AccessDeniedError{snapshotNotOwnedError}
+		}
+		if err := p.snapshotImage(session, snapshot); err != nil {
+			return nil, err
+		}
+		conf.ImageName = snapshot.Ref
+	}
+
+	if session.UserId != "" {
+		defer p.quotaLocks.lock(session.UserId)()
+		if err := p.checkInstanceQuota(session); err != nil {
+			return nil, err
+		}
+	}
+
+	if session.UserId != "" && conf.Type != "windows" {
+		m, err := p.userVolumeMount(session)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		if m != nil {
+			conf.Mounts = append(conf.Mounts, *m)
+		}
+	}
+
 	instance, err := prov.InstanceNew(session, conf)
 	if err != nil {
 		log.Println(err)
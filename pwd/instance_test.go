@@ -2,6 +2,7 @@ package pwd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -9,6 +10,7 @@ import (
 	dtypes "github.com/docker/docker/api/types"
 	"github.com/play-with-docker/play-with-docker/config"
 	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/engine"
 	"github.com/play-with-docker/play-with-docker/event"
 	"github.com/play-with-docker/play-with-docker/id"
 	"github.com/play-with-docker/play-with-docker/provisioner"
@@ -145,6 +147,8 @@ func TestInstanceNew_WithNotAllowedImage(t *testing.T) {
 	p.generator = _g
 
 	playground := &types.Playground{Id: "foobar"}
+	_s.On("PlaygroundGet", "foobar").Return(playground, nil)
+
 	sConfig := types.SessionConfig{Playground: playground, UserId: "", Duration: time.Hour, Stack: "", StackName: "", ImageName: ""}
 	session, err := p.SessionNew(context.Background(), sConfig)
 
@@ -168,6 +172,8 @@ func TestInstanceNew_WithNotAllowedImage(t *testing.T) {
 		SessionId:   session.Id,
 		SessionHost: session.Host,
 		ProxyHost:   router.EncodeHost(session.Id, "10.0.0.1", router.HostOpts{}),
+		Envs:        []string{"HELLO=WORLD"},
+		Networks:    []string{"arpanet"},
 	}
 	expectedContainerOpts := docker.CreateContainerOpts{
 		Image:         expectedInstance.Image,
@@ -225,6 +231,8 @@ func TestInstanceNew_WithCustomHostname(t *testing.T) {
 	p.generator = _g
 
 	playground := &types.Playground{Id: "foobar"}
+	_s.On("PlaygroundGet", "foobar").Return(playground, nil)
+
 	sConfig := types.SessionConfig{Playground: playground, UserId: "", Duration: time.Hour, Stack: "", StackName: "", ImageName: ""}
 	session, err := p.SessionNew(context.Background(), sConfig)
 	assert.Nil(t, err)
@@ -268,3 +276,378 @@ func TestInstanceNew_WithCustomHostname(t *testing.T) {
 	_g.AssertExpectations(t)
 	_e.M.AssertExpectations(t)
 }
+
+func TestInstanceNew_WithInstanceRuntime(t *testing.T) {
+	_d := &docker.Mock{}
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	_g.On("NewId").Return("aaaabbbbcccc")
+	_f.On("GetForSession", mock.AnythingOfType("*types.Session")).Return(_d, nil)
+	_d.On("NetworkCreate", "aaaabbbbcccc", dtypes.NetworkCreate{Attachable: true, Driver: "overlay"}).Return(nil)
+	_d.On("DaemonHost").Return("localhost")
+	_d.On("NetworkConnect", config.L2ContainerName, "aaaabbbbcccc", "").Return("10.0.0.1", nil)
+	_s.On("SessionPut", mock.AnythingOfType("*types.Session")).Return(nil)
+	_s.On("SessionCount").Return(1, nil)
+	_s.On("ClientCount").Return(0, nil)
+	_s.On("InstanceCount").Return(0, nil)
+
+	var nilArgs []interface{}
+	_e.M.On("Emit", event.SESSION_NEW, "aaaabbbbcccc", nilArgs).Return()
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+	p.generator = _g
+
+	playground := &types.Playground{Id: "foobar", InstanceRuntimes: map[string]string{"redis": types.InstanceRuntimeContainer, "gcc": "sysbox-runc"}}
+	_s.On("PlaygroundGet", "foobar").Return(playground, nil)
+
+	sConfig := types.SessionConfig{Playground: playground, UserId: "", Duration: time.Hour, Stack: "", StackName: "", ImageName: ""}
+	session, err := p.SessionNew(context.Background(), sConfig)
+	assert.Nil(t, err)
+
+	expectedInstance := types.Instance{
+		Name:        fmt.Sprintf("%s_aaaabbbbcccc", session.Id[:8]),
+		Hostname:    "redis-master",
+		IP:          "10.0.0.1",
+		RoutableIP:  "10.0.0.1",
+		Image:       "redis",
+		SessionHost: session.Host,
+		SessionId:   session.Id,
+		ProxyHost:   router.EncodeHost(session.Id, "10.0.0.1", router.HostOpts{}),
+	}
+	expectedContainerOpts := docker.CreateContainerOpts{
+		Image:         expectedInstance.Image,
+		SessionId:     session.Id,
+		ContainerName: expectedInstance.Name,
+		Hostname:      expectedInstance.Hostname,
+		ServerCert:    nil,
+		ServerKey:     nil,
+		CACert:        nil,
+		Networks:      []string{session.Id},
+	}
+
+	_d.On("ContainerCreate", expectedContainerOpts).Return(nil)
+	_d.On("ContainerIPs", expectedInstance.Name).Return(map[string]string{session.Id: "10.0.0.1"}, nil)
+	_s.On("InstancePut", mock.AnythingOfType("*types.Instance")).Return(nil)
+	_e.M.On("Emit", event.INSTANCE_NEW, "aaaabbbbcccc", []interface{}{"aaaabbbb_aaaabbbbcccc", "10.0.0.1", "redis-master", "ip10-0-0-1-aaaabbbbcccc"}).Return()
+
+	instance, err := p.InstanceNew(session, types.InstanceConfig{ImageName: "redis", Hostname: "redis-master"})
+
+	assert.Nil(t, err)
+
+	assert.Equal(t, expectedInstance, *instance)
+
+	// Images with a custom docker runtime are unprivileged too
+	expectedContainerOpts.Image = "gcc"
+	expectedContainerOpts.Runtime = "sysbox-runc"
+	_d.On("ContainerCreate", expectedContainerOpts).Return(nil)
+
+	_, err = p.InstanceNew(session, types.InstanceConfig{ImageName: "gcc", Hostname: "redis-master"})
+	assert.Nil(t, err)
+
+	_d.AssertExpectations(t)
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
+func TestInstanceNew_WithFakeRuntime(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	rt := engine.NewFake()
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinDWithRuntimes(_g, rt, _s))
+	sp := provisioner.NewRuntimeSessionProvisioner(rt)
+
+	_g.On("NewId").Return("aaaabbbbcccc")
+	_s.On("SessionPut", mock.AnythingOfType("*types.Session")).Return(nil)
+	_s.On("SessionCount").Return(1, nil)
+	_s.On("ClientCount").Return(0, nil)
+	_s.On("InstanceCount").Return(0, nil)
+	_s.On("InstanceFindBySessionId", "aaaabbbbcccc").Return([]*types.Instance{}, nil)
+
+	var nilArgs []interface{}
+	_e.M.On("Emit", event.SESSION_NEW, "aaaabbbbcccc", nilArgs).Return()
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+	p.generator = _g
+
+	playground := &types.Playground{Id: "foobar", DefaultDinDInstanceImage: "franela/dind"}
+
+	_s.On("PlaygroundGet", "foobar").Return(playground, nil)
+
+	sConfig := types.SessionConfig{Playground: playground, UserId: "", Duration: time.Hour, Stack: "", StackName: "", ImageName: ""}
+	session, err := p.SessionNew(context.Background(), sConfig)
+	assert.Nil(t, err)
+	assert.True(t, rt.HasNetwork(session.Id))
+	assert.Equal(t, "localhost", session.Host)
+	assert.Equal(t, "10.0.0.1", session.PwdIpAddress)
+
+	_s.On("InstancePut", mock.AnythingOfType("*types.Instance")).Return(nil)
+	_s.On("SessionGet", session.Id).Return(session, nil)
+	_e.M.On("Emit", event.INSTANCE_NEW, "aaaabbbbcccc", []interface{}{"aaaabbbb_aaaabbbbcccc", "10.0.0.2", "node1", "ip10-0-0-2-aaaabbbbcccc"}).Return()
+
+	instance, err := p.InstanceNew(session, types.InstanceConfig{PlaygroundFQDN: "something.play-with-docker.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.2", instance.IP)
+
+	c := rt.Container(instance.Name)
+	assert.NotNil(t, c)
+	assert.True(t, c.Opts.Privileged)
+	assert.Equal(t, "node1", c.Opts.Hostname)
+
+	code, err := p.InstanceExec(instance, []string{"echo", "hello"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, [][]string{{"echo", "hello"}}, c.Execs)
+
+	id, conn, err := p.InstanceExecTerminal(instance)
+	assert.Nil(t, err)
+	assert.NotNil(t, conn)
+	assert.Len(t, c.ExecTerminals, 1)
+	assert.Equal(t, id, c.ExecTerminals[0].Id)
+
+	err = p.InstanceResizeExecTerminal(instance, id, 24, 80)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(24), c.ExecTerminals[0].Rows)
+	assert.Equal(t, uint(80), c.ExecTerminals[0].Cols)
+
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
+func TestInstanceRecreate(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	rt := engine.NewFake()
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinDWithRuntimes(_g, rt, _s))
+	sp := provisioner.NewRuntimeSessionProvisioner(rt)
+
+	config.UserVolumeDriver = "xfsvol"
+	config.UserVolumePath = "/root"
+	rt.NetworkCreate("aaaabbbbcccc")
+	rt.ContainerCreate(engine.CreateContainerOpts{ContainerName: "aaaabbbb_node1", Networks: []string{"aaaabbbbcccc"}})
+
+	s := &types.Session{Id: "aaaabbbbcccc", UserId: "user1", PlaygroundId: "foobar"}
+	i := &types.Instance{Name: "aaaabbbb_node1", SessionId: s.Id, Image: "franela/dind", Hostname: "node1", Envs: []string{"FOO=bar"}, Networks: []string{"extra"}}
+	playground := &types.Playground{Id: "foobar", Domain: "localhost", DindVolumeSize: "10G", UserVolumes: true}
+
+	_g.On("NewId").Return("aaaabbbbdddd")
+	_s.On("PlaygroundGet", "foobar").Return(playground, nil)
+	_s.On("UserGet", "user1").Return(&types.User{Id: "user1"}, nil)
+	_s.On("UserVolumeGet", "pwd-user-user1").Return(&types.UserVolume{Name: "pwd-user-user1", UserId: "user1", Host: rt.DaemonHost()}, nil)
+	_s.On("UserVolumePut", mock.AnythingOfType("*types.UserVolume")).Return(nil)
+	_s.On("InstanceDelete", "aaaabbbb_node1").Return(nil)
+	_s.On("InstancePut", mock.AnythingOfType("*types.Instance")).Return(nil)
+	_s.On("SessionCount").Return(1, nil)
+	_s.On("ClientCount").Return(0, nil)
+	_s.On("InstanceCount").Return(1, nil)
+	_e.M.On("Emit", event.INSTANCE_DELETE, "aaaabbbbcccc", []interface{}{"aaaabbbb_node1"}).Return()
+	_e.M.On("Emit", event.INSTANCE_NEW, "aaaabbbbcccc", mock.Anything).Return()
+
+	p := NewPWDWithRuntimes(_f, rt, _e, _s, sp, ipf)
+
+	instance, err := p.InstanceRecreate(s, i)
+	assert.Nil(t, err)
+	assert.Nil(t, rt.Container("aaaabbbb_node1"))
+	assert.Equal(t, []string{"FOO=bar"}, instance.Envs)
+	assert.Equal(t, []string{"extra"}, instance.Networks)
+
+	c := rt.Container(instance.Name)
+	assert.NotNil(t, c)
+	assert.Equal(t, "node1", c.Opts.Hostname)
+	assert.Equal(t, "10G", c.Opts.DindVolumeSize)
+	assert.Equal(t, []string{"FOO=bar"}, c.Opts.Envs)
+	assert.Equal(t, []types.Mount{{Source: "pwd-user-user1", Target: "/root"}}, c.Opts.Mounts)
+
+	// Playgrounds without a size of their own get the configured one
+	config.DindVolumeSize = "20G"
+	defer func() { config.DindVolumeSize = "" }()
+	playground.DindVolumeSize = ""
+	_s.On("InstanceDelete", instance.Name).Return(nil)
+	_e.M.On("Emit", event.INSTANCE_DELETE, "aaaabbbbcccc", []interface{}{instance.Name}).Return()
+
+	instance, err = p.InstanceRecreate(s, instance)
+	assert.Nil(t, err)
+	assert.Equal(t, "20G", rt.Container(instance.Name).Opts.DindVolumeSize)
+
+	_s.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
+func TestInstanceSnapshot(t *testing.T) {
+	_d := &docker.Mock{}
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	config.SnapshotRepository = "pwd-snapshots"
+
+	s := &types.Session{Id: "aaaabbbbcccc", UserId: "user1", PlaygroundId: "foobar"}
+	i := &types.Instance{Name: "aaaabbbb_node1", Hostname: "node1", Image: "franela/dind", SessionId: s.Id}
+
+	_g.On("NewId").Return("snapshot1")
+	_s.On("UserGet", "user1").Return(&types.User{Id: "user1"}, nil)
+	_s.On("PlaygroundGet", "foobar").Return(&types.Playground{Id: "foobar"}, nil)
+	_f.On("GetForSession", s).Return(_d, nil)
+	_d.On("ContainerCommit", "aaaabbbb_node1", "pwd-snapshots/user1:snapshot1").Return(nil)
+	_d.On("DaemonHost").Return("unix:///var/run/docker.sock")
+	_d.On("ImageSize", "pwd-snapshots/user1:snapshot1").Return(int64(1024), nil)
+	_s.On("SnapshotPut", mock.AnythingOfType("*types.Snapshot")).Return(nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+	p.generator = _g
+
+	snapshot, err := p.InstanceSnapshot(s, i)
+	assert.Nil(t, err)
+	assert.Equal(t, "snapshot1", snapshot.Id)
+	assert.Equal(t, "user1", snapshot.UserId)
+	assert.Equal(t, "node1", snapshot.Hostname)
+	assert.Equal(t, "franela/dind", snapshot.Image)
+	assert.Equal(t, "pwd-snapshots/user1:snapshot1", snapshot.Ref)
+	assert.Equal(t, "unix:///var/run/docker.sock", snapshot.Host)
+	assert.Equal(t, int64(1024), snapshot.Size)
+
+	// Anonymous sessions cannot be snapshotted
+	_, err = p.InstanceSnapshot(&types.Session{Id: "aaaabbbbcccc"}, i)
+	assert.NotNil(t, err)
+
+	_d.AssertExpectations(t)
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
+func TestInstanceSnapshot_Quota(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	rf := engine.NewFake()
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinDWithRuntimes(_g, rf, _s))
+	sp := provisioner.NewRuntimeSessionProvisioner(rf)
+
+	config.SnapshotRepository = "pwd-snapshots"
+	rf.CommitSize = 600
+	rf.NetworkCreate("aaaabbbbcccc")
+	rf.ContainerCreate(engine.CreateContainerOpts{ContainerName: "aaaabbbb_node1", Networks: []string{"aaaabbbbcccc"}})
+
+	s := &types.Session{Id: "aaaabbbbcccc", UserId: "user1", PlaygroundId: "foobar"}
+	i := &types.Instance{Name: "aaaabbbb_node1", SessionId: s.Id}
+	playground := &types.Playground{Id: "foobar", UserQuota: types.Quota{MaxSnapshots: 2, MaxSnapshotSize: 1000}}
+
+	_s.On("UserGet", "user1").Return(&types.User{Id: "user1"}, nil)
+	_s.On("PlaygroundGet", "foobar").Return(playground, nil)
+	_s.On("SessionFindByUserId", "user1").Return([]*types.Session{}, nil)
+	_s.On("SessionLogFindByUserId", "user1").Return([]*types.SessionLog{}, nil)
+	_s.On("SnapshotFindByUserId", "user1").Return([]*types.Snapshot{{Id: "old", UserId: "user1", Size: 500}}, nil).Once()
+	_g.On("NewId").Return("snapshot1")
+
+	p := NewPWDWithRuntimes(_f, rf, _e, _s, sp, ipf)
+	p.generator = _g
+
+	// 500 bytes are left, so the 600 bytes snapshot is removed again
+	_, err := p.InstanceSnapshot(s, i)
+	var quotaExceeded *QuotaExceededError
+	assert.True(t, errors.As(err, &quotaExceeded))
+	assert.Equal(t, types.QuotaSnapshotSize, quotaExceeded.Quota)
+	assert.Equal(t, "", rf.Image("pwd-snapshots/user1:snapshot1"))
+
+	_s.On("SnapshotFindByUserId", "user1").Return([]*types.Snapshot{{Id: "a", Size: 1}, {Id: "b", Size: 1}}, nil)
+	_, err = p.InstanceSnapshot(s, i)
+	assert.True(t, errors.As(err, &quotaExceeded))
+	assert.Equal(t, types.QuotaSnapshots, quotaExceeded.Quota)
+}
+
+func TestInstanceNew_FromSnapshotOnOtherHost(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	host1 := engine.NewFakeOnHost("tcp://10.0.0.1:2375")
+	host2 := engine.NewFakeOnHost("tcp://10.0.0.2:2375")
+	rf := engine.FakeHosts{host1.DaemonHost(): host1, host2.DaemonHost(): host2}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinDWithRuntimes(_g, rf, _s))
+	sp := provisioner.NewRuntimeSessionProvisioner(rf)
+
+	// The snapshot was taken in a session on the first host
+	host1.NetworkCreate("aaaabbbbcccc")
+	host1.ContainerCreate(engine.CreateContainerOpts{ContainerName: "aaaabbbb_node1", Networks: []string{"aaaabbbbcccc"}})
+	host1.ContainerCommit("aaaabbbb_node1", "pwd-snapshots/user1:snapshot1")
+	snapshot := &types.Snapshot{Id: "snapshot1", UserId: "user1", Ref: "pwd-snapshots/user1:snapshot1", Host: host1.DaemonHost()}
+
+	host2.NetworkCreate("eeeeffffgggg")
+	s := &types.Session{Id: "eeeeffffgggg", UserId: "user1", PlaygroundId: "foobar", Host: host2.DaemonHost()}
+
+	_g.On("NewId").Return("aaaabbbbdddd")
+	_s.On("SnapshotGet", "snapshot1").Return(snapshot, nil)
+	_s.On("SnapshotPut", snapshot).Return(nil)
+	_s.On("PlaygroundGet", "foobar").Return(&types.Playground{Id: "foobar"}, nil)
+	_s.On("UserGet", "user1").Return(&types.User{Id: "user1"}, nil)
+	_s.On("InstancePut", mock.AnythingOfType("*types.Instance")).Return(nil)
+	_s.On("SessionCount").Return(1, nil)
+	_s.On("ClientCount").Return(0, nil)
+	_s.On("InstanceCount").Return(1, nil)
+	_e.M.On("Emit", event.INSTANCE_NEW, "eeeeffffgggg", mock.Anything).Return()
+
+	p := NewPWDWithRuntimes(_f, rf, _e, _s, sp, ipf)
+
+	instance, err := p.InstanceNew(s, types.InstanceConfig{Hostname: "node1", SnapshotId: "snapshot1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "pwd-snapshots/user1:snapshot1", instance.Image)
+	assert.Equal(t, "aaaabbbb_node1", host2.Image("pwd-snapshots/user1:snapshot1"))
+	assert.NotNil(t, host2.Container(instance.Name))
+	assert.Nil(t, host1.Container(instance.Name))
+	assert.Equal(t, []string{host2.DaemonHost()}, snapshot.Copies)
+
+	// Deleting the snapshot removes its copies too
+	_s.On("SnapshotDelete", "snapshot1").Return(nil)
+	assert.Nil(t, p.SnapshotDelete(snapshot))
+	assert.Equal(t, "", host1.Image("pwd-snapshots/user1:snapshot1"))
+	assert.Equal(t, "", host2.Image("pwd-snapshots/user1:snapshot1"))
+
+	_s.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
+func TestSnapshotDelete(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_e := &event.Mock{}
+	rf := engine.NewFake()
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinDWithRuntimes(&id.MockGenerator{}, rf, _s))
+	sp := provisioner.NewRuntimeSessionProvisioner(rf)
+
+	rf.NetworkCreate("aaaabbbbcccc")
+	rf.ContainerCreate(engine.CreateContainerOpts{ContainerName: "aaaabbbb_node1", Networks: []string{"aaaabbbbcccc"}})
+	rf.ContainerCommit("aaaabbbb_node1", "pwd-snapshots/user1:snapshot1")
+
+	_s.On("SnapshotDelete", "snapshot1").Return(nil)
+
+	p := NewPWDWithRuntimes(_f, rf, _e, _s, sp, ipf)
+
+	err := p.SnapshotDelete(&types.Snapshot{Id: "snapshot1", Ref: "pwd-snapshots/user1:snapshot1", Host: rf.DaemonHost()})
+	assert.Nil(t, err)
+	assert.Equal(t, "", rf.Image("pwd-snapshots/user1:snapshot1"))
+
+	// Images on hosts that can't be reached aren't forgotten
+	err = p.SnapshotDelete(&types.Snapshot{Id: "snapshot2", Ref: "pwd-snapshots/user1:snapshot2", Host: "tcp://10.0.0.9:2375"})
+	assert.NotNil(t, err)
+
+	_s.AssertExpectations(t)
+}
@@ -0,0 +1,136 @@
+package pwd
+
+import (
+	"log"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/satori/go.uuid"
+)
+
+// How long a replaced login session id keeps working.
+const loginSessionRotationGrace = time.Minute
+
+// LoginSessionNew logs the user in. Logins expire when they aren't used for
+// the configured time.
+func (p *pwd) LoginSessionNew(user *types.User, impersonatedBy, userAgent string) (*types.LoginSession, error) {
+	defer observeAction("LoginSessionNew", time.Now())
+
+	now := time.Now()
+	loginSession := &types.LoginSession{
+		Id:             uuid.NewV4().String(),
+		UserId:         user.Id,
+		ImpersonatedBy: impersonatedBy,
+		UserAgent:      userAgent,
+		CreatedAt:      now,
+		IssuedAt:       now,
+		ExpiresAt:      now.Add(config.LoginSessionTTL),
+		CSRFToken:      uuid.NewV4().String(),
+	}
+	if err := p.storage.LoginSessionPut(loginSession); err != nil {
+		return nil, err
+	}
+	return loginSession, nil
+}
+
+// LoginSessionGet returns the login session with the given id. Expired ones
+// are not found.
+func (p *pwd) LoginSessionGet(id string) (*types.LoginSession, error) {
+	defer observeAction("LoginSessionGet", time.Now())
+
+	loginSession, err := p.storage.LoginSessionGet(id)
+	if err != nil {
+		return nil, err
+	}
+	if loginSession.Expired(time.Now()) {
+		return nil, storage.NotFoundError
+	}
+	return loginSession, nil
+}
+
+func (p *pwd) LoginSessionFindByUser(userId string) ([]*types.LoginSession, error) {
+	defer observeAction("LoginSessionFindByUser", time.Now())
+
+	loginSessions, err := p.storage.LoginSessionFindByUserId(userId)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	found := []*types.LoginSession{}
+	for _, l := range loginSessions {
+		if !l.Expired(now) && l.ReplacedBy == "" {
+			found = append(found, l)
+		}
+	}
+	return found, nil
+}
+
+// LoginSessionRotate replaces the id of the login session with a new one,
+// which expires the configured time from now. The old id stops working
+// shortly after.
+func (p *pwd) LoginSessionRotate(loginSession *types.LoginSession) (*types.LoginSession, error) {
+	defer observeAction("LoginSessionRotate", time.Now())
+
+	now := time.Now()
+	rotated := *loginSession
+	rotated.Id = uuid.NewV4().String()
+	rotated.IssuedAt = now
+	rotated.ExpiresAt = now.Add(config.LoginSessionTTL)
+	if err := p.storage.LoginSessionPut(&rotated); err != nil {
+		return nil, err
+	}
+
+	loginSession.ReplacedBy = rotated.Id
+	if grace := now.Add(loginSessionRotationGrace); grace.Before(loginSession.ExpiresAt) {
+		loginSession.ExpiresAt = grace
+	}
+	if err := p.storage.LoginSessionPut(loginSession); err != nil {
+		return nil, err
+	}
+	return &rotated, nil
+}
+
+// LoginSessionDelete logs the login session out.
+func (p *pwd) LoginSessionDelete(loginSession *types.LoginSession) error {
+	defer observeAction("LoginSessionDelete", time.Now())
+
+	return p.storage.LoginSessionDelete(loginSession.Id)
+}
+
+// LoginSessionRevokeUser logs the user out everywhere.
+func (p *pwd) LoginSessionRevokeUser(userId string) error {
+	defer observeAction("LoginSessionRevokeUser", time.Now())
+
+	loginSessions, err := p.storage.LoginSessionFindByUserId(userId)
+	if err != nil {
+		return err
+	}
+	for _, l := range loginSessions {
+		if err := p.storage.LoginSessionDelete(l.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoginSessionPruneExpired removes the login sessions that expired.
+func (p *pwd) LoginSessionPruneExpired() error {
+	defer observeAction("LoginSessionPruneExpired", time.Now())
+
+	loginSessions, err := p.storage.LoginSessionGetAll()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, l := range loginSessions {
+		if !l.Expired(now) {
+			continue
+		}
+		if err := p.storage.LoginSessionDelete(l.Id); err != nil {
+			log.Printf("Could not remove expired login session of user [%s]. Got: %v\n", l.UserId, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package pwd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/provisioner"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestLoginSessionRotate(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(nil, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	config.LoginSessionTTL = 24 * time.Hour
+	user := &types.User{Id: "u1"}
+
+	_s.On("LoginSessionPut", mock.AnythingOfType("*types.LoginSession")).Return(nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	login, err := p.LoginSessionNew(user, "", "curl")
+	assert.Nil(t, err)
+	assert.Equal(t, "u1", login.UserId)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), login.ExpiresAt, time.Second)
+	assert.False(t, login.RotationDue(time.Hour, time.Now()))
+	assert.True(t, login.RotationDue(time.Hour, time.Now().Add(2*time.Hour)))
+
+	rotated, err := p.LoginSessionRotate(login)
+	assert.Nil(t, err)
+	assert.NotEqual(t, login.Id, rotated.Id)
+	assert.Equal(t, login.CreatedAt, rotated.CreatedAt)
+	assert.Equal(t, rotated.Id, login.ReplacedBy)
+	assert.NotEmpty(t, login.CSRFToken)
+	assert.Equal(t, login.CSRFToken, rotated.CSRFToken)
+	assert.WithinDuration(t, time.Now().Add(loginSessionRotationGrace), login.ExpiresAt, time.Second)
+	assert.False(t, login.RotationDue(time.Hour, time.Now().Add(2*time.Hour)))
+
+	_s.AssertExpectations(t)
+}
+
+func TestLoginSessionGet_Expired(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(nil, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	valid := &types.LoginSession{Id: "l1", UserId: "u1", ExpiresAt: time.Now().Add(time.Hour)}
+	expired := &types.LoginSession{Id: "l2", UserId: "u1", ExpiresAt: time.Now().Add(-time.Hour)}
+
+	_s.On("LoginSessionGet", "l1").Return(valid, nil)
+	_s.On("LoginSessionGet", "l2").Return(expired, nil)
+	_s.On("LoginSessionGetAll").Return([]*types.LoginSession{valid, expired}, nil)
+	_s.On("LoginSessionDelete", "l2").Return(nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	found, err := p.LoginSessionGet("l1")
+	assert.Nil(t, err)
+	assert.Equal(t, valid, found)
+
+	_, err = p.LoginSessionGet("l2")
+	assert.True(t, storage.NotFound(err))
+
+	err = p.LoginSessionPruneExpired()
+	assert.Nil(t, err)
+
+	_s.AssertExpectations(t)
+}
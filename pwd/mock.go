@@ -4,7 +4,9 @@ import (
 	"context"
 	"io"
 	"net"
+	"time"
 
+	"github.com/play-with-docker/play-with-docker/asciicast"
 	"github.com/play-with-docker/play-with-docker/pwd/types"
 	"github.com/stretchr/testify/mock"
 )
@@ -23,11 +25,16 @@ func (m *Mock) SessionClose(session *types.Session) error {
 	return args.Error(0)
 }
 
-func (m *Mock) SessionGetSmallestViewPort(sessionId string) types.ViewPort {
-	args := m.Called(sessionId)
+func (m *Mock) SessionGetViewPort(sessionId, terminal string) types.ViewPort {
+	args := m.Called(sessionId, terminal)
 	return args.Get(0).(types.ViewPort)
 }
 
+func (m *Mock) SessionSetResizePolicy(session *types.Session, policy string) error {
+	args := m.Called(session, policy)
+	return args.Error(0)
+}
+
 func (m *Mock) SessionDeployStack(session *types.Session) error {
 	args := m.Called(session)
 	return args.Error(0)
@@ -38,6 +45,16 @@ func (m *Mock) SessionGet(id string) (*types.Session, error) {
 	return args.Get(0).(*types.Session), args.Error(1)
 }
 
+func (m *Mock) SessionClaim(s *types.Session, user *types.User, creatorSecret string) error {
+	args := m.Called(s, user, creatorSecret)
+	return args.Error(0)
+}
+
+func (m *Mock) SessionFindByCourse(courseId string) ([]*types.Session, error) {
+	args := m.Called(courseId)
+	return args.Get(0).([]*types.Session), args.Error(1)
+}
+
 func (m *Mock) SessionSetup(session *types.Session, conf SessionSetupConf) error {
 	args := m.Called(session, conf)
 	return args.Error(0)
@@ -53,6 +70,16 @@ func (m *Mock) InstanceResizeTerminal(instance *types.Instance, cols, rows uint)
 	return args.Error(0)
 }
 
+func (m *Mock) InstanceExecTerminal(instance *types.Instance) (string, net.Conn, error) {
+	args := m.Called(instance)
+	return args.String(0), args.Get(1).(net.Conn), args.Error(2)
+}
+
+func (m *Mock) InstanceResizeExecTerminal(instance *types.Instance, id string, rows, cols uint) error {
+	args := m.Called(instance, id, rows, cols)
+	return args.Error(0)
+}
+
 func (m *Mock) InstanceGetTerminal(instance *types.Instance) (net.Conn, error) {
 	args := m.Called(instance)
 	return args.Get(0).(net.Conn), args.Error(1)
@@ -82,6 +109,11 @@ func (m *Mock) InstanceDelete(session *types.Session, instance *types.Instance)
 	return args.Error(0)
 }
 
+func (m *Mock) InstanceRecreate(session *types.Session, instance *types.Instance) (*types.Instance, error) {
+	args := m.Called(session, instance)
+	return args.Get(0).(*types.Instance), args.Error(1)
+}
+
 func (m *Mock) InstanceExec(instance *types.Instance, cmd []string) (int, error) {
 	args := m.Called(instance, cmd)
 	return args.Int(0), args.Error(1)
@@ -102,8 +134,13 @@ func (m *Mock) InstanceFile(instance *types.Instance, filePath string) (io.Reade
 	return args.Get(0).(io.Reader), args.Error(1)
 }
 
-func (m *Mock) ClientNew(id string, session *types.Session) *types.Client {
-	args := m.Called(id, session)
+func (m *Mock) InstanceSnapshot(session *types.Session, instance *types.Instance) (*types.Snapshot, error) {
+	args := m.Called(session, instance)
+	return args.Get(0).(*types.Snapshot), args.Error(1)
+}
+
+func (m *Mock) ClientNew(id string, session *types.Session, userId string) *types.Client {
+	args := m.Called(id, session, userId)
 	return args.Get(0).(*types.Client)
 }
 
@@ -111,6 +148,10 @@ func (m *Mock) ClientResizeViewPort(client *types.Client, cols, rows uint) {
 	m.Called(client, cols, rows)
 }
 
+func (m *Mock) ClientResizeTerminal(client *types.Client, terminal string, cols, rows uint) {
+	m.Called(client, terminal, cols, rows)
+}
+
 func (m *Mock) ClientClose(client *types.Client) {
 	m.Called(client)
 }
@@ -135,11 +176,241 @@ func (m *Mock) UserLogin(loginRequest *types.LoginRequest, user *types.User) (*t
 	return args.Get(0).(*types.User), args.Error(1)
 }
 
+func (m *Mock) UserNewLinkRequest(providerName string, user *types.User) (*types.LoginRequest, error) {
+	args := m.Called(providerName, user)
+	return args.Get(0).(*types.LoginRequest), args.Error(1)
+}
+
+func (m *Mock) UserUnlinkIdentity(user *types.User, provider, providerUserId string) error {
+	args := m.Called(user, provider, providerUserId)
+	return args.Error(0)
+}
+
 func (m *Mock) UserGet(id string) (*types.User, error) {
 	args := m.Called(id)
 	return args.Get(0).(*types.User), args.Error(1)
 }
 
+func (m *Mock) UserGrantRole(user *types.User, grant types.RoleGrant) error {
+	args := m.Called(user, grant)
+	return args.Error(0)
+}
+
+func (m *Mock) UserRevokeRole(user *types.User, grant types.RoleGrant) error {
+	args := m.Called(user, grant)
+	return args.Error(0)
+}
+
+func (m *Mock) UserList(query string) ([]*types.User, error) {
+	args := m.Called(query)
+	return args.Get(0).([]*types.User), args.Error(1)
+}
+
+func (m *Mock) UserBan(user *types.User) error {
+	args := m.Called(user)
+	return args.Error(0)
+}
+
+func (m *Mock) UserUnban(user *types.User) error {
+	args := m.Called(user)
+	return args.Error(0)
+}
+
+func (m *Mock) UserDelete(user *types.User) error {
+	args := m.Called(user)
+	return args.Error(0)
+}
+
+func (m *Mock) SessionLogFindByUser(userId string) ([]*types.SessionLog, error) {
+	args := m.Called(userId)
+	return args.Get(0).([]*types.SessionLog), args.Error(1)
+}
+
+func (m *Mock) UserUsage(user *types.User, playground *types.Playground, courseId string) (*types.Usage, error) {
+	args := m.Called(user, playground, courseId)
+	return args.Get(0).(*types.Usage), args.Error(1)
+}
+
+func (m *Mock) APITokenNew(user *types.User, name string, scopes []string, expiresAt time.Time) (*types.APIToken, string, error) {
+	args := m.Called(user, name, scopes, expiresAt)
+	return args.Get(0).(*types.APIToken), args.String(1), args.Error(2)
+}
+
+func (m *Mock) APITokenGet(id string) (*types.APIToken, error) {
+	args := m.Called(id)
+	return args.Get(0).(*types.APIToken), args.Error(1)
+}
+
+func (m *Mock) APITokenFindByUser(userId string) ([]*types.APIToken, error) {
+	args := m.Called(userId)
+	return args.Get(0).([]*types.APIToken), args.Error(1)
+}
+
+func (m *Mock) APITokenDelete(token *types.APIToken) error {
+	args := m.Called(token)
+	return args.Error(0)
+}
+
+func (m *Mock) APITokenAuthenticate(value string) (*types.APIToken, *types.User, error) {
+	args := m.Called(value)
+	return args.Get(0).(*types.APIToken), args.Get(1).(*types.User), args.Error(2)
+}
+
+func (m *Mock) LoginSessionNew(user *types.User, impersonatedBy, userAgent string) (*types.LoginSession, error) {
+	args := m.Called(user, impersonatedBy, userAgent)
+	return args.Get(0).(*types.LoginSession), args.Error(1)
+}
+
+func (m *Mock) LoginSessionGet(id string) (*types.LoginSession, error) {
+	args := m.Called(id)
+	return args.Get(0).(*types.LoginSession), args.Error(1)
+}
+
+func (m *Mock) LoginSessionFindByUser(userId string) ([]*types.LoginSession, error) {
+	args := m.Called(userId)
+	return args.Get(0).([]*types.LoginSession), args.Error(1)
+}
+
+func (m *Mock) LoginSessionRotate(loginSession *types.LoginSession) (*types.LoginSession, error) {
+	args := m.Called(loginSession)
+	return args.Get(0).(*types.LoginSession), args.Error(1)
+}
+
+func (m *Mock) LoginSessionDelete(loginSession *types.LoginSession) error {
+	args := m.Called(loginSession)
+	return args.Error(0)
+}
+
+func (m *Mock) LoginSessionRevokeUser(userId string) error {
+	args := m.Called(userId)
+	return args.Error(0)
+}
+
+func (m *Mock) LoginSessionPruneExpired() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *Mock) SnapshotGet(id string) (*types.Snapshot, error) {
+	args := m.Called(id)
+	return args.Get(0).(*types.Snapshot), args.Error(1)
+}
+
+func (m *Mock) SnapshotFindByUser(userId string) ([]*types.Snapshot, error) {
+	args := m.Called(userId)
+	return args.Get(0).([]*types.Snapshot), args.Error(1)
+}
+
+func (m *Mock) SnapshotDelete(snapshot *types.Snapshot) error {
+	args := m.Called(snapshot)
+	return args.Error(0)
+}
+
+func (m *Mock) RecordingNew(session *types.Session, instance *types.Instance, terminal string, cols, rows uint) (*types.Recording, *asciicast.Writer, error) {
+	args := m.Called(session, instance, terminal, cols, rows)
+	return args.Get(0).(*types.Recording), args.Get(1).(*asciicast.Writer), args.Error(2)
+}
+
+func (m *Mock) RecordingEnd(recording *types.Recording) error {
+	args := m.Called(recording)
+	return args.Error(0)
+}
+
+func (m *Mock) RecordingGet(id string) (*types.Recording, error) {
+	args := m.Called(id)
+	return args.Get(0).(*types.Recording), args.Error(1)
+}
+
+func (m *Mock) RecordingFindBySession(sessionId string) ([]*types.Recording, error) {
+	args := m.Called(sessionId)
+	return args.Get(0).([]*types.Recording), args.Error(1)
+}
+
+func (m *Mock) RecordingOpen(recording *types.Recording) (io.ReadCloser, error) {
+	args := m.Called(recording)
+	return args.Get(0).(io.ReadCloser), args.Error(1)
+}
+
+func (m *Mock) RecordingDelete(recording *types.Recording) error {
+	args := m.Called(recording)
+	return args.Error(0)
+}
+
+func (m *Mock) ExamSubmit(session *types.Session, exam string, files map[string][]byte) error {
+	args := m.Called(session, exam, files)
+	return args.Error(0)
+}
+
+func (m *Mock) ExamGrade(session *types.Session, exam string) (float64, float64, error) {
+	args := m.Called(session, exam)
+	return args.Get(0).(float64), args.Get(1).(float64), args.Error(2)
+}
+
+func (m *Mock) CommandNew(session *types.Session, instance *types.Instance, terminal, userId, line string) (*types.Command, error) {
+	args := m.Called(session, instance, terminal, userId, line)
+	return args.Get(0).(*types.Command), args.Error(1)
+}
+
+func (m *Mock) CommandFindBySession(sessionId string) ([]*types.Command, error) {
+	args := m.Called(sessionId)
+	return args.Get(0).([]*types.Command), args.Error(1)
+}
+
+func (m *Mock) CommandFindByUser(userId string) ([]*types.Command, error) {
+	args := m.Called(userId)
+	return args.Get(0).([]*types.Command), args.Error(1)
+}
+
+func (m *Mock) ShareNew(session *types.Session, role string) (*types.Share, error) {
+	args := m.Called(session, role)
+	return args.Get(0).(*types.Share), args.Error(1)
+}
+
+func (m *Mock) ShareGet(token string) (*types.Share, error) {
+	args := m.Called(token)
+	return args.Get(0).(*types.Share), args.Error(1)
+}
+
+func (m *Mock) ShareFindBySession(sessionId string) ([]*types.Share, error) {
+	args := m.Called(sessionId)
+	return args.Get(0).([]*types.Share), args.Error(1)
+}
+
+func (m *Mock) ShareDelete(share *types.Share) error {
+	args := m.Called(share)
+	return args.Error(0)
+}
+
+func (m *Mock) CourseFindOrNew(course *types.Course) (*types.Course, error) {
+	args := m.Called(course)
+	return args.Get(0).(*types.Course), args.Error(1)
+}
+
+func (m *Mock) CourseGet(id string) (*types.Course, error) {
+	args := m.Called(id)
+	return args.Get(0).(*types.Course), args.Error(1)
+}
+
+func (m *Mock) UserVolumeList() ([]*types.UserVolume, error) {
+	args := m.Called()
+	return args.Get(0).([]*types.UserVolume), args.Error(1)
+}
+
+func (m *Mock) UserVolumeGet(name string) (*types.UserVolume, error) {
+	args := m.Called(name)
+	return args.Get(0).(*types.UserVolume), args.Error(1)
+}
+
+func (m *Mock) UserVolumeDelete(volume *types.UserVolume) error {
+	args := m.Called(volume)
+	return args.Error(0)
+}
+
+func (m *Mock) UserVolumePruneIdle() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
 func (m *Mock) PlaygroundNew(playground types.Playground) (*types.Playground, error) {
 	args := m.Called(playground)
 	return args.Get(0).(*types.Playground), args.Error(1)
@@ -7,7 +7,9 @@ import (
 	"net"
 	"time"
 
+	"github.com/play-with-docker/play-with-docker/asciicast"
 	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/engine"
 	"github.com/play-with-docker/play-with-docker/event"
 	"github.com/play-with-docker/play-with-docker/id"
 	"github.com/play-with-docker/play-with-docker/provisioner"
@@ -50,6 +52,7 @@ func init() {
 
 type pwd struct {
 	dockerFactory              docker.FactoryApi
+	runtimes                   engine.FactoryApi
 	event                      event.EventApi
 	storage                    storage.StorageApi
 	generator                  id.Generator
@@ -58,6 +61,7 @@ type pwd struct {
 	instanceProvisionerFactory provisioner.InstanceProvisionerFactoryApi
 	windowsProvisioner         provisioner.InstanceProvisionerApi
 	dindProvisioner            provisioner.InstanceProvisionerApi
+	quotaLocks                 userLocks
 }
 
 var sessionNotEmpty = errors.New("Session is not empty")
@@ -69,33 +73,96 @@ func SessionNotEmpty(e error) bool {
 type PWDApi interface {
 	SessionNew(ctx context.Context, config types.SessionConfig) (*types.Session, error)
 	SessionClose(session *types.Session) error
-	SessionGetSmallestViewPort(sessionId string) types.ViewPort
+	SessionGetViewPort(sessionId, terminal string) types.ViewPort
+	SessionSetResizePolicy(session *types.Session, policy string) error
 	SessionDeployStack(session *types.Session) error
 	SessionGet(id string) (*types.Session, error)
+	SessionClaim(s *types.Session, user *types.User, creatorSecret string) error
+	SessionFindByCourse(courseId string) ([]*types.Session, error)
 	SessionSetup(session *types.Session, conf SessionSetupConf) error
 
 	InstanceNew(session *types.Session, conf types.InstanceConfig) (*types.Instance, error)
 	InstanceResizeTerminal(instance *types.Instance, cols, rows uint) error
 	InstanceGetTerminal(instance *types.Instance) (net.Conn, error)
+	InstanceExecTerminal(instance *types.Instance) (string, net.Conn, error)
+	InstanceResizeExecTerminal(instance *types.Instance, id string, rows, cols uint) error
 	InstanceUploadFromUrl(instance *types.Instance, fileName, dest, url string) error
 	InstanceUploadFromReader(instance *types.Instance, fileName, dest string, reader io.Reader) error
 	InstanceGet(session *types.Session, name string) *types.Instance
 	InstanceFindBySession(session *types.Session) ([]*types.Instance, error)
 	InstanceDelete(session *types.Session, instance *types.Instance) error
+	InstanceRecreate(session *types.Session, instance *types.Instance) (*types.Instance, error)
 	InstanceExec(instance *types.Instance, cmd []string) (int, error)
 	InstanceExecOutput(instance *types.Instance, cmd []string) (io.Reader, error)
 	InstanceFSTree(instance *types.Instance) (io.Reader, error)
 	InstanceFile(instance *types.Instance, filePath string) (io.Reader, error)
+	InstanceSnapshot(session *types.Session, instance *types.Instance) (*types.Snapshot, error)
 
-	ClientNew(id string, session *types.Session) *types.Client
+	ClientNew(id string, session *types.Session, userId string) *types.Client
 	ClientResizeViewPort(client *types.Client, cols, rows uint)
+	ClientResizeTerminal(client *types.Client, terminal string, cols, rows uint)
 	ClientClose(client *types.Client)
 	ClientCount() int
 
 	UserNewLoginRequest(providerName string) (*types.LoginRequest, error)
 	UserGetLoginRequest(id string) (*types.LoginRequest, error)
 	UserLogin(loginRequest *types.LoginRequest, user *types.User) (*types.User, error)
+	UserNewLinkRequest(providerName string, user *types.User) (*types.LoginRequest, error)
+	UserUnlinkIdentity(user *types.User, provider, providerUserId string) error
 	UserGet(id string) (*types.User, error)
+	UserGrantRole(user *types.User, grant types.RoleGrant) error
+	UserRevokeRole(user *types.User, grant types.RoleGrant) error
+	UserList(query string) ([]*types.User, error)
+	UserBan(user *types.User) error
+	UserUnban(user *types.User) error
+	UserDelete(user *types.User) error
+	SessionLogFindByUser(userId string) ([]*types.SessionLog, error)
+	UserUsage(user *types.User, playground *types.Playground, courseId string) (*types.Usage, error)
+
+	APITokenNew(user *types.User, name string, scopes []string, expiresAt time.Time) (*types.APIToken, string, error)
+	APITokenGet(id string) (*types.APIToken, error)
+	APITokenFindByUser(userId string) ([]*types.APIToken, error)
+	APITokenDelete(token *types.APIToken) error
+	APITokenAuthenticate(value string) (*types.APIToken, *types.User, error)
+
+	LoginSessionNew(user *types.User, impersonatedBy, userAgent string) (*types.LoginSession, error)
+	LoginSessionGet(id string) (*types.LoginSession, error)
+	LoginSessionFindByUser(userId string) ([]*types.LoginSession, error)
+	LoginSessionRotate(loginSession *types.LoginSession) (*types.LoginSession, error)
+	LoginSessionDelete(loginSession *types.LoginSession) error
+	LoginSessionRevokeUser(userId string) error
+	LoginSessionPruneExpired() error
+
+	SnapshotGet(id string) (*types.Snapshot, error)
+	SnapshotFindByUser(userId string) ([]*types.Snapshot, error)
+	SnapshotDelete(snapshot *types.Snapshot) error
+
+	RecordingNew(session *types.Session, instance *types.Instance, terminal string, cols, rows uint) (*types.Recording, *asciicast.Writer, error)
+	RecordingEnd(recording *types.Recording) error
+	RecordingGet(id string) (*types.Recording, error)
+	RecordingFindBySession(sessionId string) ([]*types.Recording, error)
+	RecordingOpen(recording *types.Recording) (io.ReadCloser, error)
+	RecordingDelete(recording *types.Recording) error
+
+	ExamSubmit(session *types.Session, exam string, files map[string][]byte) error
+	ExamGrade(session *types.Session, exam string) (float64, float64, error)
+
+	CommandNew(session *types.Session, instance *types.Instance, terminal, userId, line string) (*types.Command, error)
+	CommandFindBySession(sessionId string) ([]*types.Command, error)
+	CommandFindByUser(userId string) ([]*types.Command, error)
+
+	ShareNew(session *types.Session, role string) (*types.Share, error)
+	ShareGet(token string) (*types.Share, error)
+	ShareFindBySession(sessionId string) ([]*types.Share, error)
+	ShareDelete(share *types.Share) error
+
+	CourseFindOrNew(course *types.Course) (*types.Course, error)
+	CourseGet(id string) (*types.Course, error)
+
+	UserVolumeList() ([]*types.UserVolume, error)
+	UserVolumeGet(name string) (*types.UserVolume, error)
+	UserVolumeDelete(volume *types.UserVolume) error
+	UserVolumePruneIdle() error
 
 	PlaygroundNew(playground types.Playground) (*types.Playground, error)
 	PlaygroundGet(id string) *types.Playground
@@ -104,8 +171,14 @@ type PWDApi interface {
 }
 
 func NewPWD(f docker.FactoryApi, e event.EventApi, s storage.StorageApi, sp provisioner.SessionProvisionerApi, ipf provisioner.InstanceProvisionerFactoryApi) *pwd {
+	return NewPWDWithRuntimes(f, docker.NewRuntimeFactory(f), e, s, sp, ipf)
+}
+
+// NewPWDWithRuntimes is like NewPWD but commits snapshots, creates volumes
+// and sets sessions up on whatever container runtime rf hands out.
+func NewPWDWithRuntimes(f docker.FactoryApi, rf engine.FactoryApi, e event.EventApi, s storage.StorageApi, sp provisioner.SessionProvisionerApi, ipf provisioner.InstanceProvisionerFactoryApi) *pwd {
 	//  windowsProvisioner: provisioner.NewWindowsASG(f, s), dindProvisioner: provisioner.NewDinD(f)
-	return &pwd{dockerFactory: f, event: e, storage: s, generator: id.XIDGenerator{}, sessionProvisioner: sp, instanceProvisionerFactory: ipf}
+	return &pwd{dockerFactory: f, runtimes: rf, event: e, storage: s, generator: id.XIDGenerator{}, sessionProvisioner: sp, instanceProvisionerFactory: ipf}
 }
 
 func (p *pwd) getProvisioner(t string) (provisioner.InstanceProvisionerApi, error) {
@@ -0,0 +1,215 @@
+package pwd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+// QuotaExceededError is returned when a user asks for more than their quota
+// in a playground allows.
+type QuotaExceededError struct {
+	Quota string
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("Quota exceeded: %s", e.Quota)
+}
+
+// UserUsage returns what the user has used of their quota in the playground.
+// Roles are looked up in the course when courseId isn't empty.
+func (p *pwd) UserUsage(user *types.User, playground *types.Playground, courseId string) (*types.Usage, error) {
+	defer observeAction("UserUsage", time.Now())
+
+	return p.usage(user, playground, playground.QuotaFor(user, courseId), time.Now())
+}
+
+// usage counts the open sessions of the user in the playground and their
+// instances, how long their sessions were open over the day before now, how
+// many times each exam was attempted and the snapshots the user keeps. Open
+// sessions count as open until now. Callers that go on to use the quota hold
+// the quota lock of the user, so nothing is created meanwhile.
+func (p *pwd) usage(user *types.User, playground *types.Playground, quota types.Quota, now time.Time) (*types.Usage, error) {
+	sessions, err := p.storage.SessionFindByUserId(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	var openSessions, instances int64
+	for _, s := range sessions {
+		if s.PlaygroundId != playground.Id {
+			continue
+		}
+		openSessions++
+		is, err := p.storage.InstanceFindBySessionId(s.Id)
+		if err != nil {
+			return nil, err
+		}
+		instances += int64(len(is))
+	}
+
+	sessionLogs, err := p.storage.SessionLogFindByUserId(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	dayStart := now.Add(-24 * time.Hour)
+	var sessionTime time.Duration
+	attempts := map[string]int64{}
+	for _, l := range sessionLogs {
+		if l.PlaygroundId != playground.Id {
+			continue
+		}
+		if l.Exam != "" {
+			attempts[l.Exam]++
+		}
+		start, end := l.CreatedAt, l.ClosedAt
+		if end.IsZero() {
+			end = now
+		}
+		if start.Before(dayStart) {
+			start = dayStart
+		}
+		if end.After(start) {
+			sessionTime += end.Sub(start)
+		}
+	}
+
+	snapshots, err := p.storage.SnapshotFindByUserId(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	var snapshotSize int64
+	for _, s := range snapshots {
+		snapshotSize += s.Size
+	}
+
+	usage := &types.Usage{
+		Sessions:     types.NewAllowance(openSessions, int64(quota.MaxSessions)),
+		Instances:    types.NewAllowance(instances, int64(quota.MaxInstances)),
+		SessionTime:  types.NewAllowance(int64(sessionTime), int64(quota.DailySessionTime)),
+		ExamAttempts: map[string]types.Allowance{},
+		Snapshots:    types.NewAllowance(int64(len(snapshots)), int64(quota.MaxSnapshots)),
+		SnapshotSize: types.NewAllowance(snapshotSize, quota.MaxSnapshotSize),
+	}
+	for exam, n := range attempts {
+		usage.ExamAttempts[exam] = types.NewAllowance(n, int64(quota.MaxExamAttempts))
+	}
+	return usage, nil
+}
+
+// checkSessionQuota makes sure the user can start a session in the
+// playground and returns how long the session can last, which is no more
+// than the session time the user has left for the day.
+func (p *pwd) checkSessionQuota(user *types.User, config types.SessionConfig) (time.Duration, error) {
+	playground := config.Playground
+	quota := playground.QuotaFor(user, config.CourseId)
+	if quota == (types.Quota{}) {
+		return config.Duration, nil
+	}
+	usage, err := p.usage(user, playground, quota, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	if usage.Sessions.Exhausted() {
+		return 0, &QuotaExceededError{types.QuotaSessions}
+	}
+	if usage.SessionTime.Exhausted() {
+		return 0, &QuotaExceededError{types.QuotaSessionTime}
+	}
+	if config.Exam != "" && quota.MaxExamAttempts > 0 && usage.ExamAttempts[config.Exam].Used >= int64(quota.MaxExamAttempts) {
+		return 0, &QuotaExceededError{types.QuotaExamAttempts}
+	}
+
+	duration := config.Duration
+	if left := time.Duration(usage.SessionTime.Remaining); left > 0 && left < duration {
+		duration = left
+	}
+	return duration, nil
+}
+
+// checkInstanceQuota makes sure the owner of the session can add one more
+// instance to it.
+func (p *pwd) checkInstanceQuota(session *types.Session) error {
+	user, err := p.storage.UserGet(session.UserId)
+	if err != nil {
+		return err
+	}
+	playground, err := p.storage.PlaygroundGet(session.PlaygroundId)
+	if err != nil {
+		return err
+	}
+	quota := playground.QuotaFor(user, session.CourseId)
+	if quota.MaxInstances == 0 {
+		return nil
+	}
+	usage, err := p.usage(user, playground, quota, time.Now())
+	if err != nil {
+		return err
+	}
+	if usage.Instances.Exhausted() {
+		return &QuotaExceededError{types.QuotaInstances}
+	}
+	return nil
+}
+
+// checkSnapshotQuota makes sure the owner of the session can keep one more
+// snapshot and returns how many bytes of snapshots they have left, which is
+// -1 when there is no limit.
+func (p *pwd) checkSnapshotQuota(session *types.Session) (int64, error) {
+	user, err := p.storage.UserGet(session.UserId)
+	if err != nil {
+		return 0, err
+	}
+	playground, err := p.storage.PlaygroundGet(session.PlaygroundId)
+	if err != nil {
+		return 0, err
+	}
+	quota := playground.QuotaFor(user, session.CourseId)
+	if quota.MaxSnapshots == 0 && quota.MaxSnapshotSize == 0 {
+		return -1, nil
+	}
+	usage, err := p.usage(user, playground, quota, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if usage.Snapshots.Exhausted() {
+		return 0, &QuotaExceededError{types.QuotaSnapshots}
+	}
+	if usage.SnapshotSize.Exhausted() {
+		return 0, &QuotaExceededError{types.QuotaSnapshotSize}
+	}
+	return usage.SnapshotSize.Remaining, nil
+}
+
+// checkClaimQuota makes sure the user can take over the session along with
+// its instances.
+func (p *pwd) checkClaimQuota(session *types.Session, user *types.User) error {
+	playground, err := p.storage.PlaygroundGet(session.PlaygroundId)
+	if err != nil {
+		return err
+	}
+	quota := playground.QuotaFor(user, session.CourseId)
+	if quota == (types.Quota{}) {
+		return nil
+	}
+	usage, err := p.usage(user, playground, quota, time.Now())
+	if err != nil {
+		return err
+	}
+	instances, err := p.storage.InstanceFindBySessionId(session.Id)
+	if err != nil {
+		return err
+	}
+
+	if usage.Sessions.Exhausted() {
+		return &QuotaExceededError{types.QuotaSessions}
+	}
+	if usage.SessionTime.Exhausted() {
+		return &QuotaExceededError{types.QuotaSessionTime}
+	}
+	if usage.Instances.Remaining >= 0 && int64(len(instances)) > usage.Instances.Remaining {
+		return &QuotaExceededError{types.QuotaInstances}
+	}
+	return nil
+}
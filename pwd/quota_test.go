@@ -0,0 +1,118 @@
+package pwd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/provisioner"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserUsage(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_e := &event.Mock{}
+
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(nil, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	now := time.Now()
+	user := &types.User{Id: "u1"}
+	playground := &types.Playground{Id: "pg"}
+	quota := types.Quota{MaxSessions: 2, MaxInstances: 3, DailySessionTime: 4 * time.Hour, MaxExamAttempts: 2}
+
+	_s.On("SessionFindByUserId", "u1").Return([]*types.Session{
+		{Id: "s1", UserId: "u1", PlaygroundId: "pg"},
+		{Id: "s3", UserId: "u1", PlaygroundId: "other"},
+	}, nil)
+	_s.On("InstanceFindBySessionId", "s1").Return([]*types.Instance{{Name: "i1"}, {Name: "i2"}}, nil)
+	_s.On("SnapshotFindByUserId", "u1").Return([]*types.Snapshot{}, nil)
+	_s.On("SessionLogFindByUserId", "u1").Return([]*types.SessionLog{
+		// Only the last hour of this one was in the last day
+		{Id: "l1", PlaygroundId: "pg", Exam: "ex1", CreatedAt: now.Add(-25 * time.Hour), ClosedAt: now.Add(-23 * time.Hour)},
+		{Id: "l2", PlaygroundId: "pg", Exam: "ex1", CreatedAt: now.Add(-2 * time.Hour), ClosedAt: now.Add(-time.Hour)},
+		{Id: "s1", PlaygroundId: "pg", CreatedAt: now.Add(-30 * time.Minute)},
+		{Id: "l3", PlaygroundId: "other", Exam: "ex1", CreatedAt: now.Add(-time.Hour)},
+	}, nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	usage, err := p.usage(user, playground, quota, now)
+	assert.Nil(t, err)
+	assert.Equal(t, types.Allowance{Used: 1, Limit: 2, Remaining: 1}, usage.Sessions)
+	assert.Equal(t, types.Allowance{Used: 2, Limit: 3, Remaining: 1}, usage.Instances)
+	assert.Equal(t, int64(150*time.Minute), usage.SessionTime.Used)
+	assert.Equal(t, int64(90*time.Minute), usage.SessionTime.Remaining)
+	assert.Equal(t, map[string]types.Allowance{"ex1": {Used: 2, Limit: 2, Remaining: 0}}, usage.ExamAttempts)
+
+	_s.AssertExpectations(t)
+}
+
+func TestSessionNew_QuotaExceeded(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_e := &event.Mock{}
+
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(nil, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	_s.On("UserGet", "u1").Return(&types.User{Id: "u1"}, nil)
+	_s.On("SessionFindByUserId", "u1").Return([]*types.Session{{Id: "s1", UserId: "u1", PlaygroundId: "pg"}}, nil)
+	_s.On("InstanceFindBySessionId", "s1").Return([]*types.Instance{}, nil)
+	_s.On("SnapshotFindByUserId", "u1").Return([]*types.Snapshot{}, nil)
+	_s.On("SessionLogFindByUserId", "u1").Return([]*types.SessionLog{
+		{Id: "s0", PlaygroundId: "pg", Exam: "ex1", CreatedAt: time.Now().Add(-48 * time.Hour), ClosedAt: time.Now().Add(-47 * time.Hour)},
+	}, nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	playground := &types.Playground{Id: "pg", UserQuota: types.Quota{MaxSessions: 1}}
+	sConfig := types.SessionConfig{Playground: playground, UserId: "u1", Duration: time.Hour}
+	s, err := p.SessionNew(context.Background(), sConfig)
+	assert.Nil(t, s)
+	var quotaErr *QuotaExceededError
+	assert.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, types.QuotaSessions, quotaErr.Quota)
+
+	playground.UserQuota = types.Quota{MaxExamAttempts: 1}
+	sConfig.Exam = "ex1"
+	s, err = p.SessionNew(context.Background(), sConfig)
+	assert.Nil(t, s)
+	assert.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, types.QuotaExamAttempts, quotaErr.Quota)
+
+	_s.AssertExpectations(t)
+}
+
+func TestInstanceNew_QuotaExceeded(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_e := &event.Mock{}
+
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(nil, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	session := &types.Session{Id: "s1", UserId: "u1", PlaygroundId: "pg"}
+	_s.On("UserGet", "u1").Return(&types.User{Id: "u1"}, nil)
+	_s.On("PlaygroundGet", "pg").Return(&types.Playground{Id: "pg", UserQuota: types.Quota{MaxInstances: 1}}, nil)
+	_s.On("SessionFindByUserId", "u1").Return([]*types.Session{session}, nil)
+	_s.On("InstanceFindBySessionId", "s1").Return([]*types.Instance{{Name: "i1"}}, nil)
+	_s.On("SnapshotFindByUserId", "u1").Return([]*types.Snapshot{}, nil)
+	_s.On("SessionLogFindByUserId", "u1").Return([]*types.SessionLog{}, nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	i, err := p.InstanceNew(session, types.InstanceConfig{})
+	assert.Nil(t, i)
+	var quotaErr *QuotaExceededError
+	assert.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, types.QuotaInstances, quotaErr.Quota)
+
+	_s.AssertExpectations(t)
+}
@@ -0,0 +1,101 @@
+package pwd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/asciicast"
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+func recordingPath(id string) string {
+	return filepath.Join(config.RecordingsDir, fmt.Sprintf("%s.cast", id))
+}
+
+// RecordingNew starts an asciicast recording of a terminal of the instance.
+// It returns a nil recording when the playground doesn't record terminals.
+func (p *pwd) RecordingNew(session *types.Session, instance *types.Instance, terminal string, cols, rows uint) (*types.Recording, *asciicast.Writer, error) {
+	defer observeAction("RecordingNew", time.Now())
+
+	playground, err := p.storage.PlaygroundGet(session.PlaygroundId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !playground.RecordTerminals {
+		return nil, nil, nil
+	}
+
+	recording := &types.Recording{
+		Id:           p.generator.NewId(),
+		SessionId:    session.Id,
+		UserId:       session.UserId,
+		PlaygroundId: session.PlaygroundId,
+		CourseId:     session.CourseId,
+		InstanceName: instance.Name,
+		Terminal:     terminal,
+		Hostname:     instance.Hostname,
+		CreatedAt:    time.Now(),
+	}
+
+	if err := os.MkdirAll(config.RecordingsDir, 0755); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Create(recordingPath(recording.Id))
+	if err != nil {
+		log.Printf("Error creating recording [%s]. Got: %v\n", recording.Id, err)
+		return nil, nil, err
+	}
+	cast, err := asciicast.NewWriter(f, cols, rows, instance.Hostname, recording.CreatedAt)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	if err := p.storage.RecordingPut(recording); err != nil {
+		cast.Close()
+		return nil, nil, err
+	}
+
+	return recording, cast, nil
+}
+
+func (p *pwd) RecordingEnd(recording *types.Recording) error {
+	defer observeAction("RecordingEnd", time.Now())
+
+	recording.EndedAt = time.Now()
+	return p.storage.RecordingPut(recording)
+}
+
+func (p *pwd) RecordingGet(id string) (*types.Recording, error) {
+	defer observeAction("RecordingGet", time.Now())
+
+	return p.storage.RecordingGet(id)
+}
+
+func (p *pwd) RecordingFindBySession(sessionId string) ([]*types.Recording, error) {
+	defer observeAction("RecordingFindBySession", time.Now())
+
+	return p.storage.RecordingFindBySessionId(sessionId)
+}
+
+// RecordingOpen returns the asciicast of the recording. Recordings that are
+// still in progress can be read up to the last recorded event.
+func (p *pwd) RecordingOpen(recording *types.Recording) (io.ReadCloser, error) {
+	defer observeAction("RecordingOpen", time.Now())
+
+	return os.Open(recordingPath(recording.Id))
+}
+
+func (p *pwd) RecordingDelete(recording *types.Recording) error {
+	defer observeAction("RecordingDelete", time.Now())
+
+	if err := os.Remove(recordingPath(recording.Id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return p.storage.RecordingDelete(recording.Id)
+}
@@ -0,0 +1,93 @@
+package pwd
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/id"
+	"github.com/play-with-docker/play-with-docker/provisioner"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRecordingNew(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	dir, err := ioutil.TempDir("", "recordings")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	config.RecordingsDir = dir
+
+	s := &types.Session{Id: "aaaabbbbcccc", UserId: "user1", PlaygroundId: "foobar"}
+	i := &types.Instance{Name: "aaaabbbb_node1", Hostname: "node1", SessionId: s.Id}
+
+	_s.On("PlaygroundGet", "foobar").Return(&types.Playground{Id: "foobar", RecordTerminals: true}, nil)
+	_s.On("RecordingPut", mock.AnythingOfType("*types.Recording")).Return(nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	recording, cast, err := p.RecordingNew(s, i, "aaaabbbb_node1#12345678", 80, 24)
+	assert.Nil(t, err)
+	assert.Equal(t, s.Id, recording.SessionId)
+	assert.Equal(t, "user1", recording.UserId)
+	assert.Equal(t, i.Name, recording.InstanceName)
+	assert.Equal(t, "aaaabbbb_node1#12345678", recording.Terminal)
+
+	assert.Nil(t, cast.Output([]byte("hello")))
+	assert.Nil(t, cast.Close())
+	assert.Nil(t, p.RecordingEnd(recording))
+	assert.False(t, recording.EndedAt.IsZero())
+
+	r, err := p.RecordingOpen(recording)
+	assert.Nil(t, err)
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"title":"node1"`)
+	assert.Contains(t, lines[1], `"o","hello"`)
+
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
+func TestRecordingNew_Disabled(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	s := &types.Session{Id: "aaaabbbbcccc", PlaygroundId: "foobar"}
+	i := &types.Instance{Name: "aaaabbbb_node1", Hostname: "node1", SessionId: s.Id}
+
+	_s.On("PlaygroundGet", "foobar").Return(&types.Playground{Id: "foobar"}, nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	recording, cast, err := p.RecordingNew(s, i, i.Name, 80, 24)
+	assert.Nil(t, err)
+	assert.Nil(t, recording)
+	assert.Nil(t, cast)
+
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
@@ -1,25 +1,43 @@
 package pwd
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"log"
 	"math"
+	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"golang.org/x/sync/errgroup"
 
+	"github.com/play-with-docker/play-with-docker/config"
 	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/engine"
 	"github.com/play-with-docker/play-with-docker/event"
 	"github.com/play-with-docker/play-with-docker/pwd/types"
 )
 
 var preparedSessions = map[string]bool{}
 
+var sessionInvalidResizePolicyError = errors.New("Resize policy must be smallest, largest or owner")
+
+var sessionClaimedError = errors.New("Session belongs to a different user")
+var notSessionCreatorError = errors.New("Only whoever created a session can claim it")
+
+func SessionInvalidResizePolicy(e error) bool {
+	return e == sessionInvalidResizePolicyError
+}
+
+func SessionClaimed(e error) bool {
+	return e == sessionClaimedError
+}
+
 type AccessDeniedError struct {
 	Err error
 }
@@ -62,18 +80,24 @@ func (p *pwd) SessionNew(ctx context.Context, config types.SessionConfig) (*type
 	defer observeAction("SessionNew", time.Now())
 
 	// Annonymous users should be also allowed to login
+	duration := config.Duration
 	if config.UserId != "" {
-		if _, err := p.UserGet(config.UserId); errors.Is(err, userBannedError) {
+		user, err := p.UserGet(config.UserId)
+		if errors.Is(err, userBannedError) {
 			return nil, &AccessDeniedError{err}
 		} else if err != nil {
 			return nil, err
 		}
+		defer p.quotaLocks.lock(user.Id)()
+		if duration, err = p.checkSessionQuota(user, config); err != nil {
+			return nil, err
+		}
 	}
 
 	s := &types.Session{}
 	s.Id = p.generator.NewId()
 	s.CreatedAt = time.Now()
-	s.ExpiresAt = s.CreatedAt.Add(config.Duration)
+	s.ExpiresAt = s.CreatedAt.Add(duration)
 	s.Ready = true
 	s.Stack = config.Stack
 	s.UserId = config.UserId
@@ -88,6 +112,14 @@ func (p *pwd) SessionNew(ctx context.Context, config types.SessionConfig) (*type
 	}
 	s.StackName = stackName
 	s.ImageName = config.ImageName
+	s.CourseId = config.CourseId
+	s.Exam = config.Exam
+	s.LineItem = config.LineItem
+	s.LTIPlatform = config.LTIPlatform
+	s.LTIUserId = config.LTIUserId
+	if s.UserId == "" && config.CreatorSecret != "" {
+		s.SetCreatorSecret(config.CreatorSecret)
+	}
 
 	log.Printf("NewSession id=[%s]\n", s.Id)
 	if err := p.sessionProvisioner.SessionNew(ctx, s); err != nil {
@@ -100,12 +132,96 @@ func (p *pwd) SessionNew(ctx context.Context, config types.SessionConfig) (*type
 		return nil, err
 	}
 
+	if s.UserId != "" {
+		p.sessionLogNew(s)
+	}
+
 	p.setGauges()
 	p.event.Emit(event.SESSION_NEW, s.Id)
 
 	return s, nil
 }
 
+// sessionLogNew adds the session to the history of its user.
+func (p *pwd) sessionLogNew(s *types.Session) {
+	sessionLog := &types.SessionLog{
+		Id:           s.Id,
+		UserId:       s.UserId,
+		PlaygroundId: s.PlaygroundId,
+		CourseId:     s.CourseId,
+		Exam:         s.Exam,
+		ImageName:    s.ImageName,
+		Stack:        s.Stack,
+		CreatedAt:    s.CreatedAt,
+	}
+	if err := p.storage.SessionLogPut(sessionLog); err != nil {
+		log.Printf("Could not log session [%s] of user [%s]. Got: %v\n", s.Id, s.UserId, err)
+	}
+}
+
+// SessionClaim gives an anonymous session to the user, along with its
+// instances and recordings, as if the user had started it. Sessions that
+// belong to somebody else can't be claimed, and anonymous ones only with the
+// secret they were created with.
+func (p *pwd) SessionClaim(s *types.Session, user *types.User, creatorSecret string) error {
+	defer observeAction("SessionClaim", time.Now())
+
+	if s.UserId == user.Id {
+		return nil
+	} else if s.UserId != "" {
+		return sessionClaimedError
+	}
+	if !s.CreatedWith(creatorSecret) {
+		return &AccessDeniedError{notSessionCreatorError}
+	}
+	if user.IsBanned {
+		return &AccessDeniedError{userBannedError}
+	}
+	defer p.quotaLocks.lock(user.Id)()
+	if err := p.checkClaimQuota(s, user); err != nil {
+		return err
+	}
+
+	s.UserId = user.Id
+	s.CreatorSecretHash = ""
+	if err := p.storage.SessionPut(s); err != nil {
+		return err
+	}
+	p.sessionLogNew(s)
+
+	recordings, err := p.storage.RecordingFindBySessionId(s.Id)
+	if err != nil {
+		return err
+	}
+	for _, r := range recordings {
+		r.UserId = user.Id
+		if err := p.storage.RecordingPut(r); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Session [%s] was claimed by user [%s]\n", s.Id, user.Id)
+	return nil
+}
+
+// SessionFindByCourse returns the sessions that were launched from the
+// course.
+func (p *pwd) SessionFindByCourse(courseId string) ([]*types.Session, error) {
+	defer observeAction("SessionFindByCourse", time.Now())
+
+	sessions, err := p.storage.SessionGetAll()
+	if err != nil {
+		return nil, err
+	}
+	found := []*types.Session{}
+	for _, s := range sessions {
+		if s.CourseId == courseId {
+			found = append(found, s)
+		}
+	}
+	return found, nil
+}
+
 func (p *pwd) SessionClose(s *types.Session) error {
 	defer observeAction("SessionClose", time.Now())
 
@@ -138,6 +254,19 @@ func (p *pwd) SessionClose(s *types.Session) error {
 		return err
 	}
 
+	if err := os.RemoveAll(filepath.Join(config.ExamSubmissionsDir, s.Id)); err != nil {
+		log.Printf("Could not remove exam submissions of session [%s]. Got: %v\n", s.Id, err)
+	}
+
+	if s.UserId != "" {
+		if sessionLog, err := p.storage.SessionLogGet(s.Id); err == nil {
+			sessionLog.ClosedAt = time.Now()
+			if err := p.storage.SessionLogPut(sessionLog); err != nil {
+				log.Printf("Could not log close of session [%s]. Got: %v\n", s.Id, err)
+			}
+		}
+	}
+
 	log.Printf("Cleaned up session [%s]\n", s.Id)
 	p.setGauges()
 	p.event.Emit(event.SESSION_END, s.Id)
@@ -145,37 +274,73 @@ func (p *pwd) SessionClose(s *types.Session) error {
 
 }
 
-func (p *pwd) SessionGetSmallestViewPort(sessionId string) types.ViewPort {
-	defer observeAction("SessionGetSmallestViewPort", time.Now())
+// SessionGetViewPort returns the size of the named terminal, negotiated
+// between the clients of the session according to its resize policy.
+func (p *pwd) SessionGetViewPort(sessionId, terminal string) types.ViewPort {
+	defer observeAction("SessionGetViewPort", time.Now())
 
-	clients, err := p.storage.ClientFindBySessionId(sessionId)
+	session, err := p.storage.SessionGet(sessionId)
 	if err != nil {
-		log.Printf("Error finding clients for session [%s]. Got: %v\n", sessionId, err)
+		log.Printf("Error finding session [%s]. Got: %v\n", sessionId, err)
 		return types.ViewPort{Rows: 24, Cols: 80}
 	}
-	if len(clients) == 0 {
-		log.Printf("Session [%s] doesn't have clients. Returning default viewport\n", sessionId)
+	clients, err := p.storage.ClientFindBySessionId(sessionId)
+	if err != nil {
+		log.Printf("Error finding clients for session [%s]. Got: %v\n", sessionId, err)
 		return types.ViewPort{Rows: 24, Cols: 80}
 	}
-	var minRows uint
-	var minCols uint
 
+	var viewPorts []types.ViewPort
 	for _, c := range clients {
-		if c.ViewPort.Rows > 0 && c.ViewPort.Cols > 0 {
-			minRows = uint(c.ViewPort.Rows)
-			minCols = uint(c.ViewPort.Cols)
-			break
+		if vp := c.ViewPortOf(terminal); vp.Rows > 0 && vp.Cols > 0 {
+			viewPorts = append(viewPorts, vp)
 		}
 	}
-
-	for _, c := range clients {
-		if c.ViewPort.Rows > 0 && c.ViewPort.Cols > 0 {
-			minRows = uint(math.Min(float64(minRows), float64(c.ViewPort.Rows)))
-			minCols = uint(math.Min(float64(minCols), float64(c.ViewPort.Cols)))
+	if session.ResizePolicy == types.ResizePolicyOwner && session.UserId != "" {
+		// Fall back to the other clients while the owner isn't watching
+		var owner []types.ViewPort
+		for _, c := range clients {
+			if vp := c.ViewPortOf(terminal); c.UserId == session.UserId && vp.Rows > 0 && vp.Cols > 0 {
+				owner = append(owner, vp)
+			}
+		}
+		if len(owner) > 0 {
+			viewPorts = owner
 		}
 	}
+	if len(viewPorts) == 0 {
+		log.Printf("Session [%s] doesn't have clients. Returning default viewport\n", sessionId)
+		return types.ViewPort{Rows: 24, Cols: 80}
+	}
+
+	pick := math.Min
+	if session.ResizePolicy == types.ResizePolicyLargest {
+		pick = math.Max
+	}
+	rows := viewPorts[0].Rows
+	cols := viewPorts[0].Cols
+	for _, vp := range viewPorts[1:] {
+		rows = uint(pick(float64(rows), float64(vp.Rows)))
+		cols = uint(pick(float64(cols), float64(vp.Cols)))
+	}
 
-	return types.ViewPort{Rows: minRows, Cols: minCols}
+	return types.ViewPort{Rows: rows, Cols: cols}
+}
+
+// SessionSetResizePolicy changes how the terminals of the session are sized
+// and resizes them accordingly.
+func (p *pwd) SessionSetResizePolicy(session *types.Session, policy string) error {
+	defer observeAction("SessionSetResizePolicy", time.Now())
+
+	if policy != types.ResizePolicySmallest && policy != types.ResizePolicyLargest && policy != types.ResizePolicyOwner {
+		return sessionInvalidResizePolicyError
+	}
+	session.ResizePolicy = policy
+	if err := p.storage.SessionPut(session); err != nil {
+		return err
+	}
+	p.notifyClientViewPort(session.Id)
+	return nil
 }
 
 func (p *pwd) SessionDeployStack(s *types.Session) error {
@@ -188,7 +353,7 @@ func (p *pwd) SessionDeployStack(s *types.Session) error {
 
 	s.Ready = false
 	p.event.Emit(event.SESSION_READY, s.Id, false)
-	i, err := p.InstanceNew(s, types.InstanceConfig{ImageName: s.ImageName, PlaygroundFQDN: s.Host, DindVolumeSize: "5G"})
+	i, err := p.InstanceNew(s, types.InstanceConfig{ImageName: s.ImageName, PlaygroundFQDN: s.Host, DindVolumeSize: config.DindVolumeSize})
 	if err != nil {
 		log.Printf("Error creating instance for stack [%s]: %s\n", s.Stack, err)
 		return err
@@ -207,13 +372,13 @@ func (p *pwd) SessionDeployStack(s *types.Session) error {
 
 	w := sessionBuilderWriter{sessionId: s.Id, event: p.event}
 
-	dockerClient, err := p.dockerFactory.GetForSession(s)
+	runtime, err := p.runtimes.GetForSession(s)
 	if err != nil {
 		log.Println(err)
 		return err
 	}
 
-	code, err := dockerClient.ExecAttach(i.Name, []string{"sh", "-c", cmd}, &w)
+	code, err := runtime.ExecAttach(i.Name, []string{"sh", "-c", cmd}, &w)
 	if err != nil {
 		log.Printf("Error executing stack [%s]: %s\n", s.Stack, err)
 		return err
@@ -277,14 +442,14 @@ func (p *pwd) SessionSetup(session *types.Session, sconf SessionSetupConf) error
 			}
 
 			if conf.IsSwarmManager || conf.IsSwarmWorker {
-				dockerClient, err := p.dockerFactory.GetForInstance(i)
+				runtime, err := p.runtimes.GetForSession(session)
 				if err != nil {
 					return err
 				}
 				if conf.IsSwarmManager {
 					c.L.Lock()
 					if firstSwarmManager == nil {
-						tkns, err := dockerClient.SwarmInit(i.IP)
+						tkns, err := swarmInit(runtime, i)
 						if err != nil {
 							log.Printf("Cannot initialize swarm on instance %s. Got: %v\n", i.Name, err)
 							return err
@@ -295,7 +460,7 @@ func (p *pwd) SessionSetup(session *types.Session, sconf SessionSetupConf) error
 						c.L.Unlock()
 					} else {
 						c.L.Unlock()
-						if err := dockerClient.SwarmJoin(fmt.Sprintf("%s:2377", firstSwarmManager.IP), tokens.Manager); err != nil {
+						if err := swarmJoin(runtime, i, fmt.Sprintf("%s:2377", firstSwarmManager.IP), tokens.Manager); err != nil {
 							log.Printf("Cannot join manager %s to swarm. Got: %v\n", i.Name, err)
 							return err
 						}
@@ -306,7 +471,7 @@ func (p *pwd) SessionSetup(session *types.Session, sconf SessionSetupConf) error
 						c.Wait()
 					}
 					c.L.Unlock()
-					err = dockerClient.SwarmJoin(fmt.Sprintf("%s:2377", firstSwarmManager.IP), tokens.Worker)
+					err = swarmJoin(runtime, i, fmt.Sprintf("%s:2377", firstSwarmManager.IP), tokens.Worker)
 					if err != nil {
 						log.Printf("Cannot join worker %s to swarm. Got: %v\n", i.Name, err)
 						return err
@@ -348,3 +513,36 @@ func (p *pwd) SessionSetup(session *types.Session, sconf SessionSetupConf) error
 
 	return nil
 }
+
+// swarmInit makes the instance the first manager of a new swarm and returns
+// the tokens the other instances join it with. The docker CLI of the instance
+// is used, so it doesn't matter what runtime runs the instance.
+func swarmInit(runtime engine.RuntimeApi, i *types.Instance) (*docker.SwarmTokens, error) {
+	cmd := fmt.Sprintf("docker swarm init --advertise-addr %s --listen-addr 0.0.0.0:2377 >/dev/null && docker swarm join-token -q manager && docker swarm join-token -q worker", i.IP)
+	out := &bytes.Buffer{}
+	code, err := runtime.ExecAttach(i.Name, []string{"sh", "-c", cmd}, out)
+	if err != nil {
+		return nil, err
+	}
+	if code != 0 {
+		return nil, fmt.Errorf("Swarm init returned %d on instance %s: %s", code, i.Name, out.String())
+	}
+	tokens := strings.Fields(out.String())
+	if len(tokens) != 2 {
+		return nil, fmt.Errorf("Unexpected join tokens from instance %s: %s", i.Name, out.String())
+	}
+	return &docker.SwarmTokens{Manager: tokens[0], Worker: tokens[1]}, nil
+}
+
+// swarmJoin joins the instance to the swarm managed from addr.
+func swarmJoin(runtime engine.RuntimeApi, i *types.Instance, addr, token string) error {
+	out := &bytes.Buffer{}
+	code, err := runtime.ExecAttach(i.Name, []string{"docker", "swarm", "join", "--token", token, "--listen-addr", "0.0.0.0:2377", "--advertise-addr", "eth0", addr}, out)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("Swarm join returned %d on instance %s: %s", code, i.Name, out.String())
+	}
+	return nil
+}
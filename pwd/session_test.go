@@ -60,8 +60,9 @@ func TestSessionNew(t *testing.T) {
 	assert.WithinDuration(t, s.CreatedAt, before, time.Since(before))
 	assert.WithinDuration(t, s.ExpiresAt, before.Add(time.Hour), time.Second)
 	assert.True(t, s.Ready)
+	assert.False(t, s.CreatedWith(""))
 
-	sConfig = types.SessionConfig{Playground: playground, UserId: "", Duration: time.Hour, Stack: "stackPath", StackName: "stackName", ImageName: "imageName"}
+	sConfig = types.SessionConfig{Playground: playground, UserId: "", Duration: time.Hour, Stack: "stackPath", StackName: "stackName", ImageName: "imageName", CreatorSecret: "secret"}
 	s, _ = p.SessionNew(context.Background(), sConfig)
 
 	assert.Equal(t, "stackPath", s.Stack)
@@ -70,6 +71,9 @@ func TestSessionNew(t *testing.T) {
 	assert.Equal(t, "localhost", s.Host)
 	assert.Equal(t, playground.Id, s.PlaygroundId)
 	assert.False(t, s.Ready)
+	assert.NotEqual(t, "secret", s.CreatorSecretHash)
+	assert.True(t, s.CreatedWith("secret"))
+	assert.False(t, s.CreatedWith("other"))
 
 	_d.AssertExpectations(t)
 	_f.AssertExpectations(t)
@@ -207,3 +211,48 @@ func TestSessionSetup(t *testing.T) {
 	_e.M.AssertExpectations(t)
 }
 */
+
+func TestSessionClaim(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_e := &event.Mock{}
+
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(nil, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	s := &types.Session{Id: "aaaabbbbcccc", PlaygroundId: "foobar", CreatedAt: time.Now()}
+	s.SetCreatorSecret("secret")
+	user := &types.User{Id: "u1"}
+	recording := &types.Recording{Id: "r1", SessionId: s.Id}
+
+	_s.On("PlaygroundGet", "foobar").Return(&types.Playground{Id: "foobar"}, nil)
+	_s.On("SessionPut", s).Return(nil)
+	_s.On("SessionLogPut", &types.SessionLog{Id: s.Id, UserId: "u1", PlaygroundId: "foobar", CreatedAt: s.CreatedAt}).Return(nil)
+	_s.On("RecordingFindBySessionId", s.Id).Return([]*types.Recording{recording}, nil)
+	_s.On("RecordingPut", recording).Return(nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	// Knowing the id of the session isn't enough
+	err := p.SessionClaim(s, user, "")
+	var accessDenied *AccessDeniedError
+	assert.True(t, errors.As(err, &accessDenied))
+	err = p.SessionClaim(s, user, "guess")
+	assert.True(t, errors.As(err, &accessDenied))
+	assert.Equal(t, "", s.UserId)
+
+	err = p.SessionClaim(s, user, "secret")
+	assert.Nil(t, err)
+	assert.Equal(t, "u1", s.UserId)
+	assert.Equal(t, "", s.CreatorSecretHash)
+	assert.Equal(t, "u1", recording.UserId)
+
+	// Claiming it again changes nothing
+	err = p.SessionClaim(s, user, "")
+	assert.Nil(t, err)
+
+	err = p.SessionClaim(s, &types.User{Id: "u2"}, "secret")
+	assert.True(t, SessionClaimed(err))
+
+	_s.AssertExpectations(t)
+}
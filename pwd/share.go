@@ -0,0 +1,88 @@
+package pwd
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/satori/go.uuid"
+)
+
+var shareInvalidRoleError = errors.New("Share role must be observer or collaborator")
+
+func ShareInvalidRole(e error) bool {
+	return e == shareInvalidRoleError
+}
+
+// ShareNew creates a link token that grants the given role in the session
+// for config.ShareTTL, or until the session expires if that is sooner.
+// Tokens are random so they can't be guessed from the session id.
+func (p *pwd) ShareNew(session *types.Session, role string) (*types.Share, error) {
+	defer observeAction("ShareNew", time.Now())
+
+	if role != types.ShareRoleObserver && role != types.ShareRoleCollaborator {
+		return nil, shareInvalidRoleError
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(config.ShareTTL)
+	if !session.ExpiresAt.IsZero() && session.ExpiresAt.Before(expiresAt) {
+		expiresAt = session.ExpiresAt
+	}
+	share := &types.Share{
+		Token:     uuid.NewV4().String(),
+		SessionId: session.Id,
+		Role:      role,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+	if err := p.storage.SharePut(share); err != nil {
+		return nil, err
+	}
+
+	return share, nil
+}
+
+// ShareGet returns the share of the token. Expired shares are removed and
+// reported as not found.
+func (p *pwd) ShareGet(token string) (*types.Share, error) {
+	defer observeAction("ShareGet", time.Now())
+
+	share, err := p.storage.ShareGet(token)
+	if err != nil {
+		return nil, err
+	}
+	if share.Expired() {
+		if err := p.storage.ShareDelete(share.Token); err != nil {
+			log.Printf("Error deleting expired share of session [%s]. Got: %v\n", share.SessionId, err)
+		}
+		return nil, storage.NotFoundError
+	}
+	return share, nil
+}
+
+// ShareFindBySession returns the shares of the session that haven't expired.
+func (p *pwd) ShareFindBySession(sessionId string) ([]*types.Share, error) {
+	defer observeAction("ShareFindBySession", time.Now())
+
+	shares, err := p.storage.ShareFindBySessionId(sessionId)
+	if err != nil {
+		return nil, err
+	}
+	valid := []*types.Share{}
+	for _, share := range shares {
+		if !share.Expired() {
+			valid = append(valid, share)
+		}
+	}
+	return valid, nil
+}
+
+func (p *pwd) ShareDelete(share *types.Share) error {
+	defer observeAction("ShareDelete", time.Now())
+
+	return p.storage.ShareDelete(share.Token)
+}
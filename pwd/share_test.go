@@ -0,0 +1,90 @@
+package pwd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/id"
+	"github.com/play-with-docker/play-with-docker/provisioner"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestShareNew(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	config.ShareTTL = time.Hour
+	s := &types.Session{Id: "aaaabbbbcccc", ExpiresAt: time.Now().Add(2 * time.Hour)}
+
+	_s.On("SharePut", mock.AnythingOfType("*types.Share")).Return(nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	observer, err := p.ShareNew(s, types.ShareRoleObserver)
+	assert.Nil(t, err)
+	assert.Equal(t, s.Id, observer.SessionId)
+	assert.True(t, observer.ReadOnly())
+	assert.NotEmpty(t, observer.Token)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), observer.ExpiresAt, time.Minute)
+
+	collaborator, err := p.ShareNew(s, types.ShareRoleCollaborator)
+	assert.Nil(t, err)
+	assert.False(t, collaborator.ReadOnly())
+	assert.NotEqual(t, observer.Token, collaborator.Token)
+
+	_, err = p.ShareNew(s, "admin")
+	assert.True(t, ShareInvalidRole(err))
+
+	// Shares never outlive their session
+	s.ExpiresAt = time.Now().Add(time.Minute)
+	short, err := p.ShareNew(s, types.ShareRoleObserver)
+	assert.Nil(t, err)
+	assert.Equal(t, s.ExpiresAt, short.ExpiresAt)
+
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
+func TestShareGet_Expired(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	valid := &types.Share{Token: "valid", SessionId: "aaaabbbbcccc", Role: types.ShareRoleObserver, ExpiresAt: time.Now().Add(time.Hour)}
+	expired := &types.Share{Token: "expired", SessionId: "aaaabbbbcccc", Role: types.ShareRoleObserver, ExpiresAt: time.Now().Add(-time.Minute)}
+
+	_s.On("ShareGet", "valid").Return(valid, nil)
+	_s.On("ShareGet", "expired").Return(expired, nil)
+	_s.On("ShareDelete", "expired").Return(nil)
+	_s.On("ShareFindBySessionId", "aaaabbbbcccc").Return([]*types.Share{valid, expired}, nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	share, err := p.ShareGet("valid")
+	assert.Nil(t, err)
+	assert.Equal(t, valid, share)
+
+	_, err = p.ShareGet("expired")
+	assert.Equal(t, storage.NotFoundError, err)
+
+	shares, err := p.ShareFindBySession("aaaabbbbcccc")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Share{valid}, shares)
+
+	_s.AssertExpectations(t)
+}
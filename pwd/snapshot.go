@@ -0,0 +1,150 @@
+package pwd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+)
+
+var snapshotAnonymousError = errors.New("Snapshots require a logged in user")
+var snapshotNotOwnedError = errors.New("Snapshot belongs to another user")
+var snapshotNotSupportedError = errors.New("Snapshots are not supported for this instance type")
+
+func SnapshotNotSupported(e error) bool {
+	return e == snapshotNotSupportedError
+}
+
+func (p *pwd) InstanceSnapshot(session *types.Session, instance *types.Instance) (*types.Snapshot, error) {
+	defer observeAction("InstanceSnapshot", time.Now())
+
+	if session.UserId == "" {
+		return nil, &AccessDeniedError{snapshotAnonymousError}
+	}
+	if instance.Type == "windows" {
+		return nil, snapshotNotSupportedError
+	}
+
+	defer p.quotaLocks.lock(session.UserId)()
+	sizeLeft, err := p.checkSnapshotQuota(session)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &types.Snapshot{
+		Id:           p.generator.NewId(),
+		UserId:       session.UserId,
+		SessionId:    session.Id,
+		InstanceName: instance.Name,
+		Hostname:     instance.Hostname,
+		Image:        instance.Image,
+		CreatedAt:    time.Now(),
+	}
+	snapshot.Ref = fmt.Sprintf("%s/%s:%s", config.SnapshotRepository, snapshot.UserId, snapshot.Id)
+
+	runtime, err := p.runtimes.GetForSession(session)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if err := runtime.ContainerCommit(instance.Name, snapshot.Ref); err != nil {
+		log.Printf("Error committing instance [%s] to [%s]. Got: %v\n", instance.Name, snapshot.Ref, err)
+		return nil, err
+	}
+	snapshot.Host = runtime.DaemonHost()
+
+	// The size is only known once the image exists, so snapshots that don't
+	// fit are removed right away
+	size, err := runtime.ImageSize(snapshot.Ref)
+	if err != nil {
+		runtime.ImageRemove(snapshot.Ref)
+		return nil, err
+	}
+	snapshot.Size = size
+	if sizeLeft >= 0 && size > sizeLeft {
+		if err := runtime.ImageRemove(snapshot.Ref); err != nil {
+			log.Printf("Error removing snapshot image [%s]. Got: %v\n", snapshot.Ref, err)
+		}
+		return nil, &QuotaExceededError{types.QuotaSnapshotSize}
+	}
+
+	if err := p.storage.SnapshotPut(snapshot); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// snapshotImage makes sure the image of the snapshot is on the host of the
+// session, copying it from the host it was committed on.
+func (p *pwd) snapshotImage(session *types.Session, snapshot *types.Snapshot) error {
+	runtime, err := p.runtimes.GetForSession(session)
+	if err != nil {
+		return err
+	}
+	host := runtime.DaemonHost()
+	if host == snapshot.Host {
+		return nil
+	}
+	if _, err := runtime.ImageSize(snapshot.Ref); err == nil {
+		return nil
+	}
+
+	source, err := p.runtimes.GetForHost(snapshot.Host)
+	if err != nil {
+		return err
+	}
+	image, err := source.ImageSave(snapshot.Ref)
+	if err != nil {
+		log.Printf("Error saving snapshot image [%s] on [%s]. Got: %v\n", snapshot.Ref, snapshot.Host, err)
+		return err
+	}
+	defer image.Close()
+	if err := runtime.ImageLoad(image); err != nil {
+		log.Printf("Error loading snapshot image [%s] on [%s]. Got: %v\n", snapshot.Ref, host, err)
+		return err
+	}
+
+	snapshot.Copies = append(snapshot.Copies, host)
+	return p.storage.SnapshotPut(snapshot)
+}
+
+func (p *pwd) SnapshotGet(id string) (*types.Snapshot, error) {
+	defer observeAction("SnapshotGet", time.Now())
+
+	return p.storage.SnapshotGet(id)
+}
+
+func (p *pwd) SnapshotFindByUser(userId string) ([]*types.Snapshot, error) {
+	defer observeAction("SnapshotFindByUser", time.Now())
+
+	return p.storage.SnapshotFindByUserId(userId)
+}
+
+func (p *pwd) SnapshotDelete(snapshot *types.Snapshot) error {
+	defer observeAction("SnapshotDelete", time.Now())
+
+	runtime, err := p.runtimes.GetForHost(snapshot.Host)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if err := runtime.ImageRemove(snapshot.Ref); err != nil {
+		log.Printf("Error removing snapshot image [%s]. Got: %v\n", snapshot.Ref, err)
+	}
+	for _, host := range snapshot.Copies {
+		runtime, err := p.runtimes.GetForHost(host)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if err := runtime.ImageRemove(snapshot.Ref); err != nil {
+			log.Printf("Error removing copy of snapshot image [%s] on [%s]. Got: %v\n", snapshot.Ref, host, err)
+		}
+	}
+
+	return p.storage.SnapshotDelete(snapshot.Id)
+}
@@ -0,0 +1,51 @@
+package types
+
+import "time"
+
+// Parts of the API a token can be used for.
+const (
+	TokenScopeSessions  = "sessions"
+	TokenScopeInstances = "instances"
+	TokenScopeExec      = "exec"
+	TokenScopeUploads   = "uploads"
+	TokenScopeExams     = "exams"
+)
+
+var tokenScopes = []string{TokenScopeSessions, TokenScopeInstances, TokenScopeExec, TokenScopeUploads, TokenScopeExams}
+
+func ValidTokenScope(scope string) bool {
+	for _, s := range tokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIToken lets scripts use the API as the user that created it. Only the
+// hash of its secret is kept, the secret itself is shown once when the token
+// is created.
+type APIToken struct {
+	Id         string    `json:"id" bson:"id"`
+	UserId     string    `json:"user_id" bson:"user_id"`
+	Name       string    `json:"name" bson:"name"`
+	Scopes     []string  `json:"scopes" bson:"scopes"`
+	Hash       string    `json:"hash,omitempty" bson:"hash"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at" bson:"last_used_at"`
+	// ExpiresAt is zero for tokens that don't expire.
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *APIToken) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && now.After(t.ExpiresAt)
+}
@@ -1,12 +1,25 @@
 package types
 
+// Client is a browser attached to a session. ViewPort is the size of its
+// terminals unless it reported a different size for a given terminal in
+// Terminals.
 type Client struct {
-	Id        string   `json:"id" bson:"id"`
-	SessionId string   `json:"session_id" bson:"session_id"`
-	ViewPort  ViewPort `json:"viewport"`
+	Id        string              `json:"id" bson:"id"`
+	SessionId string              `json:"session_id" bson:"session_id"`
+	UserId    string              `json:"user_id" bson:"user_id"`
+	ViewPort  ViewPort            `json:"viewport"`
+	Terminals map[string]ViewPort `json:"terminals,omitempty" bson:"terminals,omitempty"`
 }
 
 type ViewPort struct {
 	Rows uint `json:"rows"`
 	Cols uint `json:"cols"`
 }
+
+// ViewPortOf returns the size of the named terminal for the client.
+func (c *Client) ViewPortOf(terminal string) ViewPort {
+	if vp, found := c.Terminals[terminal]; found {
+		return vp
+	}
+	return c.ViewPort
+}
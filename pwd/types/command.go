@@ -0,0 +1,20 @@
+package types
+
+import "time"
+
+// Command is a command line typed into a terminal of an instance, kept for
+// auditing exams. Lines typed while the terminal didn't echo, like
+// passwords, are not kept. Commands are kept for as long as the user they
+// were typed by, and are removed along with the user.
+type Command struct {
+	Id           string    `json:"id" bson:"id"`
+	SessionId    string    `json:"session_id" bson:"session_id"`
+	UserId       string    `json:"user_id" bson:"user_id"`
+	PlaygroundId string    `json:"playground_id" bson:"playground_id"`
+	CourseId     string    `json:"course_id,omitempty" bson:"course_id"`
+	InstanceName string    `json:"instance_name" bson:"instance_name"`
+	Hostname     string    `json:"hostname" bson:"hostname"`
+	Terminal     string    `json:"terminal" bson:"terminal"`
+	Line         string    `json:"line" bson:"line"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,13 @@
+package types
+
+// Course is the context of a learning management system that sessions were
+// launched from. Courses are identified by the platform that issued the
+// launch and the id of the context in that platform.
+type Course struct {
+	Id           string `json:"id" bson:"id"`
+	PlaygroundId string `json:"playground_id" bson:"playground_id"`
+	Issuer       string `json:"issuer" bson:"issuer"`
+	ContextId    string `json:"context_id" bson:"context_id"`
+	Title        string `json:"title" bson:"title"`
+	Label        string `json:"label" bson:"label"`
+}
@@ -18,10 +18,21 @@ type Instance struct {
 	ProxyHost   string          `json:"proxy_host" bson:"proxy_host"`
 	SessionHost string          `json:"session_host" bson:"session_host"`
 	Type        string          `json:"type" bson:"type"`
+	Status      string          `json:"status" bson:"status"`
 	WindowsId   string          `json:"-" bson:"windows_id"`
+	Envs        []string        `json:"envs" bson:"envs"`
+	Networks    []string        `json:"networks" bson:"networks"`
 	ctx         context.Context `json:"-" bson:"-"`
 }
 
+// Instance statuses set by the health checks. Instances that haven't been
+// checked yet have an empty status.
+const (
+	InstanceStatusRunning   = "running"
+	InstanceStatusUnhealthy = "unhealthy"
+	InstanceStatusDead      = "dead"
+)
+
 type WindowsInstance struct {
 	Id        string `bson:"id"`
 	SessionId string `bson:"session_id"`
@@ -41,4 +52,11 @@ type InstanceConfig struct {
 	DindVolumeSize string
 	Envs           []string
 	Networks       []string
+	SnapshotId     string
+	Mounts         []Mount `json:"-"`
+}
+
+type Mount struct {
+	Source string
+	Target string
 }
@@ -0,0 +1,35 @@
+package types
+
+import "time"
+
+// LoginSession is a user logged in from a browser. The login cookie only
+// points to it, so logins can be ended from the server. Its id is replaced
+// from time to time, in case a cookie leaked.
+type LoginSession struct {
+	Id     string `json:"id" bson:"id"`
+	UserId string `json:"user_id" bson:"user_id"`
+	// ImpersonatedBy is the admin that logged in as the user, if any.
+	ImpersonatedBy string `json:"impersonated_by,omitempty" bson:"impersonated_by"`
+	UserAgent      string `json:"user_agent" bson:"user_agent"`
+	// CreatedAt is when the user logged in, and IssuedAt when this id of
+	// the login was handed out.
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	IssuedAt  time.Time `json:"issued_at" bson:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+	// ReplacedBy is the id that replaced this one. Replaced ids keep working
+	// for a little while, for requests that were already on their way.
+	ReplacedBy string `json:"replaced_by,omitempty" bson:"replaced_by"`
+	// CSRFToken has to come along with the requests of the login that
+	// change something. It stays the same when the id is replaced.
+	CSRFToken string `json:"csrf_token" bson:"csrf_token"`
+}
+
+func (l *LoginSession) Expired(now time.Time) bool {
+	return now.After(l.ExpiresAt)
+}
+
+// RotationDue tells whether the id was handed out longer than every ago and
+// hasn't been replaced yet.
+func (l *LoginSession) RotationDue(every time.Duration, now time.Time) bool {
+	return l.ReplacedBy == "" && now.Sub(l.IssuedAt) > every
+}
@@ -1,7 +1,10 @@
 package types
 
 import (
+	"net/url"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -71,23 +74,153 @@ func (e PlaygroundExtras) GetDuration(name string) (time.Duration, bool) {
 	}
 }
 
+const (
+	// InstanceRuntimeDinD runs instances as privileged containers that can
+	// host their own docker daemon.
+	InstanceRuntimeDinD = "dind"
+	// InstanceRuntimeContainer runs instances as plain unprivileged
+	// containers. Any other runtime value is used as the docker runtime of
+	// an unprivileged container (e.g. sysbox-runc or runsc).
+	InstanceRuntimeContainer = "container"
+)
+
 type Playground struct {
-	Id                          string           `json:"id" bson:"id"`
-	Domain                      string           `json:"domain" bson:"domain"`
-	DefaultDinDInstanceImage    string           `json:"default_dind_instance_image" bson:"default_dind_instance_image"`
-	AvailableDinDInstanceImages []string         `json:"available_dind_instance_images" bson:"available_dind_instance_images"`
-	AllowWindowsInstances       bool             `json:"allow_windows_instances" bson:"allow_windows_instances"`
-	DefaultSessionDuration      time.Duration    `json:"default_session_duration" bson:"default_session_duration"`
-	DindVolumeSize              string           `json:"dind_volume_size" bson:"dind_volume_size"`
-	Extras                      PlaygroundExtras `json:"extras" bson:"extras"`
-	AssetsDir                   string           `json:"assets_dir" bson:"assets_dir"`
-	Tasks                       []string         `json:"tasks" bson:"tasks"`
-	GithubClientID              string           `json:"github_client_id" bson:"github_client_id"`
-	GithubClientSecret          string           `json:"github_client_secret" bson:"github_client_secret"`
-	GoogleClientID              string           `json:"google_client_id" bson:"google_client_id"`
-	GoogleClientSecret          string           `json:"google_client_secert" bson:"google_client_secret"`
-	DockerClientID              string           `json:"docker_client_id" bson:"docker_client_id"`
-	DockerClientSecret          string           `json:"docker_client_secret" bson:"docker_client_secret"`
-	DockerHost                  string           `json:"docker_host" bson:"docker_host"`
-	MaxInstances                int              `json:"max_instances" bson:"max_instances"`
+	Id                          string            `json:"id" bson:"id"`
+	Domain                      string            `json:"domain" bson:"domain"`
+	DefaultDinDInstanceImage    string            `json:"default_dind_instance_image" bson:"default_dind_instance_image"`
+	AvailableDinDInstanceImages []string          `json:"available_dind_instance_images" bson:"available_dind_instance_images"`
+	AllowWindowsInstances       bool              `json:"allow_windows_instances" bson:"allow_windows_instances"`
+	DefaultSessionDuration      time.Duration     `json:"default_session_duration" bson:"default_session_duration"`
+	DindVolumeSize              string            `json:"dind_volume_size" bson:"dind_volume_size"`
+	Extras                      PlaygroundExtras  `json:"extras" bson:"extras"`
+	AssetsDir                   string            `json:"assets_dir" bson:"assets_dir"`
+	Tasks                       []string          `json:"tasks" bson:"tasks"`
+	GithubClientID              string            `json:"github_client_id" bson:"github_client_id"`
+	GithubClientSecret          string            `json:"github_client_secret" bson:"github_client_secret"`
+	GoogleClientID              string            `json:"google_client_id" bson:"google_client_id"`
+	GoogleClientSecret          string            `json:"google_client_secert" bson:"google_client_secret"`
+	DockerClientID              string            `json:"docker_client_id" bson:"docker_client_id"`
+	DockerClientSecret          string            `json:"docker_client_secret" bson:"docker_client_secret"`
+	DockerHost                  string            `json:"docker_host" bson:"docker_host"`
+	MaxInstances                int               `json:"max_instances" bson:"max_instances"`
+	UserVolumes                 bool              `json:"user_volumes" bson:"user_volumes"`
+	DefaultInstanceRuntime      string            `json:"default_instance_runtime" bson:"default_instance_runtime"`
+	InstanceRuntimes            map[string]string `json:"instance_runtimes" bson:"instance_runtimes"`
+	InstanceHealthCheck         []string          `json:"instance_health_check" bson:"instance_health_check"`
+	RecreateCrashedInstances    bool              `json:"recreate_crashed_instances" bson:"recreate_crashed_instances"`
+	RecordTerminals             bool              `json:"record_terminals" bson:"record_terminals"`
+	AuditCommands               bool              `json:"audit_commands" bson:"audit_commands"`
+	OIDCProviders               []OIDCProvider    `json:"oidc_providers" bson:"oidc_providers"`
+	LTIPlatforms                []LTIPlatform     `json:"lti_platforms" bson:"lti_platforms"`
+	UserQuota                   Quota             `json:"user_quota" bson:"user_quota"`
+	RoleQuotas                  map[string]Quota  `json:"role_quotas" bson:"role_quotas"`
+	// AllowedOrigins are the web origins, besides the playground domain,
+	// whose pages may call the playground with the cookies of the user. "https://*.example.com" allows any subdomain of
+	// example.com over https.
+	AllowedOrigins []string `json:"allowed_origins" bson:"allowed_origins"`
+}
+
+// proxyHostRegex matches the hosts the instances of users are reached
+// through, like ip10-0-0-1-<session>-80.direct.<domain>.
+var proxyHostRegex = regexp.MustCompile(`(^|\.)ip[0-9]{1,3}-[0-9]{1,3}-[0-9]{1,3}-[0-9]{1,3}-|(^|\.)direct\.`)
+
+// AllowsOrigin tells whether pages from the origin may call the playground
+// with the cookies of the user. Only the playground itself and the allowed
+// origins are, never the hosts of instances, which serve whatever users run
+// in them.
+func (p *Playground) AllowsOrigin(origin string) bool {
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	if proxyHostRegex.MatchString(u.Hostname()) {
+		return false
+	}
+	domain := strings.ToLower(p.Domain)
+	if u.Host == domain || u.Hostname() == domain {
+		return true
+	}
+
+	for _, allowed := range p.AllowedOrigins {
+		allowed = strings.ToLower(strings.TrimSuffix(allowed, "/"))
+		prefix := u.Scheme + "://*."
+		if strings.HasPrefix(allowed, prefix) {
+			if strings.HasSuffix(u.Host, "."+strings.TrimPrefix(allowed, prefix)) {
+				return true
+			}
+		} else if allowed == u.Scheme+"://"+u.Host {
+			return true
+		}
+	}
+	return false
+}
+
+// QuotaFor returns the quota of the user in the playground. Users get the
+// quota of their highest role in the course, or in the playground when
+// courseId is empty, and the user quota when their roles have none.
+func (p *Playground) QuotaFor(user *User, courseId string) Quota {
+	scope := RoleScope{PlaygroundId: p.Id, CourseId: courseId}
+	for _, role := range []string{RoleAdmin, RoleInstructor, RoleStudent} {
+		if q, found := p.RoleQuotas[role]; found && user.HasRole(role, scope) {
+			return q
+		}
+	}
+	return p.UserQuota
+}
+
+// OIDCProvider configures login with an OpenID Connect provider. The claims
+// of the user are read from the ID token, or from the user info endpoint of
+// the provider when the token doesn't carry them.
+type OIDCProvider struct {
+	// Name identifies the provider in the login URLs.
+	Name         string   `json:"name" bson:"name"`
+	Issuer       string   `json:"issuer" bson:"issuer"`
+	ClientID     string   `json:"client_id" bson:"client_id"`
+	ClientSecret string   `json:"client_secret" bson:"client_secret"`
+	Scopes       []string `json:"scopes" bson:"scopes"`
+	IdClaim      string   `json:"id_claim" bson:"id_claim"`
+	NameClaim    string   `json:"name_claim" bson:"name_claim"`
+	EmailClaim   string   `json:"email_claim" bson:"email_claim"`
+	AvatarClaim  string   `json:"avatar_claim" bson:"avatar_claim"`
+}
+
+// Claims returns the claims the id, name, email and avatar of users are read
+// from. Claims that aren't mapped default to the standard ones.
+func (p OIDCProvider) Claims() (id, name, email, avatar string) {
+	orDefault := func(claim, def string) string {
+		if claim == "" {
+			return def
+		}
+		return claim
+	}
+	return orDefault(p.IdClaim, "sub"), orDefault(p.NameClaim, "name"), orDefault(p.EmailClaim, "email"), orDefault(p.AvatarClaim, "picture")
+}
+
+// LTIPlatform registers the playground as an LTI 1.3 tool of a learning
+// management system. The URLs are the ones the platform hands out when the
+// tool is registered with it.
+type LTIPlatform struct {
+	// Name identifies the platform. Users launched from it log in with the
+	// lti:<name> provider.
+	Name     string `json:"name" bson:"name"`
+	Issuer   string `json:"issuer" bson:"issuer"`
+	ClientID string `json:"client_id" bson:"client_id"`
+	// DeploymentIds are the deployments launches are accepted from. Launches
+	// from any deployment are accepted when empty.
+	DeploymentIds []string `json:"deployment_ids" bson:"deployment_ids"`
+	AuthLoginURL  string   `json:"auth_login_url" bson:"auth_login_url"`
+	AuthTokenURL  string   `json:"auth_token_url" bson:"auth_token_url"`
+	KeySetURL     string   `json:"key_set_url" bson:"key_set_url"`
+}
+
+// InstanceRuntime returns the runtime that instances of the given image
+// should use in this playground.
+func (p *Playground) InstanceRuntime(image string) string {
+	if r, found := p.InstanceRuntimes[image]; found && r != "" {
+		return r
+	}
+	if p.DefaultInstanceRuntime != "" {
+		return p.DefaultInstanceRuntime
+	}
+	return InstanceRuntimeDinD
 }
@@ -117,3 +117,64 @@ func TestPlayground_Extras_GetDuration(t *testing.T) {
 	assert.True(t, found)
 	assert.Equal(t, time.Hour*3, v)
 }
+
+func TestPlayground_InstanceRuntime(t *testing.T) {
+	p := Playground{InstanceRuntimes: map[string]string{"gcc": InstanceRuntimeContainer}}
+
+	assert.Equal(t, InstanceRuntimeContainer, p.InstanceRuntime("gcc"))
+	assert.Equal(t, InstanceRuntimeDinD, p.InstanceRuntime("franela/dind"))
+
+	p.DefaultInstanceRuntime = "sysbox-runc"
+	assert.Equal(t, "sysbox-runc", p.InstanceRuntime("franela/dind"))
+}
+
+func TestPlayground_QuotaFor(t *testing.T) {
+	p := Playground{
+		Id:        "pg",
+		UserQuota: Quota{MaxSessions: 1},
+		RoleQuotas: map[string]Quota{
+			RoleStudent:    {MaxSessions: 2},
+			RoleInstructor: {MaxSessions: 5},
+		},
+	}
+
+	assert.Equal(t, 1, p.QuotaFor(&User{}, "").MaxSessions)
+
+	student := &User{Roles: []RoleGrant{{Role: RoleStudent, RoleScope: RoleScope{PlaygroundId: "pg", CourseId: "c1"}}}}
+	assert.Equal(t, 2, p.QuotaFor(student, "c1").MaxSessions)
+	assert.Equal(t, 1, p.QuotaFor(student, "c2").MaxSessions)
+
+	instructor := &User{Roles: []RoleGrant{{Role: RoleInstructor, RoleScope: RoleScope{PlaygroundId: "pg"}}}}
+	assert.Equal(t, 5, p.QuotaFor(instructor, "c1").MaxSessions)
+}
+
+func TestPlayground_AllowsOrigin(t *testing.T) {
+	p := Playground{
+		Domain:         "labs.example.com",
+		AllowedOrigins: []string{"https://course.example.org", "https://*.school.edu"},
+	}
+
+	assert.True(t, p.AllowsOrigin("https://labs.example.com"))
+	assert.True(t, p.AllowsOrigin("https://labs.example.com:443"))
+	assert.True(t, p.AllowsOrigin("https://course.example.org"))
+	assert.True(t, p.AllowsOrigin("https://cs101.school.edu"))
+
+	assert.False(t, p.AllowsOrigin("https://www.labs.example.com"))
+	assert.False(t, p.AllowsOrigin("http://ip10-0-0-1-abc-80.labs.example.com"))
+	assert.False(t, p.AllowsOrigin("http://ip10-0-0-1-abc-80.direct.labs.example.com"))
+	assert.False(t, p.AllowsOrigin("https://ip10-0-0-1-abc-80.direct.cs101.school.edu"))
+	assert.False(t, p.AllowsOrigin("https://app.direct.school.edu"))
+	assert.False(t, p.AllowsOrigin("https://evillabs.example.com"))
+	assert.False(t, p.AllowsOrigin("https://labs.example.com.evil.com"))
+	assert.False(t, p.AllowsOrigin("http://course.example.org"))
+	assert.False(t, p.AllowsOrigin("https://school.edu"))
+	assert.False(t, p.AllowsOrigin("https://evilschool.edu"))
+	assert.False(t, p.AllowsOrigin("null"))
+	assert.False(t, p.AllowsOrigin(""))
+}
+
+func TestNewAllowance(t *testing.T) {
+	assert.Equal(t, Allowance{Used: 3, Limit: 0, Remaining: -1}, NewAllowance(3, 0))
+	assert.Equal(t, Allowance{Used: 3, Limit: 5, Remaining: 2}, NewAllowance(3, 5))
+	assert.True(t, NewAllowance(7, 5).Exhausted())
+}
@@ -0,0 +1,69 @@
+package types
+
+import "time"
+
+// Names of the quotas users can run out of.
+const (
+	QuotaSessions     = "sessions"
+	QuotaInstances    = "instances"
+	QuotaSessionTime  = "session_time"
+	QuotaExamAttempts = "exam_attempts"
+	QuotaSnapshots    = "snapshots"
+	QuotaSnapshotSize = "snapshot_size"
+)
+
+// Quota limits what a user can use in a playground. Limits that are zero
+// don't apply.
+type Quota struct {
+	// MaxSessions is how many sessions a user can have open at once.
+	MaxSessions int `json:"max_sessions" bson:"max_sessions"`
+	// MaxInstances is how many instances a user can have across all their
+	// sessions.
+	MaxInstances int `json:"max_instances" bson:"max_instances"`
+	// DailySessionTime is how long a user's sessions can be open in total
+	// over the last day.
+	DailySessionTime time.Duration `json:"daily_session_time" bson:"daily_session_time"`
+	// MaxExamAttempts is how many sessions a user can start for each exam.
+	MaxExamAttempts int `json:"max_exam_attempts" bson:"max_exam_attempts"`
+	// MaxSnapshots is how many snapshots a user can keep.
+	MaxSnapshots int `json:"max_snapshots" bson:"max_snapshots"`
+	// MaxSnapshotSize is how many bytes the snapshots of a user can take
+	// up in total.
+	MaxSnapshotSize int64 `json:"max_snapshot_size" bson:"max_snapshot_size"`
+}
+
+// Allowance is how much of a quota has been used. Remaining is -1 when the
+// quota has no limit.
+type Allowance struct {
+	Used      int64 `json:"used"`
+	Limit     int64 `json:"limit"`
+	Remaining int64 `json:"remaining"`
+}
+
+func NewAllowance(used, limit int64) Allowance {
+	a := Allowance{Used: used, Limit: limit, Remaining: -1}
+	if limit > 0 {
+		a.Remaining = limit - used
+		if a.Remaining < 0 {
+			a.Remaining = 0
+		}
+	}
+	return a
+}
+
+// Exhausted tells whether nothing is left of the quota.
+func (a Allowance) Exhausted() bool {
+	return a.Remaining == 0
+}
+
+// Usage is what a user has used of their quota in a playground. Session time
+// is in nanoseconds, snapshot size in bytes, and exam attempts are counted
+// for each exam.
+type Usage struct {
+	Sessions     Allowance            `json:"sessions"`
+	Instances    Allowance            `json:"instances"`
+	SessionTime  Allowance            `json:"session_time"`
+	ExamAttempts map[string]Allowance `json:"exam_attempts"`
+	Snapshots    Allowance            `json:"snapshots"`
+	SnapshotSize Allowance            `json:"snapshot_size"`
+}
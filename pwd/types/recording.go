@@ -0,0 +1,19 @@
+package types
+
+import "time"
+
+// Recording is an asciicast of the terminal of an instance.
+type Recording struct {
+	Id           string    `json:"id" bson:"id"`
+	SessionId    string    `json:"session_id" bson:"session_id"`
+	UserId       string    `json:"user_id" bson:"user_id"`
+	PlaygroundId string    `json:"playground_id" bson:"playground_id"`
+	CourseId     string    `json:"course_id,omitempty" bson:"course_id"`
+	InstanceName string    `json:"instance_name" bson:"instance_name"`
+	Hostname     string    `json:"hostname" bson:"hostname"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+	EndedAt      time.Time `json:"ended_at" bson:"ended_at"`
+	// Terminal is the name of the terminal that was recorded, which is the
+	// name of the instance for its main terminal.
+	Terminal string `json:"terminal" bson:"terminal"`
+}
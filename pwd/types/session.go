@@ -1,9 +1,20 @@
 package types
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"time"
 )
 
+// How the size of a terminal is chosen when several clients watch it.
+// Sessions without a policy use the smallest size.
+const (
+	ResizePolicySmallest = "smallest"
+	ResizePolicyLargest  = "largest"
+	ResizePolicyOwner    = "owner"
+)
+
 type SessionConfig struct {
 	Playground *Playground
 	UserId     string
@@ -11,6 +22,15 @@ type SessionConfig struct {
 	Stack      string
 	StackName  string
 	ImageName  string
+	CourseId   string
+	Exam       string
+	LineItem   string
+	// LTIPlatform and LTIUserId are who scores of the exam are posted for.
+	LTIPlatform string
+	LTIUserId   string
+	// CreatorSecret proves who created a session that doesn't belong to
+	// any user.
+	CreatorSecret string
 }
 
 type Session struct {
@@ -25,4 +45,34 @@ type Session struct {
 	Host         string    `json:"host" bson:"host"`
 	UserId       string    `json:"user_id" bson:"user_id"`
 	PlaygroundId string    `json:"playground_id" bson:"playground_id"`
+	ResizePolicy string    `json:"resize_policy" bson:"resize_policy"`
+	// Sessions launched from a course can be tied to one of its exams,
+	// whose scores are posted to the line item of the launch, for the user
+	// of the platform that launched it.
+	CourseId    string `json:"course_id,omitempty" bson:"course_id"`
+	Exam        string `json:"exam,omitempty" bson:"exam"`
+	LineItem    string `json:"line_item,omitempty" bson:"line_item"`
+	LTIPlatform string `json:"lti_platform,omitempty" bson:"lti_platform"`
+	LTIUserId   string `json:"lti_user_id,omitempty" bson:"lti_user_id"`
+	// Sessions without a user only keep a hash of the secret handed to
+	// whoever created them, which is no use to the others that can see it.
+	CreatorSecretHash string `json:"creator_secret_hash,omitempty" bson:"creator_secret_hash"`
+}
+
+// SetCreatorSecret makes secret the proof of who created the session.
+func (s *Session) SetCreatorSecret(secret string) {
+	s.CreatorSecretHash = hashSecret(secret)
+}
+
+// CreatedWith tells whether secret is the one the session was created with.
+func (s *Session) CreatedWith(secret string) bool {
+	if s.CreatorSecretHash == "" || secret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(s.CreatorSecretHash)) == 1
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,17 @@
+package types
+
+import "time"
+
+// SessionLog is what is kept about a session of a user once it is gone, so
+// the sessions a user had can be looked back at.
+type SessionLog struct {
+	Id           string    `json:"id" bson:"id"`
+	UserId       string    `json:"user_id" bson:"user_id"`
+	PlaygroundId string    `json:"playground_id" bson:"playground_id"`
+	CourseId     string    `json:"course_id,omitempty" bson:"course_id"`
+	Exam         string    `json:"exam,omitempty" bson:"exam"`
+	ImageName    string    `json:"image_name" bson:"image_name"`
+	Stack        string    `json:"stack" bson:"stack"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+	ClosedAt     time.Time `json:"closed_at" bson:"closed_at"`
+}
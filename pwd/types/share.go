@@ -0,0 +1,29 @@
+package types
+
+import "time"
+
+const (
+	ShareRoleObserver     = "observer"
+	ShareRoleCollaborator = "collaborator"
+)
+
+// Share grants access to a session to whoever knows its token until it
+// expires. Observers can only watch the terminals, collaborators can also
+// type into them.
+type Share struct {
+	Token     string    `json:"token" bson:"token"`
+	SessionId string    `json:"session_id" bson:"session_id"`
+	Role      string    `json:"role" bson:"role"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+func (s *Share) ReadOnly() bool {
+	return s.Role != ShareRoleCollaborator
+}
+
+// Expired tells whether the share no longer grants access. Shares stored
+// without an expiry are expired.
+func (s *Share) Expired() bool {
+	return !time.Now().Before(s.ExpiresAt)
+}
@@ -0,0 +1,21 @@
+package types
+
+import "time"
+
+type Snapshot struct {
+	Id           string `json:"id" bson:"id"`
+	UserId       string `json:"user_id" bson:"user_id"`
+	SessionId    string `json:"session_id" bson:"session_id"`
+	InstanceName string `json:"instance_name" bson:"instance_name"`
+	Hostname     string `json:"hostname" bson:"hostname"`
+	Image        string `json:"image" bson:"image"`
+	Ref          string `json:"ref" bson:"ref"`
+	// Host is the daemon host the image was committed on.
+	Host string `json:"host" bson:"host"`
+	// Copies are the other daemon hosts the image was copied to, to restore
+	// it in sessions there.
+	Copies []string `json:"copies,omitempty" bson:"copies"`
+	// Size is the size of the image in bytes.
+	Size      int64     `json:"size" bson:"size"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
@@ -1,16 +1,89 @@
 package types
 
+// Roles users can be given. Each role can do everything the ones before it
+// can.
+const (
+	RoleStudent    = "student"
+	RoleInstructor = "instructor"
+	RoleAdmin      = "admin"
+)
+
+var roleRanks = map[string]int{RoleStudent: 1, RoleInstructor: 2, RoleAdmin: 3}
+
+// ValidRole tells whether role is one users can be given.
+func ValidRole(role string) bool {
+	_, found := roleRanks[role]
+	return found
+}
+
+// RoleScope is where a role applies. An empty playground id stands for every
+// playground, and an empty course id for every course of the playground.
+type RoleScope struct {
+	PlaygroundId string `json:"playground_id,omitempty" bson:"playground_id"`
+	CourseId     string `json:"course_id,omitempty" bson:"course_id"`
+}
+
+// Covers tells whether the scope includes the other one.
+func (s RoleScope) Covers(other RoleScope) bool {
+	if s.PlaygroundId == "" {
+		return true
+	}
+	return s.PlaygroundId == other.PlaygroundId && (s.CourseId == "" || s.CourseId == other.CourseId)
+}
+
+// RoleGrant gives a user a role in a scope.
+type RoleGrant struct {
+	Role string `json:"role" bson:"role"`
+	RoleScope
+}
+
 type User struct {
-	Id             string `json:"id" bson:"id"`
-	Name           string `json:"name" bson:"name"`
-	ProviderUserId string `json:"provider_user_id" bson:"provider_user_id"`
-	Avatar         string `json:"avatar" bson:"avatar"`
+	Id             string      `json:"id" bson:"id"`
+	Name           string      `json:"name" bson:"name"`
+	ProviderUserId string      `json:"provider_user_id" bson:"provider_user_id"`
+	Avatar         string      `json:"avatar" bson:"avatar"`
+	Provider       string      `json:"provider" bson:"provider"`
+	Email          string      `json:"email" bson:"email"`
+	EmailVerified  bool        `json:"email_verified" bson:"email_verified"`
+	IsBanned       bool        `json:"banned" bson:"banned"`
+	Roles          []RoleGrant `json:"roles" bson:"roles"`
+	// Identities are the accounts with other providers linked to the user,
+	// besides the one the user first logged in with.
+	Identities []Identity `json:"identities" bson:"identities"`
+}
+
+// Identity is an account of a user with a login provider.
+type Identity struct {
 	Provider       string `json:"provider" bson:"provider"`
+	ProviderUserId string `json:"provider_user_id" bson:"provider_user_id"`
 	Email          string `json:"email" bson:"email"`
-	IsBanned       bool   `json:"banned" bson:"banned"`
+}
+
+// AllIdentities returns the identity the user first logged in with followed
+// by the linked ones.
+func (u *User) AllIdentities() []Identity {
+	primary := Identity{Provider: u.Provider, ProviderUserId: u.ProviderUserId, Email: u.Email}
+	return append([]Identity{primary}, u.Identities...)
+}
+
+// HasRole tells whether the user was given role, or one that can do more,
+// in a scope that covers the given one.
+func (u *User) HasRole(role string, scope RoleScope) bool {
+	for _, g := range u.Roles {
+		if roleRanks[g.Role] >= roleRanks[role] && g.Covers(scope) {
+			return true
+		}
+	}
+	return false
 }
 
 type LoginRequest struct {
 	Id       string `json:"id" bson:"id"`
 	Provider string `json:"provider" bson:"provider"`
+	// LinkUserId is the logged in user the identity is linked to, when the
+	// login was started to link another provider.
+	LinkUserId string `json:"link_user_id" bson:"link_user_id"`
+	// Nonce is sent to OpenID Connect providers, which return it in the ID
+	// token so replayed tokens can be told apart.
+	Nonce string `json:"nonce" bson:"nonce"`
 }
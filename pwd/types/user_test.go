@@ -0,0 +1,35 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserHasRole(t *testing.T) {
+	course := RoleScope{PlaygroundId: "playground1", CourseId: "course1"}
+	otherCourse := RoleScope{PlaygroundId: "playground1", CourseId: "course2"}
+	otherPlayground := RoleScope{PlaygroundId: "playground2"}
+
+	u := &User{}
+	assert.False(t, u.HasRole(RoleStudent, course))
+
+	u = &User{Roles: []RoleGrant{{Role: RoleInstructor, RoleScope: course}}}
+	assert.True(t, u.HasRole(RoleInstructor, course))
+	assert.True(t, u.HasRole(RoleStudent, course))
+	assert.False(t, u.HasRole(RoleAdmin, course))
+	assert.False(t, u.HasRole(RoleInstructor, otherCourse))
+	assert.False(t, u.HasRole(RoleInstructor, RoleScope{PlaygroundId: "playground1"}))
+
+	u = &User{Roles: []RoleGrant{{Role: RoleAdmin, RoleScope: RoleScope{PlaygroundId: "playground1"}}}}
+	assert.True(t, u.HasRole(RoleInstructor, course))
+	assert.True(t, u.HasRole(RoleAdmin, otherCourse))
+	assert.False(t, u.HasRole(RoleAdmin, otherPlayground))
+	assert.False(t, u.HasRole(RoleAdmin, RoleScope{}))
+
+	u = &User{Roles: []RoleGrant{{Role: RoleAdmin}}}
+	assert.True(t, u.HasRole(RoleAdmin, RoleScope{}))
+	assert.True(t, u.HasRole(RoleAdmin, otherPlayground))
+
+	assert.False(t, (&User{Roles: []RoleGrant{{Role: "superuser"}}}).HasRole(RoleStudent, course))
+}
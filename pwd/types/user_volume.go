@@ -0,0 +1,13 @@
+package types
+
+import "time"
+
+type UserVolume struct {
+	Name   string `json:"name" bson:"name"`
+	UserId string `json:"user_id" bson:"user_id"`
+	Size   string `json:"size" bson:"size"`
+	// Host is the daemon host the volume was created on.
+	Host       string    `json:"host" bson:"host"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at" bson:"last_used_at"`
+}
@@ -2,15 +2,35 @@ package pwd
 
 import (
 	"errors"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/play-with-docker/play-with-docker/config"
 	"github.com/play-with-docker/play-with-docker/pwd/types"
 	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/satori/go.uuid"
 )
 
 var userBannedError = errors.New("User is banned")
+var roleInvalidError = errors.New("Role must be student, instructor or admin")
+var identityLinkedError = errors.New("Identity is linked to a different user")
+var lastIdentityError = errors.New("The last identity of a user can't be unlinked")
+
+func RoleInvalid(e error) bool {
+	return e == roleInvalidError
+}
+
+func IdentityLinked(e error) bool {
+	return e == identityLinkedError
+}
+
+func LastIdentity(e error) bool {
+	return e == lastIdentityError
+}
 
 func (p *pwd) UserNewLoginRequest(providerName string) (*types.LoginRequest, error) {
-	req := &types.LoginRequest{Id: p.generator.NewId(), Provider: providerName}
+	req := &types.LoginRequest{Id: p.generator.NewId(), Provider: providerName, Nonce: uuid.NewV4().String()}
 	if err := p.storage.LoginRequestPut(req); err != nil {
 		return nil, err
 	}
@@ -25,6 +45,20 @@ func (p *pwd) UserGetLoginRequest(id string) (*types.LoginRequest, error) {
 	}
 }
 
+// UserNewLinkRequest starts a login with the provider that links the
+// identity the user logs in with to the given user.
+func (p *pwd) UserNewLinkRequest(providerName string, user *types.User) (*types.LoginRequest, error) {
+	req := &types.LoginRequest{Id: p.generator.NewId(), Provider: providerName, LinkUserId: user.Id, Nonce: uuid.NewV4().String()}
+	if err := p.storage.LoginRequestPut(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// UserLogin returns the user with the identity of user, which has the
+// provider fields filled in. Identities nobody has are linked to the user
+// that started the login to link them, or with auto-linking to the only
+// user with the same verified email. Otherwise a new user is created.
 func (p *pwd) UserLogin(loginRequest *types.LoginRequest, user *types.User) (*types.User, error) {
 	if err := p.storage.LoginRequestDelete(loginRequest.Id); err != nil {
 		return nil, err
@@ -32,23 +66,291 @@ func (p *pwd) UserLogin(loginRequest *types.LoginRequest, user *types.User) (*ty
 	u, err := p.storage.UserFindByProvider(user.Provider, user.ProviderUserId)
 
 	if err != nil {
-		if storage.NotFound(err) {
+		if !storage.NotFound(err) {
+			return nil, err
+		}
+		u, err = p.userToLink(loginRequest, user)
+		if err != nil {
+			return nil, err
+		}
+		if u == nil {
 			user.Id = p.generator.NewId()
 			if err := p.storage.UserPut(user); err != nil {
 				return nil, err
 			}
 			return user, nil
 		}
-		return nil, err
+		if u.IsBanned {
+			return nil, &AccessDeniedError{userBannedError}
+		}
+		u.Identities = append(u.Identities, types.Identity{Provider: user.Provider, ProviderUserId: user.ProviderUserId, Email: user.Email})
+		if err := p.storage.UserPut(u); err != nil {
+			return nil, err
+		}
+		return u, nil
+	}
+	if loginRequest.LinkUserId != "" && loginRequest.LinkUserId != u.Id {
+		return nil, identityLinkedError
+	}
+	if u.IsBanned {
+		return nil, &AccessDeniedError{userBannedError}
 	}
 	return u, nil
 }
+
+// userToLink returns the user a new identity is linked to, or nil when it
+// belongs to a new user.
+func (p *pwd) userToLink(loginRequest *types.LoginRequest, user *types.User) (*types.User, error) {
+	if loginRequest.LinkUserId != "" {
+		return p.storage.UserGet(loginRequest.LinkUserId)
+	}
+	if !config.AutoLinkAccounts || !user.EmailVerified || user.Email == "" {
+		return nil, nil
+	}
+
+	users, err := p.storage.UserGetAll()
+	if err != nil {
+		return nil, err
+	}
+	var found *types.User
+	for _, u := range users {
+		if u.EmailVerified && strings.EqualFold(u.Email, user.Email) {
+			if found != nil {
+				// Nobody can tell which one the identity belongs to
+				return nil, nil
+			}
+			found = u
+		}
+	}
+	return found, nil
+}
+
+// UserUnlinkIdentity removes an identity from the user. When it is the one
+// the user first logged in with, the first linked one takes its place. The
+// last identity of a user can't be removed, since the user couldn't log in
+// anymore.
+func (p *pwd) UserUnlinkIdentity(user *types.User, provider, providerUserId string) error {
+	defer observeAction("UserUnlinkIdentity", time.Now())
+
+	if len(user.Identities) == 0 {
+		if user.Provider == provider && user.ProviderUserId == providerUserId {
+			return lastIdentityError
+		}
+		return storage.NotFoundError
+	}
+
+	if user.Provider == provider && user.ProviderUserId == providerUserId {
+		next := user.Identities[0]
+		user.Provider, user.ProviderUserId = next.Provider, next.ProviderUserId
+		user.Identities = user.Identities[1:]
+		return p.storage.UserPut(user)
+	}
+	for i, identity := range user.Identities {
+		if identity.Provider == provider && identity.ProviderUserId == providerUserId {
+			user.Identities = append(user.Identities[:i:i], user.Identities[i+1:]...)
+			return p.storage.UserPut(user)
+		}
+	}
+	return storage.NotFoundError
+}
+
 func (p *pwd) UserGet(id string) (*types.User, error) {
-	var user *types.User
-	if user, err := p.storage.UserGet(id); err != nil {
+	user, err := p.storage.UserGet(id)
+	if err != nil {
 		return nil, err
 	} else if user.IsBanned {
 		return user, userBannedError
 	}
 	return user, nil
 }
+
+// UserGrantRole gives the user a role. Roles in a course also apply to the
+// playground of the course only, which is taken from the course.
+func (p *pwd) UserGrantRole(user *types.User, grant types.RoleGrant) error {
+	defer observeAction("UserGrantRole", time.Now())
+
+	if !types.ValidRole(grant.Role) {
+		return roleInvalidError
+	}
+	if grant.CourseId != "" {
+		course, err := p.storage.CourseGet(grant.CourseId)
+		if err != nil {
+			return err
+		}
+		grant.PlaygroundId = course.PlaygroundId
+	}
+	for _, g := range user.Roles {
+		if g == grant {
+			return nil
+		}
+	}
+
+	user.Roles = append(user.Roles, grant)
+	return p.storage.UserPut(user)
+}
+
+func (p *pwd) UserRevokeRole(user *types.User, grant types.RoleGrant) error {
+	defer observeAction("UserRevokeRole", time.Now())
+
+	roles := []types.RoleGrant{}
+	for _, g := range user.Roles {
+		// Roles in a course are told apart by the course alone
+		same := g.Role == grant.Role && g.CourseId == grant.CourseId
+		if grant.CourseId == "" {
+			same = same && g.PlaygroundId == grant.PlaygroundId
+		}
+		if same {
+			continue
+		}
+		roles = append(roles, g)
+	}
+	if len(roles) == len(user.Roles) {
+		return nil
+	}
+
+	user.Roles = roles
+	return p.storage.UserPut(user)
+}
+
+// UserList returns the users whose id, name, email or provider id contain
+// query, ignoring case. All users are returned when query is empty.
+func (p *pwd) UserList(query string) ([]*types.User, error) {
+	defer observeAction("UserList", time.Now())
+
+	users, err := p.storage.UserGetAll()
+	if err != nil {
+		return nil, err
+	}
+	query = strings.ToLower(query)
+	found := []*types.User{}
+	for _, u := range users {
+		for _, field := range []string{u.Id, u.Name, u.Email, u.ProviderUserId} {
+			if strings.Contains(strings.ToLower(field), query) {
+				found = append(found, u)
+				break
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Id < found[j].Id })
+	return found, nil
+}
+
+// UserBan keeps the user from logging in and starting sessions, logs the
+// user out and closes the sessions the user has open.
+func (p *pwd) UserBan(user *types.User) error {
+	defer observeAction("UserBan", time.Now())
+
+	user.IsBanned = true
+	if err := p.storage.UserPut(user); err != nil {
+		return err
+	}
+	if err := p.LoginSessionRevokeUser(user.Id); err != nil {
+		return err
+	}
+	return p.userSessionsClose(user)
+}
+
+func (p *pwd) UserUnban(user *types.User) error {
+	defer observeAction("UserUnban", time.Now())
+
+	user.IsBanned = false
+	return p.storage.UserPut(user)
+}
+
+// UserDelete closes the sessions of the user and removes the user along
+// with the snapshots, recordings, commands, API tokens, workspace and
+// session history kept for them.
+func (p *pwd) UserDelete(user *types.User) error {
+	defer observeAction("UserDelete", time.Now())
+
+	if err := p.userSessionsClose(user); err != nil {
+		return err
+	}
+
+	snapshots, err := p.storage.SnapshotFindByUserId(user.Id)
+	if err != nil {
+		return err
+	}
+	for _, s := range snapshots {
+		if err := p.SnapshotDelete(s); err != nil {
+			return err
+		}
+	}
+
+	sessionLogs, err := p.storage.SessionLogFindByUserId(user.Id)
+	if err != nil {
+		return err
+	}
+	for _, l := range sessionLogs {
+		recordings, err := p.storage.RecordingFindBySessionId(l.Id)
+		if err != nil {
+			return err
+		}
+		for _, r := range recordings {
+			if err := p.RecordingDelete(r); err != nil {
+				return err
+			}
+		}
+		if err := p.storage.SessionLogDelete(l.Id); err != nil {
+			return err
+		}
+	}
+
+	commands, err := p.storage.CommandFindByUserId(user.Id)
+	if err != nil {
+		return err
+	}
+	for _, c := range commands {
+		if err := p.storage.CommandDelete(c.Id); err != nil {
+			return err
+		}
+	}
+
+	if err := p.LoginSessionRevokeUser(user.Id); err != nil {
+		return err
+	}
+
+	tokens, err := p.storage.APITokenFindByUserId(user.Id)
+	if err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		if err := p.storage.APITokenDelete(t.Id); err != nil {
+			return err
+		}
+	}
+
+	if volume, err := p.storage.UserVolumeGet(userVolumeName(user.Id)); err == nil {
+		if err := p.UserVolumeDelete(volume); err != nil {
+			return err
+		}
+	} else if !storage.NotFound(err) {
+		return err
+	}
+
+	return p.storage.UserDelete(user.Id)
+}
+
+// userSessionsClose closes the open sessions of the user.
+func (p *pwd) userSessionsClose(user *types.User) error {
+	sessions, err := p.storage.SessionGetAll()
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		if s.UserId != user.Id {
+			continue
+		}
+		if err := p.SessionClose(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SessionLogFindByUser returns the sessions the user had, open or closed.
+func (p *pwd) SessionLogFindByUser(userId string) ([]*types.SessionLog, error) {
+	defer observeAction("SessionLogFindByUser", time.Now())
+
+	return p.storage.SessionLogFindByUserId(userId)
+}
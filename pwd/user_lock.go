@@ -0,0 +1,44 @@
+package pwd
+
+import "sync"
+
+// userLocks serializes what each user does with their quota. Checking the
+// quota and then creating what it allows isn't atomic otherwise, so requests
+// made in parallel, say from several tabs, would all pass the check.
+type userLocks struct {
+	mx    sync.Mutex
+	locks map[string]*userLock
+}
+
+type userLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock takes the lock of the user and returns the function that releases
+// it. Locks are only kept while somebody holds or waits for them.
+func (l *userLocks) lock(userId string) func() {
+	l.mx.Lock()
+	if l.locks == nil {
+		l.locks = map[string]*userLock{}
+	}
+	ul, found := l.locks[userId]
+	if !found {
+		ul = &userLock{}
+		l.locks[userId] = ul
+	}
+	ul.refs++
+	l.mx.Unlock()
+
+	ul.Lock()
+	return func() {
+		ul.Unlock()
+
+		l.mx.Lock()
+		defer l.mx.Unlock()
+		ul.refs--
+		if ul.refs == 0 {
+			delete(l.locks, userId)
+		}
+	}
+}
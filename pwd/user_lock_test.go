@@ -0,0 +1,40 @@
+package pwd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserLocks(t *testing.T) {
+	var l userLocks
+
+	unlock := l.lock("u1")
+
+	// Other users aren't held up
+	l.lock("u2")()
+
+	locked := make(chan struct{})
+	go func() {
+		l.lock("u1")()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("Lock of the user was taken twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("Lock of the user was not released")
+	}
+
+	l.mx.Lock()
+	assert.Empty(t, l.locks)
+	l.mx.Unlock()
+}
@@ -0,0 +1,244 @@
+package pwd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/id"
+	"github.com/play-with-docker/play-with-docker/provisioner"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestUserGrantRole(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	u := &types.User{Id: "aaaabbbbcccc"}
+
+	_s.On("CourseGet", "course1").Return(&types.Course{Id: "course1", PlaygroundId: "playground1"}, nil)
+	_s.On("UserPut", u).Return(nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	err := p.UserGrantRole(u, types.RoleGrant{Role: "superuser"})
+	assert.True(t, RoleInvalid(err))
+
+	err = p.UserGrantRole(u, types.RoleGrant{Role: types.RoleInstructor, RoleScope: types.RoleScope{CourseId: "course1"}})
+	assert.Nil(t, err)
+	err = p.UserGrantRole(u, types.RoleGrant{Role: types.RoleInstructor, RoleScope: types.RoleScope{CourseId: "course1"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []types.RoleGrant{{Role: types.RoleInstructor, RoleScope: types.RoleScope{PlaygroundId: "playground1", CourseId: "course1"}}}, u.Roles)
+	assert.True(t, u.HasRole(types.RoleInstructor, types.RoleScope{PlaygroundId: "playground1", CourseId: "course1"}))
+
+	err = p.UserGrantRole(u, types.RoleGrant{Role: types.RoleAdmin})
+	assert.Nil(t, err)
+	assert.Len(t, u.Roles, 2)
+
+	err = p.UserRevokeRole(u, types.RoleGrant{Role: types.RoleInstructor, RoleScope: types.RoleScope{CourseId: "course1"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []types.RoleGrant{{Role: types.RoleAdmin}}, u.Roles)
+
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
+func TestUserBan(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	u := &types.User{Id: "aaaabbbbcccc", Provider: "github", ProviderUserId: "123"}
+
+	_s.On("UserPut", u).Return(nil)
+	_s.On("LoginSessionFindByUserId", u.Id).Return([]*types.LoginSession{{Id: "login1", UserId: u.Id}}, nil)
+	_s.On("LoginSessionDelete", "login1").Return(nil)
+	_s.On("SessionGetAll").Return([]*types.Session{{Id: "session1", UserId: "someone_else"}}, nil)
+	_s.On("UserFindByProvider", "github", "123").Return(u, nil)
+	_s.On("LoginRequestDelete", mock.AnythingOfType("string")).Return(nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	err := p.UserBan(u)
+	assert.Nil(t, err)
+	assert.True(t, u.IsBanned)
+
+	// Banned users can't log in again
+	_, err = p.UserLogin(&types.LoginRequest{Id: "request1"}, &types.User{Provider: "github", ProviderUserId: "123"})
+	var accessDenied *AccessDeniedError
+	assert.True(t, errors.As(err, &accessDenied))
+
+	err = p.UserUnban(u)
+	assert.Nil(t, err)
+	assert.False(t, u.IsBanned)
+
+	user, err := p.UserLogin(&types.LoginRequest{Id: "request2"}, &types.User{Provider: "github", ProviderUserId: "123"})
+	assert.Nil(t, err)
+	assert.Equal(t, u, user)
+
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
+func TestUserList(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	u1 := &types.User{Id: "user1", Name: "Ada Lovelace", Email: "ada@example.com"}
+	u2 := &types.User{Id: "user2", Name: "Alan Turing", Email: "alan@example.org"}
+
+	_s.On("UserGetAll").Return([]*types.User{u2, u1}, nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	users, err := p.UserList("")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.User{u1, u2}, users)
+
+	users, err = p.UserList("EXAMPLE.org")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.User{u2}, users)
+
+	users, err = p.UserList("lovelace")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.User{u1}, users)
+
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
+func TestUserLogin_Link(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	u := &types.User{Id: "u1", Provider: "github", ProviderUserId: "123"}
+	other := &types.User{Id: "u2", Provider: "docker", ProviderUserId: "789"}
+	req := &types.LoginRequest{Id: "r1", Provider: "google", LinkUserId: "u1"}
+
+	_s.On("LoginRequestDelete", "r1").Return(nil)
+	_s.On("UserFindByProvider", "google", "people/456").Return((*types.User)(nil), storage.NotFoundError)
+	_s.On("UserFindByProvider", "docker", "789").Return(other, nil)
+	_s.On("UserGet", "u1").Return(u, nil)
+	_s.On("UserPut", u).Return(nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	found, err := p.UserLogin(req, &types.User{Provider: "google", ProviderUserId: "people/456", Email: "jo@example.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, u, found)
+	assert.Equal(t, []types.Identity{{Provider: "google", ProviderUserId: "people/456", Email: "jo@example.com"}}, u.Identities)
+
+	_, err = p.UserLogin(req, &types.User{Provider: "docker", ProviderUserId: "789"})
+	assert.True(t, IdentityLinked(err))
+
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
+func TestUserLogin_AutoLink(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	config.AutoLinkAccounts = true
+	defer func() { config.AutoLinkAccounts = false }()
+
+	verified := &types.User{Id: "u1", Provider: "github", ProviderUserId: "123", Email: "Jo@example.com", EmailVerified: true}
+	unverified := &types.User{Id: "u2", Provider: "docker", ProviderUserId: "789", Email: "al@example.com"}
+
+	_s.On("LoginRequestDelete", mock.Anything).Return(nil)
+	_s.On("UserFindByProvider", "google", mock.Anything).Return((*types.User)(nil), storage.NotFoundError)
+	_s.On("UserGetAll").Return([]*types.User{verified, unverified}, nil)
+	_s.On("UserPut", mock.AnythingOfType("*types.User")).Return(nil)
+	_g.On("NewId").Return("u3")
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+	p.generator = _g
+
+	found, err := p.UserLogin(&types.LoginRequest{Id: "r1"}, &types.User{Provider: "google", ProviderUserId: "people/1", Email: "jo@example.com", EmailVerified: true})
+	assert.Nil(t, err)
+	assert.Equal(t, "u1", found.Id)
+	assert.Len(t, verified.Identities, 1)
+
+	// Emails that aren't verified on either side are never linked
+	found, err = p.UserLogin(&types.LoginRequest{Id: "r2"}, &types.User{Provider: "google", ProviderUserId: "people/2", Email: "jo@example.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, "u3", found.Id)
+	found, err = p.UserLogin(&types.LoginRequest{Id: "r3"}, &types.User{Provider: "google", ProviderUserId: "people/3", Email: "al@example.com", EmailVerified: true})
+	assert.Nil(t, err)
+	assert.Equal(t, "u3", found.Id)
+	assert.Empty(t, unverified.Identities)
+
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
+func TestUserUnlinkIdentity(t *testing.T) {
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	u := &types.User{Id: "u1", Provider: "github", ProviderUserId: "123"}
+	u.Identities = []types.Identity{{Provider: "google", ProviderUserId: "people/456"}, {Provider: "docker", ProviderUserId: "789"}}
+
+	_s.On("UserPut", u).Return(nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	err := p.UserUnlinkIdentity(u, "google", "people/456")
+	assert.Nil(t, err)
+	assert.Equal(t, []types.Identity{{Provider: "docker", ProviderUserId: "789"}}, u.Identities)
+
+	err = p.UserUnlinkIdentity(u, "google", "people/456")
+	assert.True(t, storage.NotFound(err))
+
+	err = p.UserUnlinkIdentity(u, "github", "123")
+	assert.Nil(t, err)
+	assert.Equal(t, "docker", u.Provider)
+	assert.Equal(t, "789", u.ProviderUserId)
+	assert.Empty(t, u.Identities)
+
+	err = p.UserUnlinkIdentity(u, "docker", "789")
+	assert.True(t, LastIdentity(err))
+
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
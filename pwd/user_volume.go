@@ -0,0 +1,126 @@
+package pwd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+)
+
+var userVolumeOnOtherHostError = errors.New("The workspace of the user is on another host than the session")
+
+func UserVolumeOnOtherHost(e error) bool {
+	return e == userVolumeOnOtherHostError
+}
+
+func userVolumeName(userId string) string {
+	return fmt.Sprintf("pwd-user-%s", userId)
+}
+
+// userVolumeMount makes sure the persistent workspace of the session's user
+// exists and returns the mount that should be added to new instances. It
+// returns nil when the playground doesn't use persistent workspaces.
+func (p *pwd) userVolumeMount(session *types.Session) (*types.Mount, error) {
+	playground, err := p.storage.PlaygroundGet(session.PlaygroundId)
+	if err != nil {
+		return nil, err
+	}
+	if !playground.UserVolumes {
+		return nil, nil
+	}
+
+	runtime, err := p.runtimes.GetForSession(session)
+	if err != nil {
+		return nil, err
+	}
+	name := userVolumeName(session.UserId)
+	volume, err := p.storage.UserVolumeGet(name)
+	if storage.NotFound(err) {
+		driverOpts := map[string]string{}
+		if config.UserVolumeSize != "" {
+			driverOpts["size"] = config.UserVolumeSize
+		}
+		labels := map[string]string{"io.pwd.user": session.UserId}
+		if err := runtime.VolumeCreate(name, config.UserVolumeDriver, driverOpts, labels); err != nil {
+			log.Printf("Error creating volume [%s]. Got: %v\n", name, err)
+			return nil, err
+		}
+		volume = &types.UserVolume{Name: name, UserId: session.UserId, Size: config.UserVolumeSize, Host: runtime.DaemonHost(), CreatedAt: time.Now()}
+	} else if err != nil {
+		return nil, err
+	} else if volume.Host != runtime.DaemonHost() {
+		// Mounting it by name would silently create an empty volume without
+		// the size limit on this host
+		log.Printf("Volume [%s] is on [%s], not on the host of session [%s]\n", name, volume.Host, session.Id)
+		return nil, userVolumeOnOtherHostError
+	}
+
+	volume.LastUsedAt = time.Now()
+	if err := p.storage.UserVolumePut(volume); err != nil {
+		return nil, err
+	}
+
+	return &types.Mount{Source: name, Target: config.UserVolumePath}, nil
+}
+
+func (p *pwd) UserVolumeList() ([]*types.UserVolume, error) {
+	defer observeAction("UserVolumeList", time.Now())
+
+	return p.storage.UserVolumeGetAll()
+}
+
+func (p *pwd) UserVolumeGet(name string) (*types.UserVolume, error) {
+	defer observeAction("UserVolumeGet", time.Now())
+
+	return p.storage.UserVolumeGet(name)
+}
+
+func (p *pwd) UserVolumeDelete(volume *types.UserVolume) error {
+	defer observeAction("UserVolumeDelete", time.Now())
+
+	runtime, err := p.runtimes.GetForHost(volume.Host)
+	if err != nil {
+		return err
+	}
+	if err := runtime.VolumeDelete(volume.Name); err != nil {
+		log.Printf("Error deleting volume [%s]. Got: %v\n", volume.Name, err)
+		return err
+	}
+
+	return p.storage.UserVolumeDelete(volume.Name)
+}
+
+// UserVolumePruneIdle deletes the workspaces of users that have no open
+// sessions and haven't created an instance for longer than the configured
+// expiry.
+func (p *pwd) UserVolumePruneIdle() error {
+	defer observeAction("UserVolumePruneIdle", time.Now())
+
+	volumes, err := p.storage.UserVolumeGetAll()
+	if err != nil {
+		return err
+	}
+	sessions, err := p.storage.SessionGetAll()
+	if err != nil {
+		return err
+	}
+	activeUsers := map[string]bool{}
+	for _, s := range sessions {
+		activeUsers[s.UserId] = true
+	}
+
+	for _, v := range volumes {
+		if activeUsers[v.UserId] || time.Since(v.LastUsedAt) < config.UserVolumeExpiry {
+			continue
+		}
+		log.Printf("Removing idle volume [%s] of user [%s]\n", v.Name, v.UserId)
+		if err := p.UserVolumeDelete(v); err != nil {
+			log.Printf("Could not remove idle volume [%s]. Got: %v\n", v.Name, err)
+		}
+	}
+	return nil
+}
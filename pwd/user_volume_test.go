@@ -0,0 +1,112 @@
+package pwd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/play-with-docker/play-with-docker/config"
+	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/id"
+	"github.com/play-with-docker/play-with-docker/provisioner"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestUserVolumeMount(t *testing.T) {
+	_d := &docker.Mock{}
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	config.UserVolumeDriver = "xfsvol"
+	config.UserVolumeSize = "1G"
+	config.UserVolumePath = "/root"
+
+	s := &types.Session{Id: "aaaabbbbcccc", UserId: "user1", PlaygroundId: "foobar"}
+
+	_s.On("PlaygroundGet", "foobar").Return(&types.Playground{Id: "foobar", UserVolumes: true}, nil)
+	_s.On("UserVolumeGet", "pwd-user-user1").Return(&types.UserVolume{}, storage.NotFoundError)
+	_s.On("UserVolumePut", mock.AnythingOfType("*types.UserVolume")).Return(nil)
+	_f.On("GetForSession", s).Return(_d, nil)
+	_d.On("VolumeCreate", "pwd-user-user1", "xfsvol", map[string]string{"size": "1G"}, map[string]string{"io.pwd.user": "user1"}).Return(nil)
+	_d.On("DaemonHost").Return("unix:///var/run/docker.sock")
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	m, err := p.userVolumeMount(s)
+	assert.Nil(t, err)
+	assert.Equal(t, &types.Mount{Source: "pwd-user-user1", Target: "/root"}, m)
+	volume := _s.Calls[len(_s.Calls)-1].Arguments.Get(0).(*types.UserVolume)
+	assert.Equal(t, "unix:///var/run/docker.sock", volume.Host)
+
+	_d.AssertExpectations(t)
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
+func TestUserVolumeMount_OtherHost(t *testing.T) {
+	_d := &docker.Mock{}
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	s := &types.Session{Id: "aaaabbbbcccc", UserId: "user1", PlaygroundId: "foobar"}
+
+	_s.On("PlaygroundGet", "foobar").Return(&types.Playground{Id: "foobar", UserVolumes: true}, nil)
+	_s.On("UserVolumeGet", "pwd-user-user1").Return(&types.UserVolume{Name: "pwd-user-user1", UserId: "user1", Host: "tcp://10.0.0.9:2375"}, nil)
+	_f.On("GetForSession", s).Return(_d, nil)
+	_d.On("DaemonHost").Return("unix:///var/run/docker.sock")
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	_, err := p.userVolumeMount(s)
+	assert.True(t, UserVolumeOnOtherHost(err))
+
+	_d.AssertExpectations(t)
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+}
+
+func TestUserVolumePruneIdle(t *testing.T) {
+	_d := &docker.Mock{}
+	_f := &docker.FactoryMock{}
+	_s := &storage.Mock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	config.UserVolumeExpiry = time.Hour
+
+	idle := &types.UserVolume{Name: "pwd-user-idle", UserId: "idle", Host: "unix:///var/run/docker.sock", LastUsedAt: time.Now().Add(-2 * time.Hour)}
+	recent := &types.UserVolume{Name: "pwd-user-recent", UserId: "recent", LastUsedAt: time.Now()}
+	active := &types.UserVolume{Name: "pwd-user-active", UserId: "active", LastUsedAt: time.Now().Add(-2 * time.Hour)}
+
+	_s.On("UserVolumeGetAll").Return([]*types.UserVolume{idle, recent, active}, nil)
+	_s.On("SessionGetAll").Return([]*types.Session{{Id: "aaaabbbbcccc", UserId: "active"}}, nil)
+	_s.On("UserVolumeDelete", "pwd-user-idle").Return(nil)
+	_f.On("GetForHost", "unix:///var/run/docker.sock").Return(_d, nil)
+	_d.On("VolumeDelete", "pwd-user-idle").Return(nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	err := p.UserVolumePruneIdle()
+	assert.Nil(t, err)
+
+	_d.AssertExpectations(t)
+	_f.AssertExpectations(t)
+	_s.AssertExpectations(t)
+	_g.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
@@ -45,11 +45,17 @@ type scheduler struct {
 	playgroundTasks    map[string][]Task
 	started            bool
 	ticker             *time.Ticker
+	volumesTicker      *time.Ticker
+	loginsTicker       *time.Ticker
 
 	storage storage.StorageApi
 	event   event.EventApi
 	pwd     pwd.PWDApi
 	mx      sync.Mutex
+
+	// scheduledMx guards the scheduled sessions and instances. Event handlers
+	// run concurrently with each other and with the processing goroutines.
+	scheduledMx sync.Mutex
 }
 
 func NewScheduler(tasks []Task, s storage.StorageApi, e event.EventApi, p pwd.PWDApi) (*scheduler, error) {
@@ -97,6 +103,28 @@ func (s *scheduler) schedulePlaygroundsUpdate() {
 	}()
 }
 
+func (s *scheduler) scheduleUserVolumesPrune() {
+	s.volumesTicker = time.NewTicker(time.Hour)
+	go func() {
+		for range s.volumesTicker.C {
+			if err := s.pwd.UserVolumePruneIdle(); err != nil {
+				log.Printf("Error pruning idle user volumes. Got: %v\n", err)
+			}
+		}
+	}()
+}
+
+func (s *scheduler) scheduleLoginSessionsPrune() {
+	s.loginsTicker = time.NewTicker(time.Hour)
+	go func() {
+		for range s.loginsTicker.C {
+			if err := s.pwd.LoginSessionPruneExpired(); err != nil {
+				log.Printf("Error pruning expired login sessions. Got: %v\n", err)
+			}
+		}
+	}()
+}
+
 func (s *scheduler) getMatchedTasks(playground *types.Playground) []Task {
 	matchedTasks := []Task{}
 	for _, expr := range playground.Tasks {
@@ -178,6 +206,9 @@ func (s *scheduler) addTask(task Task) error {
 }
 
 func (s *scheduler) unscheduleSession(session *types.Session) {
+	s.scheduledMx.Lock()
+	defer s.scheduledMx.Unlock()
+
 	ss, found := s.scheduledSessions[session.Id]
 	if !found {
 		return
@@ -188,6 +219,9 @@ func (s *scheduler) unscheduleSession(session *types.Session) {
 	log.Printf("Unscheduled session %s\n", session.Id)
 }
 func (s *scheduler) scheduleSession(session *types.Session) {
+	s.scheduledMx.Lock()
+	defer s.scheduledMx.Unlock()
+
 	if _, found := s.scheduledSessions[session.Id]; found {
 		log.Printf("Session %s is already scheduled. Ignoring.\n", session.Id)
 		return
@@ -200,6 +234,9 @@ func (s *scheduler) scheduleSession(session *types.Session) {
 	log.Printf("Scheduled session %s\n", session.Id)
 }
 func (s *scheduler) unscheduleInstance(instance *types.Instance) {
+	s.scheduledMx.Lock()
+	defer s.scheduledMx.Unlock()
+
 	si, found := s.scheduledInstances[instance.Name]
 	if !found {
 		return
@@ -210,6 +247,9 @@ func (s *scheduler) unscheduleInstance(instance *types.Instance) {
 	log.Printf("Unscheduled instance %s\n", instance.Name)
 }
 func (s *scheduler) scheduleInstance(instance *types.Instance, playgroundId string) {
+	s.scheduledMx.Lock()
+	defer s.scheduledMx.Unlock()
+
 	if _, found := s.scheduledInstances[instance.Name]; found {
 		log.Printf("Instance %s is already scheduled. Ignoring.\n", instance.Name)
 		return
@@ -225,11 +265,24 @@ func (s *scheduler) scheduleInstance(instance *types.Instance, playgroundId stri
 
 func (s *scheduler) Stop() {
 	s.ticker.Stop()
+	s.volumesTicker.Stop()
+	s.loginsTicker.Stop()
+	s.scheduledMx.Lock()
+	sessions := []*types.Session{}
 	for _, ss := range s.scheduledSessions {
-		s.unscheduleSession(ss.session)
+		sessions = append(sessions, ss.session)
 	}
+	instances := []*types.Instance{}
 	for _, si := range s.scheduledInstances {
-		s.unscheduleInstance(si.instance)
+		instances = append(instances, si.instance)
+	}
+	s.scheduledMx.Unlock()
+
+	for _, session := range sessions {
+		s.unscheduleSession(session)
+	}
+	for _, instance := range instances {
+		s.unscheduleInstance(instance)
 	}
 	s.started = false
 }
@@ -262,6 +315,10 @@ func (s *scheduler) Start() error {
 	// Refresh playground conf every 5 minutes
 	s.schedulePlaygroundsUpdate()
 
+	// Remove workspaces of users that have been idle for too long
+	s.scheduleUserVolumesPrune()
+	s.scheduleLoginSessionsPrune()
+
 	s.event.On(event.SESSION_NEW, func(sessionId string, args ...interface{}) {
 		s.mx.Lock()
 		defer s.mx.Unlock()
@@ -0,0 +1,111 @@
+package task
+
+import (
+	"context"
+	"log"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/play-with-docker/play-with-docker/engine"
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/pwd"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+)
+
+type InstanceHealth struct {
+	Instance string `json:"instance"`
+	Status   string `json:"status"`
+}
+
+// healthCheckInterval is how often each instance is checked. Probes exec
+// into the instance, so running them on every scheduler tick is too much.
+const healthCheckInterval = 10 * time.Second
+
+type checkInstanceHealth struct {
+	event      event.EventApi
+	factory    engine.FactoryApi
+	storage    storage.StorageApi
+	pwd        pwd.PWDApi
+	cache      *lru.Cache
+	lastChecks *lru.Cache
+}
+
+var CheckInstanceHealthEvent event.EventType
+
+func init() {
+	CheckInstanceHealthEvent = event.EventType("instance health")
+}
+
+func (t *checkInstanceHealth) Name() string {
+	return "CheckInstanceHealth"
+}
+
+func (t *checkInstanceHealth) Run(ctx context.Context, instance *types.Instance) error {
+	if instance.Type == "windows" {
+		return nil
+	}
+	if last, found := t.lastChecks.Get(instance.Name); found && time.Since(last.(time.Time)) < healthCheckInterval {
+		return nil
+	}
+	t.lastChecks.Add(instance.Name, time.Now())
+
+	var session *types.Session
+	if sess, found := t.cache.Get(instance.SessionId); !found {
+		s, err := t.storage.SessionGet(instance.SessionId)
+		if err != nil {
+			return err
+		}
+		t.cache.Add(s.Id, s)
+		session = s
+	} else {
+		session = sess.(*types.Session)
+	}
+	playground, err := t.storage.PlaygroundGet(session.PlaygroundId)
+	if err != nil {
+		return err
+	}
+	runtime, err := t.factory.GetForSession(session)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	status := types.InstanceStatusRunning
+	running, err := runtime.ContainerRunning(instance.Name)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if !running {
+		status = types.InstanceStatusDead
+	} else if len(playground.InstanceHealthCheck) > 0 {
+		if code, err := runtime.Exec(instance.Name, playground.InstanceHealthCheck); err != nil || code != 0 {
+			status = types.InstanceStatusUnhealthy
+		}
+	}
+
+	if status == instance.Status {
+		return nil
+	}
+	log.Printf("Instance %s is now %s\n", instance.Name, status)
+	instance.Status = status
+	if err := t.storage.InstancePut(instance); err != nil {
+		return err
+	}
+	t.event.Emit(CheckInstanceHealthEvent, instance.SessionId, InstanceHealth{Instance: instance.Name, Status: status})
+
+	if status == types.InstanceStatusDead && playground.RecreateCrashedInstances {
+		if _, err := t.pwd.InstanceRecreate(session, instance); err != nil {
+			log.Printf("Could not recreate instance %s. Got: %v\n", instance.Name, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func NewCheckInstanceHealth(e event.EventApi, f engine.FactoryApi, s storage.StorageApi, p pwd.PWDApi) *checkInstanceHealth {
+	c, _ := lru.New(5000)
+	l, _ := lru.New(5000)
+	return &checkInstanceHealth{event: e, factory: f, storage: s, pwd: p, cache: c, lastChecks: l}
+}
@@ -0,0 +1,112 @@
+package task
+
+import (
+	"context"
+	"testing"
+
+	"github.com/play-with-docker/play-with-docker/engine"
+	"github.com/play-with-docker/play-with-docker/event"
+	"github.com/play-with-docker/play-with-docker/pwd"
+	"github.com/play-with-docker/play-with-docker/pwd/types"
+	"github.com/play-with-docker/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCheckInstanceHealth_Name(t *testing.T) {
+	e := &event.Mock{}
+	s := &storage.Mock{}
+	p := &pwd.Mock{}
+
+	task := NewCheckInstanceHealth(e, engine.NewFake(), s, p)
+
+	assert.Equal(t, "CheckInstanceHealth", task.Name())
+	e.M.AssertExpectations(t)
+	s.AssertExpectations(t)
+	p.AssertExpectations(t)
+}
+
+func newHealthCheckSetup(t *testing.T, playground *types.Playground) (*engine.Fake, *types.Session, *types.Instance) {
+	rt := engine.NewFake()
+	session := &types.Session{Id: "aaaabbbbcccc", PlaygroundId: playground.Id}
+	assert.Nil(t, rt.NetworkCreate(session.Id))
+	assert.Nil(t, rt.ContainerCreate(engine.CreateContainerOpts{ContainerName: "aaaabbbb_node1", Networks: []string{session.Id}}))
+	i := &types.Instance{Name: "aaaabbbb_node1", Image: "franela/dind", Hostname: "node1", SessionId: session.Id}
+	return rt, session, i
+}
+
+func TestCheckInstanceHealth_Run(t *testing.T) {
+	e := &event.Mock{}
+	s := &storage.Mock{}
+	p := &pwd.Mock{}
+	playground := &types.Playground{Id: "foobar", InstanceHealthCheck: []string{"docker", "info"}}
+	rt, session, i := newHealthCheckSetup(t, playground)
+
+	s.On("SessionGet", session.Id).Return(session, nil)
+	s.On("PlaygroundGet", playground.Id).Return(playground, nil)
+	s.On("InstancePut", i).Return(nil)
+	e.M.On("Emit", CheckInstanceHealthEvent, session.Id, []interface{}{InstanceHealth{Instance: i.Name, Status: types.InstanceStatusRunning}}).Return()
+
+	task := NewCheckInstanceHealth(e, rt, s, p)
+	err := task.Run(context.Background(), i)
+	assert.Nil(t, err)
+	assert.Equal(t, types.InstanceStatusRunning, i.Status)
+	assert.Equal(t, [][]string{{"docker", "info"}}, rt.Container(i.Name).Execs)
+
+	// Checks are throttled, so running again right away doesn't probe
+	err = task.Run(context.Background(), i)
+	assert.Nil(t, err)
+	assert.Len(t, rt.Container(i.Name).Execs, 1)
+
+	e.M.AssertExpectations(t)
+	s.AssertExpectations(t)
+	p.AssertExpectations(t)
+}
+
+func TestCheckInstanceHealth_Unhealthy(t *testing.T) {
+	e := &event.Mock{}
+	s := &storage.Mock{}
+	p := &pwd.Mock{}
+	playground := &types.Playground{Id: "foobar", InstanceHealthCheck: []string{"docker", "info"}}
+	rt, session, i := newHealthCheckSetup(t, playground)
+	rt.ExecExitCode = 1
+
+	s.On("SessionGet", session.Id).Return(session, nil)
+	s.On("PlaygroundGet", playground.Id).Return(playground, nil)
+	s.On("InstancePut", i).Return(nil)
+	e.M.On("Emit", CheckInstanceHealthEvent, session.Id, []interface{}{InstanceHealth{Instance: i.Name, Status: types.InstanceStatusUnhealthy}}).Return()
+
+	task := NewCheckInstanceHealth(e, rt, s, p)
+	err := task.Run(context.Background(), i)
+	assert.Nil(t, err)
+	assert.Equal(t, types.InstanceStatusUnhealthy, i.Status)
+
+	e.M.AssertExpectations(t)
+	s.AssertExpectations(t)
+	p.AssertExpectations(t)
+}
+
+func TestCheckInstanceHealth_DeadIsRecreated(t *testing.T) {
+	e := &event.Mock{}
+	s := &storage.Mock{}
+	p := &pwd.Mock{}
+	playground := &types.Playground{Id: "foobar", RecreateCrashedInstances: true}
+	rt, session, i := newHealthCheckSetup(t, playground)
+	i.Status = types.InstanceStatusRunning
+	assert.Nil(t, rt.ContainerDelete(i.Name))
+
+	s.On("SessionGet", session.Id).Return(session, nil)
+	s.On("PlaygroundGet", playground.Id).Return(playground, nil)
+	s.On("InstancePut", i).Return(nil)
+	e.M.On("Emit", CheckInstanceHealthEvent, session.Id, []interface{}{InstanceHealth{Instance: i.Name, Status: types.InstanceStatusDead}}).Return()
+	p.On("InstanceRecreate", session, mock.AnythingOfType("*types.Instance")).Return(&types.Instance{Name: "aaaabbbb_node2"}, nil)
+
+	task := NewCheckInstanceHealth(e, rt, s, p)
+	err := task.Run(context.Background(), i)
+	assert.Nil(t, err)
+	assert.Equal(t, types.InstanceStatusDead, i.Status)
+
+	e.M.AssertExpectations(t)
+	s.AssertExpectations(t)
+	p.AssertExpectations(t)
+}
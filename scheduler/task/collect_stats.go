@@ -13,7 +13,7 @@ import (
 	dockerTypes "github.com/docker/docker/api/types"
 	units "github.com/docker/go-units"
 	lru "github.com/hashicorp/golang-lru"
-	"github.com/play-with-docker/play-with-docker/docker"
+	"github.com/play-with-docker/play-with-docker/engine"
 	"github.com/play-with-docker/play-with-docker/event"
 	"github.com/play-with-docker/play-with-docker/pwd/types"
 	"github.com/play-with-docker/play-with-docker/router"
@@ -28,7 +28,7 @@ type InstanceStats struct {
 
 type collectStats struct {
 	event   event.EventApi
-	factory docker.FactoryApi
+	factory engine.FactoryApi
 	cli     *http.Client
 	cache   *lru.Cache
 	storage storage.StorageApi
@@ -86,12 +86,12 @@ func (t *collectStats) Run(ctx context.Context, instance *types.Instance) error
 	} else {
 		session = sess.(*types.Session)
 	}
-	dockerClient, err := t.factory.GetForSession(session)
+	runtime, err := t.factory.GetForSession(session)
 	if err != nil {
 		log.Println(err)
 		return err
 	}
-	reader, err := dockerClient.ContainerStats(instance.Name)
+	reader, err := runtime.ContainerStats(instance.Name)
 	if err != nil {
 		log.Println("Error while trying to collect instance stats", err)
 		return err
@@ -134,7 +134,7 @@ func proxyHost(r *http.Request) (*url.URL, error) {
 	return u, nil
 }
 
-func NewCollectStats(e event.EventApi, f docker.FactoryApi, s storage.StorageApi) *collectStats {
+func NewCollectStats(e event.EventApi, f engine.FactoryApi, s storage.StorageApi) *collectStats {
 	transport := &http.Transport{
 		DialContext: (&net.Dialer{
 			Timeout:   1 * time.Second,
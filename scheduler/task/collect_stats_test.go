@@ -37,7 +37,7 @@ func TestCollectStats_Name(t *testing.T) {
 	f := &docker.FactoryMock{}
 	s := &storage.Mock{}
 
-	task := NewCollectStats(e, f, s)
+	task := NewCollectStats(e, docker.NewRuntimeFactory(f), s)
 
 	assert.Equal(t, "CollectStats", task.Name())
 	e.M.AssertExpectations(t)
@@ -68,7 +68,7 @@ func TestCollectStats_Run(t *testing.T) {
 	d.On("ContainerStats", i.Name).Return(nopCloser{bytes.NewReader(b)}, nil)
 	e.M.On("Emit", CollectStatsEvent, "aaaabbbbcccc", []interface{}{InstanceStats{Instance: i.Name, Mem: "0.00% (0B / 0B)", Cpu: "0.00%"}}).Return()
 
-	task := NewCollectStats(e, f, s)
+	task := NewCollectStats(e, docker.NewRuntimeFactory(f), s)
 	ctx := context.Background()
 
 	err := task.Run(ctx, i)
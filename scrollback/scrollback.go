@@ -0,0 +1,71 @@
+// Package scrollback keeps the recent output of a terminal so clients that
+// reconnect can catch up on what they missed.
+package scrollback
+
+import "sync"
+
+// Buffer keeps the last Size bytes written to it. Every byte gets a sequence
+// number, its offset in everything ever written to the buffer, so readers can
+// ask for the output that came after the last byte they have seen.
+type Buffer struct {
+	mx    sync.Mutex
+	size  int
+	data  []byte
+	start uint64
+}
+
+func New(size int) *Buffer {
+	return &Buffer{size: size, data: make([]byte, 0, size)}
+}
+
+// Write appends p to the buffer, discarding the oldest bytes when it is full.
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if len(p) >= b.size {
+		b.start += uint64(len(b.data) + len(p) - b.size)
+		b.data = append(b.data[:0], p[len(p)-b.size:]...)
+		return len(p), nil
+	}
+	if overflow := len(b.data) + len(p) - b.size; overflow > 0 {
+		n := copy(b.data, b.data[overflow:])
+		b.data = b.data[:n]
+		b.start += uint64(overflow)
+	}
+	b.data = append(b.data, p...)
+	return len(p), nil
+}
+
+// Start returns the sequence number of the oldest byte still in the buffer.
+func (b *Buffer) Start() uint64 {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	return b.start
+}
+
+// End returns the sequence number the next byte written will get.
+func (b *Buffer) End() uint64 {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	return b.start + uint64(len(b.data))
+}
+
+// Since returns a copy of the output from seq onwards and the sequence number
+// of its first byte. When seq has already been discarded, or is ahead of
+// anything written (the reader saw a previous buffer), everything still in
+// the buffer is returned.
+func (b *Buffer) Since(seq uint64) ([]byte, uint64) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	end := b.start + uint64(len(b.data))
+	if seq < b.start || seq > end {
+		seq = b.start
+	}
+	data := make([]byte, end-seq)
+	copy(data, b.data[seq-b.start:])
+	return data, seq
+}
@@ -0,0 +1,49 @@
+package scrollback
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuffer(t *testing.T) {
+	b := New(8)
+
+	b.Write([]byte("hello"))
+	assert.Equal(t, uint64(0), b.Start())
+	assert.Equal(t, uint64(5), b.End())
+
+	data, seq := b.Since(2)
+	assert.Equal(t, "llo", string(data))
+	assert.Equal(t, uint64(2), seq)
+
+	b.Write([]byte(" world"))
+	assert.Equal(t, uint64(3), b.Start())
+	assert.Equal(t, uint64(11), b.End())
+
+	data, seq = b.Since(5)
+	assert.Equal(t, " world", string(data))
+	assert.Equal(t, uint64(5), seq)
+
+	data, seq = b.Since(11)
+	assert.Empty(t, data)
+	assert.Equal(t, uint64(11), seq)
+}
+
+func TestBuffer_Discarded(t *testing.T) {
+	b := New(4)
+
+	b.Write([]byte("abcdefghij"))
+	assert.Equal(t, uint64(6), b.Start())
+	assert.Equal(t, uint64(10), b.End())
+
+	// Output that was discarded can't be replayed, so everything left is
+	data, seq := b.Since(1)
+	assert.Equal(t, "ghij", string(data))
+	assert.Equal(t, uint64(6), seq)
+
+	// A reader ahead of the buffer saw a previous one
+	data, seq = b.Since(42)
+	assert.Equal(t, "ghij", string(data))
+	assert.Equal(t, uint64(6), seq)
+}
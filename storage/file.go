@@ -23,11 +23,30 @@ type DB struct {
 	LoginRequests    map[string]*types.LoginRequest    `json:"login_requests"`
 	Users            map[string]*types.User            `json:"user"`
 	Playgrounds      map[string]*types.Playground      `json:"playgrounds"`
+	Snapshots        map[string]*types.Snapshot        `json:"snapshots"`
+	UserVolumes      map[string]*types.UserVolume      `json:"user_volumes"`
+	Recordings       map[string]*types.Recording       `json:"recordings"`
+	Shares           map[string]*types.Share           `json:"shares"`
+	Commands         map[string]*types.Command         `json:"commands"`
+	Courses          map[string]*types.Course          `json:"courses"`
+	SessionLogs      map[string]*types.SessionLog      `json:"session_logs"`
+	APITokens        map[string]*types.APIToken        `json:"api_tokens"`
+	LoginSessions    map[string]*types.LoginSession    `json:"login_sessions"`
 
 	WindowsInstancesBySessionId map[string][]string `json:"windows_instances_by_session_id"`
 	InstancesBySessionId        map[string][]string `json:"instances_by_session_id"`
+	SessionsByUserId            map[string][]string `json:"sessions_by_user_id"`
 	ClientsBySessionId          map[string][]string `json:"clients_by_session_id"`
 	UsersByProvider             map[string]string   `json:"users_by_providers"`
+	SnapshotsByUserId           map[string][]string `json:"snapshots_by_user_id"`
+	RecordingsBySessionId       map[string][]string `json:"recordings_by_session_id"`
+	SharesBySessionId           map[string][]string `json:"shares_by_session_id"`
+	CommandsBySessionId         map[string][]string `json:"commands_by_session_id"`
+	CommandsByUserId            map[string][]string `json:"commands_by_user_id"`
+	CoursesByContext            map[string]string   `json:"courses_by_context"`
+	SessionLogsByUserId         map[string][]string `json:"session_logs_by_user_id"`
+	APITokensByUserId           map[string][]string `json:"api_tokens_by_user_id"`
+	LoginSessionsByUserId       map[string][]string `json:"login_sessions_by_user_id"`
 }
 
 func (store *storage) SessionGet(id string) (*types.Session, error) {
@@ -61,18 +80,41 @@ func (store *storage) SessionPut(session *types.Session) error {
 	defer store.rw.Unlock()
 
 	store.db.Sessions[session.Id] = session
+	indexSessionUser(store.db.SessionsByUserId, session)
 
 	return store.save()
 }
 
+// indexSessionUser keeps the session in the index of the user it belongs to,
+// moving it there from the user it belonged to before if it was claimed.
+func indexSessionUser(index map[string][]string, session *types.Session) {
+	for _, id := range index[session.UserId] {
+		if id == session.Id {
+			return
+		}
+	}
+	for userId, ids := range index {
+		for _, id := range ids {
+			if id == session.Id {
+				removeFromIndex(index, userId, id)
+				break
+			}
+		}
+	}
+	if session.UserId != "" {
+		index[session.UserId] = append(index[session.UserId], session.Id)
+	}
+}
+
 func (store *storage) SessionDelete(id string) error {
 	store.rw.Lock()
 	defer store.rw.Unlock()
 
-	_, found := store.db.Sessions[id]
+	session, found := store.db.Sessions[id]
 	if !found {
 		return nil
 	}
+	removeFromIndex(store.db.SessionsByUserId, session.UserId, id)
 	for _, i := range store.db.WindowsInstancesBySessionId[id] {
 		delete(store.db.WindowsInstances, i)
 	}
@@ -85,11 +127,28 @@ func (store *storage) SessionDelete(id string) error {
 		delete(store.db.Clients, i)
 	}
 	store.db.ClientsBySessionId[id] = []string{}
+	for _, i := range store.db.SharesBySessionId[id] {
+		delete(store.db.Shares, i)
+	}
+	delete(store.db.SharesBySessionId, id)
 	delete(store.db.Sessions, id)
 
 	return store.save()
 }
 
+func (store *storage) SessionFindByUserId(userId string) ([]*types.Session, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	ids := store.db.SessionsByUserId[userId]
+	sessions := make([]*types.Session, len(ids))
+	for i, id := range ids {
+		sessions[i] = store.db.Sessions[id]
+	}
+
+	return sessions, nil
+}
+
 func (store *storage) SessionCount() (int, error) {
 	store.rw.Lock()
 	defer store.rw.Unlock()
@@ -349,7 +408,16 @@ func (store *storage) UserPut(user *types.User) error {
 	store.rw.Lock()
 	defer store.rw.Unlock()
 
-	store.db.UsersByProvider[fmt.Sprintf("%s_%s", user.Provider, user.ProviderUserId)] = user.Id
+	// Identities may have been unlinked since the user was last put, so the
+	// ones indexed for the user are all replaced
+	for key, userId := range store.db.UsersByProvider {
+		if userId == user.Id {
+			delete(store.db.UsersByProvider, key)
+		}
+	}
+	for _, identity := range user.AllIdentities() {
+		store.db.UsersByProvider[fmt.Sprintf("%s_%s", identity.Provider, identity.ProviderUserId)] = user.Id
+	}
 	store.db.Users[user.Id] = user
 
 	return store.save()
@@ -365,6 +433,34 @@ func (store *storage) UserGet(id string) (*types.User, error) {
 	}
 }
 
+func (store *storage) UserGetAll() ([]*types.User, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	users := make([]*types.User, 0, len(store.db.Users))
+	for _, u := range store.db.Users {
+		users = append(users, u)
+	}
+
+	return users, nil
+}
+
+func (store *storage) UserDelete(id string) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	user, found := store.db.Users[id]
+	if !found {
+		return nil
+	}
+	for _, identity := range user.AllIdentities() {
+		delete(store.db.UsersByProvider, fmt.Sprintf("%s_%s", identity.Provider, identity.ProviderUserId))
+	}
+	delete(store.db.Users, id)
+
+	return store.save()
+}
+
 func (store *storage) PlaygroundPut(playground *types.Playground) error {
 	store.rw.Lock()
 	defer store.rw.Unlock()
@@ -384,7 +480,76 @@ func (store *storage) PlaygroundGet(id string) (*types.Playground, error) {
 	return nil, NotFoundError
 }
 
+func (store *storage) CourseGet(id string) (*types.Course, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	if course, found := store.db.Courses[id]; !found {
+		return nil, NotFoundError
+	} else {
+		return course, nil
+	}
+}
+
+func (store *storage) CoursePut(course *types.Course) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	store.db.CoursesByContext[fmt.Sprintf("%s_%s", course.Issuer, course.ContextId)] = course.Id
+	store.db.Courses[course.Id] = course
+
+	return store.save()
+}
+
+func (store *storage) CourseFindByContext(issuer, contextId string) (*types.Course, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	if courseId, found := store.db.CoursesByContext[fmt.Sprintf("%s_%s", issuer, contextId)]; !found {
+		return nil, NotFoundError
+	} else if course, found := store.db.Courses[courseId]; !found {
+		return nil, NotFoundError
+	} else {
+		return course, nil
+	}
+}
+
 func (store *storage) load() error {
+	// Start from an empty database so collections that were added after the
+	// file was written are still initialized when decoding it.
+	store.db = &DB{
+		Sessions:                    map[string]*types.Session{},
+		Instances:                   map[string]*types.Instance{},
+		Clients:                     map[string]*types.Client{},
+		WindowsInstances:            map[string]*types.WindowsInstance{},
+		LoginRequests:               map[string]*types.LoginRequest{},
+		Users:                       map[string]*types.User{},
+		Playgrounds:                 map[string]*types.Playground{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		UserVolumes:                 map[string]*types.UserVolume{},
+		Recordings:                  map[string]*types.Recording{},
+		Shares:                      map[string]*types.Share{},
+		Commands:                    map[string]*types.Command{},
+		Courses:                     map[string]*types.Course{},
+		SessionLogs:                 map[string]*types.SessionLog{},
+		APITokens:                   map[string]*types.APIToken{},
+		LoginSessions:               map[string]*types.LoginSession{},
+		WindowsInstancesBySessionId: map[string][]string{},
+		InstancesBySessionId:        map[string][]string{},
+		SessionsByUserId:            map[string][]string{},
+		ClientsBySessionId:          map[string][]string{},
+		UsersByProvider:             map[string]string{},
+		SnapshotsByUserId:           map[string][]string{},
+		RecordingsBySessionId:       map[string][]string{},
+		SharesBySessionId:           map[string][]string{},
+		CommandsBySessionId:         map[string][]string{},
+		CommandsByUserId:            map[string][]string{},
+		CoursesByContext:            map[string]string{},
+		SessionLogsByUserId:         map[string][]string{},
+		APITokensByUserId:           map[string][]string{},
+		LoginSessionsByUserId:       map[string][]string{},
+	}
+
 	file, err := os.Open(store.path)
 
 	if err == nil {
@@ -394,19 +559,15 @@ func (store *storage) load() error {
 		if err != nil {
 			return err
 		}
-	} else {
-		store.db = &DB{
-			Sessions:                    map[string]*types.Session{},
-			Instances:                   map[string]*types.Instance{},
-			Clients:                     map[string]*types.Client{},
-			WindowsInstances:            map[string]*types.WindowsInstance{},
-			LoginRequests:               map[string]*types.LoginRequest{},
-			Users:                       map[string]*types.User{},
-			Playgrounds:                 map[string]*types.Playground{},
-			WindowsInstancesBySessionId: map[string][]string{},
-			InstancesBySessionId:        map[string][]string{},
-			ClientsBySessionId:          map[string][]string{},
-			UsersByProvider:             map[string]string{},
+	}
+
+	// Files written before sessions were indexed by user don't have the
+	// index yet
+	if len(store.db.SessionsByUserId) == 0 {
+		for _, session := range store.db.Sessions {
+			if session.UserId != "" {
+				store.db.SessionsByUserId[session.UserId] = append(store.db.SessionsByUserId[session.UserId], session.Id)
+			}
 		}
 	}
 
@@ -427,6 +588,252 @@ func (store *storage) PlaygroundGetAll() ([]*types.Playground, error) {
 	return playgrounds, nil
 }
 
+func (store *storage) SnapshotGet(id string) (*types.Snapshot, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	if snapshot, found := store.db.Snapshots[id]; !found {
+		return nil, NotFoundError
+	} else {
+		return snapshot, nil
+	}
+}
+
+func (store *storage) SnapshotPut(snapshot *types.Snapshot) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	store.db.Snapshots[snapshot.Id] = snapshot
+	found := false
+	for _, i := range store.db.SnapshotsByUserId[snapshot.UserId] {
+		if i == snapshot.Id {
+			found = true
+			break
+		}
+	}
+	if !found {
+		store.db.SnapshotsByUserId[snapshot.UserId] = append(store.db.SnapshotsByUserId[snapshot.UserId], snapshot.Id)
+	}
+
+	return store.save()
+}
+
+func (store *storage) SnapshotDelete(id string) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	snapshot, found := store.db.Snapshots[id]
+	if !found {
+		return nil
+	}
+
+	snapshots := store.db.SnapshotsByUserId[snapshot.UserId]
+	for n, i := range snapshots {
+		if i == id {
+			snapshots = append(snapshots[:n], snapshots[n+1:]...)
+			break
+		}
+	}
+	store.db.SnapshotsByUserId[snapshot.UserId] = snapshots
+	delete(store.db.Snapshots, id)
+
+	return store.save()
+}
+
+func (store *storage) SnapshotFindByUserId(userId string) ([]*types.Snapshot, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	snapshotIds := store.db.SnapshotsByUserId[userId]
+	snapshots := make([]*types.Snapshot, len(snapshotIds))
+	for i, id := range snapshotIds {
+		snapshots[i] = store.db.Snapshots[id]
+	}
+
+	return snapshots, nil
+}
+
+func (store *storage) UserVolumeGet(name string) (*types.UserVolume, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	if volume, found := store.db.UserVolumes[name]; !found {
+		return nil, NotFoundError
+	} else {
+		return volume, nil
+	}
+}
+
+func (store *storage) UserVolumePut(volume *types.UserVolume) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	store.db.UserVolumes[volume.Name] = volume
+
+	return store.save()
+}
+
+func (store *storage) UserVolumeDelete(name string) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	delete(store.db.UserVolumes, name)
+
+	return store.save()
+}
+
+func (store *storage) UserVolumeGetAll() ([]*types.UserVolume, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	volumes := make([]*types.UserVolume, len(store.db.UserVolumes))
+	i := 0
+	for _, v := range store.db.UserVolumes {
+		volumes[i] = v
+		i++
+	}
+
+	return volumes, nil
+}
+
+func (store *storage) RecordingGet(id string) (*types.Recording, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	if recording, found := store.db.Recordings[id]; !found {
+		return nil, NotFoundError
+	} else {
+		return recording, nil
+	}
+}
+
+func (store *storage) RecordingPut(recording *types.Recording) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	store.db.Recordings[recording.Id] = recording
+	found := false
+	for _, i := range store.db.RecordingsBySessionId[recording.SessionId] {
+		if i == recording.Id {
+			found = true
+			break
+		}
+	}
+	if !found {
+		store.db.RecordingsBySessionId[recording.SessionId] = append(store.db.RecordingsBySessionId[recording.SessionId], recording.Id)
+	}
+
+	return store.save()
+}
+
+func (store *storage) RecordingDelete(id string) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	recording, found := store.db.Recordings[id]
+	if !found {
+		return nil
+	}
+
+	recordings := store.db.RecordingsBySessionId[recording.SessionId]
+	for n, i := range recordings {
+		if i == id {
+			recordings = append(recordings[:n], recordings[n+1:]...)
+			break
+		}
+	}
+	if len(recordings) == 0 {
+		delete(store.db.RecordingsBySessionId, recording.SessionId)
+	} else {
+		store.db.RecordingsBySessionId[recording.SessionId] = recordings
+	}
+	delete(store.db.Recordings, id)
+
+	return store.save()
+}
+
+func (store *storage) RecordingFindBySessionId(sessionId string) ([]*types.Recording, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	recordingIds := store.db.RecordingsBySessionId[sessionId]
+	recordings := make([]*types.Recording, len(recordingIds))
+	for i, id := range recordingIds {
+		recordings[i] = store.db.Recordings[id]
+	}
+
+	return recordings, nil
+}
+
+func (store *storage) ShareGet(token string) (*types.Share, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	if share, found := store.db.Shares[token]; !found {
+		return nil, NotFoundError
+	} else {
+		return share, nil
+	}
+}
+
+func (store *storage) SharePut(share *types.Share) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	store.db.Shares[share.Token] = share
+	found := false
+	for _, i := range store.db.SharesBySessionId[share.SessionId] {
+		if i == share.Token {
+			found = true
+			break
+		}
+	}
+	if !found {
+		store.db.SharesBySessionId[share.SessionId] = append(store.db.SharesBySessionId[share.SessionId], share.Token)
+	}
+
+	return store.save()
+}
+
+func (store *storage) ShareDelete(token string) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	share, found := store.db.Shares[token]
+	if !found {
+		return nil
+	}
+
+	shares := store.db.SharesBySessionId[share.SessionId]
+	for n, i := range shares {
+		if i == token {
+			shares = append(shares[:n], shares[n+1:]...)
+			break
+		}
+	}
+	if len(shares) == 0 {
+		delete(store.db.SharesBySessionId, share.SessionId)
+	} else {
+		store.db.SharesBySessionId[share.SessionId] = shares
+	}
+	delete(store.db.Shares, token)
+
+	return store.save()
+}
+
+func (store *storage) ShareFindBySessionId(sessionId string) ([]*types.Share, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	tokens := store.db.SharesBySessionId[sessionId]
+	shares := make([]*types.Share, len(tokens))
+	for i, token := range tokens {
+		shares[i] = store.db.Shares[token]
+	}
+
+	return shares, nil
+}
+
 func (store *storage) save() error {
 	file, err := os.Create(store.path)
 	if err != nil {
@@ -448,3 +855,236 @@ func NewFileStorage(path string) (StorageApi, error) {
 
 	return s, nil
 }
+
+// CommandPut appends a command to the audit log. Commands are never changed
+// once logged.
+func (store *storage) CommandPut(command *types.Command) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	if _, found := store.db.Commands[command.Id]; !found {
+		store.db.CommandsBySessionId[command.SessionId] = append(store.db.CommandsBySessionId[command.SessionId], command.Id)
+		if command.UserId != "" {
+			store.db.CommandsByUserId[command.UserId] = append(store.db.CommandsByUserId[command.UserId], command.Id)
+		}
+	}
+	store.db.Commands[command.Id] = command
+
+	return store.save()
+}
+
+func (store *storage) CommandFindBySessionId(sessionId string) ([]*types.Command, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	return store.commands(store.db.CommandsBySessionId[sessionId]), nil
+}
+
+func (store *storage) CommandFindByUserId(userId string) ([]*types.Command, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	return store.commands(store.db.CommandsByUserId[userId]), nil
+}
+
+func (store *storage) CommandDelete(id string) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	command, found := store.db.Commands[id]
+	if !found {
+		return nil
+	}
+	removeFromIndex(store.db.CommandsBySessionId, command.SessionId, id)
+	removeFromIndex(store.db.CommandsByUserId, command.UserId, id)
+	delete(store.db.Commands, id)
+
+	return store.save()
+}
+
+func (store *storage) commands(ids []string) []*types.Command {
+	commands := make([]*types.Command, len(ids))
+	for i, id := range ids {
+		commands[i] = store.db.Commands[id]
+	}
+	return commands
+}
+
+func (store *storage) SessionLogGet(id string) (*types.SessionLog, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	if sessionLog, found := store.db.SessionLogs[id]; !found {
+		return nil, NotFoundError
+	} else {
+		return sessionLog, nil
+	}
+}
+
+func (store *storage) SessionLogPut(sessionLog *types.SessionLog) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	if _, found := store.db.SessionLogs[sessionLog.Id]; !found {
+		store.db.SessionLogsByUserId[sessionLog.UserId] = append(store.db.SessionLogsByUserId[sessionLog.UserId], sessionLog.Id)
+	}
+	store.db.SessionLogs[sessionLog.Id] = sessionLog
+
+	return store.save()
+}
+
+func (store *storage) SessionLogDelete(id string) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	sessionLog, found := store.db.SessionLogs[id]
+	if !found {
+		return nil
+	}
+	removeFromIndex(store.db.SessionLogsByUserId, sessionLog.UserId, id)
+	delete(store.db.SessionLogs, id)
+
+	return store.save()
+}
+
+func (store *storage) SessionLogFindByUserId(userId string) ([]*types.SessionLog, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	ids := store.db.SessionLogsByUserId[userId]
+	logs := make([]*types.SessionLog, len(ids))
+	for i, id := range ids {
+		logs[i] = store.db.SessionLogs[id]
+	}
+
+	return logs, nil
+}
+
+func (store *storage) APITokenGet(id string) (*types.APIToken, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	if token, found := store.db.APITokens[id]; !found {
+		return nil, NotFoundError
+	} else {
+		return token, nil
+	}
+}
+
+func (store *storage) APITokenPut(token *types.APIToken) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	if _, found := store.db.APITokens[token.Id]; !found {
+		store.db.APITokensByUserId[token.UserId] = append(store.db.APITokensByUserId[token.UserId], token.Id)
+	}
+	store.db.APITokens[token.Id] = token
+
+	return store.save()
+}
+
+func (store *storage) APITokenDelete(id string) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	token, found := store.db.APITokens[id]
+	if !found {
+		return nil
+	}
+	removeFromIndex(store.db.APITokensByUserId, token.UserId, id)
+	delete(store.db.APITokens, id)
+
+	return store.save()
+}
+
+func (store *storage) APITokenFindByUserId(userId string) ([]*types.APIToken, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	ids := store.db.APITokensByUserId[userId]
+	tokens := make([]*types.APIToken, len(ids))
+	for i, id := range ids {
+		tokens[i] = store.db.APITokens[id]
+	}
+
+	return tokens, nil
+}
+
+func (store *storage) LoginSessionGet(id string) (*types.LoginSession, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	if loginSession, found := store.db.LoginSessions[id]; !found {
+		return nil, NotFoundError
+	} else {
+		return loginSession, nil
+	}
+}
+
+func (store *storage) LoginSessionGetAll() ([]*types.LoginSession, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	loginSessions := make([]*types.LoginSession, 0, len(store.db.LoginSessions))
+	for _, l := range store.db.LoginSessions {
+		loginSessions = append(loginSessions, l)
+	}
+
+	return loginSessions, nil
+}
+
+func (store *storage) LoginSessionPut(loginSession *types.LoginSession) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	if _, found := store.db.LoginSessions[loginSession.Id]; !found {
+		store.db.LoginSessionsByUserId[loginSession.UserId] = append(store.db.LoginSessionsByUserId[loginSession.UserId], loginSession.Id)
+	}
+	store.db.LoginSessions[loginSession.Id] = loginSession
+
+	return store.save()
+}
+
+func (store *storage) LoginSessionDelete(id string) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	loginSession, found := store.db.LoginSessions[id]
+	if !found {
+		return nil
+	}
+	removeFromIndex(store.db.LoginSessionsByUserId, loginSession.UserId, id)
+	delete(store.db.LoginSessions, id)
+
+	return store.save()
+}
+
+func (store *storage) LoginSessionFindByUserId(userId string) ([]*types.LoginSession, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	ids := store.db.LoginSessionsByUserId[userId]
+	loginSessions := make([]*types.LoginSession, len(ids))
+	for i, id := range ids {
+		loginSessions[i] = store.db.LoginSessions[id]
+	}
+
+	return loginSessions, nil
+}
+
+// removeFromIndex removes id from the ids indexed under key, dropping the key
+// once no ids are left.
+func removeFromIndex(index map[string][]string, key, id string) {
+	ids := index[key]
+	for n, i := range ids {
+		if i == id {
+			ids = append(ids[:n], ids[n+1:]...)
+			break
+		}
+	}
+	if len(ids) == 0 {
+		delete(index, key)
+	} else {
+		index[key] = ids
+	}
+}
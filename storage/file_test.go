@@ -37,10 +37,29 @@ func TestSessionPut(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		UserVolumes:                 map[string]*types.UserVolume{},
+		Recordings:                  map[string]*types.Recording{},
+		Shares:                      map[string]*types.Share{},
+		Commands:                    map[string]*types.Command{},
+		Courses:                     map[string]*types.Course{},
+		SessionLogs:                 map[string]*types.SessionLog{},
+		APITokens:                   map[string]*types.APIToken{},
+		LoginSessions:               map[string]*types.LoginSession{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{},
+		SessionsByUserId:            map[string][]string{},
 		ClientsBySessionId:          map[string][]string{},
 		UsersByProvider:             map[string]string{},
+		SnapshotsByUserId:           map[string][]string{},
+		RecordingsBySessionId:       map[string][]string{},
+		SharesBySessionId:           map[string][]string{},
+		CommandsBySessionId:         map[string][]string{},
+		CommandsByUserId:            map[string][]string{},
+		CoursesByContext:            map[string]string{},
+		SessionLogsByUserId:         map[string][]string{},
+		APITokensByUserId:           map[string][]string{},
+		LoginSessionsByUserId:       map[string][]string{},
 	}
 	var loadedDB *DB
 
@@ -67,10 +86,29 @@ func TestSessionGet(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		UserVolumes:                 map[string]*types.UserVolume{},
+		Recordings:                  map[string]*types.Recording{},
+		Shares:                      map[string]*types.Share{},
+		Commands:                    map[string]*types.Command{},
+		Courses:                     map[string]*types.Course{},
+		SessionLogs:                 map[string]*types.SessionLog{},
+		APITokens:                   map[string]*types.APIToken{},
+		LoginSessions:               map[string]*types.LoginSession{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{},
+		SessionsByUserId:            map[string][]string{},
 		ClientsBySessionId:          map[string][]string{},
 		UsersByProvider:             map[string]string{},
+		SnapshotsByUserId:           map[string][]string{},
+		RecordingsBySessionId:       map[string][]string{},
+		SharesBySessionId:           map[string][]string{},
+		CommandsBySessionId:         map[string][]string{},
+		CommandsByUserId:            map[string][]string{},
+		CoursesByContext:            map[string]string{},
+		SessionLogsByUserId:         map[string][]string{},
+		APITokensByUserId:           map[string][]string{},
+		LoginSessionsByUserId:       map[string][]string{},
 	}
 
 	tmpfile, err := ioutil.TempFile("", "pwd")
@@ -107,10 +145,29 @@ func TestSessionGetAll(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		UserVolumes:                 map[string]*types.UserVolume{},
+		Recordings:                  map[string]*types.Recording{},
+		Shares:                      map[string]*types.Share{},
+		Commands:                    map[string]*types.Command{},
+		Courses:                     map[string]*types.Course{},
+		SessionLogs:                 map[string]*types.SessionLog{},
+		APITokens:                   map[string]*types.APIToken{},
+		LoginSessions:               map[string]*types.LoginSession{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{},
+		SessionsByUserId:            map[string][]string{},
 		ClientsBySessionId:          map[string][]string{},
 		UsersByProvider:             map[string]string{},
+		SnapshotsByUserId:           map[string][]string{},
+		RecordingsBySessionId:       map[string][]string{},
+		SharesBySessionId:           map[string][]string{},
+		CommandsBySessionId:         map[string][]string{},
+		CommandsByUserId:            map[string][]string{},
+		CoursesByContext:            map[string]string{},
+		SessionLogsByUserId:         map[string][]string{},
+		APITokensByUserId:           map[string][]string{},
+		LoginSessionsByUserId:       map[string][]string{},
 	}
 
 	tmpfile, err := ioutil.TempFile("", "pwd")
@@ -155,12 +212,18 @@ func TestSessionDelete(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, s1, found)
 
+	err = storage.SharePut(&types.Share{Token: "aaabbbccc", SessionId: s1.Id})
+	assert.Nil(t, err)
+
 	err = storage.SessionDelete(s1.Id)
 	assert.Nil(t, err)
 
 	found, err = storage.SessionGet(s1.Id)
 	assert.True(t, NotFound(err))
 	assert.Nil(t, found)
+
+	_, err = storage.ShareGet("aaabbbccc")
+	assert.True(t, NotFound(err))
 }
 
 func TestInstanceGet(t *testing.T) {
@@ -173,10 +236,29 @@ func TestInstanceGet(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		UserVolumes:                 map[string]*types.UserVolume{},
+		Recordings:                  map[string]*types.Recording{},
+		Shares:                      map[string]*types.Share{},
+		Commands:                    map[string]*types.Command{},
+		Courses:                     map[string]*types.Course{},
+		SessionLogs:                 map[string]*types.SessionLog{},
+		APITokens:                   map[string]*types.APIToken{},
+		LoginSessions:               map[string]*types.LoginSession{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{expectedInstance.SessionId: []string{expectedInstance.Name}},
+		SessionsByUserId:            map[string][]string{},
 		ClientsBySessionId:          map[string][]string{},
 		UsersByProvider:             map[string]string{},
+		SnapshotsByUserId:           map[string][]string{},
+		RecordingsBySessionId:       map[string][]string{},
+		SharesBySessionId:           map[string][]string{},
+		CommandsBySessionId:         map[string][]string{},
+		CommandsByUserId:            map[string][]string{},
+		CoursesByContext:            map[string]string{},
+		SessionLogsByUserId:         map[string][]string{},
+		APITokensByUserId:           map[string][]string{},
+		LoginSessionsByUserId:       map[string][]string{},
 	}
 
 	tmpfile, err := ioutil.TempFile("", "pwd")
@@ -228,10 +310,29 @@ func TestInstancePut(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		UserVolumes:                 map[string]*types.UserVolume{},
+		Recordings:                  map[string]*types.Recording{},
+		Shares:                      map[string]*types.Share{},
+		Commands:                    map[string]*types.Command{},
+		Courses:                     map[string]*types.Course{},
+		SessionLogs:                 map[string]*types.SessionLog{},
+		APITokens:                   map[string]*types.APIToken{},
+		LoginSessions:               map[string]*types.LoginSession{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{i.SessionId: []string{i.Name}},
+		SessionsByUserId:            map[string][]string{},
 		ClientsBySessionId:          map[string][]string{},
 		UsersByProvider:             map[string]string{},
+		SnapshotsByUserId:           map[string][]string{},
+		RecordingsBySessionId:       map[string][]string{},
+		SharesBySessionId:           map[string][]string{},
+		CommandsBySessionId:         map[string][]string{},
+		CommandsByUserId:            map[string][]string{},
+		CoursesByContext:            map[string]string{},
+		SessionLogsByUserId:         map[string][]string{},
+		APITokensByUserId:           map[string][]string{},
+		LoginSessionsByUserId:       map[string][]string{},
 	}
 	var loadedDB *DB
 
@@ -292,10 +393,29 @@ func TestInstanceFindBySessionId(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		UserVolumes:                 map[string]*types.UserVolume{},
+		Recordings:                  map[string]*types.Recording{},
+		Shares:                      map[string]*types.Share{},
+		Commands:                    map[string]*types.Command{},
+		Courses:                     map[string]*types.Course{},
+		SessionLogs:                 map[string]*types.SessionLog{},
+		APITokens:                   map[string]*types.APIToken{},
+		LoginSessions:               map[string]*types.LoginSession{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{i1.SessionId: []string{i1.Name, i2.Name}},
+		SessionsByUserId:            map[string][]string{},
 		ClientsBySessionId:          map[string][]string{},
 		UsersByProvider:             map[string]string{},
+		SnapshotsByUserId:           map[string][]string{},
+		RecordingsBySessionId:       map[string][]string{},
+		SharesBySessionId:           map[string][]string{},
+		CommandsBySessionId:         map[string][]string{},
+		CommandsByUserId:            map[string][]string{},
+		CoursesByContext:            map[string]string{},
+		SessionLogsByUserId:         map[string][]string{},
+		APITokensByUserId:           map[string][]string{},
+		LoginSessionsByUserId:       map[string][]string{},
 	}
 
 	tmpfile, err := ioutil.TempFile("", "pwd")
@@ -329,10 +449,29 @@ func TestWindowsInstanceGetAll(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		UserVolumes:                 map[string]*types.UserVolume{},
+		Recordings:                  map[string]*types.Recording{},
+		Shares:                      map[string]*types.Share{},
+		Commands:                    map[string]*types.Command{},
+		Courses:                     map[string]*types.Course{},
+		SessionLogs:                 map[string]*types.SessionLog{},
+		APITokens:                   map[string]*types.APIToken{},
+		LoginSessions:               map[string]*types.LoginSession{},
 		WindowsInstancesBySessionId: map[string][]string{i1.SessionId: []string{i1.Id, i2.Id}},
 		InstancesBySessionId:        map[string][]string{},
+		SessionsByUserId:            map[string][]string{},
 		ClientsBySessionId:          map[string][]string{},
 		UsersByProvider:             map[string]string{},
+		SnapshotsByUserId:           map[string][]string{},
+		RecordingsBySessionId:       map[string][]string{},
+		SharesBySessionId:           map[string][]string{},
+		CommandsBySessionId:         map[string][]string{},
+		CommandsByUserId:            map[string][]string{},
+		CoursesByContext:            map[string]string{},
+		SessionLogsByUserId:         map[string][]string{},
+		APITokensByUserId:           map[string][]string{},
+		LoginSessionsByUserId:       map[string][]string{},
 	}
 
 	tmpfile, err := ioutil.TempFile("", "pwd")
@@ -385,10 +524,29 @@ func TestWindowsInstancePut(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		UserVolumes:                 map[string]*types.UserVolume{},
+		Recordings:                  map[string]*types.Recording{},
+		Shares:                      map[string]*types.Share{},
+		Commands:                    map[string]*types.Command{},
+		Courses:                     map[string]*types.Course{},
+		SessionLogs:                 map[string]*types.SessionLog{},
+		APITokens:                   map[string]*types.APIToken{},
+		LoginSessions:               map[string]*types.LoginSession{},
 		WindowsInstancesBySessionId: map[string][]string{i.SessionId: []string{i.Id}},
 		InstancesBySessionId:        map[string][]string{},
+		SessionsByUserId:            map[string][]string{},
 		ClientsBySessionId:          map[string][]string{},
 		UsersByProvider:             map[string]string{},
+		SnapshotsByUserId:           map[string][]string{},
+		RecordingsBySessionId:       map[string][]string{},
+		SharesBySessionId:           map[string][]string{},
+		CommandsBySessionId:         map[string][]string{},
+		CommandsByUserId:            map[string][]string{},
+		CoursesByContext:            map[string]string{},
+		SessionLogsByUserId:         map[string][]string{},
+		APITokensByUserId:           map[string][]string{},
+		LoginSessionsByUserId:       map[string][]string{},
 	}
 	var loadedDB *DB
 
@@ -448,10 +606,29 @@ func TestClientGet(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		UserVolumes:                 map[string]*types.UserVolume{},
+		Recordings:                  map[string]*types.Recording{},
+		Shares:                      map[string]*types.Share{},
+		Commands:                    map[string]*types.Command{},
+		Courses:                     map[string]*types.Course{},
+		SessionLogs:                 map[string]*types.SessionLog{},
+		APITokens:                   map[string]*types.APIToken{},
+		LoginSessions:               map[string]*types.LoginSession{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{},
+		SessionsByUserId:            map[string][]string{},
 		ClientsBySessionId:          map[string][]string{c.SessionId: []string{c.Id}},
 		UsersByProvider:             map[string]string{},
+		SnapshotsByUserId:           map[string][]string{},
+		RecordingsBySessionId:       map[string][]string{},
+		SharesBySessionId:           map[string][]string{},
+		CommandsBySessionId:         map[string][]string{},
+		CommandsByUserId:            map[string][]string{},
+		CoursesByContext:            map[string]string{},
+		SessionLogsByUserId:         map[string][]string{},
+		APITokensByUserId:           map[string][]string{},
+		LoginSessionsByUserId:       map[string][]string{},
 	}
 
 	tmpfile, err := ioutil.TempFile("", "pwd")
@@ -503,10 +680,29 @@ func TestClientPut(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		UserVolumes:                 map[string]*types.UserVolume{},
+		Recordings:                  map[string]*types.Recording{},
+		Shares:                      map[string]*types.Share{},
+		Commands:                    map[string]*types.Command{},
+		Courses:                     map[string]*types.Course{},
+		SessionLogs:                 map[string]*types.SessionLog{},
+		APITokens:                   map[string]*types.APIToken{},
+		LoginSessions:               map[string]*types.LoginSession{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{},
+		SessionsByUserId:            map[string][]string{},
 		ClientsBySessionId:          map[string][]string{c.SessionId: []string{c.Id}},
 		UsersByProvider:             map[string]string{},
+		SnapshotsByUserId:           map[string][]string{},
+		RecordingsBySessionId:       map[string][]string{},
+		SharesBySessionId:           map[string][]string{},
+		CommandsBySessionId:         map[string][]string{},
+		CommandsByUserId:            map[string][]string{},
+		CoursesByContext:            map[string]string{},
+		SessionLogsByUserId:         map[string][]string{},
+		APITokensByUserId:           map[string][]string{},
+		LoginSessionsByUserId:       map[string][]string{},
 	}
 	var loadedDB *DB
 
@@ -567,10 +763,29 @@ func TestClientFindBySessionId(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{},
+		Snapshots:                   map[string]*types.Snapshot{},
+		UserVolumes:                 map[string]*types.UserVolume{},
+		Recordings:                  map[string]*types.Recording{},
+		Shares:                      map[string]*types.Share{},
+		Commands:                    map[string]*types.Command{},
+		Courses:                     map[string]*types.Course{},
+		SessionLogs:                 map[string]*types.SessionLog{},
+		APITokens:                   map[string]*types.APIToken{},
+		LoginSessions:               map[string]*types.LoginSession{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{},
+		SessionsByUserId:            map[string][]string{},
 		ClientsBySessionId:          map[string][]string{c1.SessionId: []string{c1.Id, c2.Id}},
 		UsersByProvider:             map[string]string{},
+		SnapshotsByUserId:           map[string][]string{},
+		RecordingsBySessionId:       map[string][]string{},
+		SharesBySessionId:           map[string][]string{},
+		CommandsBySessionId:         map[string][]string{},
+		CommandsByUserId:            map[string][]string{},
+		CoursesByContext:            map[string]string{},
+		SessionLogsByUserId:         map[string][]string{},
+		APITokensByUserId:           map[string][]string{},
+		LoginSessionsByUserId:       map[string][]string{},
 	}
 
 	tmpfile, err := ioutil.TempFile("", "pwd")
@@ -603,10 +818,29 @@ func TestPlaygroundGet(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{p.Id: p},
+		Snapshots:                   map[string]*types.Snapshot{},
+		UserVolumes:                 map[string]*types.UserVolume{},
+		Recordings:                  map[string]*types.Recording{},
+		Shares:                      map[string]*types.Share{},
+		Commands:                    map[string]*types.Command{},
+		Courses:                     map[string]*types.Course{},
+		SessionLogs:                 map[string]*types.SessionLog{},
+		APITokens:                   map[string]*types.APIToken{},
+		LoginSessions:               map[string]*types.LoginSession{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{},
+		SessionsByUserId:            map[string][]string{},
 		ClientsBySessionId:          map[string][]string{},
 		UsersByProvider:             map[string]string{},
+		SnapshotsByUserId:           map[string][]string{},
+		RecordingsBySessionId:       map[string][]string{},
+		SharesBySessionId:           map[string][]string{},
+		CommandsBySessionId:         map[string][]string{},
+		CommandsByUserId:            map[string][]string{},
+		CoursesByContext:            map[string]string{},
+		SessionLogsByUserId:         map[string][]string{},
+		APITokensByUserId:           map[string][]string{},
+		LoginSessionsByUserId:       map[string][]string{},
 	}
 
 	tmpfile, err := ioutil.TempFile("", "pwd")
@@ -654,10 +888,29 @@ func TestPlaygroundPut(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{p.Id: p},
+		Snapshots:                   map[string]*types.Snapshot{},
+		UserVolumes:                 map[string]*types.UserVolume{},
+		Recordings:                  map[string]*types.Recording{},
+		Shares:                      map[string]*types.Share{},
+		Commands:                    map[string]*types.Command{},
+		Courses:                     map[string]*types.Course{},
+		SessionLogs:                 map[string]*types.SessionLog{},
+		APITokens:                   map[string]*types.APIToken{},
+		LoginSessions:               map[string]*types.LoginSession{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{},
+		SessionsByUserId:            map[string][]string{},
 		ClientsBySessionId:          map[string][]string{},
 		UsersByProvider:             map[string]string{},
+		SnapshotsByUserId:           map[string][]string{},
+		RecordingsBySessionId:       map[string][]string{},
+		SharesBySessionId:           map[string][]string{},
+		CommandsBySessionId:         map[string][]string{},
+		CommandsByUserId:            map[string][]string{},
+		CoursesByContext:            map[string]string{},
+		SessionLogsByUserId:         map[string][]string{},
+		APITokensByUserId:           map[string][]string{},
+		LoginSessionsByUserId:       map[string][]string{},
 	}
 	var loadedDB *DB
 
@@ -685,10 +938,29 @@ func TestPlaygroundGetAll(t *testing.T) {
 		LoginRequests:               map[string]*types.LoginRequest{},
 		Users:                       map[string]*types.User{},
 		Playgrounds:                 map[string]*types.Playground{p1.Id: p1, p2.Id: p2},
+		Snapshots:                   map[string]*types.Snapshot{},
+		UserVolumes:                 map[string]*types.UserVolume{},
+		Recordings:                  map[string]*types.Recording{},
+		Shares:                      map[string]*types.Share{},
+		Commands:                    map[string]*types.Command{},
+		Courses:                     map[string]*types.Course{},
+		SessionLogs:                 map[string]*types.SessionLog{},
+		APITokens:                   map[string]*types.APIToken{},
+		LoginSessions:               map[string]*types.LoginSession{},
 		WindowsInstancesBySessionId: map[string][]string{},
 		InstancesBySessionId:        map[string][]string{},
+		SessionsByUserId:            map[string][]string{},
 		ClientsBySessionId:          map[string][]string{},
 		UsersByProvider:             map[string]string{},
+		SnapshotsByUserId:           map[string][]string{},
+		RecordingsBySessionId:       map[string][]string{},
+		SharesBySessionId:           map[string][]string{},
+		CommandsBySessionId:         map[string][]string{},
+		CommandsByUserId:            map[string][]string{},
+		CoursesByContext:            map[string]string{},
+		SessionLogsByUserId:         map[string][]string{},
+		APITokensByUserId:           map[string][]string{},
+		LoginSessionsByUserId:       map[string][]string{},
 	}
 
 	tmpfile, err := ioutil.TempFile("", "pwd")
@@ -710,3 +982,480 @@ func TestPlaygroundGetAll(t *testing.T) {
 	assert.Subset(t, []*types.Playground{p1, p2}, found)
 	assert.Len(t, found, 2)
 }
+
+func TestSnapshotPut(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "pwd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpfile.Close()
+	os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name())
+
+	storage, err := NewFileStorage(tmpfile.Name())
+
+	assert.Nil(t, err)
+
+	sn := &types.Snapshot{Id: "aaabbbccc", UserId: "user1"}
+
+	err = storage.SnapshotPut(sn)
+	assert.Nil(t, err)
+
+	found, err := storage.SnapshotGet(sn.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, sn, found)
+
+	snapshots, err := storage.SnapshotFindByUserId("user1")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Snapshot{sn}, snapshots)
+}
+
+func TestSnapshotDelete(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "pwd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpfile.Close()
+	os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name())
+
+	storage, err := NewFileStorage(tmpfile.Name())
+
+	assert.Nil(t, err)
+
+	sn := &types.Snapshot{Id: "aaabbbccc", UserId: "user1"}
+	err = storage.SnapshotPut(sn)
+	assert.Nil(t, err)
+
+	err = storage.SnapshotDelete(sn.Id)
+	assert.Nil(t, err)
+
+	_, err = storage.SnapshotGet(sn.Id)
+	assert.True(t, NotFound(err))
+
+	snapshots, err := storage.SnapshotFindByUserId("user1")
+	assert.Nil(t, err)
+	assert.Empty(t, snapshots)
+}
+
+func TestUserVolumePut(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "pwd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpfile.Close()
+	os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name())
+
+	storage, err := NewFileStorage(tmpfile.Name())
+
+	assert.Nil(t, err)
+
+	v := &types.UserVolume{Name: "pwd-user-aaabbbccc", UserId: "aaabbbccc"}
+
+	err = storage.UserVolumePut(v)
+	assert.Nil(t, err)
+
+	found, err := storage.UserVolumeGet(v.Name)
+	assert.Nil(t, err)
+	assert.Equal(t, v, found)
+
+	volumes, err := storage.UserVolumeGetAll()
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.UserVolume{v}, volumes)
+
+	err = storage.UserVolumeDelete(v.Name)
+	assert.Nil(t, err)
+
+	_, err = storage.UserVolumeGet(v.Name)
+	assert.True(t, NotFound(err))
+}
+
+func TestRecordingPut(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "pwd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpfile.Close()
+	os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name())
+
+	storage, err := NewFileStorage(tmpfile.Name())
+
+	assert.Nil(t, err)
+
+	r := &types.Recording{Id: "aaabbbccc", SessionId: "session1", InstanceName: "session1_node1"}
+
+	err = storage.RecordingPut(r)
+	assert.Nil(t, err)
+
+	found, err := storage.RecordingGet(r.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, r, found)
+
+	recordings, err := storage.RecordingFindBySessionId("session1")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Recording{r}, recordings)
+
+	err = storage.RecordingDelete(r.Id)
+	assert.Nil(t, err)
+
+	_, err = storage.RecordingGet(r.Id)
+	assert.True(t, NotFound(err))
+
+	recordings, err = storage.RecordingFindBySessionId("session1")
+	assert.Nil(t, err)
+	assert.Empty(t, recordings)
+}
+
+func TestSharePut(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "pwd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpfile.Close()
+	os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name())
+
+	storage, err := NewFileStorage(tmpfile.Name())
+
+	assert.Nil(t, err)
+
+	s := &types.Share{Token: "aaabbbccc", SessionId: "session1", Role: types.ShareRoleObserver}
+
+	err = storage.SharePut(s)
+	assert.Nil(t, err)
+
+	found, err := storage.ShareGet(s.Token)
+	assert.Nil(t, err)
+	assert.Equal(t, s, found)
+
+	shares, err := storage.ShareFindBySessionId("session1")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Share{s}, shares)
+
+	err = storage.ShareDelete(s.Token)
+	assert.Nil(t, err)
+
+	_, err = storage.ShareGet(s.Token)
+	assert.True(t, NotFound(err))
+
+	shares, err = storage.ShareFindBySessionId("session1")
+	assert.Nil(t, err)
+	assert.Empty(t, shares)
+}
+
+func TestCommandPut(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "pwd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpfile.Close()
+	os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name())
+
+	storage, err := NewFileStorage(tmpfile.Name())
+
+	assert.Nil(t, err)
+
+	c1 := &types.Command{Id: "aaabbbccc", SessionId: "session1", UserId: "user1", InstanceName: "session1_node1", Line: "ls"}
+	c2 := &types.Command{Id: "dddeeefff", SessionId: "session2", UserId: "user1", InstanceName: "session2_node1", Line: "make"}
+	c3 := &types.Command{Id: "ggghhhiii", SessionId: "session2", InstanceName: "session2_node1", Line: "pwd"}
+
+	for _, c := range []*types.Command{c1, c2, c3} {
+		err = storage.CommandPut(c)
+		assert.Nil(t, err)
+	}
+	err = storage.CommandPut(c1)
+	assert.Nil(t, err)
+
+	commands, err := storage.CommandFindBySessionId("session2")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Command{c2, c3}, commands)
+
+	commands, err = storage.CommandFindByUserId("user1")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Command{c1, c2}, commands)
+
+	commands, err = storage.CommandFindByUserId("user2")
+	assert.Nil(t, err)
+	assert.Empty(t, commands)
+
+	err = storage.CommandDelete(c1.Id)
+	assert.Nil(t, err)
+
+	commands, err = storage.CommandFindByUserId("user1")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Command{c2}, commands)
+
+	commands, err = storage.CommandFindBySessionId("session1")
+	assert.Nil(t, err)
+	assert.Empty(t, commands)
+}
+
+func TestCoursePut(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "pwd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpfile.Close()
+	os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name())
+
+	storage, err := NewFileStorage(tmpfile.Name())
+
+	assert.Nil(t, err)
+
+	c := &types.Course{Id: "aaabbbccc", PlaygroundId: "playground1", Issuer: "https://lms.example.com", ContextId: "context1", Title: "Compilers"}
+
+	err = storage.CoursePut(c)
+	assert.Nil(t, err)
+
+	found, err := storage.CourseGet(c.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, c, found)
+
+	found, err = storage.CourseFindByContext("https://lms.example.com", "context1")
+	assert.Nil(t, err)
+	assert.Equal(t, c, found)
+
+	_, err = storage.CourseFindByContext("https://other.example.com", "context1")
+	assert.True(t, NotFound(err))
+}
+
+func TestUserDelete(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "pwd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpfile.Close()
+	os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name())
+
+	storage, err := NewFileStorage(tmpfile.Name())
+
+	assert.Nil(t, err)
+
+	u := &types.User{Id: "aaabbbccc", Provider: "github", ProviderUserId: "123"}
+
+	err = storage.UserPut(u)
+	assert.Nil(t, err)
+
+	users, err := storage.UserGetAll()
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.User{u}, users)
+
+	err = storage.UserDelete(u.Id)
+	assert.Nil(t, err)
+
+	_, err = storage.UserGet(u.Id)
+	assert.True(t, NotFound(err))
+	_, err = storage.UserFindByProvider("github", "123")
+	assert.True(t, NotFound(err))
+}
+
+func TestUserPut_LinkedIdentities(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "pwd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpfile.Close()
+	os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name())
+
+	storage, err := NewFileStorage(tmpfile.Name())
+
+	assert.Nil(t, err)
+
+	u := &types.User{Id: "aaabbbccc", Provider: "github", ProviderUserId: "123"}
+	u.Identities = []types.Identity{{Provider: "google", ProviderUserId: "people/456"}}
+
+	err = storage.UserPut(u)
+	assert.Nil(t, err)
+
+	for _, identity := range u.AllIdentities() {
+		found, err := storage.UserFindByProvider(identity.Provider, identity.ProviderUserId)
+		assert.Nil(t, err)
+		assert.Equal(t, u, found)
+	}
+
+	u.Identities = nil
+	err = storage.UserPut(u)
+	assert.Nil(t, err)
+
+	_, err = storage.UserFindByProvider("google", "people/456")
+	assert.True(t, NotFound(err))
+	found, err := storage.UserFindByProvider("github", "123")
+	assert.Nil(t, err)
+	assert.Equal(t, u, found)
+}
+
+func TestSessionLogPut(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "pwd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpfile.Close()
+	os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name())
+
+	storage, err := NewFileStorage(tmpfile.Name())
+
+	assert.Nil(t, err)
+
+	l1 := &types.SessionLog{Id: "aaabbbccc", UserId: "user1", PlaygroundId: "playground1"}
+	l2 := &types.SessionLog{Id: "dddeeefff", UserId: "user1", PlaygroundId: "playground1"}
+
+	for _, l := range []*types.SessionLog{l1, l2, l1} {
+		err = storage.SessionLogPut(l)
+		assert.Nil(t, err)
+	}
+
+	found, err := storage.SessionLogGet(l1.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, l1, found)
+
+	logs, err := storage.SessionLogFindByUserId("user1")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.SessionLog{l1, l2}, logs)
+
+	err = storage.SessionLogDelete(l1.Id)
+	assert.Nil(t, err)
+
+	logs, err = storage.SessionLogFindByUserId("user1")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.SessionLog{l2}, logs)
+}
+
+func TestSessionFindByUserId(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "pwd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpfile.Close()
+	os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name())
+
+	storage, err := NewFileStorage(tmpfile.Name())
+
+	assert.Nil(t, err)
+
+	s1 := &types.Session{Id: "aaabbbccc", UserId: "user1"}
+	s2 := &types.Session{Id: "dddeeefff", UserId: "user1"}
+	s3 := &types.Session{Id: "ggghhhiii"}
+
+	for _, s := range []*types.Session{s1, s2, s3, s1} {
+		err = storage.SessionPut(s)
+		assert.Nil(t, err)
+	}
+
+	sessions, err := storage.SessionFindByUserId("user1")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Session{s1, s2}, sessions)
+
+	// Claimed sessions move to the user that claimed them
+	s3.UserId = "user2"
+	err = storage.SessionPut(s3)
+	assert.Nil(t, err)
+	s2.UserId = "user2"
+	err = storage.SessionPut(s2)
+	assert.Nil(t, err)
+
+	sessions, err = storage.SessionFindByUserId("user1")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Session{s1}, sessions)
+	sessions, err = storage.SessionFindByUserId("user2")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Session{s3, s2}, sessions)
+
+	err = storage.SessionDelete(s3.Id)
+	assert.Nil(t, err)
+
+	sessions, err = storage.SessionFindByUserId("user2")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Session{s2}, sessions)
+}
+
+func TestAPITokenPut(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "pwd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpfile.Close()
+	os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name())
+
+	storage, err := NewFileStorage(tmpfile.Name())
+
+	assert.Nil(t, err)
+
+	t1 := &types.APIToken{Id: "aaabbbccc", UserId: "user1", Name: "ci", Hash: "hash1"}
+	t2 := &types.APIToken{Id: "dddeeefff", UserId: "user1", Name: "laptop", Hash: "hash2"}
+
+	for _, token := range []*types.APIToken{t1, t2, t1} {
+		err = storage.APITokenPut(token)
+		assert.Nil(t, err)
+	}
+
+	found, err := storage.APITokenGet(t1.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, t1, found)
+
+	tokens, err := storage.APITokenFindByUserId("user1")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.APIToken{t1, t2}, tokens)
+
+	err = storage.APITokenDelete(t1.Id)
+	assert.Nil(t, err)
+
+	_, err = storage.APITokenGet(t1.Id)
+	assert.True(t, NotFound(err))
+
+	tokens, err = storage.APITokenFindByUserId("user1")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.APIToken{t2}, tokens)
+}
+
+func TestLoginSessionPut(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "pwd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpfile.Close()
+	os.Remove(tmpfile.Name())
+	defer os.Remove(tmpfile.Name())
+
+	storage, err := NewFileStorage(tmpfile.Name())
+
+	assert.Nil(t, err)
+
+	l1 := &types.LoginSession{Id: "aaabbbccc", UserId: "user1"}
+	l2 := &types.LoginSession{Id: "dddeeefff", UserId: "user1"}
+
+	for _, l := range []*types.LoginSession{l1, l2, l1} {
+		err = storage.LoginSessionPut(l)
+		assert.Nil(t, err)
+	}
+
+	found, err := storage.LoginSessionGet(l1.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, l1, found)
+
+	loginSessions, err := storage.LoginSessionFindByUserId("user1")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.LoginSession{l1, l2}, loginSessions)
+
+	all, err := storage.LoginSessionGetAll()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []*types.LoginSession{l1, l2}, all)
+
+	err = storage.LoginSessionDelete(l1.Id)
+	assert.Nil(t, err)
+
+	_, err = storage.LoginSessionGet(l1.Id)
+	assert.True(t, NotFound(err))
+
+	loginSessions, err = storage.LoginSessionFindByUserId("user1")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.LoginSession{l2}, loginSessions)
+}
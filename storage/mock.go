@@ -25,6 +25,10 @@ func (m *Mock) SessionDelete(id string) error {
 	args := m.Called(id)
 	return args.Error(0)
 }
+func (m *Mock) SessionFindByUserId(userId string) ([]*types.Session, error) {
+	args := m.Called(userId)
+	return args.Get(0).([]*types.Session), args.Error(1)
+}
 func (m *Mock) SessionCount() (int, error) {
 	args := m.Called()
 	return args.Int(0), args.Error(1)
@@ -106,6 +110,14 @@ func (m *Mock) UserGet(id string) (*types.User, error) {
 	args := m.Called(id)
 	return args.Get(0).(*types.User), args.Error(1)
 }
+func (m *Mock) UserGetAll() ([]*types.User, error) {
+	args := m.Called()
+	return args.Get(0).([]*types.User), args.Error(1)
+}
+func (m *Mock) UserDelete(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
 func (m *Mock) PlaygroundPut(playground *types.Playground) error {
 	args := m.Called(playground)
 	return args.Error(0)
@@ -118,3 +130,147 @@ func (m *Mock) PlaygroundGetAll() ([]*types.Playground, error) {
 	args := m.Called()
 	return args.Get(0).([]*types.Playground), args.Error(1)
 }
+func (m *Mock) SnapshotGet(id string) (*types.Snapshot, error) {
+	args := m.Called(id)
+	return args.Get(0).(*types.Snapshot), args.Error(1)
+}
+func (m *Mock) SnapshotPut(snapshot *types.Snapshot) error {
+	args := m.Called(snapshot)
+	return args.Error(0)
+}
+func (m *Mock) SnapshotDelete(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+func (m *Mock) SnapshotFindByUserId(userId string) ([]*types.Snapshot, error) {
+	args := m.Called(userId)
+	return args.Get(0).([]*types.Snapshot), args.Error(1)
+}
+func (m *Mock) UserVolumeGet(name string) (*types.UserVolume, error) {
+	args := m.Called(name)
+	return args.Get(0).(*types.UserVolume), args.Error(1)
+}
+func (m *Mock) UserVolumePut(volume *types.UserVolume) error {
+	args := m.Called(volume)
+	return args.Error(0)
+}
+func (m *Mock) UserVolumeDelete(name string) error {
+	args := m.Called(name)
+	return args.Error(0)
+}
+func (m *Mock) UserVolumeGetAll() ([]*types.UserVolume, error) {
+	args := m.Called()
+	return args.Get(0).([]*types.UserVolume), args.Error(1)
+}
+func (m *Mock) RecordingGet(id string) (*types.Recording, error) {
+	args := m.Called(id)
+	return args.Get(0).(*types.Recording), args.Error(1)
+}
+func (m *Mock) RecordingPut(recording *types.Recording) error {
+	args := m.Called(recording)
+	return args.Error(0)
+}
+func (m *Mock) RecordingDelete(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+func (m *Mock) RecordingFindBySessionId(sessionId string) ([]*types.Recording, error) {
+	args := m.Called(sessionId)
+	return args.Get(0).([]*types.Recording), args.Error(1)
+}
+func (m *Mock) ShareGet(token string) (*types.Share, error) {
+	args := m.Called(token)
+	return args.Get(0).(*types.Share), args.Error(1)
+}
+func (m *Mock) SharePut(share *types.Share) error {
+	args := m.Called(share)
+	return args.Error(0)
+}
+func (m *Mock) ShareDelete(token string) error {
+	args := m.Called(token)
+	return args.Error(0)
+}
+func (m *Mock) ShareFindBySessionId(sessionId string) ([]*types.Share, error) {
+	args := m.Called(sessionId)
+	return args.Get(0).([]*types.Share), args.Error(1)
+}
+func (m *Mock) CommandPut(command *types.Command) error {
+	args := m.Called(command)
+	return args.Error(0)
+}
+func (m *Mock) CommandFindBySessionId(sessionId string) ([]*types.Command, error) {
+	args := m.Called(sessionId)
+	return args.Get(0).([]*types.Command), args.Error(1)
+}
+func (m *Mock) CommandFindByUserId(userId string) ([]*types.Command, error) {
+	args := m.Called(userId)
+	return args.Get(0).([]*types.Command), args.Error(1)
+}
+func (m *Mock) CourseGet(id string) (*types.Course, error) {
+	args := m.Called(id)
+	return args.Get(0).(*types.Course), args.Error(1)
+}
+func (m *Mock) CoursePut(course *types.Course) error {
+	args := m.Called(course)
+	return args.Error(0)
+}
+func (m *Mock) CourseFindByContext(issuer, contextId string) (*types.Course, error) {
+	args := m.Called(issuer, contextId)
+	return args.Get(0).(*types.Course), args.Error(1)
+}
+func (m *Mock) CommandDelete(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+func (m *Mock) SessionLogGet(id string) (*types.SessionLog, error) {
+	args := m.Called(id)
+	return args.Get(0).(*types.SessionLog), args.Error(1)
+}
+func (m *Mock) SessionLogPut(sessionLog *types.SessionLog) error {
+	args := m.Called(sessionLog)
+	return args.Error(0)
+}
+func (m *Mock) SessionLogDelete(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+func (m *Mock) SessionLogFindByUserId(userId string) ([]*types.SessionLog, error) {
+	args := m.Called(userId)
+	return args.Get(0).([]*types.SessionLog), args.Error(1)
+}
+func (m *Mock) APITokenGet(id string) (*types.APIToken, error) {
+	args := m.Called(id)
+	return args.Get(0).(*types.APIToken), args.Error(1)
+}
+func (m *Mock) APITokenPut(token *types.APIToken) error {
+	args := m.Called(token)
+	return args.Error(0)
+}
+func (m *Mock) APITokenDelete(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+func (m *Mock) APITokenFindByUserId(userId string) ([]*types.APIToken, error) {
+	args := m.Called(userId)
+	return args.Get(0).([]*types.APIToken), args.Error(1)
+}
+func (m *Mock) LoginSessionGet(id string) (*types.LoginSession, error) {
+	args := m.Called(id)
+	return args.Get(0).(*types.LoginSession), args.Error(1)
+}
+func (m *Mock) LoginSessionGetAll() ([]*types.LoginSession, error) {
+	args := m.Called()
+	return args.Get(0).([]*types.LoginSession), args.Error(1)
+}
+func (m *Mock) LoginSessionPut(loginSession *types.LoginSession) error {
+	args := m.Called(loginSession)
+	return args.Error(0)
+}
+func (m *Mock) LoginSessionDelete(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+func (m *Mock) LoginSessionFindByUserId(userId string) ([]*types.LoginSession, error) {
+	args := m.Called(userId)
+	return args.Get(0).([]*types.LoginSession), args.Error(1)
+}
@@ -18,6 +18,7 @@ type StorageApi interface {
 	SessionPut(session *types.Session) error
 	SessionDelete(id string) error
 	SessionCount() (int, error)
+	SessionFindByUserId(userId string) ([]*types.Session, error)
 
 	InstanceGet(name string) (*types.Instance, error)
 	InstancePut(instance *types.Instance) error
@@ -42,8 +43,55 @@ type StorageApi interface {
 	UserFindByProvider(providerName, providerUserId string) (*types.User, error)
 	UserPut(user *types.User) error
 	UserGet(id string) (*types.User, error)
+	UserGetAll() ([]*types.User, error)
+	UserDelete(id string) error
 
 	PlaygroundPut(playground *types.Playground) error
 	PlaygroundGet(id string) (*types.Playground, error)
 	PlaygroundGetAll() ([]*types.Playground, error)
+
+	SnapshotGet(id string) (*types.Snapshot, error)
+	SnapshotPut(snapshot *types.Snapshot) error
+	SnapshotDelete(id string) error
+	SnapshotFindByUserId(userId string) ([]*types.Snapshot, error)
+
+	UserVolumeGet(name string) (*types.UserVolume, error)
+	UserVolumePut(volume *types.UserVolume) error
+	UserVolumeDelete(name string) error
+	UserVolumeGetAll() ([]*types.UserVolume, error)
+
+	RecordingGet(id string) (*types.Recording, error)
+	RecordingPut(recording *types.Recording) error
+	RecordingDelete(id string) error
+	RecordingFindBySessionId(sessionId string) ([]*types.Recording, error)
+
+	ShareGet(token string) (*types.Share, error)
+	SharePut(share *types.Share) error
+	ShareDelete(token string) error
+	ShareFindBySessionId(sessionId string) ([]*types.Share, error)
+
+	CommandPut(command *types.Command) error
+	CommandFindBySessionId(sessionId string) ([]*types.Command, error)
+	CommandFindByUserId(userId string) ([]*types.Command, error)
+	CommandDelete(id string) error
+
+	CourseGet(id string) (*types.Course, error)
+	CoursePut(course *types.Course) error
+	CourseFindByContext(issuer, contextId string) (*types.Course, error)
+
+	SessionLogGet(id string) (*types.SessionLog, error)
+	SessionLogPut(sessionLog *types.SessionLog) error
+	SessionLogDelete(id string) error
+	SessionLogFindByUserId(userId string) ([]*types.SessionLog, error)
+
+	APITokenGet(id string) (*types.APIToken, error)
+	APITokenPut(token *types.APIToken) error
+	APITokenDelete(id string) error
+	APITokenFindByUserId(userId string) ([]*types.APIToken, error)
+
+	LoginSessionGet(id string) (*types.LoginSession, error)
+	LoginSessionGetAll() ([]*types.LoginSession, error)
+	LoginSessionPut(loginSession *types.LoginSession) error
+	LoginSessionDelete(id string) error
+	LoginSessionFindByUserId(userId string) ([]*types.LoginSession, error)
 }
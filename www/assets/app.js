@@ -3,10 +3,20 @@
 
   var app = angular.module('DockerPlay', ['ngMaterial', 'ngFileUpload', 'ngclipboard']);
 
+  app.config(['$httpProvider', function($httpProvider) {
+    // Requests that change something send the CSRF token of the login along
+    $httpProvider.defaults.xsrfCookieName = 'csrf_token';
+    $httpProvider.defaults.xsrfHeaderName = 'X-CSRF-Token';
+  }]);
+
   // Automatically redirects user to a new session when bypassing captcha.
   // Controller keeps code/logic separate from the HTML
   app.controller("BypassController", ['$scope', '$log', '$http', '$location', '$timeout', function($scope, $log, $http, $location, $timeout) {
     setTimeout(function() {
+      var csrfToken = document.cookie.match(/(?:^|;\s*)csrf_token=([^;]*)/);
+      if (csrfToken) {
+        document.getElementById("csrf_token").value = decodeURIComponent(csrfToken[1]);
+      }
       document.getElementById("welcomeFormBypass").submit();
     }, 500);
   }]);
@@ -21,6 +31,8 @@
 
   app.controller('PlayController', ['$scope', '$rootScope', '$log', '$http', '$location', '$timeout', '$mdDialog', '$window', 'TerminalService', 'KeyboardShortcutService', 'InstanceService', 'SessionService', 'Upload', function($scope, $rootScope,  $log, $http, $location, $timeout, $mdDialog, $window, TerminalService, KeyboardShortcutService, InstanceService, SessionService, Upload) {
     $scope.sessionId = SessionService.getCurrentSessionId();
+    $scope.shareToken = SessionService.getShareToken();
+    $scope.readOnly = false;
     $rootScope.instances = [];
     $scope.idx = {};
     $scope.host = window.location.host;
@@ -97,6 +109,67 @@
       $scope.socket.emit('instance viewport resize', geometry.cols, geometry.rows);
     }
 
+    // Additional terminals of the instances, by name
+    $scope.terminals = {};
+
+    $scope.openTerminal = function(instance) {
+      $scope.socket.emit('instance terminal open', instance.name);
+    }
+
+    $scope.closeTerminal = function(tab) {
+      $scope.socket.emit('instance terminal close', tab.name);
+    }
+
+    $scope.addTerminal = function(instanceName, name) {
+      var instance = $scope.idx[instanceName];
+      if (!instance || $scope.terminals[name]) {
+        return $scope.terminals[name];
+      }
+      var tab = { name: name, instance: instance, buffer: '' };
+      instance.tabs = instance.tabs || [];
+      instance.tabs.push(tab);
+      $scope.terminals[name] = tab;
+      return tab;
+    }
+
+    $scope.removeTerminal = function(name) {
+      var tab = $scope.terminals[name];
+      if (!tab) {
+        return;
+      }
+      clearInterval(tab.terminalBufferInterval);
+      delete $scope.terminals[name];
+      delete $scope.socket.seqs[name];
+      delete $scope.socket.decoders[name];
+      tab.instance.tabs = tab.instance.tabs.filter(function(t) {
+        return t.name != name;
+      });
+      if (tab.instance.selectedTerminal == name) {
+        $scope.selectTerminal(tab.instance);
+      }
+    }
+
+    // selectTerminal shows an additional terminal of the instance, or its
+    // main terminal when tab is not given.
+    $scope.selectTerminal = function(instance, tab) {
+      if (!tab) {
+        instance.selectedTerminal = instance.name;
+        if (instance.term) {
+          instance.term.focus();
+        }
+        return;
+      }
+      instance.selectedTerminal = tab.name;
+      if (!tab.term) {
+        $timeout(function() {
+          createTabTerminal(tab);
+          tab.term.focus();
+        }, 0, false);
+        return;
+      }
+      tab.term.focus();
+    }
+
     KeyboardShortcutService.setResizeFunc($scope.resize);
 
     $scope.closeSession = function() {
@@ -105,6 +178,35 @@
       $scope.socket.emit('session close');
     }
 
+    // How terminals watched by several clients are sized: smallest, largest or owner
+    $scope.resizePolicy = 'smallest';
+
+    $scope.setResizePolicy = function(policy) {
+      $scope.socket.emit('session resize policy', policy);
+    }
+
+    $scope.shareSession = function(role) {
+      $http({
+        method: 'POST',
+        url: '/sessions/' + $scope.sessionId + '/shares',
+        data : { role: role }
+      }).then(function(response) {
+        // The token goes in the fragment, which browsers don't send to servers
+        var link = window.location.origin + '/p/' + $scope.sessionId + '#share=' + response.data.token;
+        $scope.showAlert('Share session', 'Anyone with this link can ' + (role == 'observer' ? 'watch' : 'use') + ' your terminals: ' + link);
+      });
+    }
+
+    $scope.setReadOnly = function(readOnly) {
+      $scope.readOnly = readOnly;
+      for (var i in $rootScope.instances) {
+        var instance = $rootScope.instances[i];
+        if (instance.term) {
+          instance.term.setOption('disableStdin', readOnly);
+        }
+      }
+    }
+
     $scope.upsertInstance = function(info) {
       var i = info;
       if (!$scope.idx[i.name]) {
@@ -169,6 +271,7 @@
         url: '/sessions/' + $scope.sessionId,
       }).then(function(response) {
         $scope.setSessionState(response.data.ready);
+        $scope.resizePolicy = response.data.resize_policy || 'smallest';
 
         if (response.data.created_at) {
           $scope.expiresAt = moment(response.data.expires_at);
@@ -205,8 +308,29 @@
         base += ':' + window.location.port;
     }
 
-	var socket = new ReconnectingWebSocket(base + '/sessions/' + sessionId + '/ws/', null, {reconnectInterval: 1000});
+	var wsUrl = base + '/sessions/' + sessionId + '/ws/';
+	// pwd.v2 sends terminal I/O as binary frames: kind, name length, instance name, data
+	var socket = new ReconnectingWebSocket(wsUrl, ['pwd.v2'], {reconnectInterval: 1000, binaryType: 'arraybuffer'});
 	socket.listeners = {};
+	socket.decoders = {};
+	socket.encoder = new TextEncoder();
+	// Position in the output of each terminal, so a reconnect only replays what was missed
+	socket.seqs = {};
+
+	socket.sendTerminalIn = function(name, data) {
+		if (socket.protocol != 'pwd.v2') {
+			socket.emit('instance terminal in', name, data);
+			return;
+		}
+		var nameBytes = socket.encoder.encode(name);
+		var dataBytes = socket.encoder.encode(data);
+		var frame = new Uint8Array(2 + nameBytes.length + dataBytes.length);
+		frame[0] = 2;
+		frame[1] = nameBytes.length;
+		frame.set(nameBytes, 2);
+		frame.set(dataBytes, 2 + nameBytes.length);
+		socket.send(frame.buffer);
+	}
 
 	socket.on = function(name, cb) {
 		if (!socket.listeners[name]) {
@@ -229,12 +353,17 @@
 	  for (var i in $rootScope.instances) {
 		  var instance = $rootScope.instances[i];
 		  if (instance.term) {
-			  instance.term.setOption('disableStdin', false);
+			  instance.term.setOption('disableStdin', $scope.readOnly);
 		  }
 	  }
 	});
 	socket.addEventListener('close', function (event) {
           $scope.connected = false;
+	  var resume = [];
+	  for (var name in socket.seqs) {
+		  resume.push('resume=' + encodeURIComponent(name + ':' + socket.seqs[name]));
+	  }
+	  socket.url = wsUrl + (resume.length ? (wsUrl.indexOf('?') < 0 ? '?' : '&') + resume.join('&') : '');
 	  for (var i in $rootScope.instances) {
 		  var instance = $rootScope.instances[i];
 		  if (instance.term) {
@@ -243,6 +372,25 @@
 	  }
 	});
 	socket.addEventListener('message', function (event) {
+		if (event.data instanceof ArrayBuffer) {
+			var frame = new Uint8Array(event.data);
+			if (frame.length < 2 || frame[0] != 1) {
+				return;
+			}
+			var name = new TextDecoder().decode(frame.subarray(2, 2 + frame[1]));
+			// Multibyte characters can be split across frames, so keep a streaming decoder per instance
+			if (!socket.decoders[name]) {
+				socket.decoders[name] = new TextDecoder();
+			}
+			var payload = frame.subarray(2 + frame[1]);
+			socket.seqs[name] = (socket.seqs[name] || 0) + payload.length;
+			var data = socket.decoders[name].decode(payload, {stream: true});
+			var ls = socket.listeners['instance terminal out'] || [];
+			for (var i=0; i<ls.length; i++) {
+				ls[i](name, data);
+			}
+			return;
+		}
 		var m = JSON.parse(event.data);
 		var ls = socket.listeners[m.name];
 		if (ls) {
@@ -254,13 +402,40 @@
 	});
 
 
+        socket.on('instance terminal seq', function(name, seq) {
+            socket.seqs[name] = seq;
+        });
+
         socket.on('instance terminal status', function(name, status) {
             var instance = $scope.idx[name];
             if (instance) {
                 instance.status = status;
+                return;
+            }
+            // Additional terminals come back on their own after a reconnect
+            var sep = name.indexOf('#');
+            if (status == 'connect' && sep > 0) {
+                $scope.addTerminal(name.substring(0, sep), name);
+                $scope.$apply();
+            } else if (status == 'close') {
+                $scope.removeTerminal(name);
+                $scope.$apply();
+            }
+        });
+
+        socket.on('instance terminal opened', function(instanceName, name) {
+            var tab = $scope.addTerminal(instanceName, name);
+            if (tab) {
+                $scope.$apply(function() {
+                    $scope.selectTerminal(tab.instance, tab);
+                });
             }
         });
 
+        socket.on('instance terminal error', function(instanceName, message) {
+            $scope.showAlert('Error', 'Could not open a new terminal in ' + instanceName + ': ' + message);
+        });
+
         socket.on('session ready', function(ready) {
           $scope.setSessionState(ready);
         });
@@ -270,6 +445,15 @@
         });
 
         socket.on('instance terminal out', function(name, data) {
+          var tab = $scope.terminals[name];
+          if (tab) {
+            if (!tab.term) {
+              tab.buffer += data;
+            } else {
+              tab.term.write(data);
+            }
+            return;
+          }
           var instance = $scope.idx[name];
           if (!instance) {
             return;
@@ -307,12 +491,22 @@
           $scope.$apply();
         });
 
-        socket.on('instance viewport resize', function(cols, rows) {
+        socket.on('instance viewport resize', function(cols, rows, name) {
             if (cols == 0 || rows == 0) {
                 return
             }
-          // viewport has changed, we need to resize all terminals
+          // the size of a terminal was negotiated between the clients of the session
+          var tab = $scope.terminals[name];
+          if (tab) {
+              if (tab.term) {
+                tab.term.resize(cols, rows);
+              }
+              return;
+          }
           $rootScope.instances.forEach(function(instance) {
+              if (name && instance.name != name) {
+                return;
+              }
               if (instance.term) {
                 instance.term.resize(cols, rows);
                 if (instance.buffer) {
@@ -332,6 +526,14 @@
           $scope.$apply();
         });
 
+        socket.on('instance health', function(health) {
+          if (! $scope.idx[health.instance]) {
+              return
+          }
+          $scope.idx[health.instance].status = health.status;
+          $scope.$apply();
+        });
+
         socket.on('instance docker swarm status', function(status) {
             if (!$scope.idx[status.instance]) {
                 return
@@ -380,7 +582,6 @@
 
         $scope.socket = socket;
 
-
         // If instance is passed in URL, select it
         let inst = $scope.idx[$location.hash()];
         if (inst) {
@@ -431,6 +632,9 @@
         if ($scope.idx[name]) {
             var handler = $scope.idx[name].terminalBufferInterval;
             clearInterval(handler);
+            ($scope.idx[name].tabs || []).forEach(function(tab) {
+                $scope.removeTerminal(tab.name);
+            });
         }
       if ($scope.idx[name]) {
         delete $scope.idx[name];
@@ -460,12 +664,36 @@
     $scope.openEditor = function(instance) {
       var w = window.screen.availWidth * 45  / 100;
       var h = window.screen.availHeight * 45  / 100;
-      $window.open('/sessions/' + instance.session_id + '/instances/'+instance.name+'/editor', 'editor',
+      var url = '/sessions/' + instance.session_id + '/instances/'+instance.name+'/editor';
+      $window.open(url, 'editor',
         'width='+w+',height='+h+',resizable,scrollbars=yes,status=1');
     };
 
+    // Pages opened through a share link exchange its token for a cookie that
+    // is sent to the URLs of the session, and pages reloaded later still
+    // have it. Either way the share decides what the page may do.
+    $scope.joinShare = function() {
+      var headers = {};
+      if ($scope.shareToken) {
+        headers['X-Share-Token'] = $scope.shareToken;
+      }
+      return $http({
+        method: 'GET',
+        url: '/sessions/' + $scope.sessionId + '/share',
+        headers: headers,
+      }).then(function(response) {
+        $scope.setReadOnly(response.data.role == 'observer');
+      }, function(response) {
+        if ($scope.shareToken) {
+          $scope.showAlert('Share session', 'This share link has expired or was revoked');
+        }
+      });
+    }
+
     $scope.loadPlaygroundConf();
-    $scope.getSession($scope.sessionId);
+    $scope.joinShare().finally(function() {
+      $scope.getSession($scope.sessionId);
+    });
 
     $scope.createBuilderTerminal = function() {
       var builderTerminalContainer = document.getElementById('builder-terminal');
@@ -484,7 +712,8 @@
       var terminalContainer = document.getElementById('terminal-' + instance.name);
 
       var term = new Terminal({
-        cursorBlink: false
+        cursorBlink: false,
+        disableStdin: $scope.readOnly
       });
 
       term.open(terminalContainer);
@@ -519,7 +748,7 @@
       instance.terminalBuffer = '';
       instance.terminalBufferInterval = setInterval(function() {
           if (instance.terminalBuffer.length > 0) {
-              $scope.socket.emit('instance terminal in', instance.name, instance.terminalBuffer);
+              $scope.socket.sendTerminalIn(instance.name, instance.terminalBuffer);
               instance.terminalBuffer = '';
           }
       }, 70);
@@ -534,6 +763,37 @@
       }
     }
 
+    function createTabTerminal(tab) {
+      var term = new Terminal({
+        cursorBlink: false,
+        disableStdin: $scope.readOnly
+      });
+      term.open(document.getElementById('terminal-' + tab.name));
+      tab.term = term;
+
+      // Tell the server how big this client wants the terminal, the size
+      // actually used is negotiated with the other clients of the session
+      var geometry = term.proposeGeometry();
+      if (!$scope.readOnly) {
+        $scope.socket.emit('instance terminal resize', tab.name, geometry.cols, geometry.rows);
+      }
+      if (tab.buffer) {
+        term.write(tab.buffer);
+        tab.buffer = '';
+      }
+
+      tab.terminalBuffer = '';
+      tab.terminalBufferInterval = setInterval(function() {
+          if (tab.terminalBuffer.length > 0) {
+              $scope.socket.sendTerminalIn(tab.name, tab.terminalBuffer);
+              tab.terminalBuffer = '';
+          }
+      }, 70);
+      term.on('data', function(d) {
+          tab.terminalBuffer += d;
+      });
+    }
+
     function updateNewInstanceBtnState(isInstanceBeingCreated) {
       if (isInstanceBeingCreated === true) {
         $scope.newInstanceBtnText = '+ Creating...';
@@ -697,12 +957,23 @@
     return {
       getAvailableTemplates: getAvailableTemplates,
 	  getCurrentSessionId: getCurrentSessionId,
+	  getShareToken: getShareToken,
 	  setup: setup,
     };
 
 	function getCurrentSessionId() {
 	  return window.location.pathname.replace('/p/', '');
     }
+    // Takes the token of the share link out of the URL, so it doesn't stay
+    // in the history or get copied along with the address of the page
+    function getShareToken() {
+      var match = window.location.hash.match(/[#&]share=([^&]+)/);
+      if (!match) {
+        return null;
+      }
+      window.history.replaceState(null, '', window.location.pathname + window.location.search);
+      return decodeURIComponent(match[1]);
+    }
     function getAvailableTemplates() {
       return templates;
     }